@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// alertRules are the alerts section of the config
+var alertRules []AlertRule
+
+// AlertRule alerts the notifiers when open markers match its conditions after a sync, e.g. p1 markers older than
+// 30 days. Empty conditions match every open marker.
+type AlertRule struct {
+	// Name identifies the rule in alerts and in the throttling state
+	Name string `yaml:"name"`
+	// Markers, Priorities, Repos, Labels and Owners select markers by kind, priority such as p1, repository glob,
+	// label of their registry entry and CODEOWNERS owner
+	Markers    []string `yaml:"markers"`
+	Priorities []string `yaml:"priorities"`
+	Repos      []string `yaml:"repos"`
+	Labels     []string `yaml:"labels"`
+	Owners     []string `yaml:"owners"`
+	// OlderThan selects markers older than an age, e.g. 30d, Overdue those past their due date and Zombie those
+	// referencing a closed issue
+	OlderThan string `yaml:"older_than"`
+	Overdue   bool   `yaml:"overdue"`
+	Zombie    bool   `yaml:"zombie"`
+	// Every is how long the rule stays quiet after alerting, 7d by default
+	Every string `yaml:"every"`
+	// Notify only alerts these notifiers, e.g. slack or webhook, all of them when empty
+	Notify []string `yaml:"notify"`
+}
+
+// Alert is a rule matching open markers
+type Alert struct {
+	Rule string `json:"rule"`
+	// Condition describes the rule, e.g. p1 todo markers older than 30d
+	Condition string          `json:"condition"`
+	Time      time.Time       `json:"time"`
+	Markers   []*StoredMarker `json:"markers"`
+	// labels are the labels of the repositories of the markers, which notifiers route by
+	labels map[string][]string
+}
+
+// repo is the repository of a marker of the alert, for routing
+func (a Alert) repo(m *StoredMarker) RepoDigest {
+	return RepoDigest{Repo: m.Repo, Branch: m.Branch, Labels: a.labels[m.Repo]}
+}
+
+// splitAlert splits the markers of an alert by destination, returning the destinations in order of first marker
+func splitAlert[D comparable](a Alert, destination func(repo RepoDigest, m *StoredMarker) D) ([]D, map[D]Alert) {
+	var order []D
+	parts := map[D]Alert{}
+	for _, m := range a.Markers {
+		dest := destination(a.repo(m), m)
+		part, ok := parts[dest]
+		if !ok {
+			order = append(order, dest)
+			part = Alert{Rule: a.Rule, Condition: a.Condition, Time: a.Time, labels: a.labels}
+		}
+		part.Markers = append(part.Markers, m)
+		parts[dest] = part
+	}
+	return order, parts
+}
+
+// detail describes a marker of an alert: its repository, age and due date
+func (a Alert) detail(m *StoredMarker) string {
+	detail := fmt.Sprintf("%s, %s old", ScanResult{Repo: m.Repo, Branch: m.Branch}.title(), formatAge(m.since(a.Time)))
+	if m.Due != "" {
+		detail += ", due " + m.Due
+	}
+	return detail
+}
+
+// summary is the headline of an alert, e.g. stale-p1: 3 p1 markers older than 30d
+func (a Alert) summary() string {
+	return fmt.Sprintf("%s: %d %s", a.Rule, len(a.Markers), a.Condition)
+}
+
+// condition describes the markers a rule selects
+func (r AlertRule) condition() string {
+	var words []string
+	words = append(words, r.Priorities...)
+	words = append(words, r.Markers...)
+	words = append(words, "markers")
+	if len(r.Repos) > 0 {
+		words = append(words, "of", strings.Join(r.Repos, ", "))
+	}
+	if len(r.Labels) > 0 {
+		words = append(words, "labeled", strings.Join(r.Labels, ", "))
+	}
+	if len(r.Owners) > 0 {
+		words = append(words, "owned by", strings.Join(r.Owners, ", "))
+	}
+	var conditions []string
+	if r.OlderThan != "" {
+		conditions = append(conditions, "older than "+r.OlderThan)
+	}
+	if r.Overdue {
+		conditions = append(conditions, "overdue")
+	}
+	if r.Zombie {
+		conditions = append(conditions, "referencing a closed issue")
+	}
+	if len(conditions) > 0 {
+		words = append(words, strings.Join(conditions, " and "))
+	}
+	return strings.Join(words, " ")
+}
+
+// match returns the open markers of the store matching the rule, of the repositories of labels, oldest first
+func (r AlertRule) match(s *Store, labels map[string][]string, now time.Time) ([]*StoredMarker, error) {
+	var minAge time.Duration
+	if r.OlderThan != "" {
+		var err error
+		if minAge, err = parseAge(r.OlderThan); err != nil {
+			return nil, err
+		}
+	}
+
+	var found []*StoredMarker
+	for _, m := range s.Markers {
+		repoLabels, registered := labels[m.Repo]
+		if m.State != markerOpen || !registered {
+			continue
+		}
+		if len(r.Markers) > 0 && !containsFold(r.Markers, m.Marker) {
+			continue
+		}
+		if len(r.Priorities) > 0 && !containsFold(r.Priorities, m.Priority) {
+			continue
+		}
+		if len(r.Repos) > 0 && !matchRepos(r.Repos, m.Repo) {
+			continue
+		}
+		if len(r.Labels) > 0 && !routed(r.Labels, nil, RepoDigest{Labels: repoLabels}, m) {
+			continue
+		}
+		if len(r.Owners) > 0 && !routed(nil, r.Owners, RepoDigest{}, m) {
+			continue
+		}
+		if r.OlderThan != "" && m.since(now) < minAge {
+			continue
+		}
+		if _, overdue := m.overdue(now); r.Overdue && !overdue {
+			continue
+		}
+		if r.Zombie && len(m.closedReferences()) == 0 {
+			continue
+		}
+		found = append(found, m)
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].since(now) > found[j].since(now) })
+	return found, nil
+}
+
+// alertStatePath is the file holding when each rule last alerted
+func alertStatePath() string {
+	return strings.TrimSuffix(registryFilePath, ".registry") + ".alerts.json"
+}
+
+// loadAlertState reads when each rule last alerted, by rule name
+func loadAlertState(path string) (map[string]time.Time, error) {
+	state := map[string]time.Time{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alert state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse alert state: %w", err)
+	}
+	return state, nil
+}
+
+// alerted reports whether a notifier is among the names of a rule, webhook naming every webhook
+func alerted(names []string, n notifier) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for _, name := range names {
+		if strings.EqualFold(name, n.name()) || strings.HasPrefix(n.name(), strings.ToLower(name)+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// sendAlerts evaluates the alert rules against the open markers of the enabled registry entries and alerts the
+// notifiers of each rule matching markers, unless it alerted within its every period. Failures are logged.
+func sendAlerts(s *Store, records []RegistryRecord, now time.Time) {
+	if len(alertRules) == 0 {
+		return
+	}
+	all := notifiers()
+	if len(all) == 0 {
+		log.Warn().Msg("No notifier configured, alerts are not sent")
+		return
+	}
+
+	// rules match the open markers of every repository, not only those of the records synced
+	if err := s.load("state = ?", markerOpen); err != nil {
+		log.Err(err).Msg("Failed to load marker store")
+		return
+	}
+
+	statePath := alertStatePath()
+	state, err := loadAlertState(statePath)
+	if err != nil {
+		log.Err(err).Msg("Failed to load alert state")
+		return
+	}
+
+	labels := map[string][]string{}
+	for _, record := range records {
+		if !record.Disabled {
+			repo := canonicalURI(record.URI)
+			labels[repo] = append(labels[repo], record.Labels...)
+		}
+	}
+
+	changed := false
+	for _, rule := range alertRules {
+		logger := log.With().Str("rule", rule.Name).Logger()
+		if rule.Name == "" {
+			log.Warn().Msg("Skipping alert rule without a name")
+			continue
+		}
+		every := 7 * 24 * time.Hour
+		if rule.Every != "" {
+			if every, err = parseAge(rule.Every); err != nil {
+				logger.Warn().Err(err).Msg("Skipping alert rule")
+				continue
+			}
+		}
+		if last, ok := state[rule.Name]; ok && now.Sub(last) < every {
+			continue
+		}
+
+		markers, err := rule.match(s, labels, now)
+		if err != nil {
+			logger.Warn().Err(err).Msg("Skipping alert rule")
+			continue
+		}
+		if len(markers) == 0 {
+			continue
+		}
+
+		alert := Alert{Rule: rule.Name, Condition: rule.condition(), Time: now, Markers: markers, labels: labels}
+		sent := false
+		for _, n := range all {
+			if !alerted(rule.Notify, n) {
+				continue
+			}
+			if err := n.alert(alert); err != nil {
+				logger.Err(err).Str("notifier", n.name()).Msg("Failed to send alert")
+				continue
+			}
+			sent = true
+		}
+		// retried at the next sync when no notifier got it
+		if sent {
+			logger.Info().Int("markers", len(markers)).Msg("Sent alert")
+			state[rule.Name] = now
+			changed = true
+		}
+	}
+
+	if !changed {
+		return
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		log.Err(err).Msg("Failed to encode alert state")
+		return
+	}
+	if err := writeFileAtomic(statePath, append(data, '\n'), 0644); err != nil {
+		log.Err(err).Msg("Failed to save alert state")
+	}
+}
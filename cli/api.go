@@ -0,0 +1,674 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// apiAddr is the address tr4ck serve listens on
+var apiAddr string
+
+const (
+	// maxAPIBody is the largest request body the API reads
+	maxAPIBody = 1 << 20
+	// apiQueueSize is the number of jobs waiting for the worker before new ones are refused
+	apiQueueSize = 20
+	// apiJobsKept is the number of jobs kept with their results, the oldest finished ones are dropped first
+	apiJobsKept = 100
+)
+
+// APIJob is a scan or sync triggered through the API. Jobs run one at a time in the background, since scans share
+// global settings.
+type APIJob struct {
+	ID string `json:"id"`
+	// Kind is scan or sync
+	Kind string `json:"kind"`
+	// URI is the scanned repository, or with Branch the synced registry entries, all of them when empty
+	URI    string `json:"uri,omitempty"`
+	Branch string `json:"branch,omitempty"`
+	// State is queued, running, done or failed
+	State    string     `json:"state"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	// Result holds the findings of a scan, and Repos the outcome of each repository of a sync
+	Result *ScanResult   `json:"result,omitempty"`
+	Repos  []APIRepoSync `json:"repos,omitempty"`
+}
+
+// APIRepoSync is the outcome of syncing a registry entry
+type APIRepoSync struct {
+	Repo       string `json:"repo"`
+	Branch     string `json:"branch,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// apiRecord is the body adding a registry entry, see addToRegistry
+type apiRecord struct {
+	URI string `json:"uri"`
+	// Branches are tracked each with its own record, globs are expanded, the default branch when empty
+	Branches []string `json:"branches"`
+	Markers  []string `json:"markers"`
+	Labels   []string `json:"labels"`
+	Include  []string `json:"include"`
+	Exclude  []string `json:"exclude"`
+	Note     string   `json:"note"`
+	Schedule string   `json:"schedule"`
+}
+
+// apiRecordPatch is the body updating registry entries, absent fields are left unchanged
+type apiRecordPatch struct {
+	Markers  *[]string `json:"markers"`
+	Labels   *[]string `json:"labels"`
+	Include  *[]string `json:"include"`
+	Exclude  *[]string `json:"exclude"`
+	Note     *string   `json:"note"`
+	Disabled *bool     `json:"disabled"`
+	Schedule *string   `json:"schedule"`
+}
+
+// apiServer serves the REST API of tr4ck serve
+type apiServer struct {
+	queue chan *APIJob
+	// auth checks the tokens of requests, any request being accepted when nil
+	auth *authenticator
+	// readOnly refuses the requests requiring admin, when serving without authentication beyond localhost
+	readOnly bool
+
+	// jobs are the queued, running and latest finished jobs, oldest first
+	mu   sync.Mutex
+	jobs []*APIJob
+	// subscribers are the event streams of the clients following a job, by job ID, see jobEvents
+	subscribers map[string][]chan apiEvent
+}
+
+// handle registers the API endpoints
+func (a *apiServer) handle(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/registry", a.require(scopeRead, a.listRecords))
+	mux.HandleFunc("POST /api/v1/registry", a.require(scopeAdmin, a.addRecord))
+	mux.HandleFunc("PATCH /api/v1/registry", a.require(scopeAdmin, a.patchRecords))
+	mux.HandleFunc("DELETE /api/v1/registry", a.require(scopeAdmin, a.deleteRecords))
+	mux.HandleFunc("POST /api/v1/scans", a.require(scopeAdmin, a.startScan))
+	mux.HandleFunc("POST /api/v1/syncs", a.require(scopeAdmin, a.startSync))
+	mux.HandleFunc("GET /api/v1/jobs", a.require(scopeRead, a.listJobs))
+	mux.HandleFunc("GET /api/v1/jobs/{id}", a.require(scopeRead, a.getJob))
+	mux.HandleFunc("GET /api/v1/jobs/{id}/events", a.require(scopeRead, a.jobEvents))
+	mux.HandleFunc("GET /api/v1/markers", a.require(scopeRead, a.listMarkers))
+	mux.HandleFunc("GET /api/v1/markers/{id}", a.require(scopeRead, a.getMarker))
+}
+
+// require wraps an endpoint, replying with an error unless the request has a token of the scope
+func (a *apiServer) require(scope string, h http.HandlerFunc) http.HandlerFunc {
+	if a.readOnly && scope == scopeAdmin {
+		return func(w http.ResponseWriter, r *http.Request) {
+			apiError(w, http.StatusForbidden, errReadOnlyServer)
+		}
+	}
+	if a.auth == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := a.auth.authorize(requestToken(r), scope); err != nil {
+			apiError(w, authStatus(w, err), err)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// runServe serves the API on apiAddr, and the gRPC API on grpcAddr if set, until interrupted
+func runServe() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// syncs report with the output options
+	if _, err := configureReporter(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid output options")
+	}
+
+	auth, err := newAuthenticator(authConfig)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid auth config")
+	}
+	// anyone reaching the address could change the registry and trigger scans and syncs otherwise
+	readOnly := auth == nil && !isLoopback(apiAddr)
+	if readOnly {
+		log.Warn().Str("addr", apiAddr).Msg("Serving without authentication beyond localhost, the API can not change the registry nor trigger scans and syncs; see the auth config")
+	} else if auth == nil {
+		log.Warn().Msg("Serving without authentication, see the auth config")
+	}
+
+	a := &apiServer{queue: make(chan *APIJob, apiQueueSize), auth: auth, readOnly: readOnly}
+	mux := http.NewServeMux()
+	a.handle(mux)
+	go a.run(ctx)
+
+	if grpcAddr != "" {
+		grpcReadOnly := auth == nil && !isLoopback(grpcAddr)
+		if grpcReadOnly {
+			log.Warn().Str("addr", grpcAddr).Msg("Serving the gRPC API without authentication beyond localhost, it can not trigger scans and syncs; see the auth config")
+		}
+		defer serveGRPC(auth, grpcReadOnly)()
+	}
+
+	server := &http.Server{Addr: apiAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		log.Info().Msg("Stopping")
+		server.Close()
+	}()
+
+	log.Info().Str("addr", apiAddr).Msg("Serving the API")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal().Err(err).Str("addr", apiAddr).Msg("Failed to serve")
+	}
+}
+
+// writeJSON replies with a JSON document
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	PrintStruct(w, v)
+}
+
+// apiError replies with a JSON error
+func apiError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// registryError replies with the error of a registry change, missing and existing entries being client errors
+func registryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errRecordNotFound):
+		apiError(w, http.StatusNotFound, err)
+	case errors.Is(err, errRecordExists):
+		apiError(w, http.StatusConflict, err)
+	case errors.Is(err, errRegistryReadOnly):
+		apiError(w, http.StatusForbidden, err)
+	default:
+		log.Err(err).Msg("Failed to update registry")
+		apiError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// readJSON decodes the JSON body of a request, replying with an error when it is invalid
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxAPIBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		apiError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+// queryBool reads a boolean query parameter, false when absent
+func queryBool(r *http.Request, key string) (bool, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %s, expected true or false", key, value)
+	}
+	return b, nil
+}
+
+// queryList reads a query parameter given several times or as a comma-separated list
+func queryList(r *http.Request, key string) []string {
+	var values []string
+	for _, value := range r.URL.Query()[key] {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// registryRecords returns the registry records of a URI, tracking a branch unless empty
+func registryRecords(uri, branch string) ([]RegistryRecord, error) {
+	records, err := loadRegistry()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registry: %w", err)
+	}
+	found := []RegistryRecord{}
+	for _, record := range *records {
+		if sameURI(record.URI, uri) && (branch == "" || record.Branch == branch) {
+			found = append(found, record)
+		}
+	}
+	return found, nil
+}
+
+// matchRecords returns the registry records of a URI or matching a glob, all of them when empty, with a label
+// unless empty
+func matchRecords(uri, label string) ([]RegistryRecord, error) {
+	records, err := loadRegistry()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registry: %w", err)
+	}
+
+	found := []RegistryRecord{}
+	for _, record := range *records {
+		if uri != "" && !sameURI(record.URI, uri) && !globMatch(uri, record.URI) {
+			continue
+		}
+		if label != "" && !slices.Contains(record.Labels, label) {
+			continue
+		}
+		found = append(found, record)
+	}
+	return found, nil
+}
+
+// listRecords lists the registry entries, filtered by the uri, a URI or glob, and label query parameters
+func (a *apiServer) listRecords(w http.ResponseWriter, r *http.Request) {
+	records, err := matchRecords(r.URL.Query().Get("uri"), r.URL.Query().Get("label"))
+	if err != nil {
+		log.Err(err).Msg("Failed to load registry")
+		apiError(w, http.StatusInternalServerError, errors.New("failed to load registry"))
+		return
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// addRecord adds a repository to the registry and replies with its records
+func (a *apiServer) addRecord(w http.ResponseWriter, r *http.Request) {
+	var body apiRecord
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.URI == "" {
+		apiError(w, http.StatusBadRequest, errors.New("uri is required"))
+		return
+	}
+
+	scanMu.Lock()
+	err := addToRegistry(RegistryRecord{URI: body.URI, Markers: body.Markers, Labels: body.Labels, Include: body.Include, Exclude: body.Exclude, Note: body.Note, Schedule: body.Schedule}, body.Branches...)
+	scanMu.Unlock()
+	if errors.Is(err, errRecordExists) || errors.Is(err, errRegistryReadOnly) {
+		registryError(w, err)
+		return
+	}
+	if err != nil {
+		apiError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	records, err := registryRecords(body.URI, "")
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Info().Str("uri", body.URI).Msg("Added to the registry")
+	writeJSON(w, http.StatusCreated, records)
+}
+
+// patchRecords updates the registry entries of the uri query parameter, only that of the branch query parameter if
+// given, and replies with them
+func (a *apiServer) patchRecords(w http.ResponseWriter, r *http.Request) {
+	uri, branch := r.URL.Query().Get("uri"), r.URL.Query().Get("branch")
+	if uri == "" {
+		apiError(w, http.StatusBadRequest, errors.New("the uri query parameter is required"))
+		return
+	}
+	var patch apiRecordPatch
+	if !readJSON(w, r, &patch) {
+		return
+	}
+	if patch.Schedule != nil && *patch.Schedule != "" {
+		if _, err := parseSchedule(*patch.Schedule); err != nil {
+			apiError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	scanMu.Lock()
+	err := modifyBranch(uri, branch, func(record *RegistryRecord) {
+		if patch.Markers != nil {
+			record.Markers = *patch.Markers
+		}
+		if patch.Labels != nil {
+			record.Labels = *patch.Labels
+		}
+		if patch.Include != nil {
+			record.Include = *patch.Include
+		}
+		if patch.Exclude != nil {
+			record.Exclude = *patch.Exclude
+		}
+		if patch.Note != nil {
+			record.Note = *patch.Note
+		}
+		if patch.Disabled != nil {
+			record.Disabled = *patch.Disabled
+		}
+		if patch.Schedule != nil {
+			record.Schedule = *patch.Schedule
+		}
+	})
+	scanMu.Unlock()
+	if err != nil {
+		registryError(w, err)
+		return
+	}
+
+	records, err := registryRecords(uri, branch)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// deleteRecords removes the registry entries of the uri query parameter, only that of the branch query parameter if
+// given. The stored markers of the repository are kept.
+func (a *apiServer) deleteRecords(w http.ResponseWriter, r *http.Request) {
+	uri, branch := r.URL.Query().Get("uri"), r.URL.Query().Get("branch")
+	if uri == "" {
+		apiError(w, http.StatusBadRequest, errors.New("the uri query parameter is required"))
+		return
+	}
+
+	scanMu.Lock()
+	err := removeFromRegistry(uri, branch)
+	scanMu.Unlock()
+	if err != nil {
+		registryError(w, err)
+		return
+	}
+	log.Info().Str("uri", uri).Str("branch", branch).Msg("Removed from the registry")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startScan queues a scan of the latest commit of a repository, recorded in the marker store like tr4ck scan.
+// Local directories may only be scanned when registered.
+func (a *apiServer) startScan(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URI string `json:"uri"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.URI == "" {
+		apiError(w, http.StatusBadRequest, errors.New("uri is required"))
+		return
+	}
+	unregistered, err := unregisteredDir(body.URI)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if unregistered {
+		apiError(w, http.StatusForbidden, fmt.Errorf("directory %s is not registered", body.URI))
+		return
+	}
+
+	a.enqueue(w, &APIJob{Kind: "scan", URI: body.URI})
+}
+
+// unregisteredDir reports whether uri is a local directory that is not registered, which the APIs do not scan
+func unregisteredDir(uri string) (bool, error) {
+	if !filepath.IsAbs(canonicalURI(uri)) {
+		return false, nil
+	}
+	records, err := registryRecords(uri, "")
+	return len(records) == 0, err
+}
+
+// startSync queues a sync of the registry, or of the entries of a URI, only that of a branch if given
+func (a *apiServer) startSync(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URI    string `json:"uri"`
+		Branch string `json:"branch"`
+	}
+	if r.ContentLength != 0 && !readJSON(w, r, &body) {
+		return
+	}
+	if body.Branch != "" && body.URI == "" {
+		apiError(w, http.StatusBadRequest, errors.New("branch requires uri"))
+		return
+	}
+	if body.URI != "" {
+		records, err := registryRecords(body.URI, body.Branch)
+		if err != nil {
+			apiError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if len(records) == 0 {
+			apiError(w, http.StatusNotFound, fmt.Errorf("URI %s %w", describeRecord(RegistryRecord{URI: body.URI, Branch: body.Branch}), errRecordNotFound))
+			return
+		}
+	}
+
+	a.enqueue(w, &APIJob{Kind: "sync", URI: body.URI, Branch: body.Branch})
+}
+
+// enqueue queues a job and replies with it, or refuses it when the queue is full
+func (a *apiServer) enqueue(w http.ResponseWriter, job *APIJob) {
+	id := make([]byte, 8)
+	rand.Read(id)
+	job.ID = hex.EncodeToString(id)
+	job.State = "queued"
+	job.Created = time.Now().UTC()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case a.queue <- job:
+	default:
+		apiError(w, http.StatusServiceUnavailable, errors.New("too many jobs queued"))
+		return
+	}
+	a.jobs = append(a.jobs, job)
+	if len(a.jobs) > apiJobsKept {
+		if i := slices.IndexFunc(a.jobs, func(j *APIJob) bool { return j.Finished != nil }); i >= 0 {
+			a.jobs = slices.Delete(a.jobs, i, i+1)
+		}
+	}
+
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, *job)
+}
+
+// run runs the queued jobs until ctx is done
+func (a *apiServer) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-a.queue:
+			started := time.Now().UTC()
+			a.mu.Lock()
+			job.State, job.Started = "running", &started
+			a.publish(job, "job", *job)
+			a.mu.Unlock()
+
+			var err error
+			if job.Kind == "scan" {
+				err = a.runScan(job)
+			} else {
+				err = a.runSync(job)
+			}
+
+			finished := time.Now().UTC()
+			a.mu.Lock()
+			job.State, job.Finished = "done", &finished
+			if err != nil {
+				job.State, job.Error = "failed", err.Error()
+			}
+			a.finish(job)
+			a.mu.Unlock()
+			log.Info().Str("job", job.ID).Str("kind", job.Kind).Str("uri", job.URI).Str("state", job.State).Msg("Finished job")
+		}
+	}
+}
+
+// runScan runs a scan job
+func (a *apiServer) runScan(job *APIJob) error {
+	scanMu.Lock()
+	defer scanMu.Unlock()
+	resetSkipped()
+
+	onScanned, _ = a.jobHooks(job)
+	defer func() { onScanned = nil }()
+
+	start := time.Now()
+	result, err := scanFindings(job.URI)
+	if err != nil {
+		return err
+	}
+	result.Findings = storeFindings(result)
+	findings, err := filterBaseline(result.Findings)
+	if err != nil {
+		return fmt.Errorf("failed to apply baseline: %w", err)
+	}
+	result.Findings = findings
+
+	a.mu.Lock()
+	job.Result = &result
+	outcome := APIRepoSync{Repo: result.Repo, Branch: result.Branch, DurationMs: time.Since(start).Milliseconds()}
+	a.publish(job, "repo", APIRepoEvent{APIRepoSync: outcome, Result: &result})
+	a.mu.Unlock()
+	return nil
+}
+
+// runSync runs a sync job
+func (a *apiServer) runSync(job *APIJob) error {
+	var only func(RegistryRecord) bool
+	if job.URI != "" {
+		only = func(record RegistryRecord) bool {
+			return sameURI(record.URI, job.URI) && (job.Branch == "" || record.Branch == job.Branch)
+		}
+	}
+
+	scanMu.Lock()
+	defer scanMu.Unlock()
+
+	// the registry remote is only fetched once per command otherwise; the lock keeps it from replacing the local
+	// registry while another sync updates its cursors
+	preRunRemoteRegistry()
+
+	// the outcome of each repository is added to the job as it is synced
+	onScanned, onSynced = a.jobHooks(job)
+	defer func() { onScanned, onSynced = nil, nil }()
+
+	_, err := syncLocked(only)
+	return err
+}
+
+// listJobs lists the jobs, latest first
+func (a *apiServer) listJobs(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	jobs := make([]APIJob, 0, len(a.jobs))
+	for i := len(a.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, *a.jobs[i])
+	}
+	a.mu.Unlock()
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// getJob replies with a job and its results
+func (a *apiServer) getJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	a.mu.Lock()
+	i := slices.IndexFunc(a.jobs, func(j *APIJob) bool { return j.ID == id })
+	var job APIJob
+	if i >= 0 {
+		job = *a.jobs[i]
+	}
+	a.mu.Unlock()
+
+	if i < 0 {
+		apiError(w, http.StatusNotFound, fmt.Errorf("job %s not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// listMarkers lists the stored markers matching the query parameters, see MarkerQuery
+func (a *apiServer) listMarkers(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := MarkerQuery{
+		Repo:      params.Get("repo"),
+		Markers:   queryList(r, "marker"),
+		Author:    params.Get("author"),
+		State:     params.Get("state"),
+		OlderThan: params.Get("older_than"),
+		Paths:     queryList(r, "path"),
+		At:        params.Get("at"),
+	}
+	if q.State == "" {
+		q.State = markerOpen
+	}
+	var err error
+	if q.Overdue, err = queryBool(r, "overdue"); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	if q.Zombie, err = queryBool(r, "zombie"); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		log.Err(err).Msg("Failed to load marker store")
+		apiError(w, http.StatusInternalServerError, errors.New("failed to load marker store"))
+		return
+	}
+	markers, err := store.query(q, time.Now())
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	if markers == nil {
+		markers = []*StoredMarker{}
+	}
+	writeJSON(w, http.StatusOK, markers)
+}
+
+// getMarker replies with the stored markers of an ID or ID prefix, one per branch unless the branch query
+// parameter is given, including resolved ones
+func (a *apiServer) getMarker(w http.ResponseWriter, r *http.Request) {
+	store, err := openStore(storeFilePath())
+	if err != nil {
+		log.Err(err).Msg("Failed to load marker store")
+		apiError(w, http.StatusInternalServerError, errors.New("failed to load marker store"))
+		return
+	}
+
+	id := r.PathValue("id")
+	markers, err := store.lookup([]string{id}, r.URL.Query().Get("branch"), true)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(markers) == 0 {
+		apiError(w, http.StatusNotFound, fmt.Errorf("marker %s not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, markers)
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/rs/zerolog/log"
+)
+
+// authConfig is the auth section of the config, nil when tr4ck serve and the daemon accept any request
+var authConfig *AuthConfig
+
+const (
+	// scopeRead allows reading the registry, jobs, markers, metrics, feeds and the web UI
+	scopeRead = "read"
+	// scopeAdmin also allows changing the registry and triggering scans and syncs
+	scopeAdmin = "admin"
+	// oidcLeeway is the clock drift tolerated when checking the validity of tokens
+	oidcLeeway = time.Minute
+	// jwksRefresh is the least time between fetches of the keys of the issuer, which are fetched again when a
+	// token is signed by an unknown key
+	jwksRefresh = time.Minute
+)
+
+var (
+	// errUnauthenticated is returned for requests without a valid token
+	errUnauthenticated = errors.New("missing or invalid token")
+	// errForbidden is returned for tokens without the scope required
+	errForbidden = errors.New("token does not have the scope required")
+	// errReadOnlyServer is returned for the requests requiring admin when serving without authentication beyond
+	// localhost
+	errReadOnlyServer = errors.New("serving without authentication beyond localhost, see the auth config")
+)
+
+// AuthConfig requires a token on the requests to tr4ck serve and the daemon: one of the static Tokens, or an
+// OpenID Connect ID or access token of an issuer
+type AuthConfig struct {
+	Tokens []TokenConfig `yaml:"tokens"`
+	OIDC   *OIDCConfig   `yaml:"oidc"`
+}
+
+// TokenConfig is a static bearer token
+type TokenConfig struct {
+	// Name identifies the token in logs
+	Name string `yaml:"name"`
+	// Token is read from the TokenEnv environment variable when empty
+	Token    string `yaml:"token"`
+	TokenEnv string `yaml:"token_env"`
+	// Scope is read or admin
+	Scope string `yaml:"scope"`
+}
+
+// OIDCConfig accepts the JWTs of an OpenID Connect issuer, their scope given by a claim
+type OIDCConfig struct {
+	Issuer string `yaml:"issuer"`
+	// Audience must be one of the audiences of the tokens
+	Audience string `yaml:"audience"`
+	// ScopeClaim is the claim holding the roles of the caller, a space-separated string or a list, scope by default
+	ScopeClaim string `yaml:"scope_claim"`
+	// Admin and Read are the values of the claim granting each scope. Any valid token is granted read when Read is
+	// empty.
+	Admin []string `yaml:"admin"`
+	Read  []string `yaml:"read"`
+}
+
+// authenticator checks the tokens of requests. A nil authenticator accepts any request.
+type authenticator struct {
+	tokens []staticToken
+	oidc   *oidcVerifier
+}
+
+// staticToken is a configured token, by hash so that comparisons take the same time whatever the token
+type staticToken struct {
+	name  string
+	hash  [sha256.Size]byte
+	scope string
+}
+
+// newAuthenticator checks the auth config, nil when there is none, and fetches the keys of the OIDC issuer
+func newAuthenticator(c *AuthConfig) (*authenticator, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	a := &authenticator{}
+	for i, t := range c.Tokens {
+		token := t.Token
+		if token == "" && t.TokenEnv != "" {
+			token = os.Getenv(t.TokenEnv)
+		}
+		name := t.Name
+		if name == "" {
+			name = fmt.Sprintf("token %d", i+1)
+		}
+		if token == "" {
+			return nil, fmt.Errorf("auth %s has no token, set token or token_env", name)
+		}
+		if t.Scope != scopeRead && t.Scope != scopeAdmin {
+			return nil, fmt.Errorf("auth %s has an invalid scope %q, expected read or admin", name, t.Scope)
+		}
+		a.tokens = append(a.tokens, staticToken{name: name, hash: sha256.Sum256([]byte(token)), scope: t.Scope})
+	}
+
+	if c.OIDC != nil {
+		v, err := newOIDCVerifier(*c.OIDC)
+		if err != nil {
+			return nil, err
+		}
+		a.oidc = v
+	}
+
+	if len(a.tokens) == 0 && a.oidc == nil {
+		return nil, fmt.Errorf("auth requires tokens or oidc")
+	}
+	return a, nil
+}
+
+// authenticate returns the name and scope of a token
+func (a *authenticator) authenticate(token string) (string, string, error) {
+	if token == "" {
+		return "", "", errUnauthenticated
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(hash[:], t.hash[:]) == 1 {
+			return t.name, t.scope, nil
+		}
+	}
+
+	// static tokens are not JWTs
+	if a.oidc != nil && strings.Count(token, ".") == 2 {
+		name, scope, err := a.oidc.verify(token, time.Now())
+		if err != nil {
+			log.Debug().Err(err).Msg("Rejected token")
+			return "", "", errUnauthenticated
+		}
+		return name, scope, nil
+	}
+	return "", "", errUnauthenticated
+}
+
+// authorize checks that a token has a scope, admin including read, returning errUnauthenticated or errForbidden
+func (a *authenticator) authorize(token, scope string) error {
+	if a == nil {
+		return nil
+	}
+	name, granted, err := a.authenticate(token)
+	if err != nil {
+		return err
+	}
+	if scope == scopeAdmin && granted != scopeAdmin {
+		log.Debug().Str("token", name).Str("scope", granted).Msg("Forbidden")
+		return errForbidden
+	}
+	return nil
+}
+
+// requestToken returns the bearer token of a request, or the password of its basic credentials, which browsers,
+// feed readers and calendars can send
+func requestToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return ""
+}
+
+// authStatus returns the status of a failed authorization, challenging for credentials
+func authStatus(w http.ResponseWriter, err error) int {
+	if errors.Is(err, errForbidden) {
+		return http.StatusForbidden
+	}
+	w.Header().Add("WWW-Authenticate", `Bearer realm="tr4ck"`)
+	w.Header().Add("WWW-Authenticate", `Basic realm="tr4ck"`)
+	return http.StatusUnauthorized
+}
+
+// require wraps a handler of the daemon, replying a plain text error unless the request has a token of the scope
+func (a *authenticator) require(scope string, h http.Handler) http.Handler {
+	if a == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := a.authorize(requestToken(r), scope); err != nil {
+			http.Error(w, err.Error(), authStatus(w, err))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// oidcAlgorithms are the signature algorithms of the tokens accepted
+var oidcAlgorithms = []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512, jose.ES256, jose.ES384, jose.ES512}
+
+// curveAlgorithms are the algorithms of the EC keys by curve, which go-jose does not check when verifying
+var curveAlgorithms = map[string]string{"P-256": string(jose.ES256), "P-384": string(jose.ES384), "P-521": string(jose.ES512)}
+
+// oidcVerifier verifies the signature, issuer, audience and validity of the JWTs of an OpenID Connect issuer
+type oidcVerifier struct {
+	c       OIDCConfig
+	jwksURI string
+
+	// keys are the public keys of the issuer by key ID, fetched at most every jwksRefresh; refresh is closed when
+	// the fetch in progress completes
+	mu      sync.Mutex
+	keys    map[string]jose.JSONWebKey
+	fetched time.Time
+	refresh chan struct{}
+}
+
+// newOIDCVerifier discovers the keys of the issuer and fetches them
+func newOIDCVerifier(c OIDCConfig) (*oidcVerifier, error) {
+	if c.Issuer == "" || c.Audience == "" {
+		return nil, fmt.Errorf("auth oidc requires an issuer and an audience")
+	}
+	if c.ScopeClaim == "" {
+		c.ScopeClaim = "scope"
+	}
+
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	url := strings.TrimRight(c.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(url, &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC issuer %s: %w", c.Issuer, err)
+	}
+	if discovery.Issuer != c.Issuer || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("invalid OIDC discovery document of %s, issued by %q", c.Issuer, discovery.Issuer)
+	}
+
+	v := &oidcVerifier{c: c, jwksURI: discovery.JWKSURI}
+	keys, err := v.fetchKeys()
+	if err != nil {
+		return nil, err
+	}
+	v.keys, v.fetched = keys, time.Now()
+	return v, nil
+}
+
+// getJSON decodes the json body of a GET request
+func getJSON(url string, v interface{}) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// fetchKeys returns the signing keys of the issuer, skipping the keys it can not use
+func (v *oidcVerifier) fetchKeys() (map[string]jose.JSONWebKey, error) {
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := getJSON(v.jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch the keys of OIDC issuer %s: %w", v.c.Issuer, err)
+	}
+
+	keys := map[string]jose.JSONWebKey{}
+	for _, raw := range set.Keys {
+		var k jose.JSONWebKey
+		if err := k.UnmarshalJSON(raw); err != nil {
+			log.Warn().Err(err).Msg("Skipping OIDC key")
+			continue
+		}
+		if (k.Use != "" && k.Use != "sig") || !k.IsPublic() || !k.Valid() {
+			continue
+		}
+		keys[k.KeyID] = k
+	}
+	return keys, nil
+}
+
+// key returns the key of an ID, fetching the keys again when it is unknown, the issuer having rotated them. The
+// keys are fetched without holding the lock, so that tokens of known keys are verified meanwhile, and requests
+// for unknown keys wait for the fetch in progress rather than start their own.
+func (v *oidcVerifier) key(kid string) (jose.JSONWebKey, error) {
+	v.mu.Lock()
+	if key, ok := v.keys[kid]; ok {
+		v.mu.Unlock()
+		return key, nil
+	}
+	if refresh := v.refresh; refresh != nil {
+		v.mu.Unlock()
+		<-refresh
+		return v.knownKey(kid)
+	}
+	if time.Since(v.fetched) < jwksRefresh {
+		v.mu.Unlock()
+		return jose.JSONWebKey{}, fmt.Errorf("unknown key %q", kid)
+	}
+	refresh := make(chan struct{})
+	v.refresh, v.fetched = refresh, time.Now()
+	v.mu.Unlock()
+
+	keys, err := v.fetchKeys()
+
+	v.mu.Lock()
+	if err == nil {
+		v.keys = keys
+	}
+	v.refresh = nil
+	v.mu.Unlock()
+	close(refresh)
+
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	return v.knownKey(kid)
+}
+
+// knownKey returns the key of an ID without fetching the keys
+func (v *oidcVerifier) knownKey(kid string) (jose.JSONWebKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return jose.JSONWebKey{}, fmt.Errorf("unknown key %q", kid)
+}
+
+// verify checks a JWT and returns its subject and the scope its claims grant
+func (v *oidcVerifier) verify(token string, now time.Time) (string, string, error) {
+	parsed, err := jwt.ParseSigned(token, oidcAlgorithms)
+	if err != nil {
+		return "", "", fmt.Errorf("malformed token: %w", err)
+	}
+	header := parsed.Headers[0]
+	key, err := v.key(header.KeyID)
+	if err != nil {
+		return "", "", err
+	}
+	// the issuer may restrict a key to one algorithm
+	if key.Algorithm != "" && key.Algorithm != header.Algorithm {
+		return "", "", fmt.Errorf("algorithm %q does not match the key", header.Algorithm)
+	}
+	if ec, ok := key.Key.(*ecdsa.PublicKey); ok && curveAlgorithms[ec.Curve.Params().Name] != header.Algorithm {
+		return "", "", fmt.Errorf("algorithm %q does not match the EC key", header.Algorithm)
+	}
+
+	var registered jwt.Claims
+	var claims map[string]interface{}
+	if err := parsed.Claims(key.Key, &registered, &claims); err != nil {
+		return "", "", fmt.Errorf("invalid token: %w", err)
+	}
+	if registered.Expiry == nil {
+		return "", "", fmt.Errorf("token has no expiry")
+	}
+	expected := jwt.Expected{Issuer: v.c.Issuer, AnyAudience: jwt.Audience{v.c.Audience}, Time: now}
+	if err := registered.ValidateWithLeeway(expected, oidcLeeway); err != nil {
+		return "", "", err
+	}
+
+	subject, _ := claims["sub"].(string)
+	if email, ok := claims["email"].(string); ok {
+		subject = email
+	}
+
+	values := claimValues(claims[v.c.ScopeClaim])
+	for _, value := range values {
+		if slices.Contains(v.c.Admin, value) {
+			return subject, scopeAdmin, nil
+		}
+	}
+	if len(v.c.Read) == 0 {
+		return subject, scopeRead, nil
+	}
+	for _, value := range values {
+		if slices.Contains(v.c.Read, value) {
+			return subject, scopeRead, nil
+		}
+	}
+	return "", "", fmt.Errorf("token of %s has no scope", subject)
+}
+
+// claimValues returns the values of a claim, a space-separated string or a list of strings
+func claimValues(claim interface{}) []string {
+	switch claim := claim.(type) {
+	case string:
+		return strings.Fields(claim)
+	case []interface{}:
+		var values []string
+		for _, v := range claim {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// TestOIDCVerify checks the tokens of an issuer serving its discovery document and keys
+func TestOIDCVerify(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var issuer string
+	var rotate atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		keys := []jose.JSONWebKey{
+			{Key: &p256.PublicKey, KeyID: "p256", Use: "sig"},
+			{Key: &p384.PublicKey, KeyID: "p384", Use: "sig"},
+		}
+		if rotate.Load() {
+			keys = append(keys, jose.JSONWebKey{Key: &rotated.PublicKey, KeyID: "rotated", Use: "sig"})
+		}
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: keys})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	issuer = srv.URL
+
+	v, err := newOIDCVerifier(OIDCConfig{Issuer: issuer, Audience: "tr4ck", Admin: []string{"tr4ck:admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	sign := func(alg jose.SignatureAlgorithm, key *ecdsa.PrivateKey, kid string, claims jwt.Claims, scope string) string {
+		t.Helper()
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: jose.JSONWebKey{Key: key, KeyID: kid}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := jwt.Signed(signer).Claims(claims).Claims(map[string]interface{}{"scope": scope}).Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := jwt.Claims{Issuer: issuer, Subject: "ci", Audience: jwt.Audience{"tr4ck"}, Expiry: jwt.NewNumericDate(now.Add(time.Hour))}
+
+	subject, scope, err := v.verify(sign(jose.ES256, p256, "p256", valid, "tr4ck:admin"), now)
+	if err != nil || subject != "ci" || scope != scopeAdmin {
+		t.Fatalf("valid token verified as %q %q, %v", subject, scope, err)
+	}
+	if _, scope, err := v.verify(sign(jose.ES384, p384, "p384", valid, "other"), now); err != nil || scope != scopeRead {
+		t.Fatalf("read token verified with scope %q, %v", scope, err)
+	}
+
+	expired := valid
+	expired.Expiry = jwt.NewNumericDate(now.Add(-time.Hour))
+	wrongAudience := valid
+	wrongAudience.Audience = jwt.Audience{"other"}
+	// an ES384 token signed by the P-256 key, its signature padded to the size of ES384
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES384","kid":"p256"}`))
+	payload := strings.Split(sign(jose.ES256, p256, "p256", valid, ""), ".")[1]
+	digest := sha512.Sum384([]byte(header + "." + payload))
+	r, s, err := ecdsa.Sign(rand.Reader, p256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := append(r.FillBytes(make([]byte, 48)), s.FillBytes(make([]byte, 48))...)
+	wrongCurve := header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	rejected := map[string]string{
+		"expired":        sign(jose.ES256, p256, "p256", expired, ""),
+		"wrong audience": sign(jose.ES256, p256, "p256", wrongAudience, ""),
+		"unknown key":    sign(jose.ES256, p256, "other", valid, ""),
+		"wrong key":      sign(jose.ES384, p384, "p256", valid, ""),
+		"wrong curve":    wrongCurve,
+	}
+	for name, token := range rejected {
+		if _, _, err := v.verify(token, now); err == nil {
+			t.Errorf("%s token verified", name)
+		}
+	}
+
+	// tokens of a key the issuer rotated in are verified once the keys are fetched again, by a single fetch
+	rotate.Store(true)
+	v.fetched = time.Time{}
+	token := sign(jose.ES256, rotated, "rotated", valid, "")
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := v.verify(token, now); err != nil {
+				t.Errorf("token of the rotated key: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
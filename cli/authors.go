@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// reportBy groups the report by repository, blame author, component or CODEOWNERS owner
+var reportBy = "repo"
+
+// AuthorGroup is the outstanding markers of an author, oldest first
+type AuthorGroup struct {
+	Author   string        `json:"author"`
+	Email    string        `json:"email,omitempty"`
+	Count    int           `json:"count"`
+	Oldest   *RepoFinding  `json:"oldest,omitempty"`
+	Findings []RepoFinding `json:"findings"`
+}
+
+// groupByAuthor groups the findings of results by blame author, identified by email. Authors with the most
+// markers come first. Findings that could not be blamed, e.g. in uncommitted files, are grouped under unknown.
+func groupByAuthor(results []ScanResult) []AuthorGroup {
+	groups := map[string]*AuthorGroup{}
+	for _, result := range results {
+		for _, f := range result.Findings {
+			key := strings.ToLower(f.Email)
+			if key == "" {
+				key = f.Author
+			}
+
+			group, ok := groups[key]
+			if !ok {
+				group = &AuthorGroup{Author: f.Author, Email: f.Email}
+				if group.Author == "" {
+					group.Author = "unknown"
+				}
+				groups[key] = group
+			}
+			group.Findings = append(group.Findings, RepoFinding{Repo: result.Repo, Branch: result.Branch, Revision: result.To, Finding: f})
+		}
+	}
+
+	var authors []AuthorGroup
+	for _, group := range groups {
+		// oldest first, findings without a date last
+		sort.SliceStable(group.Findings, func(i, j int) bool {
+			a, b := group.Findings[i].Date, group.Findings[j].Date
+			return a != nil && (b == nil || a.Before(*b))
+		})
+		group.Count = len(group.Findings)
+		if group.Findings[0].Date != nil {
+			group.Oldest = &group.Findings[0]
+		}
+		authors = append(authors, *group)
+	}
+
+	sort.Slice(authors, func(i, j int) bool {
+		if authors[i].Count != authors[j].Count {
+			return authors[i].Count > authors[j].Count
+		}
+		return authors[i].Author < authors[j].Author
+	})
+
+	return authors
+}
+
+// runAuthorReport scans like report and prints the findings grouped by blame author
+func runAuthorReport(uris []string) {
+	format := outputFormat
+	if format != "markdown" && format != "text" && format != "json" && format != "porcelain" {
+		log.Fatal().Str("format", format).Msg("Invalid --format, --by author supports markdown, text, json and porcelain")
+	}
+
+	// authors come from blame
+	blameFindings = true
+
+	var results []ScanResult
+	scanAll(uris, func(result ScanResult) {
+		results = append(results, result)
+	})
+	authors := groupByAuthor(results)
+
+	var w io.Writer = os.Stdout
+	f, err := openOutput()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open output")
+	}
+	if f != nil {
+		defer f.Close()
+		w = f
+	}
+
+	switch format {
+	case "json":
+		if authors == nil {
+			authors = []AuthorGroup{}
+		}
+		PrintStruct(w, authors)
+	case "markdown":
+		writeAuthorMarkdown(w, authors)
+	case "text":
+		printAuthors(w, authors)
+	case "porcelain":
+		// author, email, repository, file, line, marker, age and text
+		for _, group := range authors {
+			for _, f := range group.Findings {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", group.Author, group.Email, f.Repo, f.File, f.Line, f.Marker, f.Age, porcelainField(f.Text))
+			}
+		}
+	}
+}
+
+// authorName formats an author with their email, if known
+func authorName(group AuthorGroup) string {
+	if group.Email == "" {
+		return group.Author
+	}
+	return fmt.Sprintf("%s <%s>", group.Author, group.Email)
+}
+
+// writeAuthorMarkdown writes a section per author listing their markers, oldest first
+func writeAuthorMarkdown(w io.Writer, authors []AuthorGroup) {
+	fmt.Fprintf(w, "# tr4ck report by author\n\n")
+	fmt.Fprintf(w, "Generated %s, %d authors.\n", time.Now().UTC().Format("2006-01-02 15:04 MST"), len(authors))
+
+	for _, group := range authors {
+		fmt.Fprintf(w, "\n## %s\n\n", markdownEscaper.Replace(authorName(group)))
+		fmt.Fprintf(w, "%d markers", group.Count)
+		if group.Oldest != nil {
+			fmt.Fprintf(w, ", oldest %s", group.Oldest.Age)
+		}
+		fmt.Fprintf(w, ".\n\n")
+
+		for _, f := range group.Findings {
+			location := fmt.Sprintf("%s:%d", f.File, f.Line)
+			if url := blobURL(f.Repo, f.Revision, f.File, f.Line); url != "" {
+				location = fmt.Sprintf("[%s](%s)", location, url)
+			}
+			repo := ScanResult{Repo: f.Repo, Branch: f.Branch}.title()
+			fmt.Fprintf(w, "- %s %s **%s** %s", markdownEscaper.Replace(repo), location, f.Marker, markdownEscaper.Replace(f.Text))
+			if f.Age != "" {
+				fmt.Fprintf(w, " (%s)", f.Age)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// printAuthors writes a colored line per author followed by their markers
+func printAuthors(w io.Writer, authors []AuthorGroup) {
+	for _, group := range authors {
+		summary := fmt.Sprintf("%d markers", group.Count)
+		if group.Oldest != nil {
+			summary += ", oldest " + group.Oldest.Age
+		}
+		fmt.Fprintf(w, "%s\t%s\n", aurora.Cyan(authorName(group)), aurora.Yellow(summary))
+
+		for _, f := range group.Findings {
+			repo := ScanResult{Repo: f.Repo, Branch: f.Branch}.title()
+			fmt.Fprintf(w, "\t%s %s:%d:%d\t%s\t%s\t%s\n", aurora.Gray(12, repo), aurora.Blue(f.File), f.Line, f.Column, aurora.BrightGreen(f.Marker), f.Age, f.Text)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io"
+	"strconv"
+)
+
+// badgeLabel is the label of the badge written with --format badge
+var badgeLabel = "TODOs"
+
+// Badge is a shields.io endpoint badge, see https://shields.io/badges/endpoint-badge
+type Badge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// badgeColor goes from green to red as markers pile up
+func badgeColor(count int) string {
+	switch {
+	case count == 0:
+		return "brightgreen"
+	case count <= 10:
+		return "green"
+	case count <= 50:
+		return "yellow"
+	case count <= 100:
+		return "orange"
+	default:
+		return "red"
+	}
+}
+
+// writeBadge writes a shields.io endpoint badge with the number of findings of the report. Combined with
+// --output-dir, each repository gets its own badge.
+func writeBadge(w io.Writer, report Report) {
+	count := 0
+	for _, result := range report.Results {
+		count += len(result.Findings)
+	}
+
+	PrintStruct(w, Badge{
+		SchemaVersion: 1,
+		Label:         badgeLabel,
+		Message:       strconv.Itoa(count),
+		Color:         badgeColor(count),
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// baselinePath is the baseline file whose findings are not reported by scan and sync
+var baselinePath string
+
+// Baseline is a snapshot of existing findings, used to only report new ones when adopting tr4ck on a legacy codebase
+type Baseline struct {
+	Created  time.Time       `json:"created"`
+	Findings []BaselineEntry `json:"findings"`
+}
+
+// BaselineEntry identifies a finding by its file, marker and line content rather than its line number,
+// so that it still matches after unrelated edits move it around
+type BaselineEntry struct {
+	File   string `json:"file"`
+	Marker string `json:"marker"`
+	Text   string `json:"text"`
+}
+
+func baselineEntry(f Finding) BaselineEntry {
+	return BaselineEntry{File: f.File, Marker: f.Marker, Text: f.Text}
+}
+
+// writeBaseline snapshots findings into the baseline file at path
+func writeBaseline(path string, findings []Finding) error {
+	baseline := Baseline{Created: time.Now().UTC(), Findings: []BaselineEntry{}}
+	for _, f := range findings {
+		baseline.Findings = append(baseline.Findings, baselineEntry(f))
+	}
+
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal baseline: %w", err)
+	}
+
+	if err := writeFileAtomic(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write baseline %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// loadBaseline reads the baseline file at path
+func loadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline %s: %w", path, err)
+	}
+
+	var baseline Baseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline %s: %w", path, err)
+	}
+
+	return &baseline, nil
+}
+
+// flagBaseline reads the baseline set with --baseline, nil when none is set
+func flagBaseline() (*Baseline, error) {
+	if baselinePath == "" {
+		return nil, nil
+	}
+	return loadBaseline(expandHome(baselinePath))
+}
+
+// filterBaseline drops the findings present in the baseline set with --baseline, see filter
+func filterBaseline(findings []Finding) ([]Finding, error) {
+	baseline, err := flagBaseline()
+	if err != nil {
+		return nil, err
+	}
+	return baseline.filter(findings), nil
+}
+
+// filter drops the findings present in the baseline, none when it is nil. Each baseline entry grandfathers a
+// single finding, so a copy of an existing marker in the same file is still reported.
+func (b *Baseline) filter(findings []Finding) []Finding {
+	if b == nil {
+		return findings
+	}
+
+	known := make(map[BaselineEntry]int)
+	for _, entry := range b.Findings {
+		known[entry]++
+	}
+
+	var kept []Finding
+	for _, f := range findings {
+		entry := baselineEntry(f)
+		if known[entry] > 0 {
+			known[entry]--
+			continue
+		}
+		kept = append(kept, f)
+	}
+
+	return kept
+}
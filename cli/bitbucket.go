@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// bitbucketConfig is the bitbucket section of the config, nil when Bitbucket is not integrated
+var bitbucketConfig *BitbucketConfig
+
+// bitbucketCloudAPI is the REST API of Bitbucket Cloud
+const bitbucketCloudAPI = "https://api.bitbucket.org/2.0"
+
+// BitbucketConfig integrates Bitbucket Cloud, or Bitbucket Server and Data Center when URL is set: issues are opened
+// for new markers on Bitbucket Cloud, which Bitbucket Server lacks, and the build status of synced commits is set
+type BitbucketConfig struct {
+	// URL is the base URL of Bitbucket Server or Data Center, e.g. https://bitbucket.example.com
+	URL string `yaml:"url"`
+	// Username and Token authenticate with an app password, or Token alone is an access token. They are read from
+	// BITBUCKET_USERNAME and BITBUCKET_TOKEN when empty.
+	Username string `yaml:"username"`
+	Token    string `yaml:"token"`
+	// Repos maps repositories to the workspace/slug, or PROJECT/slug on Bitbucket Server, of their Bitbucket
+	// repository. Other repositories hosted on Bitbucket map to themselves.
+	Repos map[string]string `yaml:"repos"`
+	// Issues opens issues on Bitbucket Cloud, of Kind, task by default
+	Issues      bool   `yaml:"issues"`
+	Kind        string `yaml:"kind"`
+	IssueConfig `yaml:",inline"`
+	// BuildStatus sets a tr4ck build status on each synced commit, failed when the new markers meet a FailOn condition
+	BuildStatus bool     `yaml:"build_status"`
+	FailOn      []string `yaml:"fail_on"`
+}
+
+// bitbucketClient calls the REST API of Bitbucket Cloud or Server
+type bitbucketClient struct {
+	c      BitbucketConfig
+	server bool
+	// api is the REST API, web the base URL of the web interface and host its host
+	api  string
+	web  string
+	host string
+}
+
+func newBitbucketClient(c BitbucketConfig) *bitbucketClient {
+	b := &bitbucketClient{c: c, api: bitbucketCloudAPI, web: "https://bitbucket.org", host: "bitbucket.org"}
+	if b.c.Username == "" {
+		b.c.Username = os.Getenv("BITBUCKET_USERNAME")
+	}
+	if b.c.Token == "" {
+		b.c.Token = os.Getenv("BITBUCKET_TOKEN")
+	}
+	if b.c.Kind == "" {
+		b.c.Kind = "task"
+	}
+	if c.URL != "" {
+		b.server = true
+		b.web = strings.TrimRight(c.URL, "/")
+		b.api = b.web + "/rest"
+		if u, err := url.Parse(b.web); err == nil {
+			b.host = strings.ToLower(u.Hostname())
+		}
+	}
+	return b
+}
+
+// request calls the REST API, path being relative to it, see callJSON
+func (b *bitbucketClient) request(method, path string, in, out any) error {
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	switch {
+	case b.c.Username != "" && b.c.Token != "":
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(b.c.Username+":"+b.c.Token)))
+	case b.c.Token != "":
+		header.Set("Authorization", "Bearer "+b.c.Token)
+	}
+	if !strings.HasPrefix(path, "https://") && !strings.HasPrefix(path, "http://") {
+		path = b.api + path
+	}
+	return callJSON("bitbucket", method, path, header, in, out)
+}
+
+// project maps the canonical URI of a repository to workspace/slug, or PROJECT/slug on Bitbucket Server, empty
+// for repositories not on this Bitbucket
+func (b *bitbucketClient) project(repo string) string {
+	for uri, project := range b.c.Repos {
+		if canonicalURI(uri) == repo {
+			return project
+		}
+	}
+
+	host, path, ok := strings.Cut(repo, "/")
+	if !ok || strings.Split(host, ":")[0] != b.host {
+		return ""
+	}
+	// http clone URLs of Bitbucket Server are under /scm
+	if b.server {
+		path = strings.TrimPrefix(path, "scm/")
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 {
+		return ""
+	}
+	if b.server {
+		parts[0] = strings.ToUpper(parts[0])
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+// bitbucketTracker opens issues on Bitbucket Cloud
+type bitbucketTracker struct {
+	*bitbucketClient
+}
+
+func (t bitbucketTracker) name() string {
+	return "bitbucket"
+}
+
+func (t bitbucketTracker) config() IssueConfig {
+	return t.c.IssueConfig
+}
+
+// bitbucketIssue is an issue of Bitbucket Cloud
+type bitbucketIssue struct {
+	ID      int    `json:"id"`
+	State   string `json:"state"`
+	Content struct {
+		Raw string `json:"raw"`
+	} `json:"content"`
+	Links struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"links"`
+}
+
+func (t bitbucketTracker) ticket(project string, issue bitbucketIssue) Ticket {
+	state := "closed"
+	if issue.State == "new" || issue.State == "open" || issue.State == "on hold" {
+		state = "open"
+	}
+	return Ticket{Tracker: t.name(), Key: fmt.Sprintf("%s#%d", project, issue.ID), URL: issue.Links.HTML.Href, State: state}
+}
+
+// existing lists the issues of the repository whose content has a marker ID. Bitbucket issues have no labels.
+func (t bitbucketTracker) existing(project string) (map[string]Ticket, error) {
+	tickets := map[string]Ticket{}
+	next := "/repositories/" + project + "/issues?pagelen=50&q=" + url.QueryEscape(`content.raw ~ "<!-- tr4ck:"`)
+	for next != "" {
+		var page struct {
+			Values []bitbucketIssue `json:"values"`
+			Next   string           `json:"next"`
+		}
+		if err := t.request(http.MethodGet, next, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, issue := range page.Values {
+			if match := ticketIDPattern.FindStringSubmatch(issue.Content.Raw); match != nil {
+				tickets[match[1]] = t.ticket(project, issue)
+			}
+		}
+		next = page.Next
+	}
+	return tickets, nil
+}
+
+func (t bitbucketTracker) open(project string, m *StoredMarker, title, body string, labels []string) (Ticket, error) {
+	var issue bitbucketIssue
+	in := map[string]any{"title": title, "kind": t.c.Kind, "content": map[string]string{"raw": withTicketID(body, m.ID)}}
+	if err := t.request(http.MethodPost, "/repositories/"+project+"/issues", in, &issue); err != nil {
+		return Ticket{}, err
+	}
+	return t.ticket(project, issue), nil
+}
+
+// issuePath is the API path of an issue
+func (t bitbucketTracker) issuePath(ticket Ticket) (string, error) {
+	project, id, ok := strings.Cut(ticket.Key, "#")
+	if !ok {
+		return "", fmt.Errorf("invalid bitbucket issue %s", ticket.Key)
+	}
+	return fmt.Sprintf("/repositories/%s/issues/%s", project, id), nil
+}
+
+func (t bitbucketTracker) comment(ticket Ticket, comment string) error {
+	path, err := t.issuePath(ticket)
+	if err != nil {
+		return err
+	}
+	return t.request(http.MethodPost, path+"/comments", map[string]any{"content": map[string]string{"raw": comment}}, nil)
+}
+
+// close comments on the issue, then resolves it
+func (t bitbucketTracker) close(ticket Ticket, comment string) error {
+	path, err := t.issuePath(ticket)
+	if err != nil {
+		return err
+	}
+	if err := t.comment(ticket, comment); err != nil {
+		return err
+	}
+	return t.request(http.MethodPut, path, map[string]string{"state": "resolved"}, nil)
+}
+
+func (t bitbucketTracker) reference(project, ref string) (Ticket, bool) {
+	return numberReference(t.name(), project, ref)
+}
+
+func (t bitbucketTracker) lookup(ticket Ticket) (Ticket, error) {
+	path, err := t.issuePath(ticket)
+	if err != nil {
+		return ticket, err
+	}
+	var issue bitbucketIssue
+	if err := t.request(http.MethodGet, path, nil, &issue); err != nil {
+		return ticket, err
+	}
+	project, _, _ := strings.Cut(ticket.Key, "#")
+	return t.ticket(project, issue), nil
+}
+
+// bitbucketStatus sets the build status of synced commits
+type bitbucketStatus struct {
+	*bitbucketClient
+	conditions []failCondition
+}
+
+// publish sets a tr4ck build status on the synced commit, failed when the added markers meet a fail_on condition
+func (s bitbucketStatus) publish(all, added ScanResult) error {
+	project := s.project(canonicalURI(added.Repo))
+	if project == "" || added.To == "" {
+		return nil
+	}
+
+	state := "SUCCESSFUL"
+	if len(failures(s.conditions, []ScanResult{added})) > 0 {
+		state = "FAILED"
+	}
+	description := fmt.Sprintf("%d new markers, %d in total", len(added.Findings), len(all.Findings))
+	in := map[string]string{"key": "tr4ck", "name": "tr4ck", "state": state, "description": description}
+
+	if s.server {
+		key, slug, _ := strings.Cut(project, "/")
+		in["url"] = fmt.Sprintf("%s/projects/%s/repos/%s/commits/%s", s.web, key, slug, added.To)
+		return s.request(http.MethodPost, "/build-status/1.0/commits/"+added.To, in, nil)
+	}
+	in["url"] = fmt.Sprintf("%s/%s/commits/%s", s.web, project, added.To)
+	return s.request(http.MethodPost, fmt.Sprintf("/repositories/%s/commit/%s/statuses/build", project, added.To), in, nil)
+}
+
+// bitbucketRepo is a repository listed by Bitbucket Cloud or Server
+type bitbucketRepo struct {
+	Slug   string `json:"slug"`
+	Name   string `json:"name"`
+	Parent *struct {
+		FullName string `json:"full_name"`
+	} `json:"parent"`
+	Origin *struct {
+		Slug string `json:"slug"`
+	} `json:"origin"`
+	Links struct {
+		Clone []struct {
+			Name string `json:"name"`
+			Href string `json:"href"`
+		} `json:"clone"`
+	} `json:"links"`
+}
+
+// cloneURL is the https clone URL of the repository, without user info
+func (r bitbucketRepo) cloneURL() string {
+	for _, link := range r.Links.Clone {
+		if link.Name != "https" && link.Name != "http" {
+			continue
+		}
+		u, err := url.Parse(link.Href)
+		if err != nil {
+			return link.Href
+		}
+		u.User = nil
+		return u.String()
+	}
+	return ""
+}
+
+// fork reports whether the repository is a fork
+func (r bitbucketRepo) fork() bool {
+	return r.Parent != nil || r.Origin != nil
+}
+
+// repositories lists the repositories of a Bitbucket Cloud workspace, or of a Bitbucket Server project
+func (b *bitbucketClient) repositories(owner string) ([]bitbucketRepo, error) {
+	var repos []bitbucketRepo
+	if b.server {
+		for start := 0; ; {
+			var page struct {
+				Values        []bitbucketRepo `json:"values"`
+				IsLastPage    bool            `json:"isLastPage"`
+				NextPageStart int             `json:"nextPageStart"`
+			}
+			path := fmt.Sprintf("/api/1.0/projects/%s/repos?limit=100&start=%d", url.PathEscape(owner), start)
+			if err := b.request(http.MethodGet, path, nil, &page); err != nil {
+				return nil, err
+			}
+			repos = append(repos, page.Values...)
+			if page.IsLastPage || len(page.Values) == 0 {
+				return repos, nil
+			}
+			start = page.NextPageStart
+		}
+	}
+
+	next := "/repositories/" + url.PathEscape(owner) + "?pagelen=100"
+	for next != "" {
+		var page struct {
+			Values []bitbucketRepo `json:"values"`
+			Next   string          `json:"next"`
+		}
+		if err := b.request(http.MethodGet, next, nil, &page); err != nil {
+			return nil, err
+		}
+		repos = append(repos, page.Values...)
+		next = page.Next
+	}
+	return repos, nil
+}
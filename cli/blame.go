@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// blameFindings enables git blame attribution of findings
+	blameFindings bool
+	// olderThan only keeps findings whose line is older than this age, e.g. 90d; implies blame
+	olderThan string
+	// olderThanAge is olderThan parsed by parseOlderThan
+	olderThanAge time.Duration
+	// oldestFirst sorts findings by age, oldest first; implies blame
+	oldestFirst bool
+	// introducedFindings looks up the commit where each marker first appeared
+	introducedFindings bool
+)
+
+// Introduction is the commit where a marker line first appeared
+type Introduction struct {
+	Commit string    `json:"commit"`
+	Author string    `json:"author"`
+	Email  string    `json:"email"`
+	Date   time.Time `json:"date"`
+	// File is the path of the file at that commit, which differs from the finding after a rename
+	File string `json:"file"`
+}
+
+// Resolution is the commit where a marker line disappeared
+type Resolution struct {
+	Commit string    `json:"commit"`
+	Author string    `json:"author"`
+	Email  string    `json:"email"`
+	Date   time.Time `json:"date"`
+}
+
+// maxResolveCommits bounds the number of commits walked to find the commits resolving markers
+const maxResolveCommits = 5000
+
+// attributeFindings sets the blame attribution and the introducing commit of each finding, as of commit hash.
+// dir is the scanned directory relative to the repository root.
+func attributeFindings(repo *git.Repository, hash, dir string, findings []Finding) {
+	blame := blameFindings || olderThan != "" || oldestFirst || tableNeedsBlame()
+	if !(blame || introducedFindings) || repo == nil || hash == "" || len(findings) == 0 {
+		return
+	}
+
+	commit, err := repo.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		log.Err(err).Str("hash", hash).Msg("Failed to get commit for blame")
+		return
+	}
+
+	if blame {
+		blameLines(commit, dir, findings)
+	}
+
+	if introducedFindings {
+		history := newLineHistory()
+		for i := range findings {
+			f := &findings[i]
+
+			intro, err := history.introducingCommit(commit, path.Join(dir, f.File), f.Text)
+			if err != nil {
+				log.Debug().Err(err).Str("file", f.File).Int("line", f.Line).Msg("Failed to find introducing commit")
+				continue
+			}
+			f.Introduced = intro
+		}
+	}
+}
+
+// blameLines sets the author, email and commit of the line of each finding
+func blameLines(commit *object.Commit, dir string, findings []Finding) {
+	// blame each file once
+	blames := map[string]*git.BlameResult{}
+	for i := range findings {
+		f := &findings[i]
+
+		result, ok := blames[f.File]
+		if !ok {
+			var err error
+			result, err = git.Blame(commit, path.Join(dir, f.File))
+			if err != nil {
+				// untracked files cannot be blamed
+				log.Debug().Err(err).Str("file", f.File).Msg("Failed to blame file")
+			}
+			blames[f.File] = result
+		}
+
+		// the line may not exist at commit when the worktree is dirty
+		if result == nil || f.Line > len(result.Lines) {
+			continue
+		}
+
+		line := result.Lines[f.Line-1]
+		f.Author = line.AuthorName
+		f.Email = line.Author
+		f.Commit = line.Hash.String()
+		date := line.Date
+		f.Date = &date
+		f.Age = formatAge(time.Since(date))
+	}
+}
+
+// errLineNotFound is returned when the marker line is not part of the starting commit, e.g. uncommitted changes
+var errLineNotFound = errors.New("line not found at commit")
+
+// lineHistory caches the trimmed lines of files at commits while walking history
+type lineHistory struct {
+	lines map[string]map[string]bool
+}
+
+func newLineHistory() *lineHistory {
+	return &lineHistory{lines: map[string]map[string]bool{}}
+}
+
+// contains reports whether file exists at commit and has a line equal to text once trimmed
+func (h *lineHistory) contains(commit *object.Commit, file, text string) (bool, error) {
+	key := commit.Hash.String() + ":" + file
+	lines, ok := h.lines[key]
+	if !ok {
+		f, err := commit.File(file)
+		if errors.Is(err, object.ErrFileNotFound) {
+			h.lines[key] = nil
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to get %s at %s: %w", file, commit.Hash, err)
+		}
+
+		content, err := f.Lines()
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s at %s: %w", file, commit.Hash, err)
+		}
+
+		lines = make(map[string]bool, len(content))
+		for _, line := range content {
+			lines[strings.TrimSpace(line)] = true
+		}
+		h.lines[key] = lines
+	}
+
+	return lines[text], nil
+}
+
+// introducingCommit walks first parents back from commit to the oldest commit in an unbroken run that
+// contains text in file, following renames of file along the way
+func (h *lineHistory) introducingCommit(commit *object.Commit, file, text string) (*Introduction, error) {
+	found, err := h.contains(commit, file, text)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errLineNotFound
+	}
+
+	current := commit
+	for current.NumParents() > 0 {
+		parent, err := current.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent of %s: %w", current.Hash, err)
+		}
+
+		parentFile, err := renamedFrom(parent, current, file)
+		if err != nil {
+			return nil, err
+		}
+
+		found, err := h.contains(parent, parentFile, text)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			break
+		}
+
+		current, file = parent, parentFile
+	}
+
+	return &Introduction{
+		Commit: current.Hash.String(),
+		Author: current.Author.Name,
+		Email:  current.Author.Email,
+		Date:   current.Author.When,
+		File:   file,
+	}, nil
+}
+
+// renamedFrom returns the path of file in parent, which differs when the file was renamed by commit
+func renamedFrom(parent, commit *object.Commit, file string) (string, error) {
+	if _, err := parent.File(file); err == nil {
+		return file, nil
+	}
+
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get tree of %s: %w", parent.Hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get tree of %s: %w", commit.Hash, err)
+	}
+
+	changes, err := object.DiffTreeWithOptions(context.Background(), parentTree, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return "", fmt.Errorf("failed to diff %s and %s: %w", parent.Hash, commit.Hash, err)
+	}
+
+	for _, change := range changes {
+		if change.To.Name == file && change.From.Name != "" {
+			return change.From.Name, nil
+		}
+	}
+
+	// added by commit
+	return file, nil
+}
+
+// firstParents returns the first-parent commits after from up to to, oldest first. The walk stops at the root
+// commit, or after maxResolveCommits, when from is not a first parent ancestor of to.
+func firstParents(from, to *object.Commit) ([]*object.Commit, error) {
+	var chain []*object.Commit
+	for current := to; current.Hash != from.Hash && len(chain) < maxResolveCommits; {
+		chain = append(chain, current)
+		if current.NumParents() == 0 {
+			break
+		}
+		parent, err := current.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent of %s: %w", current.Hash, err)
+		}
+		current = parent
+	}
+
+	slices.Reverse(chain)
+	return chain, nil
+}
+
+// resolvingCommit returns the first commit of the chain after from, oldest first, whose file no longer has text.
+// file is the path at from; renames are followed along the way.
+func (h *lineHistory) resolvingCommit(from *object.Commit, chain []*object.Commit, file, text string) (*object.Commit, error) {
+	previous := from
+	for _, commit := range chain {
+		renamed, err := renamedTo(previous, commit, file)
+		if err != nil {
+			return nil, err
+		}
+		file = renamed
+
+		found, err := h.contains(commit, file, text)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return commit, nil
+		}
+		previous = commit
+	}
+	return nil, errLineNotFound
+}
+
+// renamedTo returns the path of file in commit, which differs when commit renamed it from parent
+func renamedTo(parent, commit *object.Commit, file string) (string, error) {
+	if _, err := commit.File(file); err == nil {
+		return file, nil
+	}
+
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get tree of %s: %w", parent.Hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get tree of %s: %w", commit.Hash, err)
+	}
+
+	changes, err := object.DiffTreeWithOptions(context.Background(), parentTree, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return "", fmt.Errorf("failed to diff %s and %s: %w", parent.Hash, commit.Hash, err)
+	}
+
+	for _, change := range changes {
+		if change.From.Name == file && change.To.Name != "" {
+			return change.To.Name, nil
+		}
+	}
+
+	// deleted by commit
+	return file, nil
+}
+
+// attributeResolved sets the commit and author that removed each finding, which was at commit from and
+// is gone at commit to
+func attributeResolved(repo *git.Repository, from, to string, findings []*Finding) {
+	if repo == nil || from == "" || to == "" || len(findings) == 0 {
+		return
+	}
+
+	fromCommit, err := repo.CommitObject(plumbing.NewHash(from))
+	if err != nil {
+		log.Err(err).Str("hash", from).Msg("Failed to get commit for resolutions")
+		return
+	}
+	toCommit, err := repo.CommitObject(plumbing.NewHash(to))
+	if err != nil {
+		log.Err(err).Str("hash", to).Msg("Failed to get commit for resolutions")
+		return
+	}
+	chain, err := firstParents(fromCommit, toCommit)
+	if err != nil {
+		log.Err(err).Msg("Failed to walk commits for resolutions")
+		return
+	}
+
+	history := newLineHistory()
+	for _, f := range findings {
+		commit, err := history.resolvingCommit(fromCommit, chain, f.File, f.Text)
+		if err != nil {
+			log.Debug().Err(err).Str("file", f.File).Int("line", f.Line).Msg("Failed to find resolving commit")
+			continue
+		}
+		f.ResolvedBy = &Resolution{
+			Commit: commit.Hash.String(),
+			Author: commit.Author.Name,
+			Email:  commit.Author.Email,
+			Date:   commit.Author.When,
+		}
+	}
+}
+
+// parseOlderThan validates --older-than up front, so that an invalid age fails before any repository is cloned
+func parseOlderThan() error {
+	if olderThan == "" {
+		return nil
+	}
+	age, err := parseAge(olderThan)
+	if err != nil {
+		return fmt.Errorf("invalid --older-than: %w", err)
+	}
+	olderThanAge = age
+	return nil
+}
+
+// filterFindingsByAge applies --older-than and --oldest-first to blamed findings
+func filterFindingsByAge(findings []Finding) []Finding {
+	now := time.Now()
+
+	if olderThan != "" {
+		// findings that could not be blamed have no age and are dropped
+		var kept []Finding
+		for _, f := range findings {
+			if age, ok := f.age(now); ok && age >= olderThanAge {
+				kept = append(kept, f)
+			}
+		}
+		findings = kept
+	}
+
+	if oldestFirst {
+		sort.SliceStable(findings, func(i, j int) bool {
+			ai, _ := findings[i].age(now)
+			aj, _ := findings[j].age(now)
+			return ai > aj
+		})
+	}
+
+	return findings
+}
+
+// age returns how long the line of the finding has existed, if it was blamed
+func (f Finding) age(now time.Time) (time.Duration, bool) {
+	if f.Date == nil {
+		return 0, false
+	}
+	return now.Sub(*f.Date), true
+}
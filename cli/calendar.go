@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CalendarOptions select the markers of a calendar and how they are written
+type CalendarOptions struct {
+	// Repo is a canonical URI or a glob matched against it, and Branch a branch, restricting the calendar
+	Repo   string
+	Branch string
+	// Kind is todo for a VTODO per marker, due on its date, or event for an all-day VEVENT
+	Kind string
+}
+
+// icalEscaper escapes the TEXT values of iCalendar, see RFC 5545 section 3.3.11
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// icalLine writes a content line folded at 75 octets, continuations starting with a space, without splitting UTF-8
+// sequences
+func icalLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xc0 == 0x80 {
+			cut--
+		}
+		// not UTF-8, e.g. a run of continuation bytes, is cut anywhere rather than looping forever
+		if cut == 0 {
+			cut = limit
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	b.WriteString(line + "\r\n")
+}
+
+// icalPriority maps a marker priority, p0 the highest, to an iCalendar priority from 1, the highest, to 9, and 0
+// when undefined
+func icalPriority(priority string) int {
+	digits, ok := strings.CutPrefix(strings.ToLower(priority), "p")
+	n, err := strconv.Atoi(digits)
+	if !ok || err != nil || n < 0 {
+		return 0
+	}
+	return min(n+1, 9)
+}
+
+// calendarUID identifies the component of a marker across exports, so that calendars update it in place
+func calendarUID(m *StoredMarker) string {
+	id := m.ID
+	if id == "" {
+		sum := sha256.Sum256([]byte(m.Repo + "\x00" + m.Branch + "\x00" + m.File + "\x00" + m.Text))
+		id = hex.EncodeToString(sum[:8])
+	}
+	return id + "@tr4ck"
+}
+
+// calendar renders the open markers of the store with a valid due date as an iCalendar, see RFC 5545, soonest first
+func (s *Store) calendar(opts CalendarOptions, now time.Time) (string, error) {
+	if opts.Kind != "todo" && opts.Kind != "event" {
+		return "", fmt.Errorf("unsupported calendar kind %s, expected todo or event", opts.Kind)
+	}
+
+	type dated struct {
+		m   *StoredMarker
+		due time.Time
+	}
+	var markers []dated
+	for _, m := range s.Markers {
+		if m.State != markerOpen {
+			continue
+		}
+		if opts.Repo != "" && m.Repo != canonicalURI(opts.Repo) && !globMatch(opts.Repo, m.Repo) {
+			continue
+		}
+		if opts.Branch != "" && m.Branch != opts.Branch {
+			continue
+		}
+		if due, ok := m.dueDate(); ok {
+			markers = append(markers, dated{m, due})
+		}
+	}
+	sort.SliceStable(markers, func(i, j int) bool { return markers[i].due.Before(markers[j].due) })
+
+	name := "tr4ck markers"
+	if opts.Repo != "" {
+		name += " of " + ScanResult{Repo: opts.Repo, Branch: opts.Branch}.title()
+	}
+
+	var b strings.Builder
+	icalLine(&b, "BEGIN:VCALENDAR")
+	icalLine(&b, "VERSION:2.0")
+	icalLine(&b, "PRODID:-//cyber-nic//tr4ck "+version+"//EN")
+	icalLine(&b, "CALSCALE:GREGORIAN")
+	icalLine(&b, "X-WR-CALNAME:"+icalEscaper.Replace(name))
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, d := range markers {
+		m := d.m
+		component := "VTODO"
+		if opts.Kind == "event" {
+			component = "VEVENT"
+		}
+		icalLine(&b, "BEGIN:"+component)
+		icalLine(&b, "UID:"+calendarUID(m))
+		icalLine(&b, "DTSTAMP:"+stamp)
+		if opts.Kind == "event" {
+			icalLine(&b, "DTSTART;VALUE=DATE:"+d.due.Format("20060102"))
+			icalLine(&b, "DTEND;VALUE=DATE:"+d.due.AddDate(0, 0, 1).Format("20060102"))
+			icalLine(&b, "TRANSP:TRANSPARENT")
+		} else {
+			icalLine(&b, "DUE;VALUE=DATE:"+d.due.Format("20060102"))
+			icalLine(&b, "STATUS:NEEDS-ACTION")
+		}
+		icalLine(&b, "SUMMARY:"+icalEscaper.Replace(fmt.Sprintf("%s: %s", m.Marker, m.Text)))
+		icalLine(&b, "DESCRIPTION:"+icalEscaper.Replace(calendarDescription(m)))
+		icalLine(&b, "CATEGORIES:"+icalEscaper.Replace(m.Marker))
+		if p := icalPriority(m.Priority); p > 0 {
+			icalLine(&b, "PRIORITY:"+strconv.Itoa(p))
+		}
+		if url := markerURL(m); url != "" {
+			icalLine(&b, "URL:"+url)
+		}
+		icalLine(&b, "END:"+component)
+	}
+	icalLine(&b, "END:VCALENDAR")
+	return b.String(), nil
+}
+
+// calendarDescription describes the marker of a calendar component
+func calendarDescription(m *StoredMarker) string {
+	description := fmt.Sprintf("%s\n%s:%d\n%s", ScanResult{Repo: m.Repo, Branch: m.Branch}.title(), m.File, m.Line, m.Text)
+	if m.Assignee != "" {
+		description += "\nAssignee: " + m.Assignee
+	}
+	if m.ID != "" {
+		description += "\nID: " + m.ID
+	}
+	if m.Description != "" {
+		description += "\n\n" + m.Description
+	}
+	return description
+}
+
+// runCalendar writes the iCalendar of the marker store to output, stdout when empty
+func runCalendar(opts CalendarOptions, output string) {
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load marker store")
+	}
+
+	data, err := store.calendar(opts, time.Now())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to generate calendar")
+	}
+	if output == "" {
+		os.Stdout.WriteString(data)
+		return
+	}
+	if err := writeFileAtomic(output, []byte(data), 0644); err != nil {
+		log.Fatal().Err(err).Str("output", output).Msg("Failed to write calendar")
+	}
+}
+
+// serveCalendar serves the iCalendar of the marker store, restricted by the repo and branch query parameters, with
+// the kind query parameter, todo by default
+func serveCalendar(w http.ResponseWriter, r *http.Request) {
+	opts := CalendarOptions{Repo: r.URL.Query().Get("repo"), Branch: r.URL.Query().Get("branch"), Kind: r.URL.Query().Get("kind")}
+	if opts.Kind == "" {
+		opts.Kind = "todo"
+	}
+	if opts.Kind != "todo" && opts.Kind != "event" {
+		http.Error(w, "invalid kind", http.StatusBadRequest)
+		return
+	}
+
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		log.Err(err).Msg("Failed to load marker store")
+		http.Error(w, "failed to load marker store", http.StatusInternalServerError)
+		return
+	}
+	data, err := store.calendar(opts, time.Now())
+	if err != nil {
+		log.Err(err).Msg("Failed to generate calendar")
+		http.Error(w, "failed to generate calendar", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write([]byte(data))
+}
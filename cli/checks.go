@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// checksConfig is the github_checks section of the config, nil when sync does not publish check runs
+var checksConfig *GitHubChecksConfig
+
+// checkAnnotationsPerRequest is the most annotations the Checks API accepts per request
+const checkAnnotationsPerRequest = 50
+
+// GitHubChecksConfig publishes a check run on each commit synced on GitHub, annotating the new markers
+type GitHubChecksConfig struct {
+	// AppID and PrivateKey, a PEM file, authenticate as a GitHub App installed with the checks:write permission.
+	// The PEM is read from GITHUB_APP_PRIVATE_KEY when PrivateKey is empty.
+	AppID      int64  `yaml:"app_id"`
+	PrivateKey string `yaml:"private_key"`
+	// Token is an installation token used instead of the app, e.g. the GITHUB_TOKEN of an Actions job
+	Token string `yaml:"token"`
+	// APIURL is the REST API of GitHub Enterprise Server, e.g. https://github.example.com/api/v3
+	APIURL string `yaml:"api_url"`
+	// Repos maps repositories to the owner/name of their GitHub repository, for mirrors
+	Repos map[string]string `yaml:"repos"`
+	// Name is the name of the check, tr4ck by default
+	Name string `yaml:"name"`
+	// FailOn are the --fail-on conditions failing the check, which otherwise succeeds
+	FailOn []string `yaml:"fail_on"`
+}
+
+// checkPublisher creates check runs with the Checks API, authenticated as an app installation
+type checkPublisher struct {
+	c          GitHubChecksConfig
+	api        string
+	key        *rsa.PrivateKey
+	conditions []failCondition
+
+	mu sync.Mutex
+	// tokens are the installation tokens by owner/name
+	tokens map[string]installationToken
+}
+
+type installationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// githubCheckAnnotation is an annotation of a check run
+type githubCheckAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"`
+	Title           string `json:"title,omitempty"`
+	Message         string `json:"message"`
+}
+
+// githubCheckOutput is the output of a check run, shown on its page and next to the diff of pull requests
+type githubCheckOutput struct {
+	Title       string                  `json:"title"`
+	Summary     string                  `json:"summary"`
+	Annotations []githubCheckAnnotation `json:"annotations,omitempty"`
+}
+
+func newCheckPublisher(c GitHubChecksConfig) (*checkPublisher, error) {
+	p := &checkPublisher{c: c, api: strings.TrimRight(c.APIURL, "/"), tokens: map[string]installationToken{}}
+	if p.api == "" {
+		p.api = "https://api.github.com"
+	}
+	if p.c.Name == "" {
+		p.c.Name = "tr4ck"
+	}
+
+	conditions, err := parseFailOn(c.FailOn)
+	if err != nil {
+		return nil, err
+	}
+	p.conditions = conditions
+
+	if c.Token != "" {
+		return p, nil
+	}
+	if c.AppID == 0 {
+		return nil, fmt.Errorf("github_checks requires an app_id and private key, or a token")
+	}
+
+	data := []byte(os.Getenv("GITHUB_APP_PRIVATE_KEY"))
+	if c.PrivateKey != "" {
+		if data, err = os.ReadFile(expandHome(c.PrivateKey)); err != nil {
+			return nil, fmt.Errorf("failed to read app private key: %w", err)
+		}
+	}
+	if p.key, err = parsePrivateKey(data); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parsePrivateKey parses the PEM private key of a GitHub App, PKCS#1 as GitHub issues them, or PKCS#8
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid app private key, expected a PEM file")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse app private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid app private key, expected an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// appJWT is the token authenticating as the app, valid for 10 minutes, backdated against clock drift
+func appJWT(appID int64, key *rsa.PrivateKey, now time.Time) (string, error) {
+	encode := func(v any) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	unsigned := encode(map[string]string{"alg": "RS256", "typ": "JWT"}) + "." +
+		encode(map[string]int64{"iat": now.Add(-time.Minute).Unix(), "exp": now.Add(9 * time.Minute).Unix(), "iss": appID})
+
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign app token: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// request calls the GitHub REST API with a token, see callJSON
+func (p *checkPublisher) request(token, method, path string, in, out any) error {
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github+json")
+	header.Set("X-GitHub-Api-Version", "2022-11-28")
+	header.Set("Authorization", "Bearer "+token)
+	return callJSON("github", method, p.api+path, header, in, out)
+}
+
+// token returns a token for the repository: the configured one, or a token of the app installation on the
+// repository, cached until shortly before it expires
+func (p *checkPublisher) token(project string) (string, error) {
+	if p.c.Token != "" {
+		return p.c.Token, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.tokens[project]; ok && time.Until(t.ExpiresAt) > time.Minute {
+		return t.Token, nil
+	}
+
+	jwt, err := appJWT(p.c.AppID, p.key, time.Now())
+	if err != nil {
+		return "", err
+	}
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	if err := p.request(jwt, http.MethodGet, "/repos/"+project+"/installation", nil, &installation); err != nil {
+		return "", fmt.Errorf("failed to find app installation: %w", err)
+	}
+	var t installationToken
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", installation.ID)
+	if err := p.request(jwt, http.MethodPost, path, map[string]any{}, &t); err != nil {
+		return "", fmt.Errorf("failed to create installation token: %w", err)
+	}
+	p.tokens[project] = t
+	return t.Token, nil
+}
+
+// project maps the canonical URI of a repository to owner/name, empty for repositories not on GitHub
+func (p *checkPublisher) project(repo string) string {
+	for uri, project := range p.c.Repos {
+		if canonicalURI(uri) == repo {
+			return project
+		}
+	}
+	host := "github.com"
+	if p.c.APIURL != "" {
+		host = strings.TrimPrefix(strings.TrimPrefix(p.api, "https://"), "http://")
+		host, _, _ = strings.Cut(host, "/")
+		if host == "api.github.com" {
+			host = "github.com"
+		}
+	}
+	if path, ok := strings.CutPrefix(repo, host+"/"); ok {
+		return path
+	}
+	return ""
+}
+
+// publish creates a completed check run on the synced commit of a repository: all are the markers at that commit,
+// added those added by the sync, with an annotation each. The check fails when added meets a fail_on condition.
+func (p *checkPublisher) publish(all, added ScanResult) error {
+	project := p.project(canonicalURI(added.Repo))
+	if project == "" || added.To == "" {
+		return nil
+	}
+	token, err := p.token(project)
+	if err != nil {
+		return err
+	}
+
+	failed := failures(p.conditions, []ScanResult{added})
+	conclusion := "success"
+	if len(failed) > 0 {
+		conclusion = "failure"
+	}
+
+	output := githubCheckOutput{Title: "No new markers"}
+	if len(added.Findings) > 0 {
+		output.Title = fmt.Sprintf("%d new markers", len(added.Findings))
+	}
+	var summary bytes.Buffer
+	writeCISummary(&summary, all, added, failed)
+	output.Summary = summary.String()
+
+	var annotations []githubCheckAnnotation
+	for _, f := range added.Findings {
+		title := f.Marker
+		if f.ID != "" {
+			title += " " + f.ID
+		}
+		message := f.Text
+		if f.Description != "" {
+			message = f.Description
+		}
+		annotations = append(annotations, githubCheckAnnotation{
+			Path: f.File, StartLine: f.Line, EndLine: f.Line, AnnotationLevel: "warning", Title: title, Message: message,
+		})
+	}
+	output.Annotations = annotations[:min(checkAnnotationsPerRequest, len(annotations))]
+
+	var run struct {
+		ID int64 `json:"id"`
+	}
+	in := map[string]any{
+		"name":         p.c.Name,
+		"head_sha":     added.To,
+		"status":       "completed",
+		"conclusion":   conclusion,
+		"completed_at": time.Now().UTC().Format(time.RFC3339),
+		"output":       output,
+	}
+	if err := p.request(token, http.MethodPost, "/repos/"+project+"/check-runs", in, &run); err != nil {
+		return err
+	}
+
+	// further annotations are added by updating the output
+	for i := checkAnnotationsPerRequest; i < len(annotations); i += checkAnnotationsPerRequest {
+		output.Annotations = annotations[i:min(i+checkAnnotationsPerRequest, len(annotations))]
+		path := fmt.Sprintf("/repos/%s/check-runs/%d", project, run.ID)
+		if err := p.request(token, http.MethodPatch, path, map[string]any{"output": output}, nil); err != nil {
+			return err
+		}
+	}
+
+	log.Debug().Str("repo", project).Str("commit", added.To).Str("conclusion", conclusion).Int("annotations", len(annotations)).Msg("Published check run")
+	return nil
+}
+
+// commitReporter reports the markers of each synced commit to the forge hosting it, e.g. as a GitHub check run
+type commitReporter interface {
+	// publish reports the synced commit of added: all are the markers at that commit, added those the sync added
+	publish(all, added ScanResult) error
+}
+
+// commitReporters returns the commit reporters set up in the config, logging invalid ones
+func commitReporters() []commitReporter {
+	var reporters []commitReporter
+	if checksConfig != nil {
+		if p, err := newCheckPublisher(*checksConfig); err != nil {
+			log.Err(err).Msg("Invalid github_checks config, not publishing check runs")
+		} else {
+			reporters = append(reporters, p)
+		}
+	}
+	if bitbucketConfig != nil && bitbucketConfig.BuildStatus {
+		if conditions, err := parseFailOn(bitbucketConfig.FailOn); err != nil {
+			log.Err(err).Msg("Invalid bitbucket config, not setting build statuses")
+		} else {
+			reporters = append(reporters, bitbucketStatus{newBitbucketClient(*bitbucketConfig), conditions})
+		}
+	}
+	return reporters
+}
+
+// publishCommit reports the synced commit of a record to each reporter, logging failures. The first sync of a
+// repository reports none of its markers as added.
+func publishCommit(reporters []commitReporter, result ScanResult, current []Finding, initial bool) {
+	if initial {
+		result.Findings = nil
+	}
+	for _, r := range reporters {
+		if err := r.publish(ScanResult{Repo: result.Repo, Findings: current}, result); err != nil {
+			log.Err(err).Str("uri", result.Repo).Str("branch", result.Branch).Msg("Failed to report commit")
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// markerSeverities are the checkstyle severities of markers set in the config, by lowercase marker
+var markerSeverities = map[string]string{}
+
+// defaultSeverity is the checkstyle severity of markers without one
+const defaultSeverity = "warning"
+
+// setMarkerSeverity records the severity of a marker config entry, if any
+func setMarkerSeverity(c MarkerConfig) {
+	switch c.Severity {
+	case "":
+	case "error", "warning", "info", "ignore":
+		markerSeverities[strings.ToLower(c.Marker)] = c.Severity
+	default:
+		log.Warn().Str("marker", c.Marker).Str("severity", c.Severity).Msg("Invalid marker severity, expected error, warning, info or ignore")
+	}
+}
+
+// severityOf returns the checkstyle severity of a marker
+func severityOf(marker string) string {
+	if severity, ok := markerSeverities[strings.ToLower(marker)]; ok {
+		return severity
+	}
+	return defaultSeverity
+}
+
+type checkstyleReport struct {
+	XMLName xml.Name         `xml:"checkstyle"`
+	Version string           `xml:"version,attr"`
+	Files   []checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr,omitempty"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+// writeCheckstyle writes the report as Checkstyle XML, each finding being an error with the severity of its marker.
+// Files are prefixed with their repository when several repositories were scanned.
+func writeCheckstyle(w io.Writer, report Report) error {
+	doc := checkstyleReport{Version: "4.3"}
+
+	for _, result := range report.Results {
+		prefix := ""
+		if len(report.Results) > 1 {
+			prefix = canonicalURI(result.Repo) + "/"
+		}
+
+		files, byFile := groupByFile(result.Findings)
+		for _, file := range files {
+			entry := checkstyleFile{Name: prefix + file}
+			for _, f := range byFile[file] {
+				severity := severityOf(f.Marker)
+				if severity == "ignore" {
+					continue
+				}
+
+				message := f.Description
+				if message == "" {
+					message = f.Text
+				}
+				if f.ID != "" {
+					message += " [" + f.ID + "]"
+				}
+				entry.Errors = append(entry.Errors, checkstyleError{
+					Line:     f.Line,
+					Column:   f.Column,
+					Severity: severity,
+					Message:  message,
+					Source:   "tr4ck." + f.Marker,
+				})
+			}
+			if len(entry.Errors) > 0 {
+				doc.Files = append(doc.Files, entry)
+			}
+		}
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkstyle: %w", err)
+	}
+
+	fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+	return nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// ciSummaryLimit caps the new markers listed in the job summary
+const ciSummaryLimit = 50
+
+// CIOptions are the inputs of tr4ck ci, read from the INPUT_ environment variables of a GitHub Action
+// unless given as flags
+type CIOptions struct {
+	// Base is the commit new markers are added since, the pull request base or the commit before a push when empty
+	Base string
+	// Annotations prints a warning annotation per new marker, Summary writes the job summary
+	Annotations bool
+	Summary     bool
+}
+
+// ciInput reads the value of a GitHub Action input, e.g. fail_on from INPUT_FAIL_ON
+func ciInput(name string) string {
+	return strings.TrimSpace(os.Getenv("INPUT_" + strings.ToUpper(name)))
+}
+
+// ciInputBool reads a boolean input, def when unset
+func ciInputBool(name string, def bool) bool {
+	value := ciInput(name)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatal().Str("input", name).Str("value", value).Msg("Invalid input, expected true or false")
+	}
+	return b
+}
+
+// ciInputList reads a list input, one item per line or comma
+func ciInputList(name string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(ciInput(name), func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// applyCIInputs sets the options of tr4ck ci not given as flags from the inputs of the action
+func applyCIInputs(cmd *cobra.Command, opts *CIOptions) {
+	flags := cmd.Flags()
+	if !flags.Changed("base") {
+		opts.Base = ciInput("base")
+	}
+	if !flags.Changed("baseline") {
+		baselinePath = ciInput("baseline")
+	}
+	if !flags.Changed("fail-on") {
+		failOn = ciInputList("fail_on")
+	}
+	if !flags.Changed("path") {
+		includePaths = ciInputList("paths")
+	}
+	if !flags.Changed("exclude") {
+		excludePaths = ciInputList("exclude")
+	}
+	if !flags.Changed("annotations") {
+		opts.Annotations = ciInputBool("annotations", true)
+	}
+	if !flags.Changed("summary") {
+		opts.Summary = ciInputBool("summary", true)
+	}
+}
+
+// ciEventBase returns the base of the workflow event: the base commit of a pull request, the commit before a
+// push, or else the remote branch a pull request targets. It is empty for other events and new branches.
+func ciEventBase() string {
+	if path := os.Getenv("GITHUB_EVENT_PATH"); path != "" {
+		var event struct {
+			Before      string `json:"before"`
+			PullRequest struct {
+				Base struct {
+					SHA string `json:"sha"`
+				} `json:"base"`
+			} `json:"pull_request"`
+		}
+		if data, err := os.ReadFile(path); err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("Failed to read event")
+		} else if err := json.Unmarshal(data, &event); err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("Failed to parse event")
+		} else if sha := event.PullRequest.Base.SHA; sha != "" {
+			return sha
+		} else if event.Before != "" && strings.Trim(event.Before, "0") != "" {
+			return event.Before
+		}
+	}
+	if ref := os.Getenv("GITHUB_BASE_REF"); ref != "" {
+		return "origin/" + ref
+	}
+	return ""
+}
+
+// ciRepoURL is the web URL of the repository of the workflow, empty outside of GitHub Actions
+func ciRepoURL() string {
+	server, repository := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY")
+	if repository == "" {
+		return ""
+	}
+	if server == "" {
+		server = "https://github.com"
+	}
+	return strings.TrimSuffix(server, "/") + "/" + repository
+}
+
+// runCI scans the workspace of a GitHub Actions job, annotates the markers added since the base, writes a job
+// summary and the new_markers and total outputs, and exits with failExitCode when a --fail-on condition is met
+func runCI(opts CIOptions) {
+	conditions, err := parseFailOn(failOn)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid options")
+	}
+
+	workspace := os.Getenv("GITHUB_WORKSPACE")
+	if workspace == "" {
+		workspace = "."
+	}
+	base := opts.Base
+	if base == "" {
+		base = ciEventBase()
+	}
+
+	// the checkout is scanned in place, once for all markers and once for those added since the base
+	scanLocal = true
+	all := ScanResult{Repo: workspace}
+	if err := localFindings(&all, nil); err != nil {
+		log.Fatal().Err(err).Str("path", workspace).Msg("Failed to scan")
+	}
+
+	added := ScanResult{Repo: workspace}
+	if base != "" {
+		scanDiff = base + "...HEAD"
+		err := localFindings(&added, nil)
+		scanDiff = ""
+		if err != nil {
+			log.Warn().Err(err).Str("base", base).Msg("Failed to diff from base, reporting all markers as new; check out with fetch-depth: 0")
+			added.From = ""
+		}
+	}
+	if added.From == "" {
+		added.Findings = all.Findings
+		added.To = all.To
+	}
+
+	added.Findings, err = filterBaseline(added.Findings)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to apply baseline")
+	}
+
+	// IDs match those the marker store assigns to markers first seen by a sync of the repository
+	repo := ciRepoURL()
+	if repo == "" {
+		repo = all.Repo
+	}
+	(&Store{}).identify(repo, "", all.Findings)
+	ids := map[string]string{}
+	for _, f := range all.Findings {
+		ids[fmt.Sprintf("%s:%d", f.File, f.Line)] = f.ID
+	}
+	for i, f := range added.Findings {
+		added.Findings[i].ID = ids[fmt.Sprintf("%s:%d", f.File, f.Line)]
+	}
+	added.Repo = repo
+
+	if opts.Annotations {
+		printAnnotations(os.Stdout, added.Findings)
+	}
+
+	failed := failures(conditions, []ScanResult{added})
+
+	if opts.Summary {
+		if path := os.Getenv("GITHUB_STEP_SUMMARY"); path != "" {
+			if err := appendFile(path, func(w io.Writer) { writeCISummary(w, all, added, failed) }); err != nil {
+				log.Err(err).Msg("Failed to write job summary")
+			}
+		}
+	}
+
+	outputs := fmt.Sprintf("new_markers=%d\ntotal=%d\n", len(added.Findings), len(all.Findings))
+	if path := os.Getenv("GITHUB_OUTPUT"); path != "" {
+		if err := appendFile(path, func(w io.Writer) { io.WriteString(w, outputs) }); err != nil {
+			log.Err(err).Msg("Failed to set outputs")
+		}
+	}
+
+	log.Info().Int("new", len(added.Findings)).Int("total", len(all.Findings)).Str("base", added.From).Msg("Scanned workspace")
+
+	for _, reason := range failed {
+		log.Error().Str("condition", reason).Msg("Failure condition met")
+	}
+	if len(failed) > 0 {
+		os.Exit(failExitCode)
+	}
+}
+
+// appendFile appends what write writes to a file, as GitHub Actions expects of its command files
+func appendFile(path string, write func(io.Writer)) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	write(f)
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeCISummary writes the job summary: the count of each marker, the new markers and the failure conditions met
+func writeCISummary(w io.Writer, all, added ScanResult, failed []string) {
+	fmt.Fprintf(w, "## tr4ck\n\n")
+	fmt.Fprintf(w, "**%d** new markers", len(added.Findings))
+	if added.From != "" {
+		fmt.Fprintf(w, " since `%.7s`", added.From)
+	}
+	fmt.Fprintf(w, ", **%d** in total.\n", len(all.Findings))
+
+	totals, news := map[string]int{}, map[string]int{}
+	for _, f := range all.Findings {
+		totals[f.Marker]++
+	}
+	for _, f := range added.Findings {
+		news[f.Marker]++
+	}
+	if len(totals) > 0 {
+		names := make([]string, 0, len(totals))
+		for name := range totals {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if totals[names[i]] != totals[names[j]] {
+				return totals[names[i]] > totals[names[j]]
+			}
+			return names[i] < names[j]
+		})
+
+		fmt.Fprintf(w, "\n| Marker | New | Total |\n| --- | ---: | ---: |\n")
+		for _, name := range names {
+			fmt.Fprintf(w, "| %s | %d | %d |\n", markdownEscaper.Replace(name), news[name], totals[name])
+		}
+	}
+
+	if len(added.Findings) > 0 {
+		fmt.Fprintf(w, "\n### New markers\n\n")
+		for _, f := range added.Findings[:min(ciSummaryLimit, len(added.Findings))] {
+			location := fmt.Sprintf("`%s:%d`", f.File, f.Line)
+			if url := blobURL(added.Repo, added.To, f.File, f.Line); url != "" {
+				location = fmt.Sprintf("[%s:%d](%s)", markdownEscaper.Replace(f.File), f.Line, url)
+			}
+			fmt.Fprintf(w, "- %s **%s** %s", location, f.Marker, markdownEscaper.Replace(f.Text))
+			if f.ID != "" {
+				fmt.Fprintf(w, " `%s`", f.ID)
+			}
+			fmt.Fprintln(w)
+		}
+		if len(added.Findings) > ciSummaryLimit {
+			fmt.Fprintf(w, "- … and %d more\n", len(added.Findings)-ciSummaryLimit)
+		}
+	}
+
+	if len(failed) > 0 {
+		fmt.Fprintf(w, "\n### Failed\n\n")
+		for _, reason := range failed {
+			fmt.Fprintf(w, "- %s\n", markdownEscaper.Replace(reason))
+		}
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/rs/zerolog/log"
+)
+
+// codeownersFiles are the locations of CODEOWNERS read by GitHub, GitLab and Bitbucket, the first found wins
+var codeownersFiles = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS", ".bitbucket/CODEOWNERS"}
+
+// codeownersRule maps the paths matching a pattern to their owners, teams (@org/team), users (@user) or emails
+type codeownersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// Codeowners are the rules of a CODEOWNERS file, in file order
+type Codeowners []codeownersRule
+
+// parseCodeowners parses a CODEOWNERS file. Comments, GitLab section headers and invalid patterns are skipped.
+func parseCodeowners(data string) Codeowners {
+	var rules Codeowners
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "^[") {
+			continue
+		}
+		if comment := strings.Index(line, " #"); comment >= 0 {
+			line = line[:comment]
+		}
+
+		fields := strings.Fields(line)
+		pattern, err := codeownersPattern(fields[0])
+		if err != nil {
+			log.Debug().Err(err).Str("pattern", fields[0]).Msg("Skipping CODEOWNERS rule")
+			continue
+		}
+		rules = append(rules, codeownersRule{pattern: pattern, owners: fields[1:]})
+	}
+	return rules
+}
+
+// codeownersPattern compiles a gitignore-like pattern: patterns with a leading or inner / are relative to the
+// repository root and others match at any depth, * and ? do not match /, ** matches any number of directories,
+// and a pattern matching a directory matches the files below it
+func codeownersPattern(pattern string) (*regexp.Regexp, error) {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.Trim(pattern, "/")
+	if pattern == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			expr.WriteString("[^/]*")
+		case pattern[i] == '?':
+			expr.WriteString("[^/]")
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	if dirOnly {
+		expr.WriteString("/.*$")
+	} else {
+		expr.WriteString("(/.*)?$")
+	}
+	return regexp.Compile(expr.String())
+}
+
+// owners returns the owners of a file relative to the repository root: those of the last matching rule, as on
+// GitHub, none when it matches no rule or a rule without owners
+func (c Codeowners) owners(file string) []string {
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i].pattern.MatchString(file) {
+			return c[i].owners
+		}
+	}
+	return nil
+}
+
+// readCodeowners reads the CODEOWNERS of a commit, nil when it has none
+func readCodeowners(repo *git.Repository, hash string) (Codeowners, error) {
+	commit, err := repo.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", hash, err)
+	}
+
+	for _, path := range codeownersFiles {
+		f, err := commit.File(path)
+		if errors.Is(err, object.ErrFileNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", path, err)
+		}
+		data, err := f.Contents()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		return parseCodeowners(data), nil
+	}
+	return nil, nil
+}
+
+// assignOwners sets the owners of findings from the CODEOWNERS of commit hash. dir is the scanned directory,
+// relative to the repository root, that the paths of findings are relative to.
+func assignOwners(repo *git.Repository, hash, dir string, findings []Finding) {
+	if repo == nil || hash == "" || len(findings) == 0 {
+		return
+	}
+	codeowners, err := readCodeowners(repo, hash)
+	if err != nil {
+		log.Warn().Err(err).Msg("Ignoring CODEOWNERS")
+		return
+	}
+
+	for i := range findings {
+		file := findings[i].File
+		if dir != "" {
+			file = dir + "/" + file
+		}
+		findings[i].Owners = codeowners.owners(file)
+	}
+}
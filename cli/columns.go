@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/logrusorgru/aurora/v4"
+)
+
+var (
+	// tableColumns are the columns of the text output printed as a table, e.g. file,line,marker,age,author
+	tableColumns []string
+	// tableSort orders the findings of each repository in the text output, e.g. age
+	tableSort string
+)
+
+// columns are the columns available to --columns
+var columns = []string{
+	"id", "repo", "branch", "file", "line", "column", "marker", "text", "assignee", "priority", "due", "issues",
+	"owners", "author", "email", "commit", "date", "age",
+}
+
+// sortKeys are the orders available to --sort
+var sortKeys = []string{"file", "marker", "age", "author", "priority", "due"}
+
+// blameColumns are the columns and sort keys filled in by blame
+var blameColumns = []string{"author", "email", "commit", "date", "age"}
+
+// validateTable checks the --columns and --sort options
+func validateTable() error {
+	for _, column := range tableColumns {
+		if !slices.Contains(columns, column) {
+			return fmt.Errorf("unsupported column %s, expected one of %s", column, strings.Join(columns, ", "))
+		}
+	}
+	if tableSort != "" && !slices.Contains(sortKeys, tableSort) {
+		return fmt.Errorf("unsupported sort %s, expected one of %s", tableSort, strings.Join(sortKeys, ", "))
+	}
+	return nil
+}
+
+// tableNeedsBlame reports whether a column or the order of the text output comes from blame
+func tableNeedsBlame() bool {
+	if outputFormat != "text" {
+		return false
+	}
+	if slices.Contains(blameColumns, tableSort) {
+		return true
+	}
+	for _, column := range tableColumns {
+		if slices.Contains(blameColumns, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortFindings orders findings by key: file and line, marker, age (oldest first), author, priority or due date.
+// Findings missing the key come last.
+func sortFindings(findings []Finding, key string) {
+	now := time.Now()
+	less := func(a, b string) bool { return a != "" && (b == "" || a < b) }
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		switch key {
+		case "file":
+			if a.File != b.File {
+				return a.File < b.File
+			}
+			return a.Line < b.Line
+		case "marker":
+			return a.Marker < b.Marker
+		case "age":
+			ai, aok := a.age(now)
+			bi, bok := b.age(now)
+			return aok && (!bok || ai > bi)
+		case "author":
+			return less(a.Author, b.Author)
+		case "priority":
+			return less(a.Priority, b.Priority)
+		case "due":
+			return less(a.Due, b.Due)
+		}
+		return false
+	})
+}
+
+// columnValue returns the value of a column for a finding of result
+func columnValue(result ScanResult, f Finding, column string) string {
+	switch column {
+	case "id":
+		return f.ID
+	case "repo":
+		return result.Repo
+	case "branch":
+		return result.Branch
+	case "file":
+		return f.File
+	case "line":
+		return strconv.Itoa(f.Line)
+	case "column":
+		return strconv.Itoa(f.Column)
+	case "marker":
+		return f.Marker
+	case "text":
+		return f.Text
+	case "assignee":
+		return f.Assignee
+	case "priority":
+		return f.Priority
+	case "due":
+		return f.Due
+	case "issues":
+		return strings.Join(f.Issues, ",")
+	case "owners":
+		return strings.Join(f.Owners, ",")
+	case "author":
+		return f.Author
+	case "email":
+		return f.Email
+	case "commit":
+		if len(f.Commit) > 7 {
+			return f.Commit[:7]
+		}
+		return f.Commit
+	case "date":
+		if f.Date == nil {
+			return ""
+		}
+		return f.Date.Format("2006-01-02")
+	case "age":
+		return f.Age
+	}
+	return ""
+}
+
+// colorColumn colors a padded cell of a column
+func colorColumn(column, cell string) string {
+	switch column {
+	case "file":
+		return aurora.Blue(cell).String()
+	case "marker":
+		return aurora.BrightGreen(cell).String()
+	case "author", "email", "commit", "owners":
+		return aurora.Cyan(cell).String()
+	case "age", "date":
+		return aurora.Yellow(cell).String()
+	case "id", "repo", "branch":
+		return aurora.Gray(12, cell).String()
+	}
+	return cell
+}
+
+// printTable writes the findings of result as a table of tableColumns with a header. Cells are padded before
+// being colored, so that escape codes do not break the alignment.
+func printTable(w io.Writer, result ScanResult) {
+	rows := [][]string{}
+	for _, f := range result.Findings {
+		row := make([]string, len(tableColumns))
+		for i, column := range tableColumns {
+			row[i] = columnValue(result, f, column)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	widths := make([]int, len(tableColumns))
+	for i, column := range tableColumns {
+		widths[i] = len(column)
+		for _, row := range rows {
+			widths[i] = max(widths[i], len([]rune(row[i])))
+		}
+	}
+
+	pad := func(i int, cell string) string {
+		if i == len(widths)-1 {
+			return cell
+		}
+		return cell + strings.Repeat(" ", widths[i]-len([]rune(cell))+2)
+	}
+
+	var header strings.Builder
+	for i, column := range tableColumns {
+		header.WriteString(aurora.Bold(pad(i, strings.ToUpper(column))).String())
+	}
+	fmt.Fprintln(w, header.String())
+
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			line.WriteString(colorColumn(tableColumns[i], pad(i, cell)))
+		}
+		fmt.Fprintln(w, line.String())
+	}
+}
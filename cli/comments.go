@@ -0,0 +1,169 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// commentSyntax describes how comments and string literals are written in a language
+type commentSyntax struct {
+	line  []string
+	block [][2]string
+	// quotes are the string literal delimiters; markers inside literals are not comments
+	quotes string
+}
+
+var (
+	cSyntax      = &commentSyntax{line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: `"'`}
+	jsSyntax     = &commentSyntax{line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: "\"'`"}
+	rustSyntax   = &commentSyntax{line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: `"`}
+	hashSyntax   = &commentSyntax{line: []string{"#"}, quotes: `"'`}
+	pythonSyntax = &commentSyntax{line: []string{"#"}, block: [][2]string{{`"""`, `"""`}, {"'''", "'''"}}, quotes: `"'`}
+	sqlSyntax    = &commentSyntax{line: []string{"--"}, block: [][2]string{{"/*", "*/"}}, quotes: `'"`}
+	luaSyntax    = &commentSyntax{line: []string{"--"}, block: [][2]string{{"--[[", "]]"}}, quotes: `"'`}
+	haskellSyn   = &commentSyntax{line: []string{"--"}, block: [][2]string{{"{-", "-}"}}, quotes: `"`}
+	lispSyntax   = &commentSyntax{line: []string{";"}, quotes: `"`}
+	iniSyntax    = &commentSyntax{line: []string{";", "#"}}
+	texSyntax    = &commentSyntax{line: []string{"%"}}
+	markupSyntax = &commentSyntax{block: [][2]string{{"<!--", "-->"}}}
+	cssSyntax    = &commentSyntax{block: [][2]string{{"/*", "*/"}}, quotes: `"'`}
+	scssSyntax   = &commentSyntax{line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: `"'`}
+	phpSyntax    = &commentSyntax{line: []string{"//", "#"}, block: [][2]string{{"/*", "*/"}}, quotes: `"'`}
+	hclSyntax    = &commentSyntax{line: []string{"#", "//"}, block: [][2]string{{"/*", "*/"}}, quotes: `"`}
+)
+
+// commentSyntaxes maps file extensions to their comment syntax
+var commentSyntaxes = map[string]*commentSyntax{
+	".c": cSyntax, ".h": cSyntax, ".cc": cSyntax, ".cpp": cSyntax, ".hpp": cSyntax, ".cxx": cSyntax,
+	".go": jsSyntax, ".java": cSyntax, ".cs": cSyntax, ".swift": cSyntax, ".kt": cSyntax, ".kts": cSyntax,
+	".scala": cSyntax, ".dart": cSyntax, ".groovy": cSyntax, ".proto": cSyntax, ".m": cSyntax,
+	".js": jsSyntax, ".jsx": jsSyntax, ".mjs": jsSyntax, ".cjs": jsSyntax, ".ts": jsSyntax, ".tsx": jsSyntax,
+	".rs": rustSyntax,
+	".py": pythonSyntax,
+	".rb": hashSyntax, ".sh": hashSyntax, ".bash": hashSyntax, ".zsh": hashSyntax, ".pl": hashSyntax,
+	".r": hashSyntax, ".toml": hashSyntax, ".cmake": hashSyntax, ".ps1": hashSyntax, ".nix": hashSyntax,
+	".ex": hashSyntax, ".exs": hashSyntax, ".mk": hashSyntax,
+	".tf": hclSyntax, ".hcl": hclSyntax,
+	".php": phpSyntax,
+	".sql": sqlSyntax, ".lua": luaSyntax, ".hs": haskellSyn, ".elm": haskellSyn,
+	".lisp": lispSyntax, ".clj": lispSyntax, ".cljs": lispSyntax, ".el": lispSyntax, ".scm": lispSyntax, ".asm": lispSyntax,
+	".ini": iniSyntax, ".cfg": iniSyntax, ".conf": iniSyntax,
+	".tex": texSyntax, ".erl": texSyntax,
+	".xml": markupSyntax, ".svg": markupSyntax, ".md": markupSyntax, ".vue": markupSyntax, ".xhtml": markupSyntax,
+	".css": cssSyntax, ".scss": scssSyntax, ".less": scssSyntax,
+}
+
+// languageExtensions maps language names to their file extensions
+var languageExtensions = map[string][]string{
+	"c": {".c", ".h"}, "cpp": {".cc", ".cpp", ".hpp", ".cxx"}, "c++": {".cc", ".cpp", ".hpp", ".cxx"},
+	"csharp": {".cs"}, "c#": {".cs"}, "go": {".go"}, "java": {".java"}, "kotlin": {".kt", ".kts"},
+	"swift": {".swift"}, "scala": {".scala"}, "dart": {".dart"},
+	"javascript": {".js", ".jsx", ".mjs", ".cjs"}, "typescript": {".ts", ".tsx"},
+	"rust": {".rs"}, "python": {".py"}, "ruby": {".rb"}, "php": {".php"}, "perl": {".pl"},
+	"shell": {".sh", ".bash", ".zsh"}, "powershell": {".ps1"}, "terraform": {".tf", ".hcl"},
+	"sql": {".sql"}, "lua": {".lua"}, "haskell": {".hs"}, "elixir": {".ex", ".exs"},
+	"css": {".css", ".scss", ".less"}, "markdown": {".md"}, "xml": {".xml"},
+}
+
+// commentSyntaxNames maps extension-less file names to their comment syntax
+var commentSyntaxNames = map[string]*commentSyntax{
+	"Makefile":    hashSyntax,
+	"Dockerfile":  hashSyntax,
+	"Jenkinsfile": cSyntax,
+	"Rakefile":    hashSyntax,
+	"Gemfile":     hashSyntax,
+}
+
+// commentSyntaxFor returns the comment syntax of the file or nil when the language is unknown
+func commentSyntaxFor(file string) *commentSyntax {
+	if syntax, ok := commentSyntaxNames[filepath.Base(file)]; ok {
+		return syntax
+	}
+	return commentSyntaxes[strings.ToLower(filepath.Ext(file))]
+}
+
+// commentState carries an open block comment from one line to the next
+type commentState struct {
+	syntax *commentSyntax
+	// block is the index of the open block comment delimiter or -1
+	block int
+}
+
+func newCommentState(syntax *commentSyntax) *commentState {
+	return &commentState{syntax: syntax, block: -1}
+}
+
+// commentRanges returns the [start, end) byte ranges of line that are inside comments
+func (s *commentState) commentRanges(line string) [][2]int {
+	var ranges [][2]int
+
+	i := 0
+	if s.block >= 0 {
+		end := s.syntax.block[s.block][1]
+		idx := strings.Index(line, end)
+		if idx < 0 {
+			return [][2]int{{0, len(line)}}
+		}
+		i = idx + len(end)
+		ranges = append(ranges, [2]int{0, i})
+		s.block = -1
+	}
+
+	var quote byte
+	for i < len(line) {
+		if quote != 0 {
+			switch line[i] {
+			case '\\':
+				i++
+			case quote:
+				quote = 0
+			}
+			i++
+			continue
+		}
+
+		// block delimiters first so that --[[ and /* win over line comments
+		opened := false
+		for bi, b := range s.syntax.block {
+			if !strings.HasPrefix(line[i:], b[0]) {
+				continue
+			}
+			opened = true
+			start := i
+			idx := strings.Index(line[i+len(b[0]):], b[1])
+			if idx < 0 {
+				s.block = bi
+				return append(ranges, [2]int{start, len(line)})
+			}
+			i += len(b[0]) + idx + len(b[1])
+			ranges = append(ranges, [2]int{start, i})
+			break
+		}
+		if opened {
+			continue
+		}
+
+		for _, l := range s.syntax.line {
+			if strings.HasPrefix(line[i:], l) {
+				return append(ranges, [2]int{i, len(line)})
+			}
+		}
+
+		if strings.IndexByte(s.syntax.quotes, line[i]) >= 0 {
+			quote = line[i]
+		}
+		i++
+	}
+
+	return ranges
+}
+
+// inRanges reports whether the byte offset falls within one of the ranges
+func inRanges(ranges [][2]int, offset int) bool {
+	for _, r := range ranges {
+		if offset >= r[0] && offset < r[1] {
+			return true
+		}
+	}
+	return false
+}
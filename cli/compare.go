@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// MarkerComparison is the difference between the markers of a repository at two commits
+type MarkerComparison struct {
+	Repo string `json:"repo"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Source is where the markers of each commit come from: snapshot or scan
+	FromSource string         `json:"from_source"`
+	ToSource   string         `json:"to_source"`
+	Added      []Finding      `json:"added"`
+	Removed    []Finding      `json:"removed"`
+	Moved      []MarkerChange `json:"moved"`
+	Changed    []MarkerChange `json:"changed"`
+}
+
+// MarkerChange is a marker at two commits, with its location or text changed
+type MarkerChange struct {
+	From Finding `json:"from"`
+	To   Finding `json:"to"`
+}
+
+// compare reconciles the markers of two commits, see reconcile: matches that moved to another file or line are
+// moved, the others whose text was edited are changed
+func compare(from, to []Finding) (c MarkerComparison) {
+	matches, added, removed := reconcile(from, to, true)
+	c.Added, c.Removed, c.Moved, c.Changed = []Finding{}, []Finding{}, []MarkerChange{}, []MarkerChange{}
+
+	for _, i := range added {
+		c.Added = append(c.Added, to[i])
+	}
+	for _, i := range removed {
+		c.Removed = append(c.Removed, from[i])
+	}
+	for _, match := range matches {
+		a, b := from[match.prev], to[match.cur]
+		if a.File != b.File || a.Line != b.Line {
+			c.Moved = append(c.Moved, MarkerChange{a, b})
+		} else if a.Text != b.Text {
+			c.Changed = append(c.Changed, MarkerChange{a, b})
+		}
+	}
+	return c
+}
+
+// snapshotFindings returns the markers of the snapshot of a repository at a commit, given by its hash or a prefix
+func (s *Store) snapshotFindings(uri, revision string) (string, []Finding, bool) {
+	if !revisionPrefix.MatchString(revision) {
+		return "", nil, false
+	}
+	snapshots, err := s.loadSnapshots("revision LIKE ?", revision+"%")
+	if err != nil {
+		log.Err(err).Msg("Failed to load snapshots")
+		return "", nil, false
+	}
+	for _, snapshot := range snapshots {
+		if sameURI(snapshot.Repo, uri) && len(snapshot.Revision) >= len(revision) && snapshot.Revision[:len(revision)] == revision {
+			findings := make([]Finding, len(snapshot.Markers))
+			for i, m := range snapshot.Markers {
+				findings[i] = Finding{ID: m.ID, File: m.File, Line: m.Line, Marker: m.Marker, Text: m.Text}
+			}
+			return snapshot.Revision, findings, true
+		}
+	}
+	return "", nil, false
+}
+
+// openCompareRepo opens a local repository in place, or clones a registered or remote one
+func openCompareRepo(uri string, record *RegistryRecord) (*git.Repository, error) {
+	if isLocalDir(uri) {
+		root, err := filepath.Abs(expandHome(uri))
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve local path: %w", err)
+		}
+		repo, err := git.PlainOpenWithOptions(root, &git.PlainOpenOptions{DetectDotGit: true})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open repository: %w", err)
+		}
+		return repo, nil
+	}
+
+	if record != nil {
+		return cloneRepo(record)
+	}
+
+	rootHash, err := getRootHashFromFirstCommit(uri)
+	if err != nil {
+		log.Err(err).Msg("Failed to get root commit hash")
+	}
+	return cloneRepo(&RegistryRecord{RootHash: rootHash, URI: uri})
+}
+
+// runCompare prints the markers added, removed, moved and changed in a repository between two commits. The
+// markers of each commit come from the snapshots kept by sync, or else from a scan of its tree.
+func runCompare(uri, from, to, format string) {
+	if format != "text" && format != "json" && format != "porcelain" {
+		log.Fatal().Str("format", format).Msg("Invalid --format, expected text, json or porcelain")
+	}
+
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load marker store")
+	}
+
+	revisions := []string{from, to}
+	sources := []string{"snapshot", "snapshot"}
+	findings := make([][]Finding, 2)
+	var repo *git.Repository
+	record, _ := findRecord(uri)
+
+	for i, rev := range revisions {
+		if hash, snapshot, ok := store.snapshotFindings(uri, rev); ok {
+			revisions[i], findings[i] = hash, snapshot
+			continue
+		}
+
+		if repo == nil {
+			if repo, err = openCompareRepo(uri, record); err != nil {
+				log.Fatal().Err(err).Str("uri", uri).Msg("Failed to open repository")
+			}
+		}
+		commit, err := resolveRef(repo, rev)
+		if err != nil {
+			log.Fatal().Err(err).Str("uri", uri).Msg("Failed to resolve ref")
+		}
+
+		// a ref may name a synced commit
+		if hash, snapshot, ok := store.snapshotFindings(uri, commit.Hash.String()); ok {
+			revisions[i], findings[i] = hash, snapshot
+			continue
+		}
+
+		restore := applyRepoConfig(readRepoConfig(repo, commit.Hash.String()))
+		scanMarkers, scanPaths := scanSettings(record)
+		scanned, err := scanTree(commit, scanMarkers, scanPaths)
+		restore()
+		if err != nil {
+			log.Fatal().Err(err).Str("uri", uri).Str("ref", rev).Msg("Failed to list files with markers")
+		}
+		branch := ""
+		if record != nil {
+			branch = record.Branch
+		}
+		store.identify(uri, branch, scanned)
+		revisions[i], findings[i], sources[i] = commit.Hash.String(), scanned, "scan"
+	}
+
+	comparison := compare(findings[0], findings[1])
+	comparison.Repo = uri
+	comparison.From, comparison.To = revisions[0], revisions[1]
+	comparison.FromSource, comparison.ToSource = sources[0], sources[1]
+
+	switch format {
+	case "json":
+		PrintStruct(os.Stdout, comparison)
+	case "porcelain":
+		printComparisonPorcelain(os.Stdout, comparison)
+	default:
+		printComparison(os.Stdout, comparison)
+	}
+}
+
+// printComparison writes a summary line followed by a line per added, removed, moved and changed marker
+func printComparison(w io.Writer, c MarkerComparison) {
+	fmt.Fprintf(w, "%s %.7s..%.7s: %d added, %d removed, %d moved, %d changed\n", aurora.Gray(12, c.Repo), c.From, c.To,
+		len(c.Added), len(c.Removed), len(c.Moved), len(c.Changed))
+
+	for _, f := range c.Added {
+		fmt.Fprintf(w, "%s %s %s:%d\t%s\t%s\n", aurora.Green("+"), aurora.Gray(12, f.ID), aurora.Blue(f.File), f.Line, aurora.BrightGreen(f.Marker), f.Text)
+	}
+	for _, f := range c.Removed {
+		fmt.Fprintf(w, "%s %s %s:%d\t%s\t%s\n", aurora.Red("-"), aurora.Gray(12, f.ID), aurora.Blue(f.File), f.Line, aurora.BrightGreen(f.Marker), f.Text)
+	}
+	for _, m := range c.Moved {
+		fmt.Fprintf(w, "%s %s %s:%d -> %s:%d\t%s\t%s\n", aurora.Yellow(">"), aurora.Gray(12, m.To.ID), aurora.Blue(m.From.File), m.From.Line,
+			aurora.Blue(m.To.File), m.To.Line, aurora.BrightGreen(m.To.Marker), m.To.Text)
+	}
+	for _, m := range c.Changed {
+		fmt.Fprintf(w, "%s %s %s:%d\t%s\t%s -> %s\n", aurora.Yellow("~"), aurora.Gray(12, m.To.ID), aurora.Blue(m.To.File), m.To.Line,
+			aurora.BrightGreen(m.To.Marker), m.From.Text, m.To.Text)
+	}
+}
+
+// printComparisonPorcelain writes a tab-separated line per marker: added|removed|moved|changed, ID, file, line,
+// marker and text at the second commit, or at the first for removed markers, then the previous file, line and text
+// of moved and changed markers
+func printComparisonPorcelain(w io.Writer, c MarkerComparison) {
+	for _, f := range c.Added {
+		fmt.Fprintf(w, "added\t%s\t%s\t%d\t%s\t%s\n", f.ID, f.File, f.Line, f.Marker, porcelainField(f.Text))
+	}
+	for _, f := range c.Removed {
+		fmt.Fprintf(w, "removed\t%s\t%s\t%d\t%s\t%s\n", f.ID, f.File, f.Line, f.Marker, porcelainField(f.Text))
+	}
+	for i, changes := range [][]MarkerChange{c.Moved, c.Changed} {
+		kind := []string{"moved", "changed"}[i]
+		for _, m := range changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%d\t%s\n", kind, m.To.ID, m.To.File, m.To.Line, m.To.Marker, porcelainField(m.To.Text),
+				m.From.File, m.From.Line, porcelainField(m.From.Text))
+		}
+	}
+}
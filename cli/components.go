@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
+)
+
+// componentsPath is the file mapping paths to components for report --by component
+var componentsPath string
+
+// Component maps the files matching any of its paths to a name. Paths are globs where * also matches /.
+type Component struct {
+	Name  string   `yaml:"name"`
+	Paths []string `yaml:"paths"`
+}
+
+// ComponentGroup is the number of findings of a component, or owner, of a repository, in total and by marker
+type ComponentGroup struct {
+	Repo      string  `json:"repo"`
+	Component string  `json:"component"`
+	Count     int     `json:"count"`
+	ByMarker  []Count `json:"by_marker"`
+}
+
+// OwnerGroup is the number of findings of a CODEOWNERS owner of a repository, in total and by marker
+type OwnerGroup struct {
+	Repo     string  `json:"repo"`
+	Owner    string  `json:"owner"`
+	Count    int     `json:"count"`
+	ByMarker []Count `json:"by_marker"`
+}
+
+// loadComponents reads a component mapping file, a list of components tried in order
+func loadComponents(path string) ([]Component, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read components %s: %w", path, err)
+	}
+
+	var components []Component
+	if err := yaml.Unmarshal(data, &components); err != nil {
+		return nil, fmt.Errorf("failed to parse components %s: %w", path, err)
+	}
+
+	return components, nil
+}
+
+// componentOf returns the first component with a path matching file, or else the top-level directory of file,
+// . for files at the root
+func componentOf(components []Component, file string) string {
+	for _, c := range components {
+		for _, pattern := range c.Paths {
+			if globMatch(pattern, file) {
+				return c.Name
+			}
+		}
+	}
+
+	if dir, _, ok := strings.Cut(file, "/"); ok {
+		return dir
+	}
+	return "."
+}
+
+// groupByComponent counts the findings of each component of each repository, components with the most first
+func groupByComponent(results []ScanResult, components []Component) []ComponentGroup {
+	return groupFindings(results, func(f Finding) []string {
+		return []string{componentOf(components, f.File)}
+	})
+}
+
+// groupByOwner counts the findings of each CODEOWNERS owner of each repository, owners with the most first.
+// Findings with several owners count for each, and findings without any are grouped under unowned.
+func groupByOwner(results []ScanResult) []ComponentGroup {
+	return groupFindings(results, func(f Finding) []string {
+		if len(f.Owners) == 0 {
+			return []string{"unowned"}
+		}
+		return f.Owners
+	})
+}
+
+// groupFindings counts the findings of each group of each repository, as returned by groups, largest first
+func groupFindings(results []ScanResult, groups func(Finding) []string) []ComponentGroup {
+	type key struct{ repo, component string }
+	counts := map[key]map[string]int{}
+	for _, result := range results {
+		for _, f := range result.Findings {
+			for _, group := range groups(f) {
+				k := key{result.title(), group}
+				if counts[k] == nil {
+					counts[k] = map[string]int{}
+				}
+				counts[k][f.Marker]++
+			}
+		}
+	}
+
+	var rollup []ComponentGroup
+	for k, markers := range counts {
+		group := ComponentGroup{Repo: k.repo, Component: k.component, ByMarker: []Count{}}
+		for marker, n := range markers {
+			group.Count += n
+			group.ByMarker = append(group.ByMarker, Count{Name: marker, Count: n})
+		}
+		sortCounts(group.ByMarker)
+		rollup = append(rollup, group)
+	}
+
+	sort.Slice(rollup, func(i, j int) bool {
+		if rollup[i].Count != rollup[j].Count {
+			return rollup[i].Count > rollup[j].Count
+		}
+		if rollup[i].Repo != rollup[j].Repo {
+			return rollup[i].Repo < rollup[j].Repo
+		}
+		return rollup[i].Component < rollup[j].Component
+	})
+
+	return rollup
+}
+
+// runComponentReport scans like report and prints the findings rolled up by component, or by CODEOWNERS owner
+// when by is owner
+func runComponentReport(uris []string, by string) {
+	format := outputFormat
+	if format != "markdown" && format != "text" && format != "json" && format != "porcelain" {
+		log.Fatal().Str("format", format).Msgf("Invalid --format, --by %s supports markdown, text, json and porcelain", by)
+	}
+
+	var components []Component
+	if componentsPath != "" && by == "component" {
+		var err error
+		components, err = loadComponents(expandHome(componentsPath))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load components")
+		}
+	}
+
+	var results []ScanResult
+	scanAll(uris, func(result ScanResult) {
+		results = append(results, result)
+	})
+	groups := groupByComponent(results, components)
+	if by == "owner" {
+		groups = groupByOwner(results)
+	}
+
+	var w io.Writer = os.Stdout
+	f, err := openOutput()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open output")
+	}
+	if f != nil {
+		defer f.Close()
+		w = f
+	}
+
+	switch format {
+	case "json":
+		if by == "owner" {
+			owners := []OwnerGroup{}
+			for _, group := range groups {
+				owners = append(owners, OwnerGroup{Repo: group.Repo, Owner: group.Component, Count: group.Count, ByMarker: group.ByMarker})
+			}
+			PrintStruct(w, owners)
+			break
+		}
+		if groups == nil {
+			groups = []ComponentGroup{}
+		}
+		PrintStruct(w, groups)
+	case "markdown":
+		writeComponentMarkdown(w, groups, by)
+	case "text":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, group := range groups {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", group.Count, aurora.Cyan(group.Component), aurora.Gray(12, group.Repo), markerCounts(group.ByMarker))
+		}
+		tw.Flush()
+	case "porcelain":
+		// repository, component or owner, marker and count
+		for _, group := range groups {
+			for _, c := range group.ByMarker {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", group.Repo, group.Component, c.Name, c.Count)
+			}
+		}
+	}
+}
+
+// markerCounts formats counts by marker, e.g. TODO 3, FIXME 1
+func markerCounts(counts []Count) string {
+	parts := make([]string, len(counts))
+	for i, c := range counts {
+		parts[i] = fmt.Sprintf("%s %d", c.Name, c.Count)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// writeComponentMarkdown writes a table of the components, or owners, with the most markers
+func writeComponentMarkdown(w io.Writer, groups []ComponentGroup, by string) {
+	fmt.Fprintf(w, "# tr4ck report by %s\n\n", by)
+	fmt.Fprintf(w, "Generated %s, %d %ss.\n\n", time.Now().UTC().Format("2006-01-02 15:04 MST"), len(groups), by)
+	fmt.Fprintf(w, "| %s | Repository | Markers | By marker |\n", strings.ToUpper(by[:1])+by[1:])
+	fmt.Fprintln(w, "|---|---|---:|---|")
+	for _, group := range groups {
+		fmt.Fprintf(w, "| %s | %s | %d | %s |\n", markdownEscaper.Replace(group.Component), markdownEscaper.Replace(group.Repo), group.Count, markdownEscaper.Replace(markerCounts(group.ByMarker)))
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// daemonAddr is the address the daemon serves metrics, feeds, calendars, webhooks and the web UI on, none when
+	// empty
+	daemonAddr string
+	// scanMu serializes the scans of the daemon, which share global settings
+	scanMu sync.Mutex
+)
+
+// runDaemon syncs the registry until interrupted, each record on its schedule or else every interval, serving
+// metrics, feeds, calendars, webhooks and the web UI on daemonAddr if set
+func runDaemon(interval time.Duration) {
+	if interval <= 0 {
+		log.Fatal().Dur("interval", interval).Msg("Invalid --interval, expected a positive duration")
+	}
+	if _, err := configureReporter(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid output options")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	metrics.record(nil, nil)
+	if daemonAddr != "" {
+		auth, err := newAuthenticator(authConfig)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid auth config")
+		}
+		// anyone reaching the address could trigger syncs otherwise
+		readOnly := auth == nil && !isLoopback(daemonAddr)
+		if readOnly {
+			log.Warn().Str("addr", daemonAddr).Msg("Serving without authentication beyond localhost, the web UI can not trigger syncs; see the auth config")
+		} else if auth == nil {
+			log.Warn().Msg("Serving without authentication, see the auth config")
+		}
+
+		// webhooks are authenticated by their signatures
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", auth.require(scopeRead, metrics))
+		mux.Handle("/feed.atom", auth.require(scopeRead, http.HandlerFunc(serveFeed)))
+		mux.Handle("/calendar.ics", auth.require(scopeRead, http.HandlerFunc(serveCalendar)))
+		(&uiServer{auth: auth, readOnly: readOnly, syncing: map[string]bool{}}).handle(mux)
+		if receiverConfig != nil {
+			rc, err := newReceiver(*receiverConfig)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Invalid receiver config")
+			}
+			rc.handle(mux)
+			go rc.run(ctx)
+		}
+		server := &http.Server{Addr: daemonAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal().Err(err).Str("addr", daemonAddr).Msg("Failed to serve")
+			}
+		}()
+		defer server.Close()
+		log.Info().Str("addr", daemonAddr).Msg("Serving metrics, feeds, calendars and the web UI")
+	} else if receiverConfig != nil {
+		log.Warn().Msg("Ignoring the receiver config, webhooks require --addr")
+	}
+
+	scheduler := newSyncScheduler(interval)
+	for first := true; ; first = false {
+		records, err := loadRegistry()
+		if err != nil {
+			log.Err(err).Msg("Failed to load registry")
+		} else if due := scheduler.due(*records, time.Now()); len(due) > 0 {
+			// the registry remote is only fetched once per command otherwise
+			if !first {
+				preRunRemoteRegistry()
+			}
+			syncOnce(func(record RegistryRecord) bool { return due[recordKey(record)] })
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Stopping")
+			return
+		case <-time.After(time.Until(scheduler.wake(time.Now()))):
+		}
+	}
+}
+
+// syncOnce runs a sync of the daemon or API server, of the records matching only when set, logging failures
+// instead of exiting, and updates the metrics
+func syncOnce(only func(RegistryRecord) bool) (*SyncRun, error) {
+	scanMu.Lock()
+	defer scanMu.Unlock()
+	return syncLocked(only)
+}
+
+// syncLocked runs syncOnce, the caller holding scanMu
+func syncLocked(only func(RegistryRecord) bool) (*SyncRun, error) {
+	out, err := newReporter()
+	if err != nil {
+		err = fmt.Errorf("invalid output options: %w", err)
+		log.Err(err).Msg("Failed to sync")
+		return nil, err
+	}
+
+	run, err := syncRegistry(out, only)
+	if err != nil {
+		log.Err(err).Msg("Failed to sync")
+	}
+	if err := out.close(); err != nil {
+		log.Err(err).Msg("Failed to print report")
+	}
+
+	metrics.record(run, err)
+	if metricsTextfile != "" {
+		if err := metrics.writeTextfile(metricsTextfile); err != nil {
+			log.Err(err).Msg("Failed to write metrics")
+		}
+	}
+	log.Info().Int("repos", len(run.Repos)).Dur("duration", run.Duration).Msg("Synced")
+	return run, err
+}
+
+// isLoopback reports whether addr only listens on the loopback interface, e.g. localhost:9090 but not :9090
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	_ "modernc.org/sqlite"
+)
+
+// dbVersion is the schema version of the database, kept in its user_version
+const dbVersion = 2
+
+var (
+	// dbs are the databases opened, by path, kept open for the life of the process so that the scans and requests
+	// of the daemon and API server share them
+	dbs   = map[string]*sql.DB{}
+	dbsMu sync.Mutex
+)
+
+// dbSchema creates the tables of the database. Rows hold the JSON document of a marker, snapshot, findings state
+// of a record, history snapshot or stats, with the columns they are looked up by. Times are Unix nanoseconds.
+// The version of a marker row is incremented by each update, so that concurrent updates are detected.
+var dbSchema = []string{
+	`CREATE TABLE markers (
+		id INTEGER PRIMARY KEY,
+		repo TEXT NOT NULL,
+		branch TEXT NOT NULL,
+		marker_id TEXT NOT NULL,
+		state TEXT NOT NULL,
+		data TEXT NOT NULL,
+		version INTEGER NOT NULL DEFAULT 0
+	)`,
+	"CREATE INDEX markers_repo ON markers (repo, branch)",
+	"CREATE INDEX markers_id ON markers (marker_id)",
+	`CREATE TABLE snapshots (
+		repo TEXT NOT NULL,
+		branch TEXT NOT NULL,
+		revision TEXT NOT NULL,
+		date INTEGER NOT NULL,
+		time INTEGER NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (repo, branch, revision)
+	)`,
+	"CREATE INDEX snapshots_revision ON snapshots (revision)",
+	"CREATE INDEX snapshots_time ON snapshots (time)",
+	"CREATE TABLE findings (record TEXT PRIMARY KEY, data TEXT NOT NULL)",
+	"CREATE TABLE history (time INTEGER NOT NULL, data TEXT NOT NULL)",
+	"CREATE INDEX history_time ON history (time)",
+	"CREATE TABLE stats (id INTEGER PRIMARY KEY CHECK (id = 1), data TEXT NOT NULL)",
+}
+
+// dbUpgrades upgrade a database from the schema version they are keyed by to the next one
+var dbUpgrades = map[int][]string{
+	1: {"ALTER TABLE markers ADD COLUMN version INTEGER NOT NULL DEFAULT 0"},
+}
+
+// dbExecer runs statements on a database or in a transaction
+type dbExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// storeFilePath returns the database of the marker store, findings state, history and stats, in a .tr4ck
+// directory next to the registry unless set in the config, e.g. ~/.tr4ck/tr4ck.db
+func storeFilePath() string {
+	if storePath != "" {
+		return expandHome(storePath)
+	}
+	name := strings.TrimPrefix(strings.TrimSuffix(filepath.Base(registryFilePath), ".registry"), ".")
+	return filepath.Join(filepath.Dir(registryFilePath), ".tr4ck", name+".db")
+}
+
+// storeDB opens the database of the registry, see storeFilePath
+func storeDB() (*sql.DB, error) {
+	return openDB(storeFilePath())
+}
+
+// openDB opens the database at path, creating it and its directory if needed
+func openDB(path string) (*sql.DB, error) {
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	if db, ok := dbs[path]; ok {
+		return db, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+	// other processes, such as a sync run while the daemon is running, wait for the writes of each other
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read database %s: %w", path, err)
+	}
+	if version > dbVersion {
+		db.Close()
+		return nil, fmt.Errorf("unsupported database version %d, upgrade tr4ck", version)
+	}
+	if version == 0 {
+		if err := createDB(db); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create database %s: %w", path, err)
+		}
+	} else if version < dbVersion {
+		if err := upgradeDB(db, version); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to upgrade database %s: %w", path, err)
+		}
+	}
+
+	dbs[path] = db
+	return db, nil
+}
+
+// createDB creates the tables of a new database in a transaction
+func createDB(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, statement := range dbSchema {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("failed to create tables: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", dbVersion)); err != nil {
+		return fmt.Errorf("failed to set database version: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit database: %w", err)
+	}
+	return nil
+}
+
+// upgradeDB upgrades the tables of a database from version to the current one in a transaction
+func upgradeDB(db *sql.DB, version int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for ; version < dbVersion; version++ {
+		for _, statement := range dbUpgrades[version] {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("failed to upgrade tables from version %d: %w", version, err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", dbVersion)); err != nil {
+		return fmt.Errorf("failed to set database version: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// resolveRange resolves base..head, or base...head to diff from their merge base, to a pair of commits
+func resolveRange(repo *git.Repository, spec string) (*object.Commit, *object.Commit, error) {
+	sep := "..."
+	base, head, ok := strings.Cut(spec, sep)
+	if !ok {
+		sep = ".."
+		base, head, ok = strings.Cut(spec, sep)
+	}
+	if !ok || base == "" || head == "" {
+		return nil, nil, fmt.Errorf("invalid range %s, expected base..head", spec)
+	}
+
+	baseCommit, err := resolveRef(repo, base)
+	if err != nil {
+		return nil, nil, err
+	}
+	headCommit, err := resolveRef(repo, head)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if sep == "..." {
+		bases, err := baseCommit.MergeBase(headCommit)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to find merge base of %s: %w", spec, err)
+		}
+		if len(bases) == 0 {
+			return nil, nil, fmt.Errorf("no merge base for %s", spec)
+		}
+		baseCommit = bases[0]
+	}
+
+	return baseCommit, headCommit, nil
+}
+
+// addedLines returns the line numbers added between base and head, by file at head
+func addedLines(base, head *object.Commit) (map[string]map[int]bool, error) {
+	patch, err := base.Patch(head)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate patch: %w", err)
+	}
+
+	added := make(map[string]map[int]bool)
+	for _, filePatch := range patch.FilePatches() {
+		_, to := filePatch.Files()
+		if to == nil || filePatch.IsBinary() {
+			continue
+		}
+
+		// line numbers in the head version of the file
+		line := 1
+		for _, chunk := range filePatch.Chunks() {
+			n := chunkLines(chunk.Content())
+			switch chunk.Type() {
+			case fdiff.Equal:
+				line += n
+			case fdiff.Add:
+				if added[to.Path()] == nil {
+					added[to.Path()] = make(map[int]bool)
+				}
+				for i := 0; i < n; i++ {
+					added[to.Path()][line+i] = true
+				}
+				line += n
+			}
+		}
+	}
+
+	return added, nil
+}
+
+// chunkLines counts the lines of a chunk, whose last line may not end with a newline
+func chunkLines(content string) int {
+	n := strings.Count(content, "\n")
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		n++
+	}
+	return n
+}
+
+// scanRange lists the marker occurrences on lines added between base and head. Files are scanned as a whole
+// at head, so comment detection and metadata behave as in a full scan.
+func scanRange(base, head *object.Commit, markers []string, paths pathFilter) ([]Finding, error) {
+	added, err := addedLines(base, head)
+	if err != nil {
+		return nil, err
+	}
+
+	matcher := newMarkerMatcher(markers)
+
+	files := make([]string, 0, len(added))
+	for file := range added {
+		files = append(files, file)
+	}
+	slices.Sort(files)
+
+	var findings []Finding
+	for _, file := range files {
+		f, err := head.File(file)
+		// submodule commits are not files
+		if errors.Is(err, object.ErrFileNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s at %s: %w", file, head.Hash, err)
+		}
+
+		hits, err := scanBlob(f, matcher, paths)
+		if err != nil {
+			return nil, err
+		}
+		for _, hit := range hits {
+			if added[file][hit.Line] {
+				findings = append(findings, hit)
+			}
+		}
+	}
+
+	return findings, nil
+}
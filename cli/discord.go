@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// discordConfig is the discord section of the config, nil when sync digests are not posted to Discord
+var discordConfig *DiscordConfig
+
+const (
+	// discordEmbedsPerMessage is the most embeds a Discord message holds
+	discordEmbedsPerMessage = 10
+	// discordDescriptionLimit is the most characters of an embed description
+	discordDescriptionLimit = 4096
+)
+
+// embed colors of repositories with overdue, new, and only resolved markers
+const (
+	discordRed    = 0xe74c3c
+	discordOrange = 0xe67e22
+	discordGreen  = 0x2ecc71
+)
+
+// DiscordConfig posts the new and resolved markers of each repository synced to Discord webhooks
+type DiscordConfig struct {
+	// WebhookURL is a channel webhook, DISCORD_WEBHOOK_URL when empty
+	WebhookURL string `yaml:"webhook_url"`
+	// Username overrides the name of the webhook, tr4ck by default
+	Username string `yaml:"username"`
+	// Routes send the repositories with one of their labels, or the markers with one of their owners, to another
+	// webhook, the first matching route wins
+	Routes []DiscordRoute `yaml:"routes"`
+	// Limit caps the markers listed per section of a repository, 10 by default
+	Limit int `yaml:"limit"`
+}
+
+// DiscordRoute is a webhook for the repositories with one of the labels and the markers of files with one of the
+// CODEOWNERS owners
+type DiscordRoute struct {
+	Labels     []string `yaml:"labels"`
+	Owners     []string `yaml:"owners"`
+	WebhookURL string   `yaml:"webhook_url"`
+}
+
+// discordEmbed is a rich embed of a Discord message, one per repository
+type discordEmbed struct {
+	Title       string `json:"title"`
+	URL         string `json:"url,omitempty"`
+	Description string `json:"description"`
+	Color       int    `json:"color"`
+	Timestamp   string `json:"timestamp,omitempty"`
+}
+
+type discordNotifier struct {
+	c DiscordConfig
+}
+
+func newDiscordNotifier(c DiscordConfig) *discordNotifier {
+	n := &discordNotifier{c: c}
+	if n.c.WebhookURL == "" {
+		n.c.WebhookURL = os.Getenv("DISCORD_WEBHOOK_URL")
+	}
+	if n.c.Username == "" {
+		n.c.Username = "tr4ck"
+	}
+	if n.c.Limit <= 0 {
+		n.c.Limit = 10
+	}
+	return n
+}
+
+func (n *discordNotifier) name() string {
+	return "discord"
+}
+
+// webhook routes a marker by the labels of its repository and its owners
+func (n *discordNotifier) webhook(repo RepoDigest, m *StoredMarker) string {
+	for _, route := range n.c.Routes {
+		if routed(route.Labels, route.Owners, repo, m) {
+			return route.WebhookURL
+		}
+	}
+	return n.c.WebhookURL
+}
+
+// notify posts an embed per repository with new, resolved or overdue markers, in as few messages per webhook
+// as Discord allows
+func (n *discordNotifier) notify(d SyncDigest) error {
+	var order []string
+	routed := map[string][]discordEmbed{}
+	for _, repo := range d.Repos {
+		if repo.empty() {
+			continue
+		}
+		webhooks, parts := splitDigest(repo, func(m *StoredMarker) string { return n.webhook(repo, m) })
+		for _, webhook := range webhooks {
+			if _, ok := routed[webhook]; !ok {
+				order = append(order, webhook)
+			}
+			embed := discordRepoEmbed(parts[webhook], n.c.Limit)
+			embed.Timestamp = d.Time.Format(time.RFC3339)
+			routed[webhook] = append(routed[webhook], embed)
+		}
+	}
+
+	var errs []string
+	for _, webhook := range order {
+		if webhook == "" {
+			errs = append(errs, "no webhook to post to")
+			continue
+		}
+		embeds := routed[webhook]
+		for i := 0; i < len(embeds); i += discordEmbedsPerMessage {
+			in := map[string]any{
+				"username":         n.c.Username,
+				"embeds":           embeds[i:min(i+discordEmbedsPerMessage, len(embeds))],
+				"allowed_mentions": map[string]any{"parse": []string{}},
+			}
+			if err := callJSON("discord", http.MethodPost, webhook, nil, in, nil); err != nil {
+				errs = append(errs, err.Error())
+				break
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to post to discord: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// alert posts an embed listing the markers of an alert to their webhooks
+func (n *discordNotifier) alert(a Alert) error {
+	webhooks, parts := splitAlert(a, n.webhook)
+	var errs []string
+	for _, webhook := range webhooks {
+		if webhook == "" {
+			errs = append(errs, "no webhook to post to")
+			continue
+		}
+		embed := discordAlertEmbed(parts[webhook], n.c.Limit)
+		in := map[string]any{
+			"username":         n.c.Username,
+			"embeds":           []discordEmbed{embed},
+			"allowed_mentions": map[string]any{"parse": []string{}},
+		}
+		if err := callJSON("discord", http.MethodPost, webhook, nil, in, nil); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to post to discord: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// discordEscaper escapes Discord markdown
+var discordEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`, ">", `\>`, "[", `\[`, "]", `\]`)
+
+// discordRepoEmbed lists the new, resolved and overdue markers of a repository, at most limit per section
+func discordRepoEmbed(repo RepoDigest, limit int) discordEmbed {
+	embed := discordEmbed{Title: ScanResult{Repo: repo.Repo, Branch: repo.Branch}.title(), Color: discordGreen}
+	if !filepath.IsAbs(repo.Repo) {
+		embed.URL = "https://" + repo.Repo
+	}
+	switch {
+	case len(repo.Overdue) > 0:
+		embed.Color = discordRed
+	case len(repo.Opened) > 0:
+		embed.Color = discordOrange
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%d** new, **%d** resolved, **%d** overdue markers\n", len(repo.Opened), len(repo.Resolved), len(repo.Overdue))
+
+	line := func(emoji string, m *StoredMarker, detail string) {
+		location := discordEscaper.Replace(fmt.Sprintf("%s:%d", m.File, m.Line))
+		if url := markerURL(m); url != "" {
+			location = "[" + location + "](" + url + ")"
+		}
+		fmt.Fprintf(&b, "%s %s %s%s\n", emoji, location, discordEscaper.Replace(m.Text), detail)
+	}
+	more := func(markers []*StoredMarker, kind string) {
+		if len(markers) > limit {
+			fmt.Fprintf(&b, "… and %d more %s markers\n", len(markers)-limit, kind)
+		}
+	}
+
+	if repo.Initial && len(repo.Opened) > 0 {
+		fmt.Fprintf(&b, ":new: first sync, %d markers\n", len(repo.Opened))
+	} else {
+		for _, m := range repo.Opened[:min(limit, len(repo.Opened))] {
+			line(":new:", m, "")
+		}
+		more(repo.Opened, "new")
+	}
+
+	for _, m := range repo.Resolved[:min(limit, len(repo.Resolved))] {
+		detail := ""
+		if by := m.ResolvedBy; by != nil {
+			detail = " — resolved by " + discordEscaper.Replace(by.Author)
+		}
+		line(":white_check_mark:", m, detail)
+	}
+	more(repo.Resolved, "resolved")
+
+	for _, m := range repo.Overdue[:min(limit, len(repo.Overdue))] {
+		line(":alarm_clock:", m, " — due "+discordEscaper.Replace(m.Due))
+	}
+	more(repo.Overdue, "overdue")
+
+	embed.Description = b.String()
+	if runes := []rune(embed.Description); len(runes) > discordDescriptionLimit {
+		embed.Description = string(runes[:discordDescriptionLimit-1]) + "…"
+	}
+	return embed
+}
+
+// discordAlertEmbed lists the markers of an alert, at most limit
+func discordAlertEmbed(a Alert, limit int) discordEmbed {
+	embed := discordEmbed{Title: "tr4ck alert: " + a.Rule, Color: discordRed, Timestamp: a.Time.Format(time.RFC3339)}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%d** %s\n", len(a.Markers), discordEscaper.Replace(a.Condition))
+	for _, m := range a.Markers[:min(limit, len(a.Markers))] {
+		location := discordEscaper.Replace(fmt.Sprintf("%s:%d", m.File, m.Line))
+		if url := markerURL(m); url != "" {
+			location = "[" + location + "](" + url + ")"
+		}
+		fmt.Fprintf(&b, ":rotating_light: %s %s — %s\n", location, discordEscaper.Replace(m.Text), discordEscaper.Replace(a.detail(m)))
+	}
+	if len(a.Markers) > limit {
+		fmt.Fprintf(&b, "… and %d more markers\n", len(a.Markers)-limit)
+	}
+
+	embed.Description = b.String()
+	if runes := []rune(embed.Description); len(runes) > discordDescriptionLimit {
+		embed.Description = string(runes[:discordDescriptionLimit-1]) + "…"
+	}
+	return embed
+}
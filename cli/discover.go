@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// DiscoverOptions select and label the repositories registered by registry discover
+type DiscoverOptions struct {
+	// Match only registers the repositories whose name matches one of these glob patterns, all when empty, and
+	// Exclude skips those matching one of its patterns
+	Match   []string
+	Exclude []string
+	// Forks also registers forks, and Archived archived repositories
+	Forks    bool
+	Archived bool
+	// Topics only registers the repositories with one of these topics, all when empty
+	Topics []string
+	Labels []string
+	DryRun bool
+}
+
+// matchName reports whether a repository name is selected by the Match and Exclude patterns
+func (o DiscoverOptions) matchName(name string) bool {
+	for _, pattern := range o.Exclude {
+		if globMatch(pattern, name) {
+			return false
+		}
+	}
+	if len(o.Match) == 0 {
+		return true
+	}
+	for _, pattern := range o.Match {
+		if globMatch(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTopics reports whether a repository with these topics is selected by the Topics filter
+func (o DiscoverOptions) matchTopics(topics []string) bool {
+	if len(o.Topics) == 0 {
+		return true
+	}
+	for _, topic := range o.Topics {
+		if containsFold(topics, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// registerDiscovered adds the repositories missing from the registry, tracking their default branch, and returns
+// the number added. Failures are logged and counted, so one unreachable repository does not stop the others.
+// Added records remember their source, e.g. github:acme, and the records of that source missing from listed, the
+// repositories the source still has, because they were deleted or archived, are disabled. Repositories only left
+// out by the filters of this run are not listed by the caller.
+func registerDiscovered(source string, uris, listed []string, opts DiscoverOptions) (int, error) {
+	records, err := loadRegistry()
+	if err != nil {
+		return 0, err
+	}
+
+	added, failed := 0, 0
+	for _, uri := range uris {
+		known := false
+		for _, record := range *records {
+			if sameURI(record.URI, uri) {
+				known = true
+				break
+			}
+		}
+		if known {
+			log.Debug().Str("uri", uri).Msg("Already registered")
+			continue
+		}
+
+		if opts.DryRun {
+			fmt.Println(uri)
+			added++
+			continue
+		}
+		if err := addToRegistry(RegistryRecord{URI: uri, Labels: opts.Labels, Source: source}); err != nil {
+			log.Err(err).Str("uri", uri).Msg("Failed to add URI to the registry")
+			failed++
+			continue
+		}
+		log.Info().Str("uri", uri).Msg(aurora.Green("Added").String())
+		added++
+	}
+
+	if err := disableUndiscovered(source, listed, opts.DryRun); err != nil {
+		return added, err
+	}
+	if failed > 0 {
+		return added, fmt.Errorf("failed to add %d of %d repositories", failed, added+failed)
+	}
+	return added, nil
+}
+
+// disableUndiscovered disables the records discovered in source that are not among listed. They are not enabled
+// again when listed again, since they may have been disabled by hand.
+func disableUndiscovered(source string, listed []string, dryRun bool) error {
+	records, err := loadRegistry()
+	if err != nil {
+		return err
+	}
+
+	disabled := 0
+	for i, record := range *records {
+		if record.Source != source || record.Disabled || slices.ContainsFunc(listed, func(uri string) bool { return sameURI(uri, record.URI) }) {
+			continue
+		}
+		log.Info().Str("uri", describeRecord(record)).Str("source", source).Msg(aurora.Yellow("No longer discovered, disabling").String())
+		(*records)[i].Disabled = true
+		disabled++
+	}
+	if disabled == 0 || dryRun {
+		return nil
+	}
+
+	return saveRegistry(*records)
+}
+
+// discoverGitHub registers the repositories of a GitHub organization, or of a user when user is set
+func discoverGitHub(owner string, user bool, opts DiscoverOptions) error {
+	c := GitHubConfig{}
+	if githubConfig != nil {
+		c = *githubConfig
+	}
+	client := newGitHubTracker(c)
+
+	repos, err := client.repositories(owner, user)
+	if err != nil {
+		return fmt.Errorf("failed to list repositories of %s: %w", owner, err)
+	}
+
+	var uris, listed []string
+	for _, repo := range repos {
+		if repo.Disabled || (repo.Archived && !opts.Archived) {
+			continue
+		}
+		listed = append(listed, repo.CloneURL)
+		if (repo.Fork && !opts.Forks) || !opts.matchName(repo.Name) || !opts.matchTopics(repo.Topics) {
+			continue
+		}
+		uris = append(uris, repo.CloneURL)
+	}
+
+	added, err := registerDiscovered("github:"+owner, uris, listed, opts)
+	log.Info().Str("owner", owner).Int("listed", len(repos)).Int("selected", len(uris)).Int("new", added).Msg("Discovered repositories")
+	return err
+}
+
+// discoverGitLab registers the projects of a GitLab group, and of its subgroups when recursive is set. Projects are
+// matched by their path in the group, e.g. platform/api.
+func discoverGitLab(group string, recursive bool, opts DiscoverOptions) error {
+	c := GitLabConfig{}
+	if gitlabConfig != nil {
+		c = *gitlabConfig
+	}
+	client := newGitLabTracker(c)
+
+	group = strings.Trim(group, "/")
+	projects, err := client.projects(group, recursive)
+	if err != nil {
+		return fmt.Errorf("failed to list projects of %s: %w", group, err)
+	}
+
+	var uris, listed []string
+	for _, project := range projects {
+		if project.Archived && !opts.Archived {
+			continue
+		}
+		listed = append(listed, project.HTTPURLToRepo)
+		if project.ForkedFromProject != nil && !opts.Forks {
+			continue
+		}
+		if !opts.matchName(strings.TrimPrefix(project.PathWithNamespace, group+"/")) || !opts.matchTopics(project.Topics) {
+			continue
+		}
+		uris = append(uris, project.HTTPURLToRepo)
+	}
+
+	added, err := registerDiscovered("gitlab:"+group, uris, listed, opts)
+	log.Info().Str("group", group).Int("listed", len(projects)).Int("selected", len(uris)).Int("new", added).Msg("Discovered repositories")
+	return err
+}
+
+// discoverPath registers the git repositories found in a directory, at most maxDepth directories below it, by
+// their origin remote, or by their path when they have none. Hidden directories and the directories of found
+// repositories are not searched. Repositories are matched by their path relative to root, e.g. work/api.
+func discoverPath(root string, maxDepth int, opts DiscoverOptions) error {
+	root, err := filepath.Abs(expandHome(root))
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", root, err)
+	}
+
+	var uris, listed []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("Skipping")
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		// .git is a directory in clones and a file in worktrees and submodules
+		if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+			if rel != "." && strings.Count(rel, string(filepath.Separator))+1 >= maxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		uri := path
+		if origin := originURL(path); origin != "" {
+			uri = origin
+		}
+		listed = append(listed, uri)
+		if !opts.matchName(filepath.ToSlash(rel)) {
+			return filepath.SkipDir
+		}
+		if !slices.ContainsFunc(uris, func(u string) bool { return sameURI(u, uri) }) {
+			uris = append(uris, uri)
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return fmt.Errorf("failed to search %s: %w", root, err)
+	}
+
+	added, err := registerDiscovered("path:"+root, uris, listed, opts)
+	log.Info().Str("path", root).Int("listed", len(listed)).Int("selected", len(uris)).Int("new", added).Msg("Discovered repositories")
+	return err
+}
+
+// originURL is the URL of the origin remote of a local repository, empty when it has none
+func originURL(path string) string {
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{EnableDotGitCommonDir: true})
+	if err != nil {
+		log.Debug().Err(err).Str("path", path).Msg("Failed to open repository")
+		return ""
+	}
+	remote, err := repo.Remote("origin")
+	if err != nil || len(remote.Config().URLs) == 0 {
+		return ""
+	}
+	return remote.Config().URLs[0]
+}
+
+// discoverBitbucket registers the repositories of a Bitbucket Cloud workspace, or of a Bitbucket Server project
+func discoverBitbucket(owner string, opts DiscoverOptions) error {
+	if bitbucketConfig == nil {
+		bitbucketConfig = &BitbucketConfig{}
+	}
+	client := newBitbucketClient(*bitbucketConfig)
+
+	repos, err := client.repositories(owner)
+	if err != nil {
+		return fmt.Errorf("failed to list repositories of %s: %w", owner, err)
+	}
+
+	var uris, listed []string
+	for _, repo := range repos {
+		uri := repo.cloneURL()
+		if uri == "" {
+			continue
+		}
+		listed = append(listed, uri)
+		if (repo.fork() && !opts.Forks) || !opts.matchName(repo.Slug) {
+			continue
+		}
+		uris = append(uris, uri)
+	}
+
+	added, err := registerDiscovered("bitbucket:"+owner, uris, listed, opts)
+	log.Info().Str("owner", owner).Int("listed", len(repos)).Int("selected", len(uris)).Int("new", added).Msg("Discovered repositories")
+	return err
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emailConfig is the email section of the config, nil when no digest is emailed
+var emailConfig *EmailConfig
+
+// EmailConfig emails a digest of the marker store every day or week, once a sync runs after that time
+type EmailConfig struct {
+	// SMTPHost and SMTPPort are the mail server, port 587 with STARTTLS by default, 465 for implicit TLS
+	SMTPHost string `yaml:"smtp_host"`
+	SMTPPort int    `yaml:"smtp_port"`
+	// Username and Password authenticate with the server, the password from SMTP_PASSWORD when empty
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	// Schedule is daily or weekly
+	Schedule string `yaml:"schedule"`
+	// Limit caps the markers listed per section of a repository, 20 by default
+	Limit int `yaml:"limit"`
+}
+
+// emailStatePath is the file holding when the last digest was emailed
+func emailStatePath() string {
+	return strings.TrimSuffix(registryFilePath, ".registry") + ".digest"
+}
+
+type emailNotifier struct {
+	c EmailConfig
+}
+
+func newEmailNotifier(c EmailConfig) *emailNotifier {
+	if c.SMTPPort == 0 {
+		c.SMTPPort = 587
+	}
+	if c.Password == "" {
+		c.Password = os.Getenv("SMTP_PASSWORD")
+	}
+	if c.Schedule == "" {
+		c.Schedule = "daily"
+	}
+	if c.Limit <= 0 {
+		c.Limit = 20
+	}
+	return &emailNotifier{c: c}
+}
+
+func (n *emailNotifier) name() string {
+	return "email"
+}
+
+// period is the time between two digests
+func (n *emailNotifier) period() (time.Duration, error) {
+	switch n.c.Schedule {
+	case "daily":
+		return 24 * time.Hour, nil
+	case "weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+	return 0, fmt.Errorf("invalid email schedule %s, expected daily or weekly", n.c.Schedule)
+}
+
+// notify emails the markers opened and resolved since the last digest, and the overdue ones, once the schedule
+// is due. The digest covers the whole marker store rather than the repositories of this sync.
+func (n *emailNotifier) notify(d SyncDigest) error {
+	if n.c.SMTPHost == "" || n.c.From == "" || len(n.c.To) == 0 {
+		return fmt.Errorf("smtp_host, from and to are required")
+	}
+	period, err := n.period()
+	if err != nil {
+		return err
+	}
+
+	now := d.Time
+	since := now.Add(-period)
+	if data, err := os.ReadFile(emailStatePath()); err == nil {
+		last, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+		if err == nil && now.Sub(last) < period {
+			return nil
+		}
+		if err == nil {
+			since = last
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read digest state: %w", err)
+	}
+
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		return fmt.Errorf("failed to load marker store: %w", err)
+	}
+	// nothing happened, nothing is sent
+	if repos := store.digestSince(since, now); len(repos) > 0 {
+		msg, err := n.message(repos, since, now)
+		if err != nil {
+			return err
+		}
+		if err := n.send(msg); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(emailStatePath(), []byte(now.Format(time.RFC3339)+"\n"), 0644)
+}
+
+// digestSince groups the markers opened and resolved since a time, and the overdue ones, by repository branch
+func (s *Store) digestSince(since, now time.Time) []RepoDigest {
+	digests := map[string]*RepoDigest{}
+	digest := func(m *StoredMarker) *RepoDigest {
+		key := m.Repo + "#" + m.Branch
+		if _, ok := digests[key]; !ok {
+			digests[key] = &RepoDigest{Repo: m.Repo, Branch: m.Branch}
+		}
+		return digests[key]
+	}
+
+	for _, m := range s.Markers {
+		if !m.FirstSeen.Before(since) {
+			d := digest(m)
+			d.Opened = append(d.Opened, m)
+		}
+		if m.State == markerResolved && m.ResolvedAt != nil && !m.ResolvedAt.Before(since) {
+			d := digest(m)
+			d.Resolved = append(d.Resolved, m)
+		}
+		if _, late := m.overdue(now); late && m.State == markerOpen {
+			d := digest(m)
+			d.Overdue = append(d.Overdue, m)
+		}
+	}
+
+	var repos []RepoDigest
+	for _, d := range digests {
+		repos = append(repos, *d)
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		if repos[i].Repo != repos[j].Repo {
+			return repos[i].Repo < repos[j].Repo
+		}
+		return repos[i].Branch < repos[j].Branch
+	})
+	return repos
+}
+
+// emailSection is a list of markers of a repository in the html body
+type emailSection struct {
+	Title   string
+	Markers []emailMarker
+	More    int
+}
+
+type emailMarker struct {
+	Location string
+	URL      string
+	Text     string
+	Detail   string
+}
+
+// emailTemplate is the html body of the digest
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif">
+<h2>tr4ck {{.Schedule}} digest</h2>
+<p>{{.Summary}}</p>
+{{range .Repos}}<h3>{{.Title}}</h3>
+{{range .Sections}}<h4>{{.Title}}</h4>
+<ul>
+{{range .Markers}}<li>{{if .URL}}<a href="{{.URL}}">{{.Location}}</a>{{else}}{{.Location}}{{end}} <code>{{.Text}}</code>{{if .Detail}} &mdash; {{.Detail}}{{end}}</li>
+{{end}}{{if .More}}<li>and {{.More}} more</li>
+{{end}}</ul>
+{{end}}{{end}}</body></html>
+`))
+
+// message builds a multipart/alternative email with a plain text and an html body
+func (n *emailNotifier) message(repos []RepoDigest, since, now time.Time) ([]byte, error) {
+	opened, resolved, overdue := SyncDigest{Repos: repos}.counts()
+	summary := fmt.Sprintf("%d new, %d resolved and %d overdue markers since %s.", opened, resolved, overdue, since.Local().Format("2006-01-02 15:04"))
+
+	type repoSections struct {
+		Title    string
+		Sections []emailSection
+	}
+	var html []repoSections
+	var text strings.Builder
+	fmt.Fprintf(&text, "tr4ck %s digest\n\n%s\n", n.c.Schedule, summary)
+
+	for _, repo := range repos {
+		r := repoSections{Title: ScanResult{Repo: repo.Repo, Branch: repo.Branch}.title()}
+		fmt.Fprintf(&text, "\n%s\n", r.Title)
+
+		lists := []struct {
+			title   string
+			markers []*StoredMarker
+			detail  func(m *StoredMarker) string
+		}{
+			{"New", repo.Opened, func(m *StoredMarker) string { return "" }},
+			{"Resolved", repo.Resolved, func(m *StoredMarker) string {
+				if by := m.ResolvedBy; by != nil {
+					return "resolved by " + by.Author
+				}
+				return ""
+			}},
+			{"Overdue", repo.Overdue, func(m *StoredMarker) string { return "due " + m.Due }},
+		}
+		for _, list := range lists {
+			if len(list.markers) == 0 {
+				continue
+			}
+			section := emailSection{Title: list.title, More: max(0, len(list.markers)-n.c.Limit)}
+			fmt.Fprintf(&text, "  %s:\n", list.title)
+			for _, m := range list.markers[:min(n.c.Limit, len(list.markers))] {
+				em := emailMarker{Location: fmt.Sprintf("%s:%d", m.File, m.Line), URL: markerURL(m), Text: m.Text, Detail: list.detail(m)}
+				section.Markers = append(section.Markers, em)
+				fmt.Fprintf(&text, "    %s  %s", em.Location, em.Text)
+				if em.Detail != "" {
+					fmt.Fprintf(&text, " (%s)", em.Detail)
+				}
+				fmt.Fprintln(&text)
+			}
+			if section.More > 0 {
+				fmt.Fprintf(&text, "    and %d more\n", section.More)
+			}
+			r.Sections = append(r.Sections, section)
+		}
+		html = append(html, r)
+	}
+
+	var htmlBody bytes.Buffer
+	data := map[string]any{"Schedule": n.c.Schedule, "Summary": summary, "Repos": html}
+	if err := emailTemplate.Execute(&htmlBody, data); err != nil {
+		return nil, fmt.Errorf("failed to render email: %w", err)
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text.String()},
+		{"text/html; charset=utf-8", htmlBody.String()},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to write email: %w", err)
+		}
+		qp := quotedprintable.NewWriter(w)
+		qp.Write([]byte(part.content))
+		qp.Close()
+	}
+	parts.Close()
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.c.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.c.To, ", "))
+	fmt.Fprintf(&msg, "Subject: tr4ck %s digest: %d new, %d resolved, %d overdue markers\r\n", n.c.Schedule, opened, resolved, overdue)
+	fmt.Fprintf(&msg, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// alert emails an alert at once, in plain text, listing at most limit markers
+func (n *emailNotifier) alert(a Alert) error {
+	if n.c.SMTPHost == "" || n.c.From == "" || len(n.c.To) == 0 {
+		return fmt.Errorf("smtp_host, from and to are required")
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "tr4ck alert %s\n\n", a.summary())
+	for _, m := range a.Markers[:min(n.c.Limit, len(a.Markers))] {
+		fmt.Fprintf(&text, "  %s:%d  %s (%s)\n", m.File, m.Line, m.Text, a.detail(m))
+		if url := markerURL(m); url != "" {
+			fmt.Fprintf(&text, "    %s\n", url)
+		}
+	}
+	if len(a.Markers) > n.c.Limit {
+		fmt.Fprintf(&text, "  and %d more\n", len(a.Markers)-n.c.Limit)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.c.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.c.To, ", "))
+	fmt.Fprintf(&msg, "Subject: tr4ck alert %s\r\n", a.summary())
+	fmt.Fprintf(&msg, "Date: %s\r\n", a.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	qp.Write([]byte(text.String()))
+	qp.Close()
+	return n.send(msg.Bytes())
+}
+
+// envelope returns the bare addresses of the sender and recipients, which may be written as "Name <address>"
+func (n *emailNotifier) envelope() (string, []string, error) {
+	from, err := mail.ParseAddress(n.c.From)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid from address %s: %w", n.c.From, err)
+	}
+	var to []string
+	for _, recipient := range n.c.To {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid recipient %s: %w", recipient, err)
+		}
+		to = append(to, address.Address)
+	}
+	return from.Address, to, nil
+}
+
+// send delivers the message over implicit TLS on port 465, or else with STARTTLS when the server offers it
+func (n *emailNotifier) send(msg []byte) error {
+	from, recipients, err := n.envelope()
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(n.c.SMTPHost, fmt.Sprint(n.c.SMTPPort))
+	var auth smtp.Auth
+	if n.c.Username != "" {
+		auth = smtp.PlainAuth("", n.c.Username, n.c.Password, n.c.SMTPHost)
+	}
+
+	if n.c.SMTPPort != 465 {
+		if err := smtp.SendMail(addr, auth, from, recipients, msg); err != nil {
+			return fmt.Errorf("failed to send email: %w", err)
+		}
+		return nil
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: n.c.SMTPHost})
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	client, err := smtp.NewClient(conn, n.c.SMTPHost)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	for _, to := range recipients {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("failed to send email to %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return client.Quit()
+}
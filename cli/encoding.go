@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// errUndecodable is returned for content in an encoding the scanner cannot read, e.g. binary data
+var errUndecodable = errors.New("undecodable content")
+
+// sniffSize is the number of leading bytes used to detect the encoding of files without a BOM
+const sniffSize = 512
+
+// newDecodingReader detects the encoding of r from its BOM or leading bytes and returns a reader producing
+// UTF-8. UTF-16 is transcoded on the fly; other content is passed through, see decodeLine for Latin-1.
+func newDecodingReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		br.Discard(3)
+		return br, nil
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		br.Discard(2)
+		return &utf16Reader{r: br, order: binary.LittleEndian}, nil
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		br.Discard(2)
+		return &utf16Reader{r: br, order: binary.BigEndian}, nil
+	}
+
+	if bytes.IndexByte(head, 0) < 0 {
+		return br, nil
+	}
+	if order := utf16Order(head); order != nil {
+		return &utf16Reader{r: br, order: order}, nil
+	}
+
+	return nil, errUndecodable
+}
+
+// utf16Order returns the byte order of head when it looks like UTF-16 text without a BOM, nil otherwise
+func utf16Order(head []byte) binary.ByteOrder {
+	// text without a BOM only contains NUL bytes when encoded as UTF-16, mostly as the high byte of ASCII
+	var even, odd int
+	for i := 0; i+1 < len(head); i += 2 {
+		if head[i] == 0 {
+			even++
+		}
+		if head[i+1] == 0 {
+			odd++
+		}
+	}
+	units := len(head) / 2
+	switch {
+	case odd > units/2 && even == 0:
+		return binary.LittleEndian
+	case even > units/2 && odd == 0:
+		return binary.BigEndian
+	}
+	return nil
+}
+
+// binarySniffSize is the number of leading bytes git looks for a NUL byte in to tell binary files apart
+const binarySniffSize = 8000
+
+// peekBinary reports whether r holds binary data as git sees it, i.e. has a NUL byte in its leading bytes,
+// UTF-16 text excepted since it is transcoded. The returned reader still yields the peeked bytes.
+func peekBinary(r io.Reader) (io.Reader, bool, error) {
+	br := bufio.NewReaderSize(r, binarySniffSize)
+	head, err := br.Peek(binarySniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, false, err
+	}
+
+	if bytes.IndexByte(head, 0) < 0 {
+		return br, false, nil
+	}
+	if bytes.HasPrefix(head, []byte{0xFF, 0xFE}) || bytes.HasPrefix(head, []byte{0xFE, 0xFF}) {
+		return br, false, nil
+	}
+	return br, utf16Order(head[:min(len(head), sniffSize)]) == nil, nil
+}
+
+// utf16Reader transcodes UTF-16 to UTF-8
+type utf16Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	// pending holds a code unit read ahead after an unpaired surrogate
+	pending *uint16
+	buf     []byte
+}
+
+func (u *utf16Reader) unit() (uint16, error) {
+	if u.pending != nil {
+		unit := *u.pending
+		u.pending = nil
+		return unit, nil
+	}
+
+	var b [2]byte
+	if _, err := io.ReadFull(u.r, b[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			// odd number of bytes
+			return 0, errUndecodable
+		}
+		return 0, err
+	}
+	return u.order.Uint16(b[:]), nil
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	for len(u.buf) < len(p) {
+		first, err := u.unit()
+		if err == io.EOF && len(u.buf) > 0 {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		r := rune(first)
+		if utf16.IsSurrogate(r) {
+			second, err := u.unit()
+			if err != nil && err != io.EOF {
+				return 0, err
+			}
+			if err == nil {
+				if r = utf16.DecodeRune(r, rune(second)); r == utf8.RuneError {
+					// unpaired surrogate, the second unit is decoded on its own
+					u.pending = &second
+				}
+			} else {
+				r = utf8.RuneError
+			}
+		}
+		u.buf = utf8.AppendRune(u.buf, r)
+	}
+
+	n := copy(p, u.buf)
+	u.buf = u.buf[n:]
+	return n, nil
+}
+
+// decodeLine returns line as UTF-8, reading it as Latin-1 when it is not valid UTF-8
+func decodeLine(line string) string {
+	if utf8.ValidString(line) {
+		return line
+	}
+
+	var b strings.Builder
+	b.Grow(len(line) * 2)
+	for i := 0; i < len(line); i++ {
+		b.WriteRune(rune(line[i]))
+	}
+	return b.String()
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// apiEventBuffer is the number of events buffered for each client of a job's event stream
+	apiEventBuffer = 256
+	// apiKeepalive is how often an idle event stream sends a comment, so that proxies do not close it
+	apiKeepalive = 15 * time.Second
+)
+
+// apiEvent is a server-sent event of a job, its data encoded as JSON
+type apiEvent struct {
+	name string
+	data interface{}
+}
+
+// APIFileEvent is the file event of a job, sent as each file is read
+type APIFileEvent struct {
+	File string `json:"file"`
+	// Markers is the number of markers found in the file, and Files the number of files read in the current
+	// repository
+	Markers int `json:"markers"`
+	Files   int `json:"files"`
+}
+
+// APIRepoEvent is the repo event of a job, sent as each repository is scanned or synced
+type APIRepoEvent struct {
+	APIRepoSync
+	// Result holds the findings and resolved findings, absent when the repository failed or was unchanged
+	Result *ScanResult `json:"result,omitempty"`
+}
+
+// subscribe returns the events of a running or queued job, the caller holding a.mu
+func (a *apiServer) subscribe(id string) chan apiEvent {
+	events := make(chan apiEvent, apiEventBuffer)
+	if a.subscribers == nil {
+		a.subscribers = map[string][]chan apiEvent{}
+	}
+	a.subscribers[id] = append(a.subscribers[id], events)
+	return events
+}
+
+// unsubscribe stops sending the events of a job to a client gone
+func (a *apiServer) unsubscribe(id string, events chan apiEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.subscribers[id] = slices.DeleteFunc(a.subscribers[id], func(c chan apiEvent) bool { return c == events })
+	if len(a.subscribers[id]) == 0 {
+		delete(a.subscribers, id)
+	}
+}
+
+// publish sends an event to the clients of a job, the caller holding a.mu. Scans can not wait for slow clients:
+// file events are dropped when their buffer is full, and other events end their stream, which they can reconnect
+// to.
+func (a *apiServer) publish(job *APIJob, name string, data interface{}) {
+	subscribers := a.subscribers[job.ID]
+	for i := 0; i < len(subscribers); i++ {
+		select {
+		case subscribers[i] <- apiEvent{name: name, data: data}:
+		default:
+			if name == "file" {
+				continue
+			}
+			log.Warn().Str("job", job.ID).Msg("Dropping slow event stream")
+			close(subscribers[i])
+			subscribers = slices.Delete(subscribers, i, i+1)
+			i--
+		}
+	}
+	a.subscribers[job.ID] = subscribers
+}
+
+// finish sends the final state of a job to its clients and ends their streams, the caller holding a.mu
+func (a *apiServer) finish(job *APIJob) {
+	a.publish(job, "job", *job)
+	for _, events := range a.subscribers[job.ID] {
+		close(events)
+	}
+	delete(a.subscribers, job.ID)
+}
+
+// jobHooks returns the onScanned and onSynced hooks publishing the progress of a job
+func (a *apiServer) jobHooks(job *APIJob) (func(string, []Finding), func(RepoSync, *ScanResult)) {
+	// files counts the files read in the current repository
+	files := 0
+	scanned := func(file string, findings []Finding) {
+		files++
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.publish(job, "file", APIFileEvent{File: file, Markers: len(findings), Files: files})
+	}
+	synced := func(repo RepoSync, result *ScanResult) {
+		files = 0
+		outcome := APIRepoSync{Repo: repo.Repo, Branch: repo.Branch, DurationMs: repo.Duration.Milliseconds()}
+		if repo.Err != nil {
+			outcome.Error = repo.Err.Error()
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		job.Repos = append(job.Repos, outcome)
+		a.publish(job, "repo", APIRepoEvent{APIRepoSync: outcome, Result: result})
+	}
+	return scanned, synced
+}
+
+// jobEvents streams the progress of a job as server-sent events: the job as it is, then a file event for each file
+// read, a repo event for each repository scanned or synced, and a job event on each change of state. The stream
+// ends with the job event of its finished state.
+func (a *apiServer) jobEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apiError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	id := r.PathValue("id")
+	a.mu.Lock()
+	i := slices.IndexFunc(a.jobs, func(j *APIJob) bool { return j.ID == id })
+	var job APIJob
+	var events chan apiEvent
+	if i >= 0 {
+		job = *a.jobs[i]
+		if job.Finished == nil {
+			events = a.subscribe(id)
+		}
+	}
+	a.mu.Unlock()
+
+	if i < 0 {
+		apiError(w, http.StatusNotFound, fmt.Errorf("job %s not found", id))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginx buffers responses otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeEvent(w, apiEvent{name: "job", data: job}); err != nil || events == nil {
+		flusher.Flush()
+		return
+	}
+	flusher.Flush()
+	defer a.unsubscribe(id, events)
+
+	keepalive := time.NewTicker(apiKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes a server-sent event, its data on a single line
+func writeEvent(w http.ResponseWriter, event apiEvent) error {
+	data, err := json.Marshal(event.data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.name, err)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, data)
+	return err
+}
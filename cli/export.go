@@ -0,0 +1,279 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/rs/zerolog/log"
+	_ "modernc.org/sqlite"
+)
+
+// MarkerRow is a stored marker flattened for export
+type MarkerRow struct {
+	ID               string     `parquet:"id"`
+	Repo             string     `parquet:"repo"`
+	Branch           string     `parquet:"branch"`
+	File             string     `parquet:"file"`
+	Line             int64      `parquet:"line"`
+	Column           int64      `parquet:"column"`
+	Marker           string     `parquet:"marker"`
+	Text             string     `parquet:"text"`
+	Description      string     `parquet:"description"`
+	Assignee         string     `parquet:"assignee"`
+	Priority         string     `parquet:"priority"`
+	Due              string     `parquet:"due"`
+	Issues           string     `parquet:"issues"`
+	Author           string     `parquet:"author"`
+	Email            string     `parquet:"email"`
+	Commit           string     `parquet:"commit"`
+	Date             *time.Time `parquet:"date,optional,timestamp"`
+	State            string     `parquet:"state"`
+	FirstRevision    string     `parquet:"first_revision"`
+	Revision         string     `parquet:"revision"`
+	FirstSeen        time.Time  `parquet:"first_seen,timestamp"`
+	LastSeen         time.Time  `parquet:"last_seen,timestamp"`
+	IntroducedCommit string     `parquet:"introduced_commit"`
+	IntroducedAuthor string     `parquet:"introduced_author"`
+	IntroducedAt     *time.Time `parquet:"introduced_at,optional,timestamp"`
+	ResolvedAt       *time.Time `parquet:"resolved_at,optional,timestamp"`
+	ResolvedRevision string     `parquet:"resolved_revision"`
+	ResolvedCommit   string     `parquet:"resolved_commit"`
+	ResolvedAuthor   string     `parquet:"resolved_author"`
+	IgnoredAt        *time.Time `parquet:"ignored_at,optional,timestamp"`
+	IgnoreReason     string     `parquet:"ignore_reason"`
+}
+
+// EventRow is an event of the timeline of a stored marker
+type EventRow struct {
+	MarkerID string    `parquet:"marker_id"`
+	Time     time.Time `parquet:"time,timestamp"`
+	Kind     string    `parquet:"kind"`
+	Revision string    `parquet:"revision"`
+	File     string    `parquet:"file"`
+	Line     int64     `parquet:"line"`
+	Text     string    `parquet:"text"`
+	Author   string    `parquet:"author"`
+	Note     string    `parquet:"note"`
+}
+
+// SnapshotRow is a marker of a snapshot of a synced commit
+type SnapshotRow struct {
+	Repo     string    `parquet:"repo"`
+	Branch   string    `parquet:"branch"`
+	Revision string    `parquet:"revision"`
+	Date     time.Time `parquet:"date,timestamp"`
+	Time     time.Time `parquet:"time,timestamp"`
+	MarkerID string    `parquet:"marker_id"`
+	File     string    `parquet:"file"`
+	Line     int64     `parquet:"line"`
+	Marker   string    `parquet:"marker"`
+	Text     string    `parquet:"text"`
+}
+
+// exportRows flattens the store into the rows of the markers, events and snapshots tables
+func (s *Store) exportRows() ([]MarkerRow, []EventRow, []SnapshotRow, error) {
+	markers := []MarkerRow{}
+	events := []EventRow{}
+	for _, m := range s.Markers {
+		row := MarkerRow{
+			ID: m.ID, Repo: m.Repo, Branch: m.Branch, File: m.File, Line: int64(m.Line), Column: int64(m.Column),
+			Marker: m.Marker, Text: m.Text, Description: m.Description, Assignee: m.Assignee, Priority: m.Priority,
+			Due: m.Due, Issues: strings.Join(m.Issues, ","), Author: m.Author, Email: m.Email, Commit: m.Commit,
+			Date: m.Date, State: m.State, FirstRevision: m.FirstRevision, Revision: m.Revision,
+			FirstSeen: m.FirstSeen, LastSeen: m.LastSeen, ResolvedAt: m.ResolvedAt, ResolvedRevision: m.ResolvedRevision,
+			IgnoredAt: m.IgnoredAt, IgnoreReason: m.IgnoreReason,
+		}
+		if intro := m.Introduced; intro != nil {
+			date := intro.Date
+			row.IntroducedCommit, row.IntroducedAuthor, row.IntroducedAt = intro.Commit, intro.Author, &date
+		}
+		if by := m.ResolvedBy; by != nil {
+			row.ResolvedCommit, row.ResolvedAuthor = by.Commit, by.Author
+		}
+		markers = append(markers, row)
+
+		for _, e := range m.Events {
+			events = append(events, EventRow{
+				MarkerID: m.ID, Time: e.Time, Kind: e.Kind, Revision: e.Revision, File: e.File, Line: int64(e.Line),
+				Text: e.Text, Author: e.Author, Note: e.Note,
+			})
+		}
+	}
+
+	saved, err := s.loadSnapshots("")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	snapshots := []SnapshotRow{}
+	for _, snapshot := range saved {
+		for _, m := range snapshot.Markers {
+			snapshots = append(snapshots, SnapshotRow{
+				Repo: snapshot.Repo, Branch: snapshot.Branch, Revision: snapshot.Revision, Date: snapshot.Date,
+				Time: snapshot.Time, MarkerID: m.ID, File: m.File, Line: int64(m.Line), Marker: m.Marker, Text: m.Text,
+			})
+		}
+	}
+
+	return markers, events, snapshots, nil
+}
+
+// exportParquet writes a parquet file per table to dir
+func exportParquet(dir string, markers []MarkerRow, events []EventRow, snapshots []SnapshotRow) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	if err := parquet.WriteFile(filepath.Join(dir, "markers.parquet"), markers); err != nil {
+		return fmt.Errorf("failed to write markers.parquet: %w", err)
+	}
+	if err := parquet.WriteFile(filepath.Join(dir, "events.parquet"), events); err != nil {
+		return fmt.Errorf("failed to write events.parquet: %w", err)
+	}
+	if err := parquet.WriteFile(filepath.Join(dir, "snapshots.parquet"), snapshots); err != nil {
+		return fmt.Errorf("failed to write snapshots.parquet: %w", err)
+	}
+	return nil
+}
+
+// exportSQLite writes the tables to a new SQLite database at path, replacing an existing file
+func exportSQLite(path string, markers []MarkerRow, events []EventRow, snapshots []SnapshotRow) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	tables := []struct {
+		name string
+		rows any
+	}{
+		{"markers", markers},
+		{"events", events},
+		{"snapshots", snapshots},
+	}
+	for _, table := range tables {
+		if err := insertRows(tx, table.name, table.rows); err != nil {
+			return err
+		}
+	}
+
+	indexes := []string{
+		"CREATE INDEX markers_repo ON markers (repo, branch, state)",
+		"CREATE INDEX events_marker ON events (marker_id)",
+		"CREATE INDEX snapshots_revision ON snapshots (repo, revision)",
+	}
+	for _, index := range indexes {
+		if _, err := tx.Exec(index); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit database: %w", err)
+	}
+	return nil
+}
+
+// insertRows creates a table with a column per field of the row structs, named after their parquet tag, and
+// inserts the rows. Times are stored as RFC 3339 text, which SQLite date functions understand.
+func insertRows(tx *sql.Tx, table string, rows any) error {
+	slice := reflect.ValueOf(rows)
+	rowType := slice.Type().Elem()
+
+	var columns, definitions, placeholders []string
+	for i := 0; i < rowType.NumField(); i++ {
+		field := rowType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("parquet"), ",")
+
+		kind := "TEXT"
+		if field.Type.Kind() == reflect.Int64 {
+			kind = "INTEGER"
+		}
+		columns = append(columns, name)
+		definitions = append(definitions, fmt.Sprintf("%q %s", name, kind))
+		placeholders = append(placeholders, "?")
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", table, strings.Join(definitions, ", "))); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", table, err)
+	}
+
+	insert, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s VALUES (%s)", table, strings.Join(placeholders, ", ")))
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert into %s: %w", table, err)
+	}
+	defer insert.Close()
+
+	for i := 0; i < slice.Len(); i++ {
+		row := slice.Index(i)
+		values := make([]any, len(columns))
+		for j := range columns {
+			values[j] = sqlValue(row.Field(j).Interface())
+		}
+		if _, err := insert.Exec(values...); err != nil {
+			return fmt.Errorf("failed to insert into %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// sqlValue converts times to RFC 3339 text, and nil times to NULL
+func sqlValue(v any) any {
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC().Format(time.RFC3339)
+	case *time.Time:
+		if t == nil {
+			return nil
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	return v
+}
+
+// runExport exports the marker store as a SQLite database or a directory of parquet files
+func runExport(format, output string) {
+	if format != "sqlite" && format != "parquet" {
+		log.Fatal().Str("format", format).Msg("Invalid --format, expected sqlite or parquet")
+	}
+	if output == "" {
+		output = map[string]string{"sqlite": "tr4ck.db", "parquet": "tr4ck-parquet"}[format]
+	}
+
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load marker store")
+	}
+
+	markers, events, snapshots, err := store.exportRows()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load marker store")
+	}
+	if format == "parquet" {
+		err = exportParquet(output, markers, events, snapshots)
+	} else {
+		err = exportSQLite(output, markers, events, snapshots)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Str("output", output).Msg("Failed to export marker store")
+	}
+
+	fmt.Printf("Marker store exported to %s: %d markers, %d events, %d snapshot rows\n", output, len(markers), len(events), len(snapshots))
+}
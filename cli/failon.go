@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// failOn are the conditions that make scan, sync and report exit with failExitCode, e.g. new-markers,
+// count>100 or marker=fixme
+var failOn []string
+
+// failExitCode is the exit status of runs meeting a --fail-on condition, distinct from errors
+const failExitCode = 3
+
+// failCondition is a parsed --fail-on condition
+type failCondition struct {
+	spec string
+	// count fails when the markers exceed it, marker when a finding has it, and neither on any finding
+	count  int
+	marker string
+}
+
+// parseFailOn parses the --fail-on conditions: new-markers, count>N or marker=NAME
+func parseFailOn(specs []string) ([]failCondition, error) {
+	var conditions []failCondition
+	for _, spec := range specs {
+		condition := failCondition{spec: spec, count: -1}
+
+		switch {
+		case spec == "new-markers":
+		case strings.HasPrefix(spec, "count>"):
+			n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(spec, "count>")))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid --fail-on %s, expected count>N", spec)
+			}
+			condition.count = n
+		case strings.HasPrefix(spec, "marker="):
+			condition.marker = strings.TrimSpace(strings.TrimPrefix(spec, "marker="))
+			if condition.marker == "" {
+				return nil, fmt.Errorf("invalid --fail-on %s, expected marker=NAME", spec)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported --fail-on %s, expected new-markers, count>N or marker=NAME", spec)
+		}
+
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
+
+// failures returns the conditions met by the findings of results. Findings are the markers reported: those added
+// since the previous sync, by --diff or since the baseline, so new-markers fails on any finding.
+func failures(conditions []failCondition, results []ScanResult) []string {
+	return countFailures(conditions, results, -1)
+}
+
+// countFailures returns the conditions met by the findings of results, count>N checking total, the number of
+// markers of the scanned repositories, rather than the findings unless negative
+func countFailures(conditions []failCondition, results []ScanResult, total int) []string {
+	found := 0
+	markers := map[string]int{}
+	for _, result := range results {
+		found += len(result.Findings)
+		for _, f := range result.Findings {
+			markers[strings.ToLower(f.Marker)]++
+		}
+	}
+	if total < 0 {
+		total = found
+	}
+
+	var failed []string
+	for _, c := range conditions {
+		switch {
+		case c.marker != "":
+			if n := markers[strings.ToLower(c.marker)]; n > 0 {
+				failed = append(failed, fmt.Sprintf("%s: %d %s markers", c.spec, n, c.marker))
+			}
+		case c.count >= 0:
+			if total > c.count {
+				failed = append(failed, fmt.Sprintf("%s: %d markers", c.spec, total))
+			}
+		case found > 0:
+			failed = append(failed, fmt.Sprintf("%s: %d markers", c.spec, found))
+		}
+	}
+	return failed
+}
+
+// exitOnFailure exits with failExitCode when the results of a reporter meet a --fail-on condition
+func (r *reporter) exitOnFailure() {
+	failed := countFailures(r.failOn, r.report.Results, r.markers)
+	if len(failed) == 0 {
+		return
+	}
+
+	for _, reason := range failed {
+		log.Error().Str("condition", reason).Msg("Failure condition met")
+	}
+	os.Exit(failExitCode)
+}
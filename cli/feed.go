@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// feedKinds are the marker events listed in feeds, moves and text changes being too noisy to subscribe to
+var feedKinds = map[string]string{
+	"opened":    "opened",
+	"resolved":  "resolved",
+	"ignored":   "ignored",
+	"unignored": "reopened",
+}
+
+// FeedOptions select the marker events of a feed
+type FeedOptions struct {
+	// Repo is a canonical URI or a glob matched against it, and Branch a branch, restricting the feed
+	Repo   string
+	Branch string
+	// Limit caps the entries, latest first
+	Limit int
+}
+
+// atomFeed is an Atom feed of marker events, see RFC 4287
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Updated  string       `xml:"updated"`
+	Author   *atomPerson  `xml:"author,omitempty"`
+	Link     *atomLink    `xml:"link,omitempty"`
+	Category atomCategory `xml:"category"`
+	Content  atomText     `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// feed builds the Atom feed of the opened, resolved, ignored and reopened markers of the store, latest first
+func (s *Store) feed(opts FeedOptions, now time.Time) atomFeed {
+	type event struct {
+		m *StoredMarker
+		e MarkerEvent
+	}
+	var events []event
+	for _, m := range s.Markers {
+		if opts.Repo != "" && m.Repo != canonicalURI(opts.Repo) && !globMatch(opts.Repo, m.Repo) {
+			continue
+		}
+		if opts.Branch != "" && m.Branch != opts.Branch {
+			continue
+		}
+		for _, e := range m.Events {
+			if _, ok := feedKinds[e.Kind]; ok {
+				events = append(events, event{m, e})
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].e.Time.After(events[j].e.Time) })
+	if opts.Limit > 0 && len(events) > opts.Limit {
+		events = events[:opts.Limit]
+	}
+
+	feed := atomFeed{ID: "urn:tr4ck:feed", Title: "tr4ck markers", Updated: now.UTC().Format(time.RFC3339), Author: atomPerson{Name: "tr4ck"}}
+	if opts.Repo != "" {
+		title := ScanResult{Repo: opts.Repo, Branch: opts.Branch}.title()
+		feed.ID += ":" + title
+		feed.Title = "tr4ck markers of " + title
+	}
+	if len(events) > 0 {
+		feed.Updated = events[0].e.Time.UTC().Format(time.RFC3339)
+	}
+
+	for _, ev := range events {
+		m, e := ev.m, ev.e
+		kind := feedKinds[e.Kind]
+		entry := atomEntry{
+			ID:       fmt.Sprintf("urn:tr4ck:%s:%s:%d", m.ID, e.Kind, e.Time.Unix()),
+			Title:    fmt.Sprintf("%s %s in %s: %s", m.Marker, kind, ScanResult{Repo: m.Repo, Branch: m.Branch}.title(), m.Text),
+			Updated:  e.Time.UTC().Format(time.RFC3339),
+			Category: atomCategory{Term: kind},
+			Content:  atomText{Type: "text", Body: feedContent(m, e)},
+		}
+		if e.Author != "" {
+			entry.Author = &atomPerson{Name: e.Author}
+		}
+		if url := markerURL(m); url != "" {
+			entry.Link = &atomLink{Href: url}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+// feedContent describes the marker of an event
+func feedContent(m *StoredMarker, e MarkerEvent) string {
+	content := fmt.Sprintf("%s:%d\n%s", m.File, m.Line, m.Text)
+	if m.ID != "" {
+		content += "\nID: " + m.ID
+	}
+	if e.Revision != "" {
+		content += "\nCommit: " + e.Revision
+	}
+	if m.Description != "" {
+		content += "\n\n" + m.Description
+	}
+	if e.Note != "" {
+		content += "\n\n" + e.Note
+	}
+	return content
+}
+
+// renderFeed encodes a feed as an XML document
+func renderFeed(feed atomFeed) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(feed); err != nil {
+		return nil, fmt.Errorf("failed to encode feed: %w", err)
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// runFeed writes the Atom feed of the marker store to output, stdout when empty
+func runFeed(opts FeedOptions, output string) {
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load marker store")
+	}
+
+	data, err := renderFeed(store.feed(opts, time.Now()))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to generate feed")
+	}
+	if output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := writeFileAtomic(output, data, 0644); err != nil {
+		log.Fatal().Err(err).Str("output", output).Msg("Failed to write feed")
+	}
+}
+
+// serveFeed serves the Atom feed of the marker store, restricted by the repo, branch and limit query parameters
+func serveFeed(w http.ResponseWriter, r *http.Request) {
+	opts := FeedOptions{Repo: r.URL.Query().Get("repo"), Branch: r.URL.Query().Get("branch"), Limit: 100}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		opts.Limit = n
+	}
+
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		log.Err(err).Msg("Failed to load marker store")
+		http.Error(w, "failed to load marker store", http.StatusInternalServerError)
+		return
+	}
+	data, err := renderFeed(store.feed(opts, time.Now()))
+	if err != nil {
+		log.Err(err).Msg("Failed to generate feed")
+		http.Error(w, "failed to generate feed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write(data)
+}
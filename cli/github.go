@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// githubConfig is the github section of the config, nil when issues are not opened on GitHub
+var githubConfig *GitHubConfig
+
+// GitHubConfig opens a GitHub issue per new marker and closes it when the marker is resolved
+type GitHubConfig struct {
+	// Token is a token allowed to write issues, GITHUB_TOKEN when empty
+	Token string `yaml:"token"`
+	// APIURL is the REST API of GitHub Enterprise Server, e.g. https://github.example.com/api/v3
+	APIURL string `yaml:"api_url"`
+	// Repos maps repositories to the owner/name their issues are opened in. Other repositories hosted on
+	// GitHub get issues in themselves.
+	Repos       map[string]string `yaml:"repos"`
+	IssueConfig `yaml:",inline"`
+}
+
+// githubTracker is the issue tracker of the GitHub REST API
+type githubTracker struct {
+	c     GitHubConfig
+	api   string
+	token string
+}
+
+func newGitHubTracker(c GitHubConfig) *githubTracker {
+	t := &githubTracker{c: c, api: strings.TrimRight(c.APIURL, "/"), token: c.Token}
+	if t.api == "" {
+		t.api = "https://api.github.com"
+	}
+	if t.token == "" {
+		t.token = os.Getenv("GITHUB_TOKEN")
+	}
+	return t
+}
+
+func (t *githubTracker) name() string {
+	return "github"
+}
+
+func (t *githubTracker) config() IssueConfig {
+	return t.c.IssueConfig
+}
+
+// project maps the canonical URI of a repository to owner/name
+func (t *githubTracker) project(repo string) string {
+	for uri, project := range t.c.Repos {
+		if canonicalURI(uri) == repo {
+			return project
+		}
+	}
+	if path, ok := strings.CutPrefix(repo, "github.com/"); ok {
+		return path
+	}
+	return ""
+}
+
+// githubIssue is an issue of the GitHub REST API
+type githubIssue struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	State   string `json:"state"`
+	Body    string `json:"body"`
+	// PullRequest is set for pull requests, which the issues API lists too
+	PullRequest *struct{} `json:"pull_request"`
+}
+
+// request calls the GitHub REST API, see callJSON
+func (t *githubTracker) request(method, path string, in, out any) error {
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github+json")
+	header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if t.token != "" {
+		header.Set("Authorization", "Bearer "+t.token)
+	}
+	return callJSON("github", method, t.api+path, header, in, out)
+}
+
+func (t *githubTracker) ticket(project string, issue githubIssue) Ticket {
+	return Ticket{Tracker: t.name(), Key: fmt.Sprintf("%s#%d", project, issue.Number), URL: issue.HTMLURL, State: issue.State}
+}
+
+// existing lists the issues of the project labeled tr4ck, in any state
+func (t *githubTracker) existing(project string) (map[string]Ticket, error) {
+	tickets := map[string]Ticket{}
+	for page := 1; ; page++ {
+		var issues []githubIssue
+		path := fmt.Sprintf("/repos/%s/issues?labels=%s&state=all&per_page=100&page=%d", project, ticketLabel, page)
+		if err := t.request(http.MethodGet, path, nil, &issues); err != nil {
+			return nil, err
+		}
+		for _, issue := range issues {
+			if match := ticketIDPattern.FindStringSubmatch(issue.Body); match != nil && issue.PullRequest == nil {
+				tickets[match[1]] = t.ticket(project, issue)
+			}
+		}
+		if len(issues) < 100 {
+			return tickets, nil
+		}
+	}
+}
+
+func (t *githubTracker) open(project string, m *StoredMarker, title, body string, labels []string) (Ticket, error) {
+	var issue githubIssue
+	in := map[string]any{"title": title, "body": withTicketID(body, m.ID), "labels": labels}
+	if err := t.request(http.MethodPost, "/repos/"+project+"/issues", in, &issue); err != nil {
+		return Ticket{}, err
+	}
+	return t.ticket(project, issue), nil
+}
+
+// issuePath is the API path of an issue
+func (t *githubTracker) issuePath(ticket Ticket) (string, error) {
+	project, number, ok := strings.Cut(ticket.Key, "#")
+	if !ok {
+		return "", fmt.Errorf("invalid github issue %s", ticket.Key)
+	}
+	return fmt.Sprintf("/repos/%s/issues/%s", project, number), nil
+}
+
+func (t *githubTracker) comment(ticket Ticket, comment string) error {
+	path, err := t.issuePath(ticket)
+	if err != nil {
+		return err
+	}
+	return t.request(http.MethodPost, path+"/comments", map[string]string{"body": comment}, nil)
+}
+
+// close comments on the issue, then closes it as completed
+func (t *githubTracker) close(ticket Ticket, comment string) error {
+	path, err := t.issuePath(ticket)
+	if err != nil {
+		return err
+	}
+	if err := t.comment(ticket, comment); err != nil {
+		return err
+	}
+	return t.request(http.MethodPatch, path, map[string]string{"state": "closed", "state_reason": "completed"}, nil)
+}
+
+func (t *githubTracker) reference(project, ref string) (Ticket, bool) {
+	return numberReference(t.name(), project, ref)
+}
+
+func (t *githubTracker) lookup(ticket Ticket) (Ticket, error) {
+	path, err := t.issuePath(ticket)
+	if err != nil {
+		return ticket, err
+	}
+	var issue githubIssue
+	if err := t.request(http.MethodGet, path, nil, &issue); err != nil {
+		return ticket, err
+	}
+	project, _, _ := strings.Cut(ticket.Key, "#")
+	return t.ticket(project, issue), nil
+}
+
+// githubRepo is a repository listed by GitHub
+type githubRepo struct {
+	Name     string   `json:"name"`
+	CloneURL string   `json:"clone_url"`
+	Fork     bool     `json:"fork"`
+	Archived bool     `json:"archived"`
+	Disabled bool     `json:"disabled"`
+	Topics   []string `json:"topics"`
+}
+
+// repositories lists the repositories of an organization, or of a user when user is set
+func (t *githubTracker) repositories(owner string, user bool) ([]githubRepo, error) {
+	path := "/orgs/" + url.PathEscape(owner) + "/repos?type=all"
+	if user {
+		path = "/users/" + url.PathEscape(owner) + "/repos?type=owner"
+	}
+
+	var repos []githubRepo
+	for page := 1; ; page++ {
+		var batch []githubRepo
+		if err := t.request(http.MethodGet, fmt.Sprintf("%s&per_page=100&page=%d", path, page), nil, &batch); err != nil {
+			return nil, err
+		}
+		repos = append(repos, batch...)
+		if len(batch) < 100 {
+			return repos, nil
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// gitlabConfig is the gitlab section of the config, nil when issues are not opened on GitLab
+var gitlabConfig *GitLabConfig
+
+// GitLabConfig opens a GitLab issue per new marker and closes it when the marker is resolved
+type GitLabConfig struct {
+	// Token is a personal, group or project access token with the api scope, GITLAB_TOKEN when empty
+	Token string `yaml:"token"`
+	// APIURL is the REST API of the GitLab instance, https://gitlab.com/api/v4 by default
+	APIURL string `yaml:"api_url"`
+	// Repos maps repositories to the project path their issues are opened in. Other repositories hosted on
+	// the GitLab instance get issues in themselves.
+	Repos map[string]string `yaml:"repos"`
+	// ProjectLabels are added to the issues of each project, by project path
+	ProjectLabels map[string][]string `yaml:"project_labels"`
+	IssueConfig   `yaml:",inline"`
+}
+
+// gitlabTracker is the issue tracker of the GitLab REST API
+type gitlabTracker struct {
+	c     GitLabConfig
+	api   string
+	host  string
+	token string
+}
+
+func newGitLabTracker(c GitLabConfig) *gitlabTracker {
+	t := &gitlabTracker{c: c, api: strings.TrimRight(c.APIURL, "/"), token: c.Token}
+	if t.api == "" {
+		t.api = "https://gitlab.com/api/v4"
+	}
+	if u, err := url.Parse(t.api); err == nil {
+		t.host = strings.ToLower(u.Host)
+	}
+	if t.token == "" {
+		t.token = os.Getenv("GITLAB_TOKEN")
+	}
+	return t
+}
+
+func (t *gitlabTracker) name() string {
+	return "gitlab"
+}
+
+func (t *gitlabTracker) config() IssueConfig {
+	return t.c.IssueConfig
+}
+
+// project maps the canonical URI of a repository to its project path, e.g. group/subgroup/name
+func (t *gitlabTracker) project(repo string) string {
+	for uri, project := range t.c.Repos {
+		if canonicalURI(uri) == repo {
+			return project
+		}
+	}
+	if path, ok := strings.CutPrefix(repo, t.host+"/"); ok && t.host != "" {
+		return path
+	}
+	return ""
+}
+
+// gitlabIssue is an issue of the GitLab REST API
+type gitlabIssue struct {
+	IID         int    `json:"iid"`
+	WebURL      string `json:"web_url"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+}
+
+// request calls the GitLab REST API, see callJSON
+func (t *gitlabTracker) request(method, path string, in, out any) error {
+	header := http.Header{}
+	if t.token != "" {
+		header.Set("PRIVATE-TOKEN", t.token)
+	}
+	return callJSON("gitlab", method, t.api+path, header, in, out)
+}
+
+// ticket converts an issue, whose state is opened or closed
+func (t *gitlabTracker) ticket(project string, issue gitlabIssue) Ticket {
+	state := issue.State
+	if state == "opened" {
+		state = "open"
+	}
+	return Ticket{Tracker: t.name(), Key: fmt.Sprintf("%s#%d", project, issue.IID), URL: issue.WebURL, State: state}
+}
+
+// existing lists the issues of the project labeled tr4ck, in any state
+func (t *gitlabTracker) existing(project string) (map[string]Ticket, error) {
+	tickets := map[string]Ticket{}
+	for page := 1; ; page++ {
+		var issues []gitlabIssue
+		path := fmt.Sprintf("/projects/%s/issues?labels=%s&scope=all&state=all&per_page=100&page=%d", url.PathEscape(project), ticketLabel, page)
+		if err := t.request(http.MethodGet, path, nil, &issues); err != nil {
+			return nil, err
+		}
+		for _, issue := range issues {
+			if match := ticketIDPattern.FindStringSubmatch(issue.Description); match != nil {
+				tickets[match[1]] = t.ticket(project, issue)
+			}
+		}
+		if len(issues) < 100 {
+			return tickets, nil
+		}
+	}
+}
+
+// open creates an issue with the labels of the marker and of the project
+func (t *gitlabTracker) open(project string, m *StoredMarker, title, body string, labels []string) (Ticket, error) {
+	labels = append(labels, t.c.ProjectLabels[project]...)
+
+	var issue gitlabIssue
+	in := map[string]string{"title": title, "description": withTicketID(body, m.ID), "labels": strings.Join(labels, ",")}
+	if err := t.request(http.MethodPost, "/projects/"+url.PathEscape(project)+"/issues", in, &issue); err != nil {
+		return Ticket{}, err
+	}
+	return t.ticket(project, issue), nil
+}
+
+// issuePath is the API path of an issue
+func (t *gitlabTracker) issuePath(ticket Ticket) (string, error) {
+	project, iid, ok := strings.Cut(ticket.Key, "#")
+	if !ok {
+		return "", fmt.Errorf("invalid gitlab issue %s", ticket.Key)
+	}
+	return fmt.Sprintf("/projects/%s/issues/%s", url.PathEscape(project), iid), nil
+}
+
+// comment adds a note to the issue
+func (t *gitlabTracker) comment(ticket Ticket, comment string) error {
+	path, err := t.issuePath(ticket)
+	if err != nil {
+		return err
+	}
+	return t.request(http.MethodPost, path+"/notes", map[string]string{"body": comment}, nil)
+}
+
+// close adds a note to the issue, then closes it
+func (t *gitlabTracker) close(ticket Ticket, comment string) error {
+	path, err := t.issuePath(ticket)
+	if err != nil {
+		return err
+	}
+	if err := t.comment(ticket, comment); err != nil {
+		return err
+	}
+	return t.request(http.MethodPut, path, map[string]string{"state_event": "close"}, nil)
+}
+
+func (t *gitlabTracker) reference(project, ref string) (Ticket, bool) {
+	return numberReference(t.name(), project, ref)
+}
+
+func (t *gitlabTracker) lookup(ticket Ticket) (Ticket, error) {
+	path, err := t.issuePath(ticket)
+	if err != nil {
+		return ticket, err
+	}
+	var issue gitlabIssue
+	if err := t.request(http.MethodGet, path, nil, &issue); err != nil {
+		return ticket, err
+	}
+	project, _, _ := strings.Cut(ticket.Key, "#")
+	return t.ticket(project, issue), nil
+}
+
+// gitlabProject is a project listed by GitLab
+type gitlabProject struct {
+	PathWithNamespace string    `json:"path_with_namespace"`
+	HTTPURLToRepo     string    `json:"http_url_to_repo"`
+	Archived          bool      `json:"archived"`
+	ForkedFromProject *struct{} `json:"forked_from_project"`
+	Topics            []string  `json:"topics"`
+}
+
+// projects lists the projects of a group, and of its subgroups when recursive is set
+func (t *gitlabTracker) projects(group string, recursive bool) ([]gitlabProject, error) {
+	path := fmt.Sprintf("/groups/%s/projects?include_subgroups=%t&order_by=id&sort=asc", url.PathEscape(group), recursive)
+
+	var projects []gitlabProject
+	for page := 1; ; page++ {
+		var batch []gitlabProject
+		if err := t.request(http.MethodGet, fmt.Sprintf("%s&per_page=100&page=%d", path, page), nil, &batch); err != nil {
+			return nil, err
+		}
+		projects = append(projects, batch...)
+		if len(batch) < 100 {
+			return projects, nil
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cyber-nic/tr4ck/cli/tr4ckpb"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcAddr is the address tr4ck serve serves the gRPC API on, none when empty
+var grpcAddr string
+
+// grpcServer implements the TrackService of proto/tr4ck/v1/tr4ck.proto
+type grpcServer struct {
+	tr4ckpb.UnimplementedTrackServiceServer
+}
+
+// grpcScopes are the scopes required by the methods of the gRPC API when auth is configured
+var grpcScopes = map[string]string{
+	tr4ckpb.TrackService_Scan_FullMethodName:         scopeAdmin,
+	tr4ckpb.TrackService_Sync_FullMethodName:         scopeAdmin,
+	tr4ckpb.TrackService_ListRecords_FullMethodName:  scopeRead,
+	tr4ckpb.TrackService_QueryMarkers_FullMethodName: scopeRead,
+}
+
+// serveGRPC serves the gRPC API on grpcAddr, the calls requiring the tokens of auth if set and those requiring
+// admin being refused when readOnly, returning a function stopping it
+func serveGRPC(auth *authenticator, readOnly bool) func() {
+	listener, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		log.Fatal().Err(err).Str("addr", grpcAddr).Msg("Failed to serve the gRPC API")
+	}
+
+	var opts []grpc.ServerOption
+	if auth != nil || readOnly {
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				if err := grpcAuthorize(ctx, auth, readOnly, info.FullMethod); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := grpcAuthorize(ss.Context(), auth, readOnly, info.FullMethod); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			}),
+		)
+	}
+
+	server := grpc.NewServer(opts...)
+	tr4ckpb.RegisterTrackServiceServer(server, &grpcServer{})
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Fatal().Err(err).Str("addr", grpcAddr).Msg("Failed to serve the gRPC API")
+		}
+	}()
+	log.Info().Str("addr", grpcAddr).Msg("Serving the gRPC API")
+	return server.Stop
+}
+
+// grpcAuthorize checks the bearer token of the authorization metadata of a call against the scope of its method,
+// unknown methods requiring admin, which are refused when readOnly
+func grpcAuthorize(ctx context.Context, auth *authenticator, readOnly bool, method string) error {
+	scope, ok := grpcScopes[method]
+	if !ok {
+		scope = scopeAdmin
+	}
+	if readOnly && scope == scopeAdmin {
+		return status.Error(codes.PermissionDenied, errReadOnlyServer.Error())
+	}
+
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			if t, ok := strings.CutPrefix(value, "Bearer "); ok {
+				token = strings.TrimSpace(t)
+			}
+		}
+	}
+
+	err := auth.authorize(token, scope)
+	switch {
+	case errors.Is(err, errForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return nil
+}
+
+// eventStream streams the events of a scan or sync. Scans can not be interrupted, so events are dropped once the
+// client is gone, err holding why.
+type eventStream struct {
+	stream grpc.ServerStreamingServer[tr4ckpb.ScanEvent]
+	err    error
+	// files counts the files scanned in the current repository
+	files int
+}
+
+func (e *eventStream) send(event *tr4ckpb.ScanEvent) {
+	if e.err == nil {
+		e.err = e.stream.Send(event)
+	}
+}
+
+// scanned streams a file read by the scan, see onScanned
+func (e *eventStream) scanned(file string, findings []Finding) {
+	e.files++
+	e.send(&tr4ckpb.ScanEvent{Event: &tr4ckpb.ScanEvent_File{File: &tr4ckpb.FileScanned{
+		File:    file,
+		Markers: int32(len(findings)),
+		Files:   int32(e.files),
+	}}})
+}
+
+// synced streams the findings and result of a repository of a sync, see onSynced
+func (e *eventStream) synced(repo RepoSync, result *ScanResult) {
+	if result == nil {
+		result = &ScanResult{Repo: repo.Repo, Branch: repo.Branch}
+	}
+	e.result(*result, repo.Duration, repo.Err)
+}
+
+// result streams the findings, resolved findings and result of a repository
+func (e *eventStream) result(result ScanResult, duration time.Duration, err error) {
+	for _, f := range result.Findings {
+		e.send(&tr4ckpb.ScanEvent{Event: &tr4ckpb.ScanEvent_Finding{Finding: findingMessage(result.Repo, result.Branch, f, false)}})
+	}
+	for _, f := range result.Resolved {
+		e.send(&tr4ckpb.ScanEvent{Event: &tr4ckpb.ScanEvent_Finding{Finding: findingMessage(result.Repo, result.Branch, f, true)}})
+	}
+
+	message := &tr4ckpb.RepositoryResult{
+		Repo:       result.Repo,
+		Branch:     result.Branch,
+		From:       result.From,
+		To:         result.To,
+		Findings:   int32(len(result.Findings)),
+		Resolved:   int32(len(result.Resolved)),
+		DurationMs: duration.Milliseconds(),
+	}
+	if len(result.Skipped) > 0 {
+		message.Skipped = map[string]int32{}
+		for reason, count := range result.Skipped {
+			message.Skipped[reason] = int32(count)
+		}
+	}
+	if err != nil {
+		message.Error = err.Error()
+	}
+	e.send(&tr4ckpb.ScanEvent{Event: &tr4ckpb.ScanEvent_Result{Result: message}})
+	e.files = 0
+}
+
+// findingMessage converts a finding of a repository
+func findingMessage(repo, branch string, f Finding, resolved bool) *tr4ckpb.Finding {
+	message := &tr4ckpb.Finding{
+		Repo:        repo,
+		Branch:      branch,
+		Id:          f.ID,
+		File:        f.File,
+		Line:        int32(f.Line),
+		Column:      int32(f.Column),
+		Marker:      f.Marker,
+		Text:        f.Text,
+		Assignee:    f.Assignee,
+		Due:         f.Due,
+		Priority:    f.Priority,
+		Description: f.Description,
+		Issues:      f.Issues,
+		Owners:      f.Owners,
+		Author:      f.Author,
+		Email:       f.Email,
+		Commit:      f.Commit,
+		Resolved:    resolved,
+	}
+	if f.Date != nil {
+		message.Date = timestamppb.New(*f.Date)
+	}
+	return message
+}
+
+// Scan scans the latest commit of a repository, streaming each file read, then the findings and the result
+func (s *grpcServer) Scan(req *tr4ckpb.ScanRequest, stream grpc.ServerStreamingServer[tr4ckpb.ScanEvent]) error {
+	if req.Uri == "" {
+		return status.Error(codes.InvalidArgument, "uri is required")
+	}
+	unregistered, err := unregisteredDir(req.Uri)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if unregistered {
+		return status.Errorf(codes.PermissionDenied, "directory %s is not registered", req.Uri)
+	}
+
+	scanMu.Lock()
+	defer scanMu.Unlock()
+	resetSkipped()
+
+	events := &eventStream{stream: stream}
+	onScanned = events.scanned
+	defer func() { onScanned = nil }()
+
+	start := time.Now()
+	result, err := scanFindings(req.Uri)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to scan %s: %v", req.Uri, err)
+	}
+	result.Findings = storeFindings(result)
+	findings, err := filterBaseline(result.Findings)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to apply baseline: %v", err)
+	}
+	result.Findings = findings
+
+	events.result(result, time.Since(start), nil)
+	return events.err
+}
+
+// Sync syncs the registry, or the entries of a repository, streaming each file read, and the findings and result
+// of each repository once synced
+func (s *grpcServer) Sync(req *tr4ckpb.SyncRequest, stream grpc.ServerStreamingServer[tr4ckpb.ScanEvent]) error {
+	if req.Branch != "" && req.Uri == "" {
+		return status.Error(codes.InvalidArgument, "branch requires uri")
+	}
+	var only func(RegistryRecord) bool
+	if req.Uri != "" {
+		records, err := registryRecords(req.Uri, req.Branch)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if len(records) == 0 {
+			return status.Errorf(codes.NotFound, "URI %s %v", describeRecord(RegistryRecord{URI: req.Uri, Branch: req.Branch}), errRecordNotFound)
+		}
+		only = func(record RegistryRecord) bool {
+			return sameURI(record.URI, req.Uri) && (req.Branch == "" || record.Branch == req.Branch)
+		}
+	}
+
+	// the registry remote is only fetched once per command otherwise
+	preRunRemoteRegistry()
+
+	scanMu.Lock()
+	defer scanMu.Unlock()
+
+	events := &eventStream{stream: stream}
+	onScanned, onSynced = events.scanned, events.synced
+	defer func() { onScanned, onSynced = nil, nil }()
+
+	if _, err := syncLocked(only); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return events.err
+}
+
+// ListRecords lists the registry entries of a URI or glob, and with a label, all of them by default
+func (s *grpcServer) ListRecords(ctx context.Context, req *tr4ckpb.ListRecordsRequest) (*tr4ckpb.ListRecordsResponse, error) {
+	records, err := matchRecords(req.Uri, req.Label)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &tr4ckpb.ListRecordsResponse{}
+	for _, record := range records {
+		resp.Records = append(resp.Records, &tr4ckpb.Record{
+			Uri:        record.URI,
+			Branch:     record.Branch,
+			RootHash:   record.RootHash,
+			LatestHash: record.LastestHash,
+			Markers:    record.Markers,
+			Labels:     record.Labels,
+			Note:       record.Note,
+			Include:    record.Include,
+			Exclude:    record.Exclude,
+			Disabled:   record.Disabled,
+			Source:     record.Source,
+			Schedule:   record.Schedule,
+		})
+	}
+	return resp, nil
+}
+
+// QueryMarkers streams the stored markers matching filters, see MarkerQuery
+func (s *grpcServer) QueryMarkers(req *tr4ckpb.QueryMarkersRequest, stream grpc.ServerStreamingServer[tr4ckpb.StoredMarker]) error {
+	q := MarkerQuery{
+		Repo:      req.Repo,
+		Markers:   req.Markers,
+		Author:    req.Author,
+		State:     req.State,
+		OlderThan: req.OlderThan,
+		Paths:     req.Paths,
+		Overdue:   req.Overdue,
+		Zombie:    req.Zombie,
+		At:        req.At,
+	}
+	if q.State == "" {
+		q.State = markerOpen
+	}
+
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("failed to load marker store: %v", err))
+	}
+	markers, err := store.query(q, time.Now())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	for _, m := range markers {
+		message := &tr4ckpb.StoredMarker{
+			Finding:      findingMessage(m.Repo, m.Branch, m.Finding, false),
+			State:        m.State,
+			FirstSeen:    timestamppb.New(m.FirstSeen),
+			LastSeen:     timestamppb.New(m.LastSeen),
+			IgnoreReason: m.IgnoreReason,
+		}
+		if m.ResolvedAt != nil {
+			message.ResolvedAt = timestamppb.New(*m.ResolvedAt)
+		}
+		if err := stream.Send(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
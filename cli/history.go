@@ -0,0 +1,302 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// reportTrend reports the evolution of marker counts instead of the current findings
+	reportTrend bool
+	// trendSince is how far back the trend goes, e.g. 90d
+	trendSince = "90d"
+)
+
+// sparks are the bars of sparklines, from lowest to highest
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// Snapshot is the number of findings per marker of each registry entry after a sync
+type Snapshot struct {
+	Time time.Time `json:"time"`
+	// Counts are by record key, then marker
+	Counts map[string]map[string]int `json:"counts"`
+}
+
+// TrendPoint is the number of findings at the last snapshot of a day
+type TrendPoint struct {
+	Time  time.Time `json:"time"`
+	Count int       `json:"count"`
+}
+
+// TrendSeries is the evolution of the findings of a marker in a repository, or of all its findings without marker
+type TrendSeries struct {
+	Repo   string       `json:"repo"`
+	Marker string       `json:"marker,omitempty"`
+	Points []TrendPoint `json:"points"`
+}
+
+// snapshot counts the findings of each record by marker
+func (s findingsState) snapshot() Snapshot {
+	snapshot := Snapshot{Time: time.Now().UTC(), Counts: map[string]map[string]int{}}
+	for key, findings := range s {
+		counts := map[string]int{}
+		for _, f := range findings {
+			counts[f.Marker]++
+		}
+		snapshot.Counts[key] = counts
+	}
+	return snapshot
+}
+
+// appendSnapshot adds a snapshot to the history
+func appendSnapshot(db dbExecer, snapshot Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+
+	if _, err := db.Exec("INSERT INTO history (time, data) VALUES (?, ?)", snapshot.Time.UnixNano(), data); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+
+	return nil
+}
+
+// loadHistory reads the snapshots taken after since, oldest first
+func loadHistory(db *sql.DB, since time.Time) ([]Snapshot, error) {
+	rows, err := db.Query("SELECT data FROM history WHERE time > ? ORDER BY time", since.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []Snapshot
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", err)
+		}
+		var snapshot Snapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to parse history: %w", err)
+		}
+		history = append(history, snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	return history, nil
+}
+
+// trendSeries returns the total and per marker series of each repository, keeping the last snapshot of each day
+func trendSeries(history []Snapshot) []TrendSeries {
+	var daily []Snapshot
+	for _, snapshot := range history {
+		if n := len(daily); n > 0 && sameDay(daily[n-1].Time, snapshot.Time) {
+			daily[n-1] = snapshot
+			continue
+		}
+		daily = append(daily, snapshot)
+	}
+
+	// every marker ever seen in a repository, so that a resolved marker drops to 0
+	markers := map[string]map[string]bool{}
+	for _, snapshot := range daily {
+		for key, counts := range snapshot.Counts {
+			if markers[key] == nil {
+				markers[key] = map[string]bool{}
+			}
+			for marker := range counts {
+				markers[key][marker] = true
+			}
+		}
+	}
+
+	var keys []string
+	for key := range markers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var series []TrendSeries
+	for _, key := range keys {
+		var names []string
+		for marker := range markers[key] {
+			names = append(names, marker)
+		}
+		sort.Strings(names)
+
+		total := TrendSeries{Repo: recordKeyTitle(key)}
+		perMarker := make([]TrendSeries, len(names))
+		for i, marker := range names {
+			perMarker[i] = TrendSeries{Repo: total.Repo, Marker: marker}
+		}
+
+		for _, snapshot := range daily {
+			counts, ok := snapshot.Counts[key]
+			if !ok {
+				continue
+			}
+			sum := 0
+			for i, marker := range names {
+				perMarker[i].Points = append(perMarker[i].Points, TrendPoint{Time: snapshot.Time, Count: counts[marker]})
+				sum += counts[marker]
+			}
+			total.Points = append(total.Points, TrendPoint{Time: snapshot.Time, Count: sum})
+		}
+
+		series = append(series, total)
+		series = append(series, perMarker...)
+	}
+
+	return series
+}
+
+// sameDay reports whether two times fall on the same local day
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Local().Date()
+	by, bm, bd := b.Local().Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// recordKeyTitle names the repository and branch of a record key, see recordKey
+func recordKeyTitle(key string) string {
+	uri, branch, _ := strings.Cut(key, "#")
+	if branch != "" {
+		return uri + " (" + branch + ")"
+	}
+	return uri
+}
+
+// sparkline draws counts as a line of bars scaled between their minimum and maximum
+func sparkline(points []TrendPoint) string {
+	if len(points) == 0 {
+		return ""
+	}
+
+	lo, hi := points[0].Count, points[0].Count
+	for _, p := range points {
+		lo, hi = min(lo, p.Count), max(hi, p.Count)
+	}
+
+	var b strings.Builder
+	for _, p := range points {
+		i := 0
+		if hi > lo {
+			i = (p.Count - lo) * (len(sparks) - 1) / (hi - lo)
+		}
+		b.WriteRune(sparks[i])
+	}
+	return b.String()
+}
+
+// runTrend prints the evolution of marker counts over the snapshots taken by sync since trendSince,
+// in outputFormat to outputPath or stdout
+func runTrend() {
+	age, err := parseAge(trendSince)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid --since")
+	}
+
+	db, err := storeDB()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open database")
+	}
+	history, err := loadHistory(db, time.Now().Add(-age))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load history")
+	}
+
+	var w io.Writer = os.Stdout
+	f, err := openOutput()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open output")
+	}
+	if f != nil {
+		defer f.Close()
+		w = f
+	}
+
+	if err := printTrend(w, trendSeries(history), outputFormat); err != nil {
+		log.Fatal().Err(err).Msg("Failed to print trend")
+	}
+}
+
+// printTrend writes the series in the given format: text or markdown (a table with sparklines), csv, json
+// or porcelain (tab-separated date, repository, marker and count)
+func printTrend(w io.Writer, series []TrendSeries, format string) error {
+	switch format {
+	case "json":
+		if series == nil {
+			series = []TrendSeries{}
+		}
+		PrintStruct(w, series)
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"date", "repo", "marker", "count"})
+		for _, s := range series {
+			for _, p := range s.Points {
+				cw.Write([]string{p.Time.Local().Format("2006-01-02"), s.Repo, s.Marker, strconv.Itoa(p.Count)})
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return fmt.Errorf("failed to write csv: %w", err)
+		}
+
+	case "porcelain":
+		for _, s := range series {
+			for _, p := range s.Points {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", p.Time.Local().Format("2006-01-02"), s.Repo, seriesMarker(s), p.Count)
+			}
+		}
+
+	case "markdown":
+		fmt.Fprintf(w, "# tr4ck trend since %s\n\n", trendSince)
+		fmt.Fprintln(w, "| Repository | Marker | First | Last | Change | Trend |")
+		fmt.Fprintln(w, "|---|---|---:|---:|---:|---|")
+		for _, s := range series {
+			first, last := s.Points[0].Count, s.Points[len(s.Points)-1].Count
+			fmt.Fprintf(w, "| %s | %s | %d | %d | %s | %s |\n", markdownEscaper.Replace(s.Repo), markdownEscaper.Replace(seriesMarker(s)), first, last, signed(last-first), sparkline(s.Points))
+		}
+
+	case "text":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, s := range series {
+			first, last := s.Points[0].Count, s.Points[len(s.Points)-1].Count
+			repo := aurora.Blue(s.Repo).String()
+			if s.Marker != "" {
+				repo = ""
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n", repo, aurora.BrightGreen(seriesMarker(s)), first, last, signed(last-first), sparkline(s.Points))
+		}
+		tw.Flush()
+
+	default:
+		return fmt.Errorf("unsupported format %s", format)
+	}
+
+	return nil
+}
+
+// seriesMarker names the marker of a series, all for the total of a repository
+func seriesMarker(s TrendSeries) string {
+	if s.Marker == "" {
+		return "all"
+	}
+	return s.Marker
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// hookSignature marks the pre-commit hooks written by hook install, which it may overwrite
+const hookSignature = "# installed by tr4ck hook install"
+
+// HookOptions configure the pre-commit check of staged files
+type HookOptions struct {
+	// Mode is block to abort commits adding markers that meet a --fail-on condition, or warn to only list them
+	Mode string
+	// Command runs tr4ck from the installed hook
+	Command string
+	// Force overwrites an existing hook that was not installed by tr4ck
+	Force bool
+	// FailOn are the --fail-on conditions blocking commits, new-markers by default. They are kept apart from the
+	// conditions of scan, sync and report, which have no default.
+	FailOn []string
+}
+
+func (o HookOptions) validate() error {
+	if o.Mode != "block" && o.Mode != "warn" {
+		return fmt.Errorf("invalid --mode %s, expected block or warn", o.Mode)
+	}
+	return nil
+}
+
+// openWorktree opens the git repository of the current directory and returns it with the root of its worktree
+func openWorktree() (*git.Repository, string, error) {
+	repo, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open repository: %w", err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get worktree: %w", err)
+	}
+	return repo, w.Filesystem.Root(), nil
+}
+
+// stagedFindings lists the markers of the staged files that are not in HEAD, by file, marker and text so that
+// markers moved by other edits are not new. files restricts the check to these paths when not empty.
+func stagedFindings(repo *git.Repository, files []string, markers []string, paths pathFilter) ([]Finding, error) {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	// there is no HEAD before the first commit
+	var head *object.Tree
+	if ref, err := repo.Head(); err == nil {
+		commit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get HEAD commit: %w", err)
+		}
+		if head, err = commit.Tree(); err != nil {
+			return nil, fmt.Errorf("failed to get HEAD tree: %w", err)
+		}
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, fmt.Errorf("failed to get HEAD reference: %w", err)
+	}
+
+	matcher := newMarkerMatcher(markers)
+
+	var findings []Finding
+	for _, entry := range idx.Entries {
+		if entry.Mode == filemode.Submodule || (len(files) > 0 && !slices.Contains(files, entry.Name)) {
+			continue
+		}
+
+		var previous *object.File
+		if head != nil {
+			if previous, err = head.File(entry.Name); err == nil && previous.Hash == entry.Hash {
+				continue
+			}
+		}
+
+		blob, err := repo.BlobObject(entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read staged %s: %w", entry.Name, err)
+		}
+		hits, err := scanBlob(object.NewFile(entry.Name, entry.Mode, blob), matcher, paths)
+		if err != nil {
+			return nil, err
+		}
+		if len(hits) == 0 {
+			continue
+		}
+
+		known := map[BaselineEntry]int{}
+		if previous != nil {
+			before, err := scanBlob(previous, matcher, paths)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range before {
+				known[baselineEntry(f)]++
+			}
+		}
+		for _, hit := range hits {
+			if entry := baselineEntry(hit); known[entry] > 0 {
+				known[entry]--
+				continue
+			}
+			findings = append(findings, hit)
+		}
+	}
+
+	return findings, nil
+}
+
+// runHook checks the staged files for new markers, exiting with failExitCode in block mode when they meet a
+// --fail-on condition. files are paths relative to the current directory, as passed by pre-commit.
+func runHook(opts HookOptions, files []string) {
+	if err := opts.validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid options")
+	}
+	conditions, err := parseFailOn(opts.FailOn)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid options")
+	}
+
+	repo, root, err := openWorktree()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to check staged files")
+	}
+
+	// index paths are relative to the root of the worktree
+	var names []string
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			log.Fatal().Err(err).Str("file", file).Msg("Failed to resolve path")
+		}
+		if rel, err := filepath.Rel(root, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			names = append(names, filepath.ToSlash(rel))
+		}
+	}
+	if len(files) > 0 && len(names) == 0 {
+		return
+	}
+
+	defer applyRepoConfig(readDirRepoConfig(root))()
+	scanMarkers, scanPaths := scanSettings(nil)
+
+	findings, err := stagedFindings(repo, names, scanMarkers, scanPaths)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to check staged files")
+	}
+	findings, err = filterBaseline(findings)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to apply baseline")
+	}
+	if len(findings) == 0 {
+		return
+	}
+
+	printFindings(os.Stderr, findings)
+
+	failed := failures(conditions, []ScanResult{{Findings: findings}})
+	if opts.Mode == "warn" || len(failed) == 0 {
+		log.Warn().Int("markers", len(findings)).Msg(aurora.Yellow("New markers staged").String())
+		return
+	}
+
+	for _, reason := range failed {
+		log.Error().Str("condition", reason).Msg("Failure condition met")
+	}
+	log.Error().Int("markers", len(findings)).Msg("Commit blocked by new markers, resolve them or commit with --no-verify")
+	os.Exit(failExitCode)
+}
+
+// hooksDir returns the hooks directory of a repository: core.hooksPath, or the hooks of its git directory,
+// shared by linked worktrees
+func hooksDir(repo *git.Repository, root string) (string, error) {
+	if cfg, err := repo.Config(); err == nil && cfg.Raw != nil {
+		if path := cfg.Raw.Section("core").Option("hooksPath"); path != "" {
+			path = expandHome(path)
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(root, path)
+			}
+			return path, nil
+		}
+	}
+
+	gitDir := filepath.Join(root, ".git")
+	if data, err := os.ReadFile(gitDir); err == nil {
+		// a linked worktree or submodule, whose .git file points to its git directory
+		dir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+		if !ok {
+			return "", fmt.Errorf("invalid %s", gitDir)
+		}
+		gitDir = strings.TrimSpace(dir)
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(root, gitDir)
+		}
+		if common, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+			dir := strings.TrimSpace(string(common))
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(gitDir, dir)
+			}
+			gitDir = dir
+		}
+	}
+	return filepath.Join(gitDir, "hooks"), nil
+}
+
+// hookScript is the pre-commit hook running hook run with the options of hook install
+func hookScript(opts HookOptions) string {
+	args := []string{opts.Command, "hook", "run", "--mode", opts.Mode}
+	for _, condition := range opts.FailOn {
+		args = append(args, "--fail-on", "'"+strings.ReplaceAll(condition, "'", `'\''`)+"'")
+	}
+	if baselinePath != "" {
+		args = append(args, "--baseline", "'"+strings.ReplaceAll(baselinePath, "'", `'\''`)+"'")
+	}
+	return "#!/bin/sh\n" + hookSignature + "\nexec " + strings.Join(args, " ") + "\n"
+}
+
+// installHook writes the pre-commit hook of the repository of the current directory
+func installHook(opts HookOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if _, err := parseFailOn(opts.FailOn); err != nil {
+		return err
+	}
+
+	repo, root, err := openWorktree()
+	if err != nil {
+		return err
+	}
+	dir, err := hooksDir(repo, root)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, "pre-commit")
+	if data, err := os.ReadFile(path); err == nil && !strings.Contains(string(data), hookSignature) && !opts.Force {
+		return fmt.Errorf("%s already exists, use --force to replace it", path)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+	if err := writeFileAtomic(path, []byte(hookScript(opts)), 0755); err != nil {
+		return fmt.Errorf("failed to write hook: %w", err)
+	}
+
+	log.Info().Str("path", path).Str("mode", opts.Mode).Msg(aurora.Green("Installed pre-commit hook").String())
+	return nil
+}
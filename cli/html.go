@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+)
+
+// ageBuckets are the columns of the age heatmap, by upper bound in days
+var ageBuckets = []struct {
+	label string
+	days  int
+}{
+	{"< 30d", 30},
+	{"30-90d", 90},
+	{"90-180d", 180},
+	{"180d-1y", 365},
+	{"> 1y", -1},
+}
+
+// htmlBar is a bar of the summary charts
+type htmlBar struct {
+	Label   string
+	Count   int
+	Percent int
+}
+
+// htmlCell is a cell of the age heatmap, Level from 0 (none) to 4 (most findings)
+type htmlCell struct {
+	Count int
+	Level int
+}
+
+type htmlHeatRow struct {
+	Repo  string
+	Cells []htmlCell
+}
+
+type htmlRow struct {
+	ID     string
+	File   string
+	Line   int
+	URL    string
+	Marker string
+	Text   string
+	Author string
+	Age    string
+	// AgeDays sorts the age column, -1 without blame
+	AgeDays int
+}
+
+type htmlRepo struct {
+	Title  string
+	Commit string
+	Note   string
+	Rows   []htmlRow
+}
+
+type htmlData struct {
+	Generated string
+	Total     int
+	Markers   []htmlBar
+	Repos     []htmlBar
+	Buckets   []string
+	Heatmap   []htmlHeatRow
+	Unblamed  int
+	Results   []htmlRepo
+}
+
+// writeHTML writes the report as a self-contained HTML page with summary charts, an age heatmap
+// and sortable, filterable tables of findings per repository
+func writeHTML(w io.Writer, report Report) error {
+	data := htmlData{Generated: report.Started.UTC().Format("2006-01-02 15:04 MST")}
+	for _, bucket := range ageBuckets {
+		data.Buckets = append(data.Buckets, bucket.label)
+	}
+
+	markerCounts := map[string]int{}
+	heatMax := 0
+	for _, result := range report.Results {
+		title := result.title()
+		data.Total += len(result.Findings)
+		data.Repos = append(data.Repos, htmlBar{Label: title, Count: len(result.Findings)})
+
+		repo := htmlRepo{Title: title, Commit: fmt.Sprintf("%.7s", result.To), Note: result.Note}
+		heat := htmlHeatRow{Repo: title, Cells: make([]htmlCell, len(ageBuckets))}
+
+		files, byFile := groupByFile(result.Findings)
+		for _, file := range files {
+			for _, f := range byFile[file] {
+				markerCounts[f.Marker]++
+
+				row := htmlRow{
+					ID:      f.ID,
+					File:    f.File,
+					Line:    f.Line,
+					URL:     blobURL(result.Repo, result.To, f.File, f.Line),
+					Marker:  f.Marker,
+					Text:    f.Text,
+					Author:  f.Author,
+					Age:     f.Age,
+					AgeDays: -1,
+				}
+
+				if f.Date != nil {
+					row.AgeDays = int(report.Started.Sub(*f.Date) / (24 * time.Hour))
+					cell := &heat.Cells[ageBucket(row.AgeDays)]
+					cell.Count++
+					heatMax = max(heatMax, cell.Count)
+				} else {
+					data.Unblamed++
+				}
+
+				repo.Rows = append(repo.Rows, row)
+			}
+		}
+
+		data.Results = append(data.Results, repo)
+		data.Heatmap = append(data.Heatmap, heat)
+	}
+
+	for marker, count := range markerCounts {
+		data.Markers = append(data.Markers, htmlBar{Label: marker, Count: count})
+	}
+	sortBars(data.Markers, data.Total)
+	sortBars(data.Repos, data.Total)
+
+	for _, row := range data.Heatmap {
+		for i := range row.Cells {
+			if row.Cells[i].Count > 0 {
+				row.Cells[i].Level = 1 + 3*(row.Cells[i].Count-1)/max(heatMax-1, 1)
+			}
+		}
+	}
+
+	if err := htmlTemplate.Execute(w, data); err != nil {
+		return fmt.Errorf("failed to render html: %w", err)
+	}
+	return nil
+}
+
+// ageBucket returns the heatmap column of an age in days
+func ageBucket(days int) int {
+	for i, bucket := range ageBuckets {
+		if bucket.days < 0 || days < bucket.days {
+			return i
+		}
+	}
+	return len(ageBuckets) - 1
+}
+
+// sortBars orders bars by count, largest first, and sets their share of total
+func sortBars(bars []htmlBar, total int) {
+	sort.SliceStable(bars, func(i, j int) bool {
+		if bars[i].Count != bars[j].Count {
+			return bars[i].Count > bars[j].Count
+		}
+		return bars[i].Label < bars[j].Label
+	})
+	for i := range bars {
+		if total > 0 {
+			bars[i].Percent = 100 * bars[i].Count / total
+		}
+	}
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>tr4ck report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+h1 { margin-bottom: 0; }
+.muted { color: #6e7781; }
+.charts { display: flex; flex-wrap: wrap; gap: 3em; margin: 1.5em 0; }
+.chart { min-width: 320px; }
+.bar { display: flex; align-items: center; margin: 2px 0; font-size: 0.9em; }
+.bar .label { width: 14em; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+.bar .fill { background: #0969da; height: 1em; margin-right: 0.5em; min-width: 2px; }
+table { border-collapse: collapse; margin: 0.5em 0 2em; font-size: 0.9em; }
+th, td { border: 1px solid #d0d7de; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+table.findings th { cursor: pointer; user-select: none; }
+table.findings td.text { font-family: ui-monospace, Menlo, monospace; white-space: pre-wrap; }
+.heat td.level { text-align: center; min-width: 4em; }
+.heat .l0 { background: #ffffff; }
+.heat .l1 { background: #fff1c2; }
+.heat .l2 { background: #ffd58a; }
+.heat .l3 { background: #ff9f5a; }
+.heat .l4 { background: #f0604d; color: #fff; }
+#filter { padding: 6px; width: 24em; margin-bottom: 1em; }
+</style>
+</head>
+<body>
+<h1>tr4ck report</h1>
+<p class="muted">Generated {{.Generated}}, {{.Total}} findings in {{len .Results}} repositories.</p>
+
+<div class="charts">
+<div class="chart">
+<h3>Findings per marker</h3>
+{{range .Markers}}<div class="bar"><span class="label">{{.Label}}</span><span class="fill" style="width: {{.Percent}}%"></span>{{.Count}}</div>
+{{end}}</div>
+<div class="chart">
+<h3>Findings per repository</h3>
+{{range .Repos}}<div class="bar"><span class="label" title="{{.Label}}">{{.Label}}</span><span class="fill" style="width: {{.Percent}}%"></span>{{.Count}}</div>
+{{end}}</div>
+</div>
+
+<h2>Age</h2>
+<table class="heat">
+<tr><th>Repository</th>{{range .Buckets}}<th>{{.}}</th>{{end}}</tr>
+{{range .Heatmap}}<tr><td>{{.Repo}}</td>{{range .Cells}}<td class="level l{{.Level}}">{{if .Count}}{{.Count}}{{end}}</td>{{end}}</tr>
+{{end}}</table>
+{{if .Unblamed}}<p class="muted">{{.Unblamed}} findings without blame are not shown, scan with --blame to age them.</p>{{end}}
+
+<h2>Findings</h2>
+<input id="filter" type="search" placeholder="Filter by file, marker, text or author">
+{{range .Results}}
+<h3>{{.Title}}{{if .Commit}} <span class="muted">{{.Commit}}</span>{{end}}</h3>
+{{if .Note}}<p class="muted">{{.Note}}</p>{{end}}
+{{if .Rows}}<table class="findings">
+<thead><tr><th>ID</th><th>File</th><th>Line</th><th>Marker</th><th>Text</th><th>Author</th><th>Age</th></tr></thead>
+<tbody>
+{{range .Rows}}<tr><td><code>{{.ID}}</code></td><td>{{.File}}</td><td data-sort="{{.Line}}">{{if .URL}}<a href="{{.URL}}">{{.Line}}</a>{{else}}{{.Line}}{{end}}</td><td>{{.Marker}}</td><td class="text">{{.Text}}</td><td>{{.Author}}</td><td data-sort="{{.AgeDays}}">{{.Age}}</td></tr>
+{{end}}</tbody>
+</table>{{else}}<p class="muted">No findings.</p>{{end}}
+{{end}}
+
+<script>
+document.getElementById("filter").addEventListener("input", function (e) {
+  var q = e.target.value.toLowerCase();
+  document.querySelectorAll("table.findings tbody tr").forEach(function (tr) {
+    tr.style.display = tr.textContent.toLowerCase().indexOf(q) < 0 ? "none" : "";
+  });
+});
+document.querySelectorAll("table.findings th").forEach(function (th) {
+  th.addEventListener("click", function () {
+    var table = th.closest("table"), body = table.tBodies[0];
+    var col = Array.prototype.indexOf.call(th.parentNode.children, th);
+    var asc = th.dataset.order !== "asc";
+    th.dataset.order = asc ? "asc" : "desc";
+    var key = function (tr) {
+      var td = tr.children[col];
+      return td.dataset.sort !== undefined ? Number(td.dataset.sort) : td.textContent.toLowerCase();
+    };
+    Array.from(body.rows).sort(function (a, b) {
+      var x = key(a), y = key(b);
+      return (x < y ? -1 : x > y ? 1 : 0) * (asc ? 1 : -1);
+    }).forEach(function (tr) { body.appendChild(tr); });
+  });
+});
+</script>
+</body>
+</html>
+`))
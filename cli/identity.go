@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// minSimilarity is the text similarity above which an edited marker line is the same marker
+const minSimilarity = 0.6
+
+// maxSimilarityPairs bounds the number of text comparisons when reconciling findings
+const maxSimilarityPairs = 250000
+
+// findingMatch pairs a previous finding with the current finding it became, by index
+type findingMatch struct {
+	prev, cur int
+}
+
+// reconcile pairs the previous findings of a repository with its current findings, so that a marker keeps its
+// identity when its file is renamed, its line moves or its text is edited. Findings are matched, in order:
+//   - by file, marker and line content, as in baselines
+//   - by marker and line content in another file, preferring files with the same name, for renames and moves
+//   - by marker and similar line content, preferring the same file, for edits
+//
+// Unless fuzzy, only the first pass runs: a partial scan can not tell a moved or edited marker from one it did not
+// see. It returns the matches and the indexes of the current findings that are new and the previous ones that are gone.
+func reconcile(prev, cur []Finding, fuzzy bool) (matches []findingMatch, added, removed []int) {
+	prevLeft := make([]bool, len(prev))
+	curLeft := make([]bool, len(cur))
+	for i := range prevLeft {
+		prevLeft[i] = true
+	}
+	for i := range curLeft {
+		curLeft[i] = true
+	}
+	match := func(p, c int) {
+		matches = append(matches, findingMatch{p, c})
+		prevLeft[p], curLeft[c] = false, false
+	}
+
+	// unchanged markers
+	exact := map[BaselineEntry][]int{}
+	for i, f := range prev {
+		exact[baselineEntry(f)] = append(exact[baselineEntry(f)], i)
+	}
+	for c, f := range cur {
+		entry := baselineEntry(f)
+		if candidates := exact[entry]; len(candidates) > 0 {
+			exact[entry] = candidates[1:]
+			match(candidates[0], c)
+		}
+	}
+
+	if !fuzzy {
+		return matches, unmatched(curLeft), unmatched(prevLeft)
+	}
+
+	// renamed or moved files
+	type content struct{ marker, text string }
+	moved := map[content][]int{}
+	for i, f := range prev {
+		if prevLeft[i] {
+			moved[content{f.Marker, f.Text}] = append(moved[content{f.Marker, f.Text}], i)
+		}
+	}
+	for c, f := range cur {
+		if !curLeft[c] {
+			continue
+		}
+		key := content{f.Marker, f.Text}
+		candidates := moved[key]
+		if len(candidates) == 0 {
+			continue
+		}
+		best := 0
+		for i, p := range candidates {
+			if path.Base(prev[p].File) == path.Base(f.File) {
+				best = i
+				break
+			}
+		}
+		match(candidates[best], c)
+		moved[key] = slices.Delete(candidates, best, best+1)
+	}
+
+	// edited lines, best pairs first
+	type pair struct {
+		prev, cur int
+		score     float64
+	}
+	var pairs []pair
+	comparisons := 0
+	for c, f := range cur {
+		if !curLeft[c] {
+			continue
+		}
+		for p, g := range prev {
+			if !prevLeft[p] || g.Marker != f.Marker {
+				continue
+			}
+			if comparisons++; comparisons > maxSimilarityPairs {
+				break
+			}
+			score := textSimilarity(g, f)
+			if score < minSimilarity {
+				continue
+			}
+			if g.File == f.File {
+				score += 0.1
+			}
+			pairs = append(pairs, pair{p, c, score})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].score > pairs[j].score })
+	for _, p := range pairs {
+		if prevLeft[p.prev] && curLeft[p.cur] {
+			match(p.prev, p.cur)
+		}
+	}
+
+	return matches, unmatched(curLeft), unmatched(prevLeft)
+}
+
+// unmatched returns the indexes of the findings left
+func unmatched(left []bool) []int {
+	var indexes []int
+	for i, l := range left {
+		if l {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// textSimilarity is the Dice coefficient of the words of two marker lines, without the marker itself,
+// from 0 for no common word to 1 for the same words
+func textSimilarity(a, b Finding) float64 {
+	words := func(f Finding) map[string]int {
+		counts := map[string]int{}
+		for _, token := range searchTokens(f.Text) {
+			if token != strings.ToLower(f.Marker) {
+				counts[token]++
+			}
+		}
+		return counts
+	}
+
+	wa, wb := words(a), words(b)
+	total, common := 0, 0
+	for word, n := range wa {
+		total += n
+		common += min(n, wb[word])
+	}
+	for _, n := range wb {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	return 2 * float64(common) / float64(total)
+}
+
+// markerID is a short hash of the repository, file and whitespace-normalized text of a marker. The nth copy
+// of the same line in a file gets a distinct ID.
+func markerID(repo, file, text string, n int) string {
+	key := canonicalURI(repo) + "\x00" + file + "\x00" + strings.Join(strings.Fields(text), " ")
+	if n > 0 {
+		key += fmt.Sprintf("\x00%d", n)
+	}
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// usedIDs returns the IDs of the markers of a repository branch, in any state. IDs are only unique within a
+// branch, so that the same marker on several branches shares its ID.
+func (s *Store) usedIDs(repo, branch string) map[string]bool {
+	used := map[string]bool{}
+	for _, m := range s.Markers {
+		if m.Repo == repo && m.Branch == branch {
+			used[m.ID] = true
+		}
+	}
+	return used
+}
+
+// newID returns the ID of a new marker, unique among the IDs used
+func newID(repo string, f Finding, used map[string]bool) string {
+	for n := 0; ; n++ {
+		if id := markerID(repo, f.File, f.Text, n); !used[id] {
+			used[id] = true
+			return id
+		}
+	}
+}
+
+// identify sets the ID of findings of a repository branch: the ID of the stored marker they match, which was
+// assigned when the marker was first seen and survives renames and edits, or else a new one
+func (s *Store) identify(repo, branch string, findings []Finding) {
+	repo = canonicalURI(repo)
+
+	used := s.usedIDs(repo, branch)
+	stored := map[BaselineEntry][]string{}
+	for _, m := range s.Markers {
+		if m.Repo == repo && m.Branch == branch && m.State != markerResolved {
+			stored[baselineEntry(m.Finding)] = append(stored[baselineEntry(m.Finding)], m.ID)
+		}
+	}
+
+	for i := range findings {
+		entry := baselineEntry(findings[i])
+		if ids := stored[entry]; len(ids) > 0 {
+			findings[i].ID = ids[0]
+			stored[entry] = ids[1:]
+			continue
+		}
+		findings[i].ID = newID(repo, findings[i], used)
+	}
+}
+
+// findByID returns the markers whose ID starts with id, e.g. 3f2a or 3f2a9c1d
+func (s *Store) findByID(id string) []*StoredMarker {
+	var found []*StoredMarker
+	for _, m := range s.Markers {
+		if id != "" && strings.HasPrefix(m.ID, strings.ToLower(id)) {
+			found = append(found, m)
+		}
+	}
+	return found
+}
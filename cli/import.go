@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// importSources are the formats tr4ck import reads
+var importSources = []string{"leasot", "todo-txt", "csv"}
+
+// importedMarker is a marker read from the output of another tool, resolved when Completed is set
+type importedMarker struct {
+	Repo   string
+	Branch string
+	Finding
+	Created   *time.Time
+	Completed *time.Time
+}
+
+// leasotTodo is an entry of the json reporter of leasot, e.g. leasot --reporter json 'src/**/*.js'
+type leasotTodo struct {
+	File string `json:"file"`
+	Tag  string `json:"tag"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+	Ref  string `json:"ref"`
+}
+
+// readLeasot reads the todos of the leasot json reporter; the reference of a todo is its assignee
+func readLeasot(r io.Reader) ([]importedMarker, error) {
+	var todos []leasotTodo
+	if err := json.NewDecoder(r).Decode(&todos); err != nil {
+		return nil, fmt.Errorf("failed to parse leasot json: %w", err)
+	}
+
+	var markers []importedMarker
+	for _, todo := range todos {
+		text := todo.Tag
+		if todo.Ref != "" {
+			text += "(" + todo.Ref + ")"
+		}
+		text += ": " + todo.Text
+
+		markers = append(markers, importedMarker{Finding: Finding{
+			File:        filepath.ToSlash(todo.File),
+			Line:        todo.Line,
+			Marker:      strings.ToUpper(todo.Tag),
+			Text:        text,
+			Assignee:    todo.Ref,
+			Description: todo.Text,
+		}})
+	}
+	return markers, nil
+}
+
+// todoTxtDate matches a date of a todo.txt line
+var todoTxtDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// readTodoTxt reads the tasks of a todo.txt file, see https://github.com/todotxt/todo.txt. Tasks have no location,
+// so they are attached to file at their line number; x marks completed tasks, (A) to (J) the priority p0 to p9, +project and
+// @context become tags and due: the due date.
+func readTodoTxt(r io.Reader, file string) ([]importedMarker, error) {
+	var markers []importedMarker
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		m := importedMarker{Finding: Finding{File: file, Line: n, Marker: "TODO", Text: line}}
+		fields := strings.Fields(line)
+		date := func() *time.Time {
+			if len(fields) > 0 && todoTxtDate.MatchString(fields[0]) {
+				if t, err := time.Parse("2006-01-02", fields[0]); err == nil {
+					fields = fields[1:]
+					return &t
+				}
+			}
+			return nil
+		}
+
+		if len(fields) > 0 && fields[0] == "x" {
+			fields = fields[1:]
+			now := time.Now().UTC()
+			m.Completed = &now
+			if completed := date(); completed != nil {
+				m.Completed = completed
+			}
+		}
+		// (A) to (J) are p0 to p9
+		if len(fields) > 0 && len(fields[0]) == 3 && fields[0][0] == '(' && fields[0][2] == ')' {
+			if letter := fields[0][1]; letter >= 'A' && letter <= 'J' {
+				m.Priority = fmt.Sprintf("p%d", letter-'A')
+			} else {
+				m.Priority = strings.ToLower(fields[0][1:2])
+			}
+			fields = fields[1:]
+		}
+		m.Created = date()
+
+		var words []string
+		for _, field := range fields {
+			switch {
+			case strings.HasPrefix(field, "+") && len(field) > 1:
+				m.tag("project", field[1:])
+			case strings.HasPrefix(field, "@") && len(field) > 1:
+				m.tag("context", field[1:])
+			case strings.HasPrefix(field, "due:"):
+				m.Due = strings.TrimPrefix(field, "due:")
+			default:
+				words = append(words, field)
+			}
+		}
+		m.Description = strings.Join(words, " ")
+		addIssueRefs(&m.Finding, m.Description)
+		markers = append(markers, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read todo.txt: %w", err)
+	}
+	return markers, nil
+}
+
+// tag adds a value to a tag of the marker, comma-separated
+func (m *importedMarker) tag(key, value string) {
+	if m.Tags == nil {
+		m.Tags = map[string]string{}
+	}
+	if existing := m.Tags[key]; existing != "" {
+		value = existing + "," + value
+	}
+	m.Tags[key] = value
+}
+
+// readImportCSV reads a csv file with a header naming its columns, such as the csv output of tr4ck. The file,
+// line and marker or text columns are required; repo, branch, id, column, author, email, assignee, priority, due,
+// state (open or resolved) and date (the blame date, 2006-01-02 or RFC 3339) are optional.
+func readImportCSV(r io.Reader) ([]importedMarker, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["file"]; !ok {
+		return nil, fmt.Errorf("csv has no file column")
+	}
+	if _, ok := columns["line"]; !ok {
+		return nil, fmt.Errorf("csv has no line column")
+	}
+
+	var markers []importedMarker
+	for n := 2; ; n++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv line %d: %w", n, err)
+		}
+		value := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		line, err := strconv.Atoi(value("line"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid line %q on csv line %d", value("line"), n)
+		}
+		column, _ := strconv.Atoi(value("column"))
+
+		m := importedMarker{Repo: value("repo"), Branch: value("branch"), Finding: Finding{
+			ID:       value("id"),
+			File:     filepath.ToSlash(value("file")),
+			Line:     line,
+			Column:   column,
+			Marker:   strings.ToUpper(value("marker")),
+			Text:     value("text"),
+			Author:   value("author"),
+			Email:    value("email"),
+			Assignee: value("assignee"),
+			Priority: value("priority"),
+			Due:      value("due"),
+		}}
+		if m.Marker == "" && m.Text == "" {
+			return nil, fmt.Errorf("no marker nor text on csv line %d", n)
+		}
+		if m.Text == "" {
+			m.Text = m.Marker
+		}
+		if m.Marker == "" {
+			m.Marker = strings.ToUpper(strings.FieldsFunc(m.Text, func(r rune) bool { return r == ' ' || r == ':' || r == '(' })[0])
+		}
+		if date := value("date"); date != "" {
+			if t, err := time.Parse(time.RFC3339, date); err == nil {
+				m.Date = &t
+			} else if t, err := time.Parse("2006-01-02", date); err == nil {
+				m.Date = &t
+			}
+		}
+		if value("state") == markerResolved {
+			now := time.Now().UTC()
+			m.Completed = &now
+		}
+		markers = append(markers, m)
+	}
+	return markers, nil
+}
+
+// importMarkers adds imported markers to the store as open markers, or resolved ones when completed, with an
+// opened event noting the source. Markers matching a stored marker of the same repository branch, in any state,
+// are skipped, so importing twice is harmless. It returns the markers added.
+func (s *Store) importMarkers(imported []importedMarker, source string, now time.Time) []*StoredMarker {
+	// IDs are unique within a repository branch, see usedIDs
+	used := map[string]map[string]bool{}
+	existing := map[string]int{}
+	key := func(repo, branch string, f Finding) string {
+		entry := baselineEntry(f)
+		return repo + "\x00" + branch + "\x00" + entry.File + "\x00" + entry.Marker + "\x00" + entry.Text
+	}
+	for _, m := range s.Markers {
+		existing[key(m.Repo, m.Branch, m.Finding)]++
+	}
+
+	var added []*StoredMarker
+	for _, im := range imported {
+		repo := canonicalURI(im.Repo)
+		if k := key(repo, im.Branch, im.Finding); existing[k] > 0 {
+			existing[k]--
+			continue
+		}
+
+		branchKey := repo + "\x00" + im.Branch
+		if used[branchKey] == nil {
+			used[branchKey] = s.usedIDs(repo, im.Branch)
+		}
+		f := im.Finding
+		if f.ID == "" || used[branchKey][f.ID] {
+			f.ID = newID(repo, f, used[branchKey])
+		}
+		used[branchKey][f.ID] = true
+
+		firstSeen := now
+		if im.Created != nil {
+			firstSeen = *im.Created
+		}
+		m := &StoredMarker{Repo: repo, Branch: im.Branch, Finding: f, FirstSeen: firstSeen, LastSeen: now, State: markerOpen}
+		m.Events = append(m.Events, MarkerEvent{Time: firstSeen, Kind: "opened", File: f.File, Line: f.Line, Text: f.Text, Note: "imported from " + source})
+		if im.Completed != nil {
+			resolvedAt := *im.Completed
+			m.State = markerResolved
+			m.ResolvedAt = &resolvedAt
+			m.Events = append(m.Events, MarkerEvent{Time: resolvedAt, Kind: "resolved", Note: "imported from " + source})
+		}
+
+		s.Markers = append(s.Markers, m)
+		added = append(added, m)
+	}
+	return added
+}
+
+// runImport seeds the marker store with the markers of a file produced by another tool, attached to repo and
+// branch unless the file names them, and writes the open ones to a baseline file if set
+func runImport(source, path, repo, branch, baselineFile string) {
+	var reader func(io.Reader) ([]importedMarker, error)
+	switch source {
+	case "leasot":
+		reader = readLeasot
+	case "todo-txt":
+		reader = func(r io.Reader) ([]importedMarker, error) { return readTodoTxt(r, filepath.Base(path)) }
+	case "csv":
+		reader = readImportCSV
+	default:
+		log.Fatal().Str("from", source).Msgf("Invalid --from, expected one of %s", strings.Join(importSources, ", "))
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(expandHome(path))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to open import file")
+		}
+		defer f.Close()
+		r = f
+	}
+
+	imported, err := reader(r)
+	if err != nil {
+		log.Fatal().Err(err).Str("file", path).Msg("Failed to read import file")
+	}
+	for i := range imported {
+		if imported[i].Repo == "" {
+			imported[i].Repo = repo
+		}
+		if imported[i].Branch == "" {
+			imported[i].Branch = branch
+		}
+		if imported[i].Repo == "" {
+			log.Fatal().Str("file", imported[i].File).Msg("Marker without repository, set --repo")
+		}
+		// local paths are stored as absolute paths, as by scan
+		if isLocalDir(imported[i].Repo) {
+			if abs, err := filepath.Abs(expandHome(imported[i].Repo)); err == nil {
+				imported[i].Repo = abs
+			}
+		}
+	}
+
+	storeFile := storeFilePath()
+	store, err := loadStore(storeFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load marker store")
+	}
+
+	added := store.importMarkers(imported, source, time.Now().UTC())
+	if err := store.save(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to save marker store")
+	}
+
+	if baselineFile != "" {
+		var open []Finding
+		for _, m := range added {
+			if m.State == markerOpen {
+				open = append(open, m.Finding)
+			}
+		}
+		if err := writeBaseline(expandHome(baselineFile), open); err != nil {
+			log.Fatal().Err(err).Msg("Failed to create baseline")
+		}
+	}
+
+	fmt.Printf("Imported %d of %d markers from %s\n", len(added), len(imported), path)
+}
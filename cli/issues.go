@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ticketLabel is added to every issue opened for a marker, so that they can be listed again
+const ticketLabel = "tr4ck"
+
+// ticketIDPattern finds the marker ID kept in the body of the issues opened by tr4ck
+var ticketIDPattern = regexp.MustCompile(`<!-- tr4ck:([0-9a-f]+) -->`)
+
+// Ticket is an issue opened in an issue tracker for a stored marker
+type Ticket struct {
+	// Tracker is the issue tracker, e.g. github
+	Tracker string `json:"tracker"`
+	// Key identifies the issue in the tracker, e.g. owner/name#12
+	Key string `json:"key"`
+	URL string `json:"url,omitempty"`
+	// State is open or closed
+	State string `json:"state"`
+}
+
+// IssueConfig is how the issues of markers are written, shared by the issue trackers
+type IssueConfig struct {
+	// Markers only opens issues for these markers, all markers when empty
+	Markers []string `yaml:"markers"`
+	// Title and Body are text/template templates executed with the stored marker and its URL
+	Title string `yaml:"title"`
+	Body  string `yaml:"body"`
+	// Labels are added to the issues of each marker, e.g. FIXME: [bug]
+	Labels map[string][]string `yaml:"labels"`
+	// Backfill also opens issues for the markers found by the first sync of a repository
+	Backfill bool `yaml:"backfill"`
+	// References is what sync does to the issues referenced by resolved markers, e.g. TODO(#123): comment to
+	// comment on them, or close to close them once no open marker references them. Nothing when empty.
+	References string `yaml:"references"`
+}
+
+const (
+	defaultIssueTitle = `{{.Text}}`
+	defaultIssueBody  = `{{.Text}}
+
+{{if .URL}}[{{.File}}:{{.Line}}]({{.URL}}){{else}}{{.File}}:{{.Line}}{{end}} in {{.Repo}}{{if .Author}}, added by {{.Author}}{{end}}
+`
+)
+
+// issueTracker opens an issue per new marker and closes it when the marker is resolved
+type issueTracker interface {
+	name() string
+	config() IssueConfig
+	// project is where the issues of the markers of a repository are opened, empty to skip the repository
+	project(repo string) string
+	// existing returns the issues already opened in a project by marker ID, so that none is opened twice
+	existing(project string) (map[string]Ticket, error)
+	open(project string, m *StoredMarker, title, body string, labels []string) (Ticket, error)
+	// comment comments on an issue, close comments then closes it
+	comment(t Ticket, comment string) error
+	close(t Ticket, comment string) error
+	// reference maps an issue reference of a marker of the project, e.g. #123, to its issue in the tracker
+	reference(project, ref string) (Ticket, bool)
+	// lookup fetches an issue, with its URL and state
+	lookup(t Ticket) (Ticket, error)
+}
+
+// httpClient calls the APIs of trackers and notifiers and the HTTP and S3 registry remotes, with a timeout so that
+// an unresponsive service does not hold up a command or sync
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// callJSON sends a request with a json body, unless in is nil, and decodes the json response into out, unless
+// nil. Responses other than 2xx are errors quoting the start of their body.
+func callJSON(service, method, url string, header http.Header, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", service, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s %s: %s: %s", service, method, req.URL.Path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", service, err)
+	}
+	return nil
+}
+
+// issueTrackers returns the issue trackers set up in the config
+func issueTrackers() []issueTracker {
+	var trackers []issueTracker
+	if githubConfig != nil {
+		trackers = append(trackers, newGitHubTracker(*githubConfig))
+	}
+	if gitlabConfig != nil {
+		trackers = append(trackers, newGitLabTracker(*gitlabConfig))
+	}
+	if jiraConfig != nil {
+		trackers = append(trackers, newJiraTracker(*jiraConfig))
+	}
+	if bitbucketConfig != nil && bitbucketConfig.Issues {
+		if bitbucketConfig.URL != "" {
+			log.Warn().Msg("Bitbucket Server has no issues, not opening issues on Bitbucket")
+		} else {
+			trackers = append(trackers, bitbucketTracker{newBitbucketClient(*bitbucketConfig)})
+		}
+	}
+	return trackers
+}
+
+// issueContent renders the title and body of the issue of a marker
+func issueContent(c IssueConfig, m *StoredMarker) (string, string, error) {
+	data := struct {
+		*StoredMarker
+		URL string
+	}{m, markerURL(m)}
+
+	render := func(name, text, fallback string) (string, error) {
+		if text == "" {
+			text = fallback
+		}
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("invalid issue %s template: %w", name, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("failed to render issue %s: %w", name, err)
+		}
+		return buf.String(), nil
+	}
+
+	title, err := render("title", c.Title, defaultIssueTitle)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := render("body", c.Body, defaultIssueBody)
+	if err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(title), strings.TrimRight(body, "\n") + "\n", nil
+}
+
+// withTicketID ends the body of an issue with the marker ID in an HTML comment, see ticketIDPattern
+func withTicketID(body, id string) string {
+	return body + "\n<!-- tr4ck:" + id + " -->\n"
+}
+
+// markerURL links to the line of a stored marker on the web host of its repository, empty for local directories
+func markerURL(m *StoredMarker) string {
+	if filepath.IsAbs(m.Repo) {
+		return ""
+	}
+	// the stored repository is canonical, e.g. github.com/owner/name
+	return blobURL("https://"+m.Repo, m.Revision, m.File, m.Line)
+}
+
+// ticket returns the ticket of the marker in a tracker
+func (m *StoredMarker) ticket(tracker string) *Ticket {
+	for i := range m.Tickets {
+		if m.Tickets[i].Tracker == tracker {
+			return &m.Tickets[i]
+		}
+	}
+	return nil
+}
+
+// removal tells when a resolved marker was removed, e.g. " in 3f2a9c1 by Jane", with a link to the commit on the
+// web host of its repository. It is empty when the commit is unknown.
+func removal(m *StoredMarker) string {
+	commit, text := m.ResolvedRevision, " as of "+m.ResolvedRevision
+	if by := m.ResolvedBy; by != nil {
+		commit, text = by.Commit, fmt.Sprintf(" in %s by %s", by.Commit, by.Author)
+	}
+	if commit == "" {
+		return ""
+	}
+	if !filepath.IsAbs(m.Repo) {
+		if url := commitURL("https://"+m.Repo, commit); url != "" {
+			text += " (" + url + ")"
+		}
+	}
+	return text
+}
+
+// closingComment explains why the issue of a resolved marker is closed
+func closingComment(m *StoredMarker) string {
+	return "The marker was removed" + removal(m) + "."
+}
+
+// numberReference maps #123, an issue of project, or owner/name#123 to an issue of GitHub, GitLab or Bitbucket
+func numberReference(tracker, project, ref string) (Ticket, bool) {
+	repo, number, ok := strings.Cut(ref, "#")
+	if !ok || number == "" {
+		return Ticket{}, false
+	}
+	if repo == "" {
+		repo = project
+	}
+	return Ticket{Tracker: tracker, Key: repo + "#" + number}, true
+}
+
+// syncTickets opens an issue in each tracker for the markers opened by a sync, unless initial is set and the
+// tracker does not backfill, and closes the issues of the resolved markers. Failures are logged.
+func syncTickets(trackers []issueTracker, opened, resolved []*StoredMarker, initial bool) {
+	for _, tracker := range trackers {
+		c := tracker.config()
+
+		if !initial || c.Backfill {
+			existing := map[string]map[string]Ticket{}
+			for _, m := range opened {
+				if len(c.Markers) > 0 && !containsFold(c.Markers, m.Marker) {
+					continue
+				}
+				if m.ticket(tracker.name()) != nil {
+					continue
+				}
+				project := tracker.project(m.Repo)
+				if project == "" {
+					continue
+				}
+
+				if _, ok := existing[project]; !ok {
+					tickets, err := tracker.existing(project)
+					if err != nil {
+						log.Err(err).Str("tracker", tracker.name()).Str("project", project).Msg("Failed to list issues")
+						existing[project] = nil
+						continue
+					}
+					existing[project] = tickets
+				}
+				if existing[project] == nil {
+					continue
+				}
+				if t, ok := existing[project][m.ID]; ok {
+					m.Tickets = append(m.Tickets, t)
+					continue
+				}
+
+				title, body, err := issueContent(c, m)
+				if err != nil {
+					log.Err(err).Str("tracker", tracker.name()).Msg("Failed to write issue")
+					continue
+				}
+				labels := []string{ticketLabel}
+				for marker, extra := range c.Labels {
+					if strings.EqualFold(marker, m.Marker) {
+						labels = append(labels, extra...)
+					}
+				}
+				t, err := tracker.open(project, m, title, body, labels)
+				if err != nil {
+					log.Err(err).Str("tracker", tracker.name()).Str("project", project).Str("id", m.ID).Msg("Failed to open issue")
+					continue
+				}
+				m.Tickets = append(m.Tickets, t)
+				log.Debug().Str("tracker", tracker.name()).Str("issue", t.Key).Str("id", m.ID).Msg("Opened issue")
+			}
+		}
+
+		for _, m := range resolved {
+			t := m.ticket(tracker.name())
+			if t == nil || t.State != "open" {
+				continue
+			}
+			if err := tracker.close(*t, closingComment(m)); err != nil {
+				log.Err(err).Str("tracker", tracker.name()).Str("issue", t.Key).Msg("Failed to close issue")
+				continue
+			}
+			t.State = "closed"
+			log.Debug().Str("tracker", tracker.name()).Str("issue", t.Key).Str("id", m.ID).Msg("Closed issue")
+		}
+	}
+}
+
+// syncReferences comments on, or closes, the issues referenced by the markers resolved by a sync in the trackers
+// set up with references. An issue referenced by several resolved markers gets a single comment, and is only
+// commented on when open markers of the store still reference it. Failures are logged.
+func syncReferences(trackers []issueTracker, store *Store, resolved []*StoredMarker) {
+	for _, tracker := range trackers {
+		mode := tracker.config().References
+		if mode == "" {
+			continue
+		}
+		if mode != "comment" && mode != "close" {
+			log.Warn().Str("tracker", tracker.name()).Str("references", mode).Msg("Invalid references, expected comment or close")
+			continue
+		}
+
+		var order []string
+		tickets := map[string]Ticket{}
+		removed := map[string][]*StoredMarker{}
+		refs := map[string]string{}
+		for _, m := range resolved {
+			project := tracker.project(m.Repo)
+			if project == "" {
+				continue
+			}
+			for _, ref := range m.Issues {
+				t, ok := tracker.reference(project, ref)
+				if !ok {
+					continue
+				}
+				// the issue opened for the marker is closed by syncTickets
+				if own := m.ticket(tracker.name()); own != nil && own.Key == t.Key {
+					continue
+				}
+				if _, ok := tickets[t.Key]; !ok {
+					order = append(order, t.Key)
+					tickets[t.Key], refs[t.Key] = t, ref
+				}
+				removed[t.Key] = append(removed[t.Key], m)
+			}
+		}
+
+		for _, key := range order {
+			t, markers := tickets[key], removed[key]
+			remaining := store.referencing(markers[0].Repo, refs[key])
+
+			var comment strings.Builder
+			for _, m := range markers {
+				fmt.Fprintf(&comment, "The %s at %s:%d referencing this issue was removed%s.\n", m.Marker, m.File, m.Line, removal(m))
+			}
+			var err error
+			if mode == "close" && remaining == 0 {
+				err = tracker.close(t, comment.String())
+			} else {
+				if remaining > 0 {
+					fmt.Fprintf(&comment, "Open markers still referencing it: %d.\n", remaining)
+				}
+				err = tracker.comment(t, comment.String())
+			}
+			if err != nil {
+				log.Err(err).Str("tracker", tracker.name()).Str("issue", key).Msg("Failed to update referenced issue")
+				continue
+			}
+			log.Debug().Str("tracker", tracker.name()).Str("issue", key).Int("removed", len(markers)).Int("remaining", remaining).Msg("Updated referenced issue")
+		}
+	}
+}
+
+// referencing counts the open markers of a repository referencing an issue
+func (s *Store) referencing(repo, ref string) int {
+	n := 0
+	for _, m := range s.Markers {
+		if m.Repo == repo && m.State == markerOpen && slices.Contains(m.Issues, ref) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// jiraConfig is the jira section of the config, nil when tickets are not filed in Jira
+var jiraConfig *JiraConfig
+
+// jiraKeychainService is the keychain entry holding the Jira API token, under the account of the Jira email
+const jiraKeychainService = "tr4ck-jira"
+
+// JiraConfig files a Jira ticket per new marker and transitions it when the marker is resolved
+type JiraConfig struct {
+	// URL is the Jira site, e.g. https://acme.atlassian.net
+	URL string `yaml:"url"`
+	// Email is the account of the API token of Jira Cloud, JIRA_EMAIL when empty. Without one, the token is a
+	// personal access token of Jira Server or Data Center.
+	Email string `yaml:"email"`
+	// Project is the key of the project tickets are filed in, and Projects maps repositories to other projects
+	Project  string            `yaml:"project"`
+	Projects map[string]string `yaml:"projects"`
+	// IssueType is the type of the tickets, Task by default
+	IssueType string `yaml:"issue_type"`
+	// Priorities maps the priority of markers, e.g. p1, to Jira priority names, e.g. High
+	Priorities map[string]string `yaml:"priorities"`
+	// Transition is the workflow transition of the tickets of resolved markers, Done by default
+	Transition  string `yaml:"transition"`
+	IssueConfig `yaml:",inline"`
+}
+
+// defaultJiraBody is defaultIssueBody in Jira wiki markup
+const defaultJiraBody = `{{.Text}}
+
+{{if .URL}}[{{.File}}:{{.Line}}|{{.URL}}]{{else}}{{.File}}:{{.Line}}{{end}} in {{.Repo}}{{if .Author}}, added by {{.Author}}{{end}}
+`
+
+// jiraTracker is the issue tracker of the Jira REST API
+type jiraTracker struct {
+	c     JiraConfig
+	site  string
+	email string
+	token string
+	// cloud sites search with the enhanced search API
+	cloud bool
+}
+
+// newJiraTracker reads the API token from JIRA_API_TOKEN, or else from the keychain
+func newJiraTracker(c JiraConfig) *jiraTracker {
+	t := &jiraTracker{c: c, site: strings.TrimRight(c.URL, "/"), email: c.Email, token: os.Getenv("JIRA_API_TOKEN")}
+	if t.email == "" {
+		t.email = os.Getenv("JIRA_EMAIL")
+	}
+	if t.token == "" {
+		token, err := keychainSecret(jiraKeychainService, t.email)
+		if err != nil {
+			log.Warn().Err(err).Msg("No Jira API token in JIRA_API_TOKEN nor in the keychain")
+		}
+		t.token = token
+	}
+	if u, err := url.Parse(t.site); err == nil {
+		t.cloud = strings.HasSuffix(strings.ToLower(u.Hostname()), ".atlassian.net")
+	}
+	if t.c.IssueType == "" {
+		t.c.IssueType = "Task"
+	}
+	if t.c.Transition == "" {
+		t.c.Transition = "Done"
+	}
+	if t.c.Body == "" {
+		t.c.Body = defaultJiraBody
+	}
+	return t
+}
+
+// keychainSecret reads a password from the macOS keychain, or from the Secret Service on Linux, e.g. stored with
+// security add-generic-password -s tr4ck-jira -a <email> -w, or secret-tool store --label tr4ck service tr4ck-jira
+// account <email>
+func keychainSecret(service, account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	default:
+		return "", fmt.Errorf("no keychain support on %s", runtime.GOOS)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from keychain: %w", service, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (t *jiraTracker) name() string {
+	return "jira"
+}
+
+func (t *jiraTracker) config() IssueConfig {
+	return t.c.IssueConfig
+}
+
+// project is the key of the Jira project of a repository
+func (t *jiraTracker) project(repo string) string {
+	for uri, project := range t.c.Projects {
+		if canonicalURI(uri) == repo {
+			return project
+		}
+	}
+	return t.c.Project
+}
+
+// request calls the Jira REST API with basic authentication for Jira Cloud, or a bearer token, see callJSON
+func (t *jiraTracker) request(method, path string, in, out any) error {
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	if t.email != "" {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(t.email+":"+t.token)))
+	} else if t.token != "" {
+		header.Set("Authorization", "Bearer "+t.token)
+	}
+	return callJSON("jira", method, t.site+path, header, in, out)
+}
+
+// jiraIssue is an issue of the Jira REST API
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Labels []string `json:"labels"`
+		Status struct {
+			StatusCategory struct {
+				Key string `json:"key"`
+			} `json:"statusCategory"`
+		} `json:"status"`
+	} `json:"fields"`
+}
+
+// ticket converts an issue, closed once its status is in the done category
+func (t *jiraTracker) ticket(key, category string) Ticket {
+	state := "open"
+	if category == "done" {
+		state = "closed"
+	}
+	return Ticket{Tracker: t.name(), Key: key, URL: t.site + "/browse/" + key, State: state}
+}
+
+// idLabel is the label holding the marker ID of a ticket, since Jira descriptions have no hidden comments
+func idLabel(id string) string {
+	return ticketLabel + "-" + id
+}
+
+// existing searches the tickets of the project labeled tr4ck, with the enhanced search API on Jira Cloud and
+// the classic one on Jira Server and Data Center
+func (t *jiraTracker) existing(project string) (map[string]Ticket, error) {
+	tickets := map[string]Ticket{}
+	query := url.Values{}
+	query.Set("jql", fmt.Sprintf("project = %q AND labels = %s", project, ticketLabel))
+	query.Set("fields", "labels,status")
+	query.Set("maxResults", "100")
+
+	for start := 0; ; {
+		var page struct {
+			Issues        []jiraIssue `json:"issues"`
+			Total         int         `json:"total"`
+			NextPageToken string      `json:"nextPageToken"`
+		}
+		path := "/rest/api/2/search?"
+		if t.cloud {
+			path = "/rest/api/3/search/jql?"
+		} else {
+			query.Set("startAt", fmt.Sprint(start))
+		}
+		if err := t.request(http.MethodGet, path+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+
+		for _, issue := range page.Issues {
+			for _, label := range issue.Fields.Labels {
+				if id, ok := strings.CutPrefix(label, ticketLabel+"-"); ok {
+					tickets[id] = t.ticket(issue.Key, issue.Fields.Status.StatusCategory.Key)
+				}
+			}
+		}
+
+		start += len(page.Issues)
+		if t.cloud {
+			if page.NextPageToken == "" {
+				return tickets, nil
+			}
+			query.Set("nextPageToken", page.NextPageToken)
+		} else if len(page.Issues) == 0 || start >= page.Total {
+			return tickets, nil
+		}
+	}
+}
+
+// open files a ticket with the Jira priority of the marker priority, if mapped
+func (t *jiraTracker) open(project string, m *StoredMarker, title, body string, labels []string) (Ticket, error) {
+	fields := map[string]any{
+		"project":     map[string]string{"key": project},
+		"issuetype":   map[string]string{"name": t.c.IssueType},
+		"summary":     title,
+		"description": body,
+		"labels":      append(labels, idLabel(m.ID)),
+	}
+	for priority, name := range t.c.Priorities {
+		if m.Priority != "" && strings.EqualFold(priority, m.Priority) {
+			fields["priority"] = map[string]string{"name": name}
+		}
+	}
+
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := t.request(http.MethodPost, "/rest/api/2/issue", map[string]any{"fields": fields}, &created); err != nil {
+		return Ticket{}, err
+	}
+	return t.ticket(created.Key, "new"), nil
+}
+
+func (t *jiraTracker) comment(ticket Ticket, comment string) error {
+	return t.request(http.MethodPost, "/rest/api/2/issue/"+ticket.Key+"/comment", map[string]string{"body": comment}, nil)
+}
+
+// close comments on the ticket, then applies the configured transition
+func (t *jiraTracker) close(ticket Ticket, comment string) error {
+	if err := t.comment(ticket, comment); err != nil {
+		return err
+	}
+	path := "/rest/api/2/issue/" + ticket.Key
+
+	var transitions struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"transitions"`
+	}
+	if err := t.request(http.MethodGet, path+"/transitions", nil, &transitions); err != nil {
+		return err
+	}
+	for _, transition := range transitions.Transitions {
+		if strings.EqualFold(transition.Name, t.c.Transition) {
+			in := map[string]any{"transition": map[string]string{"id": transition.ID}}
+			return t.request(http.MethodPost, path+"/transitions", in, nil)
+		}
+	}
+	return fmt.Errorf("no %s transition for jira issue %s", t.c.Transition, ticket.Key)
+}
+
+// reference maps a reference to a ticket of the project, e.g. ABC-12 in ABC, so that words like UTF-8 are not
+// taken for tickets
+func (t *jiraTracker) reference(project, ref string) (Ticket, bool) {
+	if project == "" || !strings.HasPrefix(ref, project+"-") {
+		return Ticket{}, false
+	}
+	return Ticket{Tracker: t.name(), Key: ref, URL: t.site + "/browse/" + ref}, true
+}
+
+func (t *jiraTracker) lookup(ticket Ticket) (Ticket, error) {
+	var issue jiraIssue
+	if err := t.request(http.MethodGet, "/rest/api/2/issue/"+url.PathEscape(ticket.Key)+"?fields=status", nil, &issue); err != nil {
+		return ticket, err
+	}
+	return t.ticket(issue.Key, issue.Fields.Status.StatusCategory.Key), nil
+}
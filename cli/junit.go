@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// junitCases selects whether each finding or each file is a failed JUnit test case
+var junitCases = "marker"
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Line      int           `xml:"line,attr,omitempty"`
+	Failure   *junitFailure `xml:"failure"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// writeJUnit writes the report as JUnit XML with a test suite per repository and a failed test case
+// per finding, or per file with junitCases set to file
+func writeJUnit(w io.Writer, report Report) error {
+	suites := junitTestSuites{Name: "tr4ck"}
+
+	for _, result := range report.Results {
+		suite := junitTestSuite{
+			Name: result.title(),
+			Time: fmt.Sprintf("%.3f", float64(result.DurationMs)/1000),
+		}
+
+		files, byFile := groupByFile(result.Findings)
+		for _, file := range files {
+			findings := byFile[file]
+
+			if junitCases == "file" {
+				var body strings.Builder
+				for _, f := range findings {
+					fmt.Fprintf(&body, "%s:%d:%d %s\n", f.File, f.Line, f.Column, f.Text)
+				}
+				suite.Cases = append(suite.Cases, junitTestCase{
+					Name:      file,
+					ClassName: result.Repo,
+					File:      file,
+					Failure: &junitFailure{
+						Message: fmt.Sprintf("%d markers", len(findings)),
+						Type:    "tr4ck",
+						Body:    body.String(),
+					},
+				})
+				continue
+			}
+
+			for _, f := range findings {
+				name := fmt.Sprintf("%s:%d %s", f.File, f.Line, f.Marker)
+				if f.ID != "" {
+					name += " " + f.ID
+				}
+				suite.Cases = append(suite.Cases, junitTestCase{
+					Name:      name,
+					ClassName: f.File,
+					File:      f.File,
+					Line:      f.Line,
+					Failure: &junitFailure{
+						Message: f.Text,
+						Type:    f.Marker,
+						Body:    fmt.Sprintf("%s:%d:%d %s\n", f.File, f.Line, f.Column, f.Text),
+					},
+				})
+			}
+		}
+
+		suite.Tests = len(suite.Cases)
+		suite.Failures = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal junit: %w", err)
+	}
+
+	fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// LeaderboardWindow is the number of markers an author introduced and resolved within a time window
+type LeaderboardWindow struct {
+	// Since is the length of the window, e.g. 30d, or all
+	Since      string `json:"since"`
+	Introduced int    `json:"introduced"`
+	Resolved   int    `json:"resolved"`
+}
+
+// LeaderboardEntry is the open markers of an author and their activity in each window
+type LeaderboardEntry struct {
+	Author  string              `json:"author"`
+	Email   string              `json:"email,omitempty"`
+	Open    int                 `json:"open"`
+	Windows []LeaderboardWindow `json:"windows"`
+}
+
+// markerAuthor is who introduced a marker and when: the author of its introducing commit, else the blame author
+// of its line, else unknown as of its first sighting
+func (m *StoredMarker) markerAuthor() (string, string, time.Time) {
+	if intro := m.Introduced; intro != nil {
+		return intro.Author, intro.Email, intro.Date
+	}
+	if m.Date != nil {
+		return m.Author, m.Email, *m.Date
+	}
+	return "", "", m.FirstSeen
+}
+
+// leaderboard counts the open markers of each author, and the markers they introduced and resolved within each
+// window. Authors who resolved the most markers in the first window come first.
+func leaderboard(markers []*StoredMarker, windows []string, now time.Time) ([]LeaderboardEntry, error) {
+	starts := make([]time.Time, len(windows))
+	for i, window := range windows {
+		if window == "all" {
+			continue
+		}
+		age, err := parseAge(window)
+		if err != nil {
+			return nil, err
+		}
+		starts[i] = now.Add(-age)
+	}
+
+	entries := map[string]*LeaderboardEntry{}
+	entry := func(author, email string) *LeaderboardEntry {
+		key := strings.ToLower(email)
+		if key == "" {
+			key = author
+		}
+		e, ok := entries[key]
+		if !ok {
+			e = &LeaderboardEntry{Author: author, Email: email, Windows: make([]LeaderboardWindow, len(windows))}
+			if e.Author == "" {
+				e.Author = "unknown"
+			}
+			for i, window := range windows {
+				e.Windows[i].Since = window
+			}
+			entries[key] = e
+		}
+		return e
+	}
+
+	for _, m := range markers {
+		author, email, introduced := m.markerAuthor()
+		e := entry(author, email)
+		if m.State == markerOpen {
+			e.Open++
+		}
+		for i, start := range starts {
+			if !introduced.Before(start) {
+				e.Windows[i].Introduced++
+			}
+		}
+
+		if m.State != markerResolved {
+			continue
+		}
+		resolver, resolved := entry("", ""), m.LastSeen
+		if m.ResolvedAt != nil {
+			resolved = *m.ResolvedAt
+		}
+		if by := m.ResolvedBy; by != nil {
+			resolver, resolved = entry(by.Author, by.Email), by.Date
+		}
+		for i, start := range starts {
+			if !resolved.Before(start) {
+				resolver.Windows[i].Resolved++
+			}
+		}
+	}
+
+	var board []LeaderboardEntry
+	for _, e := range entries {
+		board = append(board, *e)
+	}
+	sort.Slice(board, func(i, j int) bool {
+		a, b := board[i], board[j]
+		if len(windows) > 0 && a.Windows[0].Resolved != b.Windows[0].Resolved {
+			return a.Windows[0].Resolved > b.Windows[0].Resolved
+		}
+		if a.Open != b.Open {
+			return a.Open < b.Open
+		}
+		return a.Author < b.Author
+	})
+	return board, nil
+}
+
+// runLeaderboard prints the leaderboard of the stored markers of the repositories matching repo, at most limit
+// authors, in table, markdown or json
+func runLeaderboard(repo string, windows []string, limit int, format string) {
+	if format != "table" && format != "markdown" && format != "json" {
+		log.Fatal().Str("format", format).Msg("Invalid --format, expected table, markdown or json")
+	}
+
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load marker store")
+	}
+
+	markers, err := store.query(MarkerQuery{Repo: repo, State: "all"}, time.Now())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid query")
+	}
+
+	board, err := leaderboard(markers, windows, time.Now())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid --since")
+	}
+	if limit > 0 {
+		board = board[:min(limit, len(board))]
+	}
+
+	switch format {
+	case "json":
+		if board == nil {
+			board = []LeaderboardEntry{}
+		}
+		PrintStruct(os.Stdout, board)
+	case "markdown":
+		writeLeaderboardMarkdown(os.Stdout, board, windows)
+	default:
+		printLeaderboard(os.Stdout, board, windows)
+	}
+}
+
+// printLeaderboard writes the leaderboard as a table, with introduced (+) and resolved (-) columns per window.
+// The header is colored like its column so that escape codes do not break the alignment.
+func printLeaderboard(w io.Writer, board []LeaderboardEntry, windows []string) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	header := []string{aurora.Cyan("AUTHOR").String(), "OPEN"}
+	for _, window := range windows {
+		header = append(header, aurora.Red("+"+window).String(), aurora.Green("-"+window).String())
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, e := range board {
+		cells := []string{aurora.Cyan(e.Author).String(), fmt.Sprint(e.Open)}
+		for _, window := range e.Windows {
+			cells = append(cells, aurora.Red(fmt.Sprint(window.Introduced)).String(), aurora.Green(fmt.Sprint(window.Resolved)).String())
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	tw.Flush()
+}
+
+// writeLeaderboardMarkdown writes the leaderboard as a markdown table
+func writeLeaderboardMarkdown(w io.Writer, board []LeaderboardEntry, windows []string) {
+	fmt.Fprintf(w, "# tr4ck leaderboard\n\n")
+
+	fmt.Fprint(w, "| Author | Open |")
+	for _, window := range windows {
+		fmt.Fprintf(w, " Introduced (%s) | Resolved (%s) |", window, window)
+	}
+	fmt.Fprint(w, "\n|---|---:|")
+	for range windows {
+		fmt.Fprint(w, "---:|---:|")
+	}
+	fmt.Fprintln(w)
+
+	for _, e := range board {
+		fmt.Fprintf(w, "| %s | %d |", markdownEscaper.Replace(e.Author), e.Open)
+		for _, window := range e.Windows {
+			fmt.Fprintf(w, " %d | %d |", window.Introduced, window.Resolved)
+		}
+		fmt.Fprintln(w)
+	}
+}
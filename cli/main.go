@@ -1,18 +1,16 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/storage/memory"
-	"github.com/logrusorgru/aurora/v4"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -28,6 +26,20 @@ var (
 	markers           []string
 	ignoreDirs        map[string]struct{}
 	ignoredExtensions map[string]struct{}
+	// registryRemoteURI is the optional shared registry the local registry is synced from
+	registryRemoteURI string
+	// registryWriteCredential allows pushing local registry changes to the remote
+	registryWriteCredential string
+	// registryReadToken allows fetching a private remote registry, see registryReadCredential
+	registryReadToken string
+	// caseInsensitive matches every marker regardless of case, caseInsensitiveMarkers only the listed ones
+	caseInsensitive        bool
+	caseInsensitiveMarkers map[string]struct{}
+	// registryProfile selects one of the named registries from the config
+	registryProfile  string
+	registryProfiles map[string]RegistryProfile
+	// submodules initializes and scans submodules of cloned repositories
+	submodules bool
 )
 
 func init() {
@@ -76,65 +88,125 @@ func init() {
 
 }
 
-// cloneRepo clones a repository at a specific commit hash or syncs it to the latest state if it already exists.
+// isLocalDir reports whether the URI is an existing local directory
+func isLocalDir(uri string) bool {
+	info, err := os.Stat(expandHome(uri))
+	return err == nil && info.IsDir()
+}
+
+// archivePath returns the local clone location of a registry record. Each tracked branch gets its own clone.
+func archivePath(record RegistryRecord) string {
+	dir := record.RootHash
+	if record.Branch != "" {
+		dir += "@" + strings.ReplaceAll(record.Branch, "/", "_")
+	}
+	return filepath.Join(os.TempDir(), "tr4ck", "archives", dir)
+}
+
+// cloneRepo clones the tracked branch of a repository, or the default branch when none is set,
+// or syncs it to the latest state if it already exists.
 func cloneRepo(record *RegistryRecord) (*git.Repository, error) {
-	dst := filepath.Join(os.TempDir(), "tr4ck", "archives", record.RootHash)
+	dst := archivePath(*record)
+
+	var branch plumbing.ReferenceName
+	if record.Branch != "" {
+		branch = plumbing.NewBranchReferenceName(record.Branch)
+	}
 
 	// Check if the destination directory already exists
 	if _, err := os.Stat(dst); !os.IsNotExist(err) {
-		// If the repository exists, open it and pull the latest changes
+		// If the repository exists, open it and fetch the latest changes
 		repo, err := git.PlainOpen(dst)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open existing repository: %w", err)
 		}
 
+		// scans read the object store, only submodules need the worktree
+		if !submodules {
+			if err := fetchHead(repo); err != nil {
+				return nil, err
+			}
+			return repo, nil
+		}
+
 		w, err := repo.Worktree()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get worktree: %w", err)
+			return nil, fmt.Errorf("failed to get worktree, remove %s to clone it again with submodules: %w", dst, err)
 		}
 
-		err = w.Pull(&git.PullOptions{RemoteName: "origin"})
+		err = w.Pull(&git.PullOptions{
+			RemoteName:    "origin",
+			ReferenceName: branch,
+			SingleBranch:  true,
+		})
 		if err != nil && err != git.NoErrAlreadyUpToDate {
 			return nil, fmt.Errorf("failed to pull updates: %w", err)
 		}
 
-		// Checkout the specific commit
-		hash := plumbing.NewHash(record.RootHash)
-		err = w.Checkout(&git.CheckoutOptions{
-			Hash: hash,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to checkout commit: %w", err)
+		// pull skips submodules when already up to date, and the archive may predate --submodules
+		if submodules {
+			if err := updateSubmodules(w); err != nil {
+				return nil, err
+			}
 		}
 
 		return repo, nil
 	}
 
-	// If the repository does not exist, clone it
-	repo, err := git.PlainClone(dst, false, &git.CloneOptions{
+	recurse := git.NoRecurseSubmodules
+	if submodules {
+		recurse = git.DefaultSubmoduleRecursionDepth
+	}
+
+	// If the repository does not exist, clone it. Without submodules a bare clone is enough.
+	repo, err := git.PlainClone(dst, !submodules, &git.CloneOptions{
 		// Progress:     os.Stdout,
-		URL:          record.URI,
-		SingleBranch: true,
+		URL:               record.URI,
+		ReferenceName:     branch,
+		SingleBranch:      true,
+		RecurseSubmodules: recurse,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to clone repository: %w", err)
 	}
 
-	// Checkout the specific commit
-	w, err := repo.Worktree()
+	return repo, nil
+}
+
+// fetchHead updates the branch HEAD points to from origin, without touching a worktree if there is one
+func fetchHead(repo *git.Repository) error {
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD reference: %w", err)
+	}
+
+	err = repo.Fetch(&git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", head.Name(), head.Name()))},
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("failed to fetch updates: %w", err)
+	}
+
+	return nil
+}
+
+// updateSubmodules initializes and updates the submodules of the worktree recursively
+func updateSubmodules(w *git.Worktree) error {
+	subs, err := w.Submodules()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get worktree: %w", err)
+		return fmt.Errorf("failed to list submodules: %w", err)
 	}
 
-	hash := plumbing.NewHash(record.RootHash)
-	err = w.Checkout(&git.CheckoutOptions{
-		Hash: hash,
+	err = subs.Update(&git.SubmoduleUpdateOptions{
+		Init:              true,
+		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to checkout commit: %w", err)
+		return fmt.Errorf("failed to update submodules: %w", err)
 	}
 
-	return repo, nil
+	return nil
 }
 
 func getLatestCommit(repo *git.Repository) (string, error) {
@@ -151,35 +223,38 @@ func getLatestCommit(repo *git.Repository) (string, error) {
 	return commit.Hash.String(), nil
 }
 
-// listChangedFilesSinceCommit lists all files that have changed between two commits
-func listChangedFilesSinceCommit(repo *git.Repository, oldCommitHash, newCommitHash string) ([]string, []string, error) {
+// listChangedFilesSinceCommit lists all files that have changed between two commits: those added or modified, those
+// removed, and the previous paths of those renamed
+func listChangedFilesSinceCommit(repo *git.Repository, oldCommitHash, newCommitHash string) ([]string, []string, []string, error) {
 	// Get the commit objects for the specified commit hashes
 	oldCommit, err := repo.CommitObject(plumbing.NewHash(oldCommitHash))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get commit object for old hash %s: %w", oldCommitHash, err)
+		return nil, nil, nil, fmt.Errorf("failed to get commit object for old hash %s: %w", oldCommitHash, err)
 	}
 
 	newCommit, err := repo.CommitObject(plumbing.NewHash(newCommitHash))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get commit object for new hash %s: %w", newCommitHash, err)
+		return nil, nil, nil, fmt.Errorf("failed to get commit object for new hash %s: %w", newCommitHash, err)
 	}
 
 	// Get the patch between the two commits
 	patch, err := oldCommit.Patch(newCommit)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate patch: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to generate patch: %w", err)
 	}
 
-	// Extract the changed and removed files from the patch
+	// Extract the changed, removed and renamed files from the patch
 	changedFiles := make(map[string]struct{})
 	removedFiles := make(map[string]struct{})
+	renamedFiles := make(map[string]struct{})
 
 	for _, filePatch := range patch.FilePatches() {
 		from, to := filePatch.Files()
 
 		if from != nil && to != nil && from.Path() != to.Path() {
-			// This is a rename operation
+			// This is a rename operation, the markers of the old path are reconciled with those of the new one
 			delete(changedFiles, from.Path())
+			renamedFiles[from.Path()] = struct{}{}
 			log.Trace().Str("from", from.Path()).Str("to", to.Path()).Msg("rename")
 			// filter
 			if _, ignore := ignoredExtensions[filepath.Ext(from.Path())]; ignore {
@@ -189,7 +264,7 @@ func listChangedFilesSinceCommit(repo *git.Repository, oldCommitHash, newCommitH
 			changedFiles[to.Path()] = struct{}{}
 		} else if to != nil {
 			// filter
-			if _, ignore := ignoredExtensions[filepath.Ext(from.Path())]; ignore {
+			if _, ignore := ignoredExtensions[filepath.Ext(to.Path())]; ignore {
 				continue
 			}
 
@@ -219,7 +294,12 @@ func listChangedFilesSinceCommit(repo *git.Repository, oldCommitHash, newCommitH
 		removed = append(removed, file)
 	}
 
-	return changed, removed, nil
+	var renamed []string
+	for file := range renamedFiles {
+		renamed = append(renamed, file)
+	}
+
+	return changed, removed, renamed, nil
 }
 
 func getRootHashFromFirstCommit(repoURI string) (string, error) {
@@ -258,6 +338,28 @@ func getRootHashFromFirstCommit(repoURI string) (string, error) {
 	return ref.Hash().String(), nil
 }
 
+// listRemoteBranches returns the head commit of every branch of the remote repository, keyed by branch name
+func listRemoteBranches(repoURI string) (map[string]string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{repoURI},
+	})
+
+	refs, err := remote.List(&git.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote references: %w", err)
+	}
+
+	branches := make(map[string]string)
+	for _, ref := range refs {
+		if ref.Name().IsBranch() {
+			branches[ref.Name().Short()] = ref.Hash().String()
+		}
+	}
+
+	return branches, nil
+}
+
 func findDefaultRef(repo *git.Repository) (*plumbing.Reference, error) {
 	// Get the reference to the fetched commit
 	ref, err := repo.Reference(plumbing.ReferenceName("refs/heads/main"), true)
@@ -275,117 +377,126 @@ func findDefaultRef(repo *git.Repository) (*plumbing.Reference, error) {
 	return nil, fmt.Errorf("failed to find default branch")
 }
 
-// containsMarker checks if a file contains any of the specified markers
-func containsMarker(filePath string, markers []string) (bool, string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return false, "", fmt.Errorf("failed to open file %s: %w", filePath, err)
-	}
-	defer file.Close()
+type Config struct {
+	RegistryFilePath string         `yaml:"registry_file_path"`
+	RegistryRemote   string         `yaml:"registry_remote"`
+	Markers          []MarkerConfig `yaml:"markers"`
+	CaseInsensitive  bool           `yaml:"case_insensitive"`
+	CommentsOnly     bool           `yaml:"comments_only"`
+	Submodules       bool           `yaml:"submodules"`
+	MaxFileSize      int64          `yaml:"max_file_size"`
+	ContextLines     int            `yaml:"context_lines"`
+	// LanguageMarkers replaces the markers for files with the given extension or name
+	LanguageMarkers   map[string][]MarkerConfig `yaml:"language_markers"`
+	IgnoreDirs        []string                  `yaml:"ignore_dirs"`
+	IgnoredExtensions []string                  `yaml:"ignore_extensions"`
+	IncludePaths      []string                  `yaml:"include_paths"`
+	ExcludePaths      []string                  `yaml:"exclude_paths"`
+	// StorePath is the marker store database, in a .tr4ck directory next to the registry by default
+	StorePath string `yaml:"store_path"`
+	// Registries holds named registry profiles selectable with --registry
+	Registries map[string]RegistryProfile `yaml:"registries"`
+	// GitHub and GitLab open and close issues for the markers found by sync
+	GitHub *GitHubConfig `yaml:"github"`
+	GitLab *GitLabConfig `yaml:"gitlab"`
+	// Bitbucket opens issues and sets the build status of synced commits on Bitbucket
+	Bitbucket *BitbucketConfig `yaml:"bitbucket"`
+	// GitHubChecks publishes a check run on each commit synced on GitHub
+	GitHubChecks *GitHubChecksConfig `yaml:"github_checks"`
+	// Jira files tickets for the markers found by sync
+	Jira *JiraConfig `yaml:"jira"`
+	// Slack posts a digest of each sync
+	Slack *SlackConfig `yaml:"slack"`
+	// Discord posts the markers of each repository synced
+	Discord *DiscordConfig `yaml:"discord"`
+	// Webhooks receive the marker and sync events of each sync
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	// Email sends a daily or weekly digest of the marker store
+	Email *EmailConfig `yaml:"email"`
+	// Alerts notify when open markers match a rule after a sync
+	Alerts []AlertRule `yaml:"alerts"`
+	// Receiver accepts the webhooks of GitHub and GitLab in daemon mode
+	Receiver *ReceiverConfig `yaml:"receiver"`
+	// Auth requires scoped tokens on the API, gRPC API and daemon endpoints
+	Auth *AuthConfig `yaml:"auth"`
+}
 
-	reader := bufio.NewReader(file)
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return false, "", fmt.Errorf("error reading file %s: %w", filePath, err)
-		}
-		for _, marker := range markers {
-			if strings.Contains(line, marker) {
-				return true, marker, nil
-			}
-		}
-	}
+// RegistryProfile is a named registry with its own file path and defaults which override the global config when selected
+type RegistryProfile struct {
+	RegistryFilePath  string         `yaml:"registry_file_path"`
+	RegistryRemote    string         `yaml:"registry_remote"`
+	Markers           []MarkerConfig `yaml:"markers"`
+	IgnoreDirs        []string       `yaml:"ignore_dirs"`
+	IgnoredExtensions []string       `yaml:"ignore_extensions"`
+}
 
-	return false, "", nil
+// MarkerConfig is a marker entry in the config, either a plain string or a mapping with per-marker options
+type MarkerConfig struct {
+	Marker          string `yaml:"marker"`
+	CaseInsensitive bool   `yaml:"case_insensitive"`
+	// Severity is the checkstyle severity of the marker's findings: error, warning, info or ignore
+	Severity string `yaml:"severity"`
 }
 
-// listFilesWithMarkers lists all files in the repository that contain any markers
-func listFilesWithMarkers(repo *git.Repository, markers []string) ([]string, error) {
-	worktree, err := repo.Worktree()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get worktree: %w", err)
+// UnmarshalYAML accepts both "- todo" and "- {marker: todo, case_insensitive: true}"
+func (m *MarkerConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&m.Marker); err == nil {
+		return nil
 	}
 
-	// Collect all files in the repository
-	var filesWithMarkers []string
-	root := worktree.Filesystem.Root()
-	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			switch info.Name() {
-			case ".git", "node_modules", ".idea", ".vscode", "vendor", "build",
-				"dist", ".cache", "target", ".DS_Store", ".svn", ".hg", ".tox",
-				"__pycache__", ".mypy_cache", ".pytest_cache":
-				return filepath.SkipDir
-			}
-		}
-		if !info.IsDir() {
-			// filter
-			ext := filepath.Ext(path)
-			if _, ignore := ignoredExtensions[ext]; ignore {
-				return nil
-			}
+	type plain MarkerConfig
+	return unmarshal((*plain)(m))
+}
 
-			hit, mark, err := containsMarker(path, markers)
-			if err != nil {
-				return err
-			}
-			if hit {
-				file, err := filepath.Rel(root, path)
-				if err != nil {
-					return err
-				}
-				log.Trace().Str("file", file).Str("marker", mark).Msg(aurora.BrightGreen("tr4ck").String())
-				filesWithMarkers = append(filesWithMarkers, file)
-			}
+// applyMarkerConfig replaces the global markers and records which ones match case-insensitively
+func applyMarkerConfig(configs []MarkerConfig) {
+	markers = nil
+	caseInsensitiveMarkers = make(map[string]struct{})
+	for _, c := range configs {
+		markers = append(markers, c.Marker)
+		if c.CaseInsensitive {
+			caseInsensitiveMarkers[c.Marker] = struct{}{}
 		}
-		return nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("error walking the file tree: %w", err)
+		setMarkerSeverity(c)
 	}
-
-	return filesWithMarkers, nil
 }
 
-// listFilesWithMarkersSinceCommit lists files that contain any markers and have changed since the specified commit
-func listFilesWithMarkersSinceCommit(repo *git.Repository, firstHash, latestHash string, markers []string) ([]string, []string, error) {
-	changedFiles, removedFiles, err := listChangedFilesSinceCommit(repo, firstHash, latestHash)
-	if err != nil {
-		return nil, nil, err
+// applyLanguageMarkerConfig sets the per-language marker sets. Keys are language names (python), extensions
+// with a leading dot (.py) or file names (Makefile).
+func applyLanguageMarkerConfig(languages map[string][]MarkerConfig) {
+	languageMarkers = make(map[string][]string)
+	if caseInsensitiveMarkers == nil {
+		caseInsensitiveMarkers = make(map[string]struct{})
 	}
 
-	w, err := repo.Worktree()
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get worktree: %w", err)
-	}
+	for key, configs := range languages {
+		var set []string
+		for _, c := range configs {
+			set = append(set, c.Marker)
+			if c.CaseInsensitive {
+				caseInsensitiveMarkers[c.Marker] = struct{}{}
+			}
+			setMarkerSeverity(c)
+		}
 
-	var filesWithMarkers []string
-	for _, file := range changedFiles {
-		absFilePath := filepath.Join(w.Filesystem.Root(), file)
-		hit, mark, err := containsMarker(absFilePath, markers)
-		if err != nil {
-			return nil, nil, err
+		keys := []string{key}
+		if exts, ok := languageExtensions[strings.ToLower(key)]; ok {
+			keys = exts
+		} else if strings.HasPrefix(key, ".") {
+			keys = []string{strings.ToLower(key)}
 		}
-		if hit {
-			log.Trace().Str("file", file).Str("marker", mark).Msg(aurora.BrightGreen("tr4ck").String())
-			filesWithMarkers = append(filesWithMarkers, file)
+		for _, k := range keys {
+			languageMarkers[k] = append(languageMarkers[k], set...)
 		}
 	}
-
-	return filesWithMarkers, removedFiles, nil
 }
 
-type Config struct {
-	RegistryFilePath  string   `yaml:"registry_file_path"`
-	Markers           []string `yaml:"markers"`
-	IgnoreDirs        []string `yaml:"ignore_dirs"`
-	IgnoredExtensions []string `yaml:"ignore_extensions"`
+// expandHome replaces a leading ~ with the home directory
+func expandHome(path string) string {
+	if path != "" && path[0] == '~' {
+		return filepath.Join(homeDir, path[1:])
+	}
+	return path
 }
 
 func loadConfig(path string) error {
@@ -400,15 +511,48 @@ func loadConfig(path string) error {
 
 	// update global registry file path
 	if config.RegistryFilePath != "" {
-		if registryFilePath[0] == '~' {
-			registryFilePath = filepath.Join(homeDir, registryFilePath[1:])
-		}
+		registryFilePath = expandHome(config.RegistryFilePath)
+	}
+
+	// update global registry remote
+	if config.RegistryRemote != "" {
+		registryRemoteURI = config.RegistryRemote
+	}
+
+	if config.StorePath != "" {
+		storePath = config.StorePath
 	}
 
 	// update global markers
 	if len(config.Markers) > 0 {
-		markers = config.Markers
+		applyMarkerConfig(config.Markers)
+	}
+	if len(config.LanguageMarkers) > 0 {
+		applyLanguageMarkerConfig(config.LanguageMarkers)
+	}
+
+	// config can only enable these, flags parsed earlier must not be reset
+	if config.CaseInsensitive {
+		caseInsensitive = true
 	}
+	if config.CommentsOnly {
+		commentsOnly = true
+	}
+	if config.Submodules {
+		submodules = true
+	}
+	// unless overridden by --max-file-size
+	if config.MaxFileSize != 0 && maxFileSize == defaultMaxFileSize {
+		maxFileSize = config.MaxFileSize
+	}
+	// unless overridden by --context
+	if config.ContextLines > 0 && contextLines == 0 {
+		contextLines = config.ContextLines
+	}
+
+	// path patterns from the config are combined with --path and --exclude
+	includePaths = append(includePaths, config.IncludePaths...)
+	excludePaths = append(excludePaths, config.ExcludePaths...)
 
 	// update global ignore dirs
 	if len(config.IgnoreDirs) > 0 {
@@ -424,6 +568,59 @@ func loadConfig(path string) error {
 		}
 	}
 
+	// keep registry profiles for later selection
+	registryProfiles = config.Registries
+
+	githubConfig = config.GitHub
+	gitlabConfig = config.GitLab
+	checksConfig = config.GitHubChecks
+	bitbucketConfig = config.Bitbucket
+	jiraConfig = config.Jira
+	slackConfig = config.Slack
+	discordConfig = config.Discord
+	webhookConfigs = config.Webhooks
+	emailConfig = config.Email
+	alertRules = config.Alerts
+	receiverConfig = config.Receiver
+	authConfig = config.Auth
+
+	return nil
+}
+
+// applyRegistryProfile applies the registry profile selected with --registry on top of the global config
+func applyRegistryProfile() error {
+	if registryProfile == "" {
+		return nil
+	}
+
+	profile, ok := registryProfiles[registryProfile]
+	if !ok {
+		return fmt.Errorf("unknown registry profile %s", registryProfile)
+	}
+
+	// each profile gets its own registry file by default so repo sets don't mix
+	registryFilePath = filepath.Join(homeDir, fmt.Sprintf(".tr4ck.%s.registry", registryProfile))
+	if profile.RegistryFilePath != "" {
+		registryFilePath = expandHome(profile.RegistryFilePath)
+	}
+
+	// a profile only shares the global remote if it names it explicitly
+	registryRemoteURI = profile.RegistryRemote
+
+	if len(profile.Markers) > 0 {
+		applyMarkerConfig(profile.Markers)
+	}
+
+	for _, dir := range profile.IgnoreDirs {
+		ignoreDirs[dir] = struct{}{}
+	}
+
+	for _, ext := range profile.IgnoredExtensions {
+		ignoredExtensions[ext] = struct{}{}
+	}
+
+	log.Trace().Str("registry", registryProfile).Str("path", registryFilePath).Msg("using registry profile")
+
 	return nil
 }
 
@@ -444,9 +641,7 @@ func preRunConfig() {
 	}
 
 	// replace ~ with home directory if first character
-	if configFilePath[0] == '~' {
-		configFilePath = filepath.Join(homeDir, configFilePath[1:])
-	}
+	configFilePath = expandHome(configFilePath)
 
 	loadConfig(configFilePath)
 
@@ -457,71 +652,44 @@ func main() {
 	// root cmd with prerun to handle custom config file
 	// default is to scan all registered repos
 	var rootCmd = &cobra.Command{
-		Use:   "sync",
-		Short: "sync repos",
+		Use:         "sync",
+		Short:       "sync repos",
+		Annotations: map[string]string{porcelainFormat: "porcelain"},
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			applyFormatDefault(cmd)
+			applyPorcelain(cmd)
 			preRunConfig()
+			if err := applyRegistryProfile(); err != nil {
+				log.Fatal().Err(err).Msg("Failed to select registry")
+			}
+			if err := parseOlderThan(); err != nil {
+				log.Fatal().Err(err).Msg("Invalid scan options")
+			}
+			preRunRemoteRegistry()
 		},
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
-				registry, err := loadRegistry()
+				out, err := newReporter()
 				if err != nil {
-					fmt.Printf("failed to load registry\n")
-					os.Exit(1)
+					log.Fatal().Err(err).Msg("Invalid output options")
 				}
 
-				for _, record := range *registry {
-					repo, err := cloneRepo(&record)
-					if err != nil {
-						log.Err(err).Str("uri", record.URI).Msg("Failed to clone repository")
-					}
-
-					// latest commit
-					latestHash, err := getLatestCommit(repo)
-					if err != nil {
-						log.Err(err).Msg("Failed to get latest commit")
-					}
-
-					if record.LastestHash == latestHash {
-						log.Debug().Str("uri", record.URI).Str("latest", latestHash).Msg(aurora.BrightYellow("Skip").String())
-						// no latest commit, skip
-						continue
-					}
-
-					firstHash := record.LastestHash
-					// handle possible empty latest commit hash
-					if firstHash == "" {
-						firstHash = record.RootHash
-					}
-
-					// list commits since last processed commit
-					changed, removed, err := listFilesWithMarkersSinceCommit(repo, firstHash, latestHash, markers)
-					if err != nil {
-						log.Err(err).Msg("Failed to list files in latest commit")
-						continue
-					}
-
-					if changed == nil && removed == nil {
-						log.Debug().Str("uri", record.URI).Str("latest", latestHash).Msg(aurora.BrightYellow("Skip").String())
-						// update registry
-						record.LastestHash = latestHash
-						if err = updateRegistry(record); err != nil {
-							log.Err(err).Msg("Failed to update registry")
-						}
-
-						// no changed files, skip
-						continue
-					}
-
-					log.Debug().Int("changed", len(changed)).Int("removed", len(removed)).Str("uri", record.URI).Str("latest", latestHash).Str("hash", record.LastestHash).Msg(aurora.BrightYellow("Update").String())
+				run, err := syncRegistry(out, nil)
+				if err != nil {
+					log.Fatal().Err(err).Msg("Failed to sync")
+				}
 
-					// update registry
-					record.LastestHash = latestHash
-					if err = updateRegistry(record); err != nil {
-						log.Err(err).Msg("Failed to update registry")
+				if metricsTextfile != "" {
+					metrics.record(run, nil)
+					if err := metrics.writeTextfile(metricsTextfile); err != nil {
+						log.Err(err).Msg("Failed to write metrics")
 					}
+				}
 
+				if err := out.close(); err != nil {
+					log.Fatal().Err(err).Msg("Failed to print report")
 				}
+				out.exitOnFailure()
 			}
 		},
 	}
@@ -529,50 +697,100 @@ func main() {
 	// optional custom config file
 	rootCmd.PersistentFlags().StringVar(&configFilePath, "config", "", "config file path (optional)")
 
+	// optional named registry profile
+	rootCmd.PersistentFlags().StringVar(&registryProfile, "registry", "", "named registry profile from the config file (optional)")
+
+	// machine-parsable output for scripts
+	rootCmd.PersistentFlags().BoolVar(&porcelain, "porcelain", false, "only log errors and print stable tab-separated lines")
+
+	// optional credential used to push changes to a remote registry
+	rootCmd.PersistentFlags().StringVar(&registryWriteCredential, "write", "", "credential for updating the remote registry (optional)")
+	rootCmd.PersistentFlags().StringVar(&registryReadToken, "read", "", "credential for reading a private remote registry, the --write one by default (optional)")
+
+	rootCmd.Flags().StringSliceVar(&includePaths, "path", nil, "only scan paths matching these glob patterns, e.g. src/**/*.go")
+	rootCmd.Flags().StringSliceVar(&excludePaths, "exclude", nil, "skip paths matching these glob patterns, e.g. *.min.js")
+	rootCmd.Flags().IntVar(&contextLines, "context", 0, "capture this many lines before and after each marker")
+	rootCmd.Flags().Int64Var(&maxFileSize, "max-file-size", defaultMaxFileSize, "skip files larger than this many bytes, 0 for no limit")
+	rootCmd.Flags().BoolVar(&submodules, "submodules", false, "initialize, update and scan submodules of cloned repositories")
+	rootCmd.Flags().StringVar(&baselinePath, "baseline", "", "only report markers missing from this baseline file")
+	rootCmd.Flags().BoolVar(&blameFindings, "blame", false, "attribute each marker to the author and commit of its line")
+	rootCmd.Flags().StringVar(&olderThan, "older-than", "", "only report markers older than this age, e.g. 90d, 12w or 1y (implies --blame)")
+	rootCmd.Flags().BoolVar(&oldestFirst, "oldest-first", false, "sort markers by age, oldest first (implies --blame)")
+	rootCmd.Flags().BoolVar(&introducedFindings, "introduced", false, "find the commit where each marker first appeared, following renames")
+	rootCmd.Flags().StringVar(&metricsTextfile, "metrics-textfile", "", "write Prometheus metrics to this file after syncing, e.g. for the node exporter textfile collector")
+	addOutputFlags(rootCmd, "text")
+
 	var scanCmd = &cobra.Command{
-		Use:   "scan",
-		Short: "Scan an entire repository for markers",
+		Use:         "scan [uri|path]",
+		Short:       "Scan an entire repository or local directory for markers",
+		Annotations: map[string]string{porcelainFormat: "porcelain"},
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
 				fmt.Println("Please provide a repository URI")
 				os.Exit(1)
 			}
 
-			uri := args[0]
-			rootHash, err := getRootHashFromFirstCommit(uri)
-			if err != nil {
-				log.Err(err).Msg("Failed to get root commit hash")
-			}
+			runScan(args[0])
+		},
+	}
 
-			repo, err := cloneRepo(&RegistryRecord{
-				RootHash: rootHash,
-				URI:      uri,
-			})
-			if err != nil {
-				log.Err(err).Msg("Failed to clone repository")
-			}
+	addScanFlags(scanCmd)
+	scanCmd.Flags().StringVar(&baselinePath, "baseline", "", "only report markers missing from this baseline file")
+	addOutputFlags(scanCmd, "text")
 
-			// get latest hash
-			latestHash, err := getLatestCommit(repo)
-			if err != nil {
-				log.Err(err).Msg("Failed to get latest commit")
+	var reportCmd = &cobra.Command{
+		Use:         "report [uri|path...]",
+		Short:       "Report the markers of repositories or local directories, or of every registered repository",
+		Annotations: map[string]string{porcelainFormat: "porcelain"},
+		Run: func(cmd *cobra.Command, args []string) {
+			if reportTrend {
+				runTrend()
 				return
 			}
-
-			changed, err := listFilesWithMarkers(repo, markers)
-			if err != nil {
-				log.Err(err).Msg("Failed to list files with markers")
+			if reportOldest > 0 {
+				runOldestReport(args)
+				return
 			}
-
-			if changed == nil {
-				log.Debug().Str("uri", uri).Str("latest", latestHash).Msg(aurora.BrightYellow("Skip").String())
+			if reportZombies {
+				runZombieReport(args)
 				return
 			}
+			switch reportBy {
+			case "repo":
+				runReport(args)
+			case "author":
+				runAuthorReport(args)
+			case "component", "owner":
+				runComponentReport(args, reportBy)
+			default:
+				log.Fatal().Str("by", reportBy).Msg("Invalid --by, expected repo, author, component or owner")
+			}
+		},
+	}
 
-			log.Debug().Int("changed", len(changed)).Str("uri", uri).Str("latest", latestHash).Str("hash", latestHash).Msg(aurora.BrightYellow("Update").String())
+	addScanFlags(reportCmd)
+	addOutputFlags(reportCmd, "markdown")
+	reportCmd.Flags().BoolVar(&reportTrend, "trend", false, "report how marker counts evolved per repository over the snapshots taken by sync")
+	reportCmd.Flags().StringVar(&trendSince, "since", "90d", "how far back --trend goes, e.g. 90d, 12w or 1y")
+	reportCmd.Flags().StringVar(&reportBy, "by", "repo", "group findings by repo, by blame author (implies --blame), by component or by CODEOWNERS owner")
+	reportCmd.Flags().StringVar(&componentsPath, "components", "", "yaml file mapping paths to components for --by component, top-level directories by default")
+	reportCmd.Flags().BoolVar(&reportZombies, "zombies", false, "list the open markers of the marker store referencing a closed issue, checked in the configured issue trackers")
+	reportCmd.Flags().IntVar(&reportOldest, "oldest", 0, "list the N longest-lived markers across repositories with their age and author (implies --blame)")
+
+	var statsFormat string
+	var statsCmd = &cobra.Command{
+		Use:         "stats [uri|path...]",
+		Short:       "Summarize the registry and the markers of its repositories, with changes since the previous run",
+		Annotations: map[string]string{porcelainFormat: "tsv"},
+		Run: func(cmd *cobra.Command, args []string) {
+			runStats(args, statsFormat)
 		},
 	}
 
+	addScanFlags(statsCmd)
+	statsCmd.Flags().StringVar(&statsFormat, "format", "table", "output format: table, tsv or json")
+	statsCmd.Flags().IntVar(&statsTop, "top", 10, "number of directories and files listed as top offenders")
+
 	var versionCmd = &cobra.Command{
 		Use:   "version",
 		Short: "Print the version number",
@@ -587,28 +805,48 @@ func main() {
 		Short:   "Manage registry entries",
 	}
 
+	var listFilter registryFilter
+	var listVerbose bool
+	var listFormat string
 	var listCmd = &cobra.Command{
-		Use:   "ls",
-		Short: "List the registry entries",
+		Use:         "ls",
+		Short:       "List the registry entries",
+		Annotations: map[string]string{porcelainFormat: "tsv"},
 		Run: func(cmd *cobra.Command, args []string) {
 			reg, err := loadRegistry()
 			if err != nil {
 				log.Fatal().Err(err).Msg("Failed to load registry")
 			}
 
+			var records []RegistryRecord
 			for _, record := range *reg {
-				fmt.Printf("%s	%s	%s\n", aurora.Green(record.RootHash), record.LastestHash, aurora.Blue(record.URI))
+				if listFilter.match(record) {
+					records = append(records, record)
+				}
+			}
+
+			if err := printRegistry(os.Stdout, records, listFormat, listVerbose); err != nil {
+				log.Fatal().Err(err).Msg("Failed to print registry")
 			}
 		},
 	}
 
+	listCmd.Flags().BoolVarP(&listVerbose, "verbose", "v", false, "show notes, labels and markers")
+	listCmd.Flags().StringVar(&listFormat, "format", "table", "output format: table, tsv, json or yaml")
+	listCmd.Flags().StringVar(&listFilter.uriGlob, "uri-glob", "", "only list URIs matching the glob pattern")
+	listCmd.Flags().StringVar(&listFilter.label, "label", "", "only list entries with the label")
+	listCmd.Flags().IntVar(&listFilter.staleDays, "stale", 0, "only list entries whose latest hash is older than N days")
+	listCmd.Flags().BoolVar(&listFilter.missingCache, "missing-cache", false, "only list entries without a local clone")
+
+	var addMarkers, addLabels, addBranches, addInclude, addExclude []string
+	var addSchedule string
 	var addCmd = &cobra.Command{
 		Use:   "add [uri]",
 		Short: "Add URI to the registry",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			uri := args[0]
-			err := addToRegistry(uri)
+			err := addToRegistry(RegistryRecord{URI: uri, Markers: addMarkers, Labels: addLabels, Include: addInclude, Exclude: addExclude, Schedule: addSchedule}, addBranches...)
 			if err != nil {
 				fmt.Printf("Failed to add URI to the registry: %v\n", err)
 				os.Exit(1)
@@ -617,6 +855,114 @@ func main() {
 		},
 	}
 
+	addCmd.Flags().StringSliceVar(&addMarkers, "markers", nil, "markers overriding the global list for this repository")
+	addCmd.Flags().StringSliceVar(&addLabels, "labels", nil, "labels used to group and filter registry entries")
+	addCmd.Flags().StringSliceVar(&addInclude, "path", nil, "only scan paths matching these glob patterns in this repository")
+	addCmd.Flags().StringSliceVar(&addExclude, "exclude", nil, "skip paths matching these glob patterns in this repository")
+	addCmd.Flags().StringSliceVar(&addBranches, "branch", nil, "branches to track, each with its own cursor; globs such as release/* are expanded (default branch when omitted)")
+	addCmd.Flags().StringVar(&addSchedule, "schedule", "", "cron expression the daemon syncs this repository on instead of its --interval, e.g. '0 */6 * * *' or @weekly")
+
+	var labelBranch string
+	var labelCmd = &cobra.Command{
+		Use:   "label [uri] [labels...]",
+		Short: "Set the labels of a registry entry",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := setRecordLabels(args[0], labelBranch, args[1:]); err != nil {
+				fmt.Printf("Failed to label URI: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("URI %s labeled\n", args[0])
+		},
+	}
+
+	labelCmd.Flags().StringVar(&labelBranch, "branch", "", "only label the entry tracking this branch")
+
+	var refreshReset bool
+	var refreshCmd = &cobra.Command{
+		Use:   "refresh [uri]",
+		Short: "Re-resolve the root hash of one or all registry entries",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var uri string
+			if len(args) == 1 {
+				uri = args[0]
+			}
+			if err := refreshRegistry(uri, refreshReset); err != nil {
+				fmt.Printf("Failed to refresh the registry: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	refreshCmd.Flags().BoolVar(&refreshReset, "reset", false, "reset the latest hash so the next sync rescans the whole tree")
+
+	var disableBranch string
+	var disableCmd = &cobra.Command{
+		Use:   "disable [uri]",
+		Short: "Skip a registry entry during sync without removing it",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := setRecordDisabled(args[0], disableBranch, true); err != nil {
+				fmt.Printf("Failed to disable URI: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("URI %s disabled\n", args[0])
+		},
+	}
+
+	disableCmd.Flags().StringVar(&disableBranch, "branch", "", "only disable the entry tracking this branch")
+
+	var enableBranch string
+	var enableCmd = &cobra.Command{
+		Use:   "enable [uri]",
+		Short: "Re-enable a disabled registry entry",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := setRecordDisabled(args[0], enableBranch, false); err != nil {
+				fmt.Printf("Failed to enable URI: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("URI %s enabled\n", args[0])
+		},
+	}
+
+	enableCmd.Flags().StringVar(&enableBranch, "branch", "", "only enable the entry tracking this branch")
+
+	var annotateBranch string
+	var annotateCmd = &cobra.Command{
+		Use:   "annotate [uri] [text]",
+		Short: "Set a free-form note on a registry entry",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			note := strings.Join(args[1:], " ")
+			if err := setRecordNote(args[0], annotateBranch, note); err != nil {
+				fmt.Printf("Failed to annotate URI: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("URI %s annotated\n", args[0])
+		},
+	}
+
+	annotateCmd.Flags().StringVar(&annotateBranch, "branch", "", "only annotate the entry tracking this branch")
+
+	var scheduleBranch string
+	var scheduleCmd = &cobra.Command{
+		Use:   "schedule [uri] [cron]",
+		Short: "Set the cron expression the daemon syncs a registry entry on, or clear it to sync it every --interval",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			schedule := strings.Join(args[1:], " ")
+			if err := setRecordSchedule(args[0], scheduleBranch, schedule); err != nil {
+				fmt.Printf("Failed to schedule URI: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("URI %s scheduled\n", args[0])
+		},
+	}
+
+	scheduleCmd.Flags().StringVar(&scheduleBranch, "branch", "", "only schedule the entry tracking this branch")
+
 	var initCmd = &cobra.Command{
 		Use:   "init",
 		Short: "Initialize registry file",
@@ -625,7 +971,420 @@ func main() {
 		},
 	}
 
-	registryCmd.AddCommand(addCmd, listCmd)
-	rootCmd.AddCommand(versionCmd, initCmd, registryCmd, scanCmd)
+	var discoverCmd = &cobra.Command{
+		Use:   "discover",
+		Short: "Add the repositories of a forge organization, or of a directory, to the registry",
+	}
+
+	var discover DiscoverOptions
+	var discoverBitbucketCmd = &cobra.Command{
+		Use:   "bitbucket [workspace|project]",
+		Short: "Add the repositories of a Bitbucket Cloud workspace, or of a Bitbucket Server project, to the registry",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := discoverBitbucket(args[0], discover); err != nil {
+				log.Fatal().Err(err).Msg("Failed to discover repositories")
+			}
+		},
+	}
+
+	var discoverOrg, discoverUser string
+	var discoverGitHubCmd = &cobra.Command{
+		Use:   "github",
+		Short: "Add the repositories of a GitHub organization or user to the registry, disabling those gone since",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if (discoverOrg == "") == (discoverUser == "") {
+				log.Fatal().Msg("Expected one of --org or --user")
+			}
+			owner := discoverOrg
+			if discoverUser != "" {
+				owner = discoverUser
+			}
+			if err := discoverGitHub(owner, discoverUser != "", discover); err != nil {
+				log.Fatal().Err(err).Msg("Failed to discover repositories")
+			}
+		},
+	}
+	discoverGitHubCmd.Flags().StringVar(&discoverOrg, "org", "", "organization whose repositories are added")
+	discoverGitHubCmd.Flags().StringVar(&discoverUser, "user", "", "user whose repositories are added")
+	discoverGitHubCmd.Flags().BoolVar(&discover.Archived, "archived", false, "also add archived repositories")
+	discoverGitHubCmd.Flags().StringSliceVar(&discover.Topics, "topics", nil, "only add repositories with one of these topics")
+
+	var discoverGroup string
+	var discoverRecursive bool
+	var discoverGitLabCmd = &cobra.Command{
+		Use:   "gitlab",
+		Short: "Add the projects of a GitLab group to the registry, disabling those gone since",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := discoverGitLab(discoverGroup, discoverRecursive, discover); err != nil {
+				log.Fatal().Err(err).Msg("Failed to discover repositories")
+			}
+		},
+	}
+	discoverGitLabCmd.Flags().StringVar(&discoverGroup, "group", "", "group whose projects are added, e.g. acme/platform")
+	discoverGitLabCmd.Flags().BoolVar(&discoverRecursive, "recursive", false, "also add the projects of subgroups")
+	discoverGitLabCmd.Flags().BoolVar(&discover.Archived, "archived", false, "also add archived projects")
+	discoverGitLabCmd.Flags().StringSliceVar(&discover.Topics, "topics", nil, "only add projects with one of these topics")
+	discoverGitLabCmd.MarkFlagRequired("group")
+
+	var discoverMaxDepth int
+	var discoverPathCmd = &cobra.Command{
+		Use:   "path [directory]",
+		Short: "Add the git repositories found in a directory to the registry, by their origin remote",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if discoverMaxDepth <= 0 {
+				log.Fatal().Int("max-depth", discoverMaxDepth).Msg("Invalid --max-depth, expected a positive number")
+			}
+			if err := discoverPath(args[0], discoverMaxDepth, discover); err != nil {
+				log.Fatal().Err(err).Msg("Failed to discover repositories")
+			}
+		},
+	}
+	discoverPathCmd.Flags().IntVar(&discoverMaxDepth, "max-depth", 3, "search at most this many directories deep")
+
+	discoverCmd.PersistentFlags().StringSliceVar(&discover.Match, "match", nil, "only add repositories whose name matches these glob patterns")
+	discoverCmd.PersistentFlags().StringSliceVar(&discover.Exclude, "exclude", nil, "skip repositories whose name matches these glob patterns")
+	discoverCmd.PersistentFlags().BoolVar(&discover.Forks, "forks", false, "also add forks")
+	discoverCmd.PersistentFlags().StringSliceVar(&discover.Labels, "labels", nil, "labels of the added registry entries")
+	discoverCmd.PersistentFlags().BoolVar(&discover.DryRun, "dry-run", false, "print the repositories that would be added")
+
+	discoverCmd.AddCommand(discoverGitHubCmd, discoverGitLabCmd, discoverBitbucketCmd, discoverPathCmd)
+
+	registryCmd.AddCommand(addCmd, listCmd, refreshCmd, disableCmd, enableCmd, labelCmd, annotateCmd, scheduleCmd, discoverCmd)
+	var baselineCmd = &cobra.Command{
+		Use:   "baseline",
+		Short: "Manage baseline files of grandfathered markers",
+	}
+
+	var baselineFile string
+	var baselineCreateCmd = &cobra.Command{
+		Use:   "create [uri|path]",
+		Short: "Snapshot the current markers of a repository or local directory into a baseline file",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			result, err := scanFindings(args[0])
+			if err != nil {
+				log.Fatal().Err(err).Str("uri", args[0]).Msg("Failed to scan")
+			}
+			findings := result.Findings
+
+			if err := writeBaseline(expandHome(baselineFile), findings); err != nil {
+				log.Fatal().Err(err).Msg("Failed to create baseline")
+			}
+
+			fmt.Printf("Baseline file %s created with %d findings\n", baselineFile, len(findings))
+		},
+	}
+
+	addScanFlags(baselineCreateCmd)
+	baselineCreateCmd.Flags().StringVar(&baselineFile, "file", ".tr4ck.baseline.json", "baseline file to write")
+
+	baselineCmd.AddCommand(baselineCreateCmd)
+
+	var ignoreBranch, ignoreReason string
+	var ignoreCmd = &cobra.Command{
+		Use:   "ignore <id> | <uri|path> <file:line>",
+		Short: "Ignore a stored marker so that scan, sync and report no longer report it",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			runIgnore(args, ignoreBranch, ignoreReason, false)
+		},
+	}
+
+	ignoreCmd.Flags().StringVar(&ignoreBranch, "branch", "", "only ignore the marker on this branch")
+	ignoreCmd.Flags().StringVar(&ignoreReason, "reason", "", "why the marker is ignored")
+
+	var unignoreCmd = &cobra.Command{
+		Use:   "unignore <id> | <uri|path> <file:line>",
+		Short: "Report an ignored marker again",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			runIgnore(args, ignoreBranch, "", true)
+		},
+	}
+
+	unignoreCmd.Flags().StringVar(&ignoreBranch, "branch", "", "only report the marker again on this branch")
+
+	var query MarkerQuery
+	var queryFormat string
+	var queryCmd = &cobra.Command{
+		Use:         "query",
+		Short:       "List the stored markers matching filters",
+		Annotations: map[string]string{porcelainFormat: "porcelain"},
+		Args:        cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runQuery(query, queryFormat)
+		},
+	}
+
+	queryCmd.Flags().StringVar(&query.Repo, "repo", "", "only list markers of this repository, or of repositories matching a glob")
+	queryCmd.Flags().StringSliceVar(&query.Markers, "marker", nil, "only list these markers, e.g. todo,fixme")
+	queryCmd.Flags().StringVar(&query.Author, "author", "", "only list markers whose blame author name or email contains this")
+	queryCmd.Flags().StringVar(&query.State, "state", "open", "only list markers in this state: open, resolved, ignored or all")
+	queryCmd.Flags().StringVar(&query.OlderThan, "older-than", "", "only list markers older than this age, e.g. 30d, 12w or 1y")
+	queryCmd.Flags().StringSliceVar(&query.Paths, "path", nil, "only list markers of files matching these glob patterns, e.g. 'src/**'")
+	queryCmd.Flags().BoolVar(&query.Overdue, "overdue", false, "only list markers whose due: date has passed, most overdue first")
+	queryCmd.Flags().BoolVar(&query.Zombie, "zombie", false, "only list markers referencing an issue that was closed as of the last sync")
+	queryCmd.Flags().StringVar(&query.At, "at", "", "list markers as they were at a synced commit or a date, e.g. 3f2a9c1, 2024-06-30 or 2024-06-30T12:00:00Z")
+	queryCmd.Flags().StringVar(&queryFormat, "format", "table", "output format: table, json or porcelain")
+
+	var searchQuery MarkerQuery
+	var searchFormat string
+	var searchLimit int
+	var searchCmd = &cobra.Command{
+		Use:         "search <text>",
+		Short:       "Search the text, description and surrounding lines of stored markers, best matches first",
+		Annotations: map[string]string{porcelainFormat: "porcelain"},
+		Args:        cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runSearch(strings.Join(args, " "), searchQuery, searchLimit, searchFormat)
+		},
+	}
+
+	searchCmd.Flags().StringVar(&searchQuery.Repo, "repo", "", "only search markers of this repository, or of repositories matching a glob")
+	searchCmd.Flags().StringSliceVar(&searchQuery.Markers, "marker", nil, "only search these markers, e.g. todo,fixme")
+	searchCmd.Flags().StringVar(&searchQuery.State, "state", "open", "only search markers in this state: open, resolved, ignored or all")
+	searchCmd.Flags().IntVar(&searchLimit, "limit", 20, "maximum number of matches, 0 for all")
+	searchCmd.Flags().StringVar(&searchFormat, "format", "table", "output format: table, json or porcelain")
+
+	var showBranch, showFormat string
+	var showCmd = &cobra.Command{
+		Use:   "show <id> | <uri|path> <file:line>",
+		Short: "Show the timeline of a stored marker, from the commit that introduced it",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			runShow(args, showBranch, showFormat)
+		},
+	}
+
+	showCmd.Flags().StringVar(&showBranch, "branch", "", "only show the marker on this branch")
+	showCmd.Flags().StringVar(&showFormat, "format", "text", "output format: text or json")
+
+	var compareFormat string
+	var compareCmd = &cobra.Command{
+		Use:         "compare <uri|path> <commitA> <commitB>",
+		Short:       "Compare the markers of a repository at two commits: added, removed, moved and changed",
+		Annotations: map[string]string{porcelainFormat: "porcelain"},
+		Args:        cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			runCompare(args[0], args[1], args[2], compareFormat)
+		},
+	}
+
+	compareCmd.Flags().StringVar(&compareFormat, "format", "text", "output format: text, json or porcelain")
+
+	var leaderboardRepo, leaderboardFormat string
+	var leaderboardWindows []string
+	var leaderboardLimit int
+	var leaderboardCmd = &cobra.Command{
+		Use:   "leaderboard",
+		Short: "Rank authors by the stored markers they resolved and introduced, with their open markers",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runLeaderboard(leaderboardRepo, leaderboardWindows, leaderboardLimit, leaderboardFormat)
+		},
+	}
+
+	leaderboardCmd.Flags().StringVar(&leaderboardRepo, "repo", "", "only count markers of this repository, or of repositories matching a glob")
+	leaderboardCmd.Flags().StringSliceVar(&leaderboardWindows, "since", []string{"30d"}, "time windows to count introduced and resolved markers in, e.g. 7d,30d,1y or all")
+	leaderboardCmd.Flags().IntVar(&leaderboardLimit, "limit", 20, "maximum number of authors, 0 for all")
+	leaderboardCmd.Flags().StringVar(&leaderboardFormat, "format", "table", "output format: table, markdown or json")
+
+	var importFrom, importRepo, importBranch, importBaseline string
+	var importCmd = &cobra.Command{
+		Use:   "import <file|->",
+		Short: "Seed the marker store with the output of another TODO tool: leasot json, todo.txt or csv",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runImport(importFrom, args[0], importRepo, importBranch, importBaseline)
+		},
+	}
+
+	importCmd.Flags().StringVar(&importFrom, "from", "", "format of the file: leasot, todo-txt or csv")
+	importCmd.Flags().StringVar(&importRepo, "repo", "", "repository URI or local path of the imported markers, unless the csv has a repo column")
+	importCmd.Flags().StringVar(&importBranch, "branch", "", "tracked branch of the imported markers")
+	importCmd.Flags().StringVar(&importBaseline, "baseline", "", "also write the imported open markers to this baseline file")
+	importCmd.MarkFlagRequired("from")
+
+	var dbCmd = &cobra.Command{
+		Use:   "db",
+		Short: "Manage the marker store",
+	}
+
+	var exportFormat, exportOutput string
+	var dbExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export the markers, events and snapshots of the marker store for analytics tools",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runExport(exportFormat, exportOutput)
+		},
+	}
+
+	dbExportCmd.Flags().StringVar(&exportFormat, "format", "sqlite", "export format: sqlite or parquet")
+	dbExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "database file, or directory of parquet files (default tr4ck.db or tr4ck-parquet)")
+
+	var prune PruneOptions
+	var dbPruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove old resolved markers and snapshots from the marker store, optionally archiving them",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runPrune(prune)
+		},
+	}
+
+	dbPruneCmd.Flags().StringVar(&prune.ResolvedOlderThan, "resolved-older-than", "", "remove markers resolved longer ago than this age, e.g. 1y")
+	dbPruneCmd.Flags().StringVar(&prune.SnapshotsOlderThan, "snapshots-older-than", "", "remove the snapshots of commits synced longer ago than this age, e.g. 1y")
+	dbPruneCmd.Flags().StringVar(&prune.Archive, "archive", "", "database the removed markers and snapshots are added to, e.g. ~/.tr4ck/archive.db")
+	dbPruneCmd.Flags().BoolVar(&prune.DryRun, "dry-run", false, "list what would be removed without changing the store")
+	dbPruneCmd.Flags().BoolVarP(&prune.Yes, "yes", "y", false, "do not ask for confirmation")
+
+	dbCmd.AddCommand(dbExportCmd, dbPruneCmd)
+
+	var ci CIOptions
+	var ciCmd = &cobra.Command{
+		Use:   "ci",
+		Short: "Scan the workspace of a GitHub Actions job, annotating new markers and failing on thresholds",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			applyCIInputs(cmd, &ci)
+			runCI(ci)
+		},
+	}
+
+	ciCmd.Flags().StringVar(&ci.Base, "base", "", "report markers added since this commit or ref (input base, default the pull request base or the commit before a push)")
+	ciCmd.Flags().StringVar(&baselinePath, "baseline", "", "only report new markers missing from this baseline file (input baseline)")
+	ciCmd.Flags().StringArrayVar(&failOn, "fail-on", nil, "fail when a condition is met by the new markers: new-markers, count>N or marker=NAME (input fail_on)")
+	ciCmd.Flags().StringSliceVar(&includePaths, "path", nil, "only scan paths matching these glob patterns (input paths)")
+	ciCmd.Flags().StringSliceVar(&excludePaths, "exclude", nil, "skip paths matching these glob patterns (input exclude)")
+	ciCmd.Flags().BoolVar(&ci.Annotations, "annotations", true, "print a warning annotation per new marker (input annotations)")
+	ciCmd.Flags().BoolVar(&ci.Summary, "summary", true, "write a job summary (input summary)")
+
+	var hookCmd = &cobra.Command{
+		Use:   "hook",
+		Short: "Check staged files for new markers before committing",
+		// commits should not wait on the registry remote, which the hook does not use
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			applyPorcelain(cmd)
+			preRunConfig()
+		},
+	}
+
+	var hook HookOptions
+	var hookRunCmd = &cobra.Command{
+		Use:   "run [file...]",
+		Short: "List the markers added by the staged changes, blocking the commit in block mode",
+		Run: func(cmd *cobra.Command, args []string) {
+			runHook(hook, args)
+		},
+	}
+
+	var hookInstallCmd = &cobra.Command{
+		Use:   "install",
+		Short: "Install a git pre-commit hook running hook run with these options",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := installHook(hook); err != nil {
+				log.Fatal().Err(err).Msg("Failed to install hook")
+			}
+		},
+	}
+
+	for _, cmd := range []*cobra.Command{hookRunCmd, hookInstallCmd} {
+		cmd.Flags().StringVar(&hook.Mode, "mode", "block", "block commits adding markers that meet a --fail-on condition, or warn to only list them")
+		cmd.Flags().StringArrayVar(&hook.FailOn, "fail-on", []string{"new-markers"}, "block when the new markers meet a condition: new-markers, count>N or marker=NAME (repeatable)")
+		cmd.Flags().StringVar(&baselinePath, "baseline", "", "only report markers missing from this baseline file")
+	}
+	hookInstallCmd.Flags().StringVar(&hook.Command, "command", "tr4ck", "command running tr4ck in the hook")
+	hookInstallCmd.Flags().BoolVar(&hook.Force, "force", false, "replace an existing pre-commit hook")
+
+	hookCmd.AddCommand(hookRunCmd, hookInstallCmd)
+
+	var daemonInterval time.Duration
+	var daemonCmd = &cobra.Command{
+		Use:   "daemon",
+		Short: "Sync the registry periodically, serving Prometheus metrics, Atom feeds, webhooks and a web UI",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runDaemon(daemonInterval)
+		},
+	}
+
+	daemonCmd.Flags().DurationVar(&daemonInterval, "interval", time.Hour, "time between syncs of the registry entries without a schedule")
+	daemonCmd.Flags().StringVar(&daemonAddr, "addr", "", "serve Prometheus metrics on /metrics, the Atom feed on /feed.atom, the iCalendar on /calendar.ics, webhooks on /hooks and the web UI on /ui at this address, e.g. :9090")
+	daemonCmd.Flags().StringVar(&daemonAddr, "metrics-addr", "", "serve at this address, see --addr")
+	daemonCmd.Flags().MarkDeprecated("metrics-addr", "use --addr instead")
+	daemonCmd.Flags().StringVar(&metricsTextfile, "metrics-textfile", "", "write Prometheus metrics to this file after each sync")
+
+	var serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve a REST API, and optionally a gRPC API, to manage the registry, trigger scans and syncs and query stored markers",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runServe()
+		},
+	}
+
+	serveCmd.Flags().StringVar(&apiAddr, "addr", "localhost:8080", "address to serve the API at")
+	serveCmd.Flags().StringVar(&grpcAddr, "grpc-addr", "", "also serve the gRPC API of proto/tr4ck/v1/tr4ck.proto at this address, e.g. localhost:9443")
+
+	var feed FeedOptions
+	var feedOutput string
+	var feedCmd = &cobra.Command{
+		Use:   "feed [uri|glob]",
+		Short: "Write an Atom feed of the markers opened, resolved, ignored and reopened, of all repositories or one",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				feed.Repo = args[0]
+			}
+			runFeed(feed, feedOutput)
+		},
+	}
+
+	feedCmd.Flags().StringVar(&feed.Branch, "branch", "", "only list the markers of this branch")
+	feedCmd.Flags().IntVar(&feed.Limit, "limit", 100, "maximum number of entries, latest first")
+	feedCmd.Flags().StringVarP(&feedOutput, "output", "o", "", "write the feed to this file instead of stdout")
+
+	var calendar CalendarOptions
+	var calendarOutput string
+	var calendarCmd = &cobra.Command{
+		Use:   "calendar [uri|glob]",
+		Short: "Write an iCalendar of the open markers with a due: date, of all repositories or one",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				calendar.Repo = args[0]
+			}
+			runCalendar(calendar, calendarOutput)
+		},
+	}
+
+	calendarCmd.Flags().StringVar(&calendar.Branch, "branch", "", "only list the markers of this branch")
+	calendarCmd.Flags().StringVar(&calendar.Kind, "kind", "todo", "write each marker as a todo, due on its date, or as an all-day event")
+	calendarCmd.Flags().StringVarP(&calendarOutput, "output", "o", "", "write the calendar to this file instead of stdout")
+
+	var watchCmd = &cobra.Command{
+		Use:   "watch [path...]",
+		Short: "Watch local directories, printing the markers added and removed as files are saved",
+		Args:  cobra.ArbitraryArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				args = []string{"."}
+			}
+			runWatch(args)
+		},
+	}
+
+	watchCmd.Flags().StringSliceVar(&includePaths, "path", nil, "only watch paths matching these glob patterns, e.g. src/**/*.go")
+	watchCmd.Flags().StringSliceVar(&excludePaths, "exclude", nil, "skip paths matching these glob patterns, e.g. *.min.js")
+	watchCmd.Flags().BoolVar(&noGitignore, "no-gitignore", false, "watch files matched by .gitignore")
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", watchDebounce, "wait this long after a file changes before rescanning it")
+
+	rootCmd.AddCommand(versionCmd, initCmd, registryCmd, scanCmd, reportCmd, statsCmd, baselineCmd, ignoreCmd, unignoreCmd, queryCmd, searchCmd, showCmd, compareCmd, leaderboardCmd, importCmd, dbCmd, ciCmd, hookCmd, daemonCmd, serveCmd, feedCmd, calendarCmd, watchCmd)
 	rootCmd.Execute()
 }
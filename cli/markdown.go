@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// markdownEscaper escapes the characters markdown would interpret in finding text
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "|", `\|`, "#", `\#`,
+)
+
+// blobURL links to a line of a file at a commit on the repository's web host, or returns an empty string
+// for local paths. GitLab and Bitbucket have their own URL layout, other hosts are assumed to follow GitHub's.
+func blobURL(repo, commit, file string, line int) string {
+	uri := canonicalURI(repo)
+	host, _, ok := strings.Cut(uri, "/")
+	if !ok || host == "" || commit == "" {
+		return ""
+	}
+
+	file = (&url.URL{Path: file}).EscapedPath()
+
+	switch {
+	case strings.Contains(host, "gitlab"):
+		return fmt.Sprintf("https://%s/-/blob/%s/%s#L%d", uri, commit, file, line)
+	case host == "bitbucket.org":
+		return fmt.Sprintf("https://%s/src/%s/%s#lines-%d", uri, commit, file, line)
+	default:
+		return fmt.Sprintf("https://%s/blob/%s/%s#L%d", uri, commit, file, line)
+	}
+}
+
+// commitURL links to a commit on the web host of the repository, assuming GitHub's URL layout for unknown hosts
+func commitURL(repo, commit string) string {
+	uri := canonicalURI(repo)
+	host, _, ok := strings.Cut(uri, "/")
+	if !ok || host == "" || commit == "" {
+		return ""
+	}
+
+	switch {
+	case strings.Contains(host, "gitlab"):
+		return fmt.Sprintf("https://%s/-/commit/%s", uri, commit)
+	case host == "bitbucket.org":
+		return fmt.Sprintf("https://%s/commits/%s", uri, commit)
+	default:
+		return fmt.Sprintf("https://%s/commit/%s", uri, commit)
+	}
+}
+
+// writeMarkdown writes the report grouped per repository and file, linking each finding to its line
+func writeMarkdown(w io.Writer, report Report) {
+	total := 0
+	for _, result := range report.Results {
+		total += len(result.Findings)
+	}
+
+	fmt.Fprintf(w, "# tr4ck report\n\n")
+	fmt.Fprintf(w, "Generated %s, %d findings in %d repositories.\n", report.Started.UTC().Format("2006-01-02 15:04 MST"), total, len(report.Results))
+
+	for _, result := range report.Results {
+		fmt.Fprintf(w, "\n## %s\n\n", markdownEscaper.Replace(result.title()))
+		if result.Note != "" {
+			fmt.Fprintf(w, "> %s\n\n", markdownEscaper.Replace(strings.Join(strings.Fields(result.Note), " ")))
+		}
+
+		if result.To != "" {
+			fmt.Fprintf(w, "Commit `%.7s`, ", result.To)
+		}
+		fmt.Fprintf(w, "%d findings.\n", len(result.Findings))
+
+		files, byFile := groupByFile(result.Findings)
+		for _, file := range files {
+			fmt.Fprintf(w, "\n### `%s`\n\n", file)
+
+			for _, f := range byFile[file] {
+				location := fmt.Sprintf("L%d", f.Line)
+				if url := blobURL(result.Repo, result.To, f.File, f.Line); url != "" {
+					location = fmt.Sprintf("[%s](%s)", location, url)
+				}
+
+				fmt.Fprintf(w, "- %s **%s** %s", location, f.Marker, markdownEscaper.Replace(f.Text))
+				if f.Commit != "" {
+					fmt.Fprintf(w, " (%s, %s)", markdownEscaper.Replace(f.Author), f.Age)
+				}
+				if f.ID != "" {
+					fmt.Fprintf(w, " `%s`", f.ID)
+				}
+				fmt.Fprintln(w)
+			}
+		}
+
+		if len(result.Resolved) > 0 {
+			fmt.Fprintf(w, "\n### Resolved\n\n")
+			for _, f := range result.Resolved {
+				fmt.Fprintf(w, "- `%s` L%d **%s** ~~%s~~", f.File, f.Line, f.Marker, markdownEscaper.Replace(f.Text))
+				if by := f.ResolvedBy; by != nil {
+					fmt.Fprintf(w, " resolved by %s in `%.7s`", markdownEscaper.Replace(by.Author), by.Commit)
+				}
+				fmt.Fprintln(w)
+			}
+		}
+	}
+}
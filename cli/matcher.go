@@ -0,0 +1,236 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// languageMarkers maps extensions (.py) and file names (Makefile) to the marker set used for those files
+var languageMarkers map[string][]string
+
+// markerMatch is a marker occurrence within a line
+type markerMatch struct {
+	// index is the byte offset of the match
+	index  int
+	marker string
+}
+
+type matcherEntry struct {
+	marker string
+	// pattern is the marker, lowercased when matching case-insensitively
+	pattern string
+	fold    bool
+}
+
+// markerMatcher finds marker occurrences in lines. It is built once per scan from the marker set as an
+// Aho–Corasick automaton, so each line is read once regardless of the number of markers.
+type markerMatcher struct {
+	entries []matcherEntry
+	// fold is set when any marker is case-insensitive: the automaton is then built from lowercased markers,
+	// input bytes are lowercased while scanning and case-sensitive matches are checked against the line
+	fold bool
+	// next holds 256 transitions per state, with failure links resolved at build time
+	next []int32
+	// out lists the entries ending at each state, including those reached through failure links
+	out [][]int
+	// start marks the bytes leaving the root state, so that text between matches is skipped quickly
+	start [256]bool
+	// languages holds the matchers of the per-language marker sets, by extension or file name
+	languages map[string]*markerMatcher
+}
+
+// newMarkerMatcher builds a matcher for the given markers, honoring the global and per-marker case_insensitive
+// settings. Files of a language with its own marker set are matched against that set instead.
+func newMarkerMatcher(markers []string) *markerMatcher {
+	m := buildMarkerMatcher(markers)
+	for key, set := range languageMarkers {
+		if m.languages == nil {
+			m.languages = make(map[string]*markerMatcher)
+		}
+		m.languages[key] = buildMarkerMatcher(set)
+	}
+	return m
+}
+
+// forFile returns the matcher of the file's language marker set, or m when it has none
+func (m *markerMatcher) forFile(file string) *markerMatcher {
+	if len(m.languages) == 0 {
+		return m
+	}
+	if lm, ok := m.languages[filepath.Base(file)]; ok {
+		return lm
+	}
+	if lm, ok := m.languages[strings.ToLower(filepath.Ext(file))]; ok {
+		return lm
+	}
+	return m
+}
+
+func buildMarkerMatcher(markers []string) *markerMatcher {
+	m := &markerMatcher{}
+	for _, marker := range markers {
+		if marker == "" {
+			continue
+		}
+
+		_, fold := caseInsensitiveMarkers[marker]
+		fold = fold || caseInsensitive
+
+		entry := matcherEntry{marker: marker, pattern: marker, fold: fold}
+		if fold {
+			entry.pattern = asciiLower(marker)
+			m.fold = true
+		}
+		m.entries = append(m.entries, entry)
+	}
+
+	m.build()
+	return m
+}
+
+// build constructs the trie of patterns and resolves failure links breadth first
+func (m *markerMatcher) build() {
+	m.next = make([]int32, 256)
+	m.out = [][]int{nil}
+
+	for id, e := range m.entries {
+		key := e.pattern
+		if m.fold {
+			key = asciiLower(key)
+		}
+
+		state := int32(0)
+		for i := 0; i < len(key); i++ {
+			t := int(state)*256 + int(key[i])
+			if m.next[t] == 0 {
+				m.next[t] = int32(len(m.out))
+				m.next = append(m.next, make([]int32, 256)...)
+				m.out = append(m.out, nil)
+			}
+			state = m.next[t]
+		}
+		m.out[state] = append(m.out[state], id)
+	}
+
+	// root transitions either enter the trie or stay at the root
+	fail := make([]int32, len(m.out))
+	var queue []int32
+	for c := 0; c < 256; c++ {
+		if child := m.next[c]; child != 0 {
+			m.start[c] = true
+			if m.fold && 'a' <= c && c <= 'z' {
+				m.start[c-('a'-'A')] = true
+			}
+			queue = append(queue, child)
+		}
+	}
+
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		// outputs of the longest proper suffix also end here
+		m.out[state] = append(m.out[state], m.out[fail[state]]...)
+
+		for c := 0; c < 256; c++ {
+			t := int(state)*256 + c
+			child := m.next[t]
+			if child == 0 {
+				// missing transitions follow the failure link
+				m.next[t] = m.next[int(fail[state])*256+c]
+				continue
+			}
+			fail[child] = m.next[int(fail[state])*256+c]
+			queue = append(queue, child)
+		}
+	}
+}
+
+// find returns every marker occurrence in line, ordered by position. Occurrences of the same marker do not
+// overlap, while different markers may match overlapping text.
+func (m *markerMatcher) find(line string) []markerMatch {
+	type hit struct {
+		markerMatch
+		id int
+	}
+
+	var hits []hit
+	// end of the previous occurrence of each entry, allocated on the first hit
+	var lastEnd []int
+
+	next, out, fold := m.next, m.out, m.fold
+	state := int32(0)
+	for i := 0; i < len(line); i++ {
+		if state == 0 {
+			for i < len(line) && !m.start[line[i]] {
+				i++
+			}
+			if i == len(line) {
+				break
+			}
+		}
+
+		c := line[i]
+		if fold && 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+
+		state = next[int(state)<<8|int(c)]
+		if out[state] == nil {
+			continue
+		}
+
+		for _, id := range out[state] {
+			e := m.entries[id]
+			start := i + 1 - len(e.pattern)
+
+			if lastEnd == nil {
+				lastEnd = make([]int, len(m.entries))
+			}
+			if start < lastEnd[id] {
+				continue
+			}
+			if fold && !e.fold && line[start:i+1] != e.marker {
+				continue
+			}
+
+			lastEnd[id] = i + 1
+			hits = append(hits, hit{markerMatch{index: start, marker: e.marker}, id})
+		}
+	}
+
+	if hits == nil {
+		return nil
+	}
+
+	// matches are found by end position, report them by start and then marker order
+	slices.SortFunc(hits, func(a, b hit) int {
+		if a.index != b.index {
+			return a.index - b.index
+		}
+		return a.id - b.id
+	})
+
+	matches := make([]markerMatch, len(hits))
+	for i, h := range hits {
+		matches[i] = h.markerMatch
+	}
+	return matches
+}
+
+// asciiLower lowercases ASCII letters only, so byte offsets in the result match the input
+func asciiLower(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; 'A' <= c && c <= 'Z' {
+			b := []byte(s)
+			for j := i; j < len(b); j++ {
+				if 'A' <= b[j] && b[j] <= 'Z' {
+					b[j] += 'a' - 'A'
+				}
+			}
+			return string(b)
+		}
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// indexFind is the matcher the automaton replaced, running strings.Index once per marker over the line
+func indexFind(m *markerMatcher, line string) []markerMatch {
+	folded := asciiLower(line)
+	var matches []markerMatch
+	for _, e := range m.entries {
+		haystack := line
+		if e.fold {
+			haystack = folded
+		}
+		for offset := 0; ; {
+			idx := strings.Index(haystack[offset:], e.pattern)
+			if idx < 0 {
+				break
+			}
+			idx += offset
+			matches = append(matches, markerMatch{index: idx, marker: e.marker})
+			offset = idx + len(e.pattern)
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b markerMatch) int { return a.index - b.index })
+	return matches
+}
+
+// withCaseInsensitive sets the case_insensitive settings for the duration of a test or benchmark
+func withCaseInsensitive(tb testing.TB, all bool, markers ...string) {
+	savedAll, savedMarkers := caseInsensitive, caseInsensitiveMarkers
+	tb.Cleanup(func() { caseInsensitive, caseInsensitiveMarkers = savedAll, savedMarkers })
+
+	caseInsensitive = all
+	caseInsensitiveMarkers = map[string]struct{}{}
+	for _, marker := range markers {
+		caseInsensitiveMarkers[marker] = struct{}{}
+	}
+}
+
+func TestMarkerMatcherMatchesIndex(t *testing.T) {
+	// a small alphabet makes overlapping, repeated and differently cased occurrences common
+	const alphabet = "TODOtodoXx: é"
+	random := func(r *rand.Rand, n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = alphabet[r.Intn(len(alphabet))]
+		}
+		return string(b)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for round := 0; round < 2000; round++ {
+		markers := make([]string, 1+r.Intn(6))
+		var folded []string
+		for i := range markers {
+			markers[i] = random(r, 1+r.Intn(4))
+			if r.Intn(3) == 0 {
+				folded = append(folded, markers[i])
+			}
+		}
+		withCaseInsensitive(t, r.Intn(5) == 0, folded...)
+		m := buildMarkerMatcher(markers)
+
+		for i := 0; i < 20; i++ {
+			line := random(r, r.Intn(40))
+			got, want := m.find(line), indexFind(m, line)
+			if len(got) == 0 && len(want) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("markers %q (case-insensitive %q, all %v), line %q:\n got %v\nwant %v", markers, folded, caseInsensitive, line, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkMarkerMatcher(b *testing.B) {
+	many := []string{"TODO", "FIXME", "HACK"}
+	for i := len(many); i < 53; i++ {
+		many = append(many, fmt.Sprintf("MARK%02d", i))
+	}
+	line := strings.Repeat("\tvalue := compute(input, options) // keep in sync with the parser ", 3)[:190] + " TODO: tidy"
+
+	for _, markers := range [][]string{many[:3], many} {
+		for _, fold := range []bool{false, true} {
+			b.Run(fmt.Sprintf("markers=%d/fold=%v", len(markers), fold), func(b *testing.B) {
+				withCaseInsensitive(b, fold)
+				m := buildMarkerMatcher(markers)
+				b.Run("automaton", func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						m.find(line)
+					}
+				})
+				b.Run("index", func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						indexFind(m, line)
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// priorityPattern matches short priorities such as p1 or P0
+var priorityPattern = regexp.MustCompile(`^[pP][0-9]$`)
+
+// issuePattern matches issue references: #123 or org/repo#123 for GitHub and GitLab, JIRA-456 for Jira
+var issuePattern = regexp.MustCompile(`(?:[\w.-]+/[\w.-]+)?#\d+\b|\b[A-Z][A-Z0-9]+-\d+\b`)
+
+// notIssueKeys are common identifiers shaped like Jira keys, e.g. UTF-8 or SHA-256
+var notIssueKeys = map[string]struct{}{
+	"UTF": {}, "SHA": {}, "ISO": {}, "AES": {}, "RSA": {}, "MD": {}, "IEEE": {}, "ECMA": {}, "TLS": {}, "HTTP": {}, "CP": {}, "ES": {},
+}
+
+// addIssueRefs attaches the issue references found in text to the finding, once each
+func addIssueRefs(f *Finding, text string) {
+	for _, loc := range issuePattern.FindAllStringIndex(text, -1) {
+		ref := text[loc[0]:loc[1]]
+		// e.g. a#1 or an anchor in a URL
+		if loc[0] > 0 && ref[0] == '#' && !strings.ContainsRune(" \t([{,;:", rune(text[loc[0]-1])) {
+			continue
+		}
+		if key, _, ok := strings.Cut(ref, "-"); ok {
+			if _, skip := notIssueKeys[key]; skip {
+				continue
+			}
+		}
+		if !slices.Contains(f.Issues, ref) {
+			f.Issues = append(f.Issues, ref)
+		}
+	}
+}
+
+// parseMarkerMetadata fills the structured fields of a finding from the text following its marker,
+// using the convention marker(assignee, due:2025-09-01, p1): description
+func parseMarkerMetadata(f *Finding, rest string) {
+	if strings.HasPrefix(rest, "(") {
+		if end := strings.Index(rest, ")"); end > 0 {
+			for _, item := range strings.Split(rest[1:end], ",") {
+				item = strings.TrimSpace(item)
+				if item == "" {
+					continue
+				}
+
+				key, value, ok := strings.Cut(item, ":")
+				key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+				switch {
+				case issuePattern.FindString(item) == item:
+					addIssueRefs(f, item)
+				case ok && key == "due":
+					f.Due = value
+				case ok && (key == "priority" || key == "p"):
+					f.Priority = strings.ToLower(value)
+				case ok && (key == "owner" || key == "assignee"):
+					f.Assignee = strings.TrimPrefix(value, "@")
+				case ok:
+					if f.Tags == nil {
+						f.Tags = make(map[string]string)
+					}
+					f.Tags[key] = value
+				case priorityPattern.MatchString(item):
+					f.Priority = strings.ToLower(item)
+				case f.Assignee == "":
+					f.Assignee = strings.TrimPrefix(item, "@")
+				}
+			}
+			rest = rest[end+1:]
+		}
+	}
+
+	rest = strings.TrimSpace(rest)
+	rest = strings.TrimSpace(strings.TrimLeft(rest, ":-"))
+	// drop trailing block comment terminators
+	rest = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(rest, "*/"), "-->"))
+	f.Description = rest
+	addIssueRefs(f, rest)
+}
+
+// continuation is a finding whose comment may continue on the following lines
+type continuation struct {
+	// index of the finding
+	index int
+	// lineToken is set for line comments, e.g. //
+	lineToken string
+	// blockEnd is set within an unterminated block comment, e.g. */
+	blockEnd string
+}
+
+// commentContinuation reports whether the comment holding the marker at index may continue on the next
+// lines: either a whole-line comment or a block comment left open on this line
+func commentContinuation(syntax *commentSyntax, line string, index int) (continuation, bool) {
+	before := strings.TrimSpace(line[:index])
+
+	for _, token := range syntax.line {
+		if strings.HasPrefix(before, token) {
+			return continuation{lineToken: token}, true
+		}
+	}
+
+	for _, block := range syntax.block {
+		open := strings.LastIndex(line[:index], block[0])
+		// a marker on a middle line of a /* ... */ block, e.g. " * TODO"
+		inside := before == "*" && block[0] == "/*"
+		if (open >= 0 || inside) && !strings.Contains(line[index:], block[1]) {
+			return continuation{blockEnd: block[1]}, true
+		}
+	}
+
+	return continuation{}, false
+}
+
+// next returns the description text of a following line and whether the comment may continue after it
+func (c continuation) next(text string) (string, bool) {
+	trimmed := strings.TrimSpace(text)
+
+	if c.lineToken != "" {
+		rest, ok := strings.CutPrefix(trimmed, c.lineToken)
+		if !ok {
+			return "", false
+		}
+		// e.g. /// and ## comments
+		rest = strings.TrimSpace(strings.TrimLeft(rest, c.lineToken[:1]))
+		return rest, rest != ""
+	}
+
+	if end := strings.Index(trimmed, c.blockEnd); end >= 0 {
+		return strings.TrimSpace(strings.TrimPrefix(trimmed[:end], "*")), false
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(trimmed, "*"))
+	return rest, rest != ""
+}
+
+// continueDescriptions appends a following comment line to the description of pending findings and returns
+// those whose comment may continue further
+func continueDescriptions(findings []Finding, pending []continuation, text string) []continuation {
+	var next []continuation
+	for _, c := range pending {
+		rest, more := c.next(text)
+		if rest != "" {
+			f := &findings[c.index]
+			f.Description = strings.TrimSpace(f.Description + " " + rest)
+			addIssueRefs(f, rest)
+		}
+		if more {
+			next = append(next, c)
+		}
+	}
+	return next
+}
+
+// dueDate returns the parsed due date of the finding, if any
+func (f Finding) dueDate() (time.Time, bool) {
+	if f.Due == "" {
+		return time.Time{}, false
+	}
+
+	due, err := time.Parse("2006-01-02", f.Due)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return due, true
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsTextfile is written after each sync, for the textfile collector of the node exporter
+var metricsTextfile string
+
+// syncMetrics renders the Prometheus metrics of the marker store and of the syncs, once per sync
+type syncMetrics struct {
+	mu   sync.Mutex
+	page []byte
+	// errors counts the repositories that failed to sync, by labelKey of repository and branch
+	errors map[string]int
+	syncs  int
+}
+
+var metrics = &syncMetrics{errors: map[string]int{}}
+
+// labelEscaper escapes Prometheus label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricWriter writes metrics in the Prometheus text exposition format
+type metricWriter struct {
+	w io.Writer
+}
+
+func (m metricWriter) help(name, kind, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a sample, labels being name and value pairs
+func (m metricWriter) sample(name string, value float64, labels ...string) {
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1])))
+	}
+	if len(pairs) > 0 {
+		name += "{" + strings.Join(pairs, ",") + "}"
+	}
+	fmt.Fprintf(m.w, "%s %g\n", name, value)
+}
+
+// cloneCacheSize is the size in bytes of the clones of registered repositories
+func cloneCacheSize() int64 {
+	var size int64
+	filepath.WalkDir(filepath.Join(os.TempDir(), "tr4ck", "archives"), func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// record adds a sync to the metrics, nil before the first one, and renders them with the current marker store
+func (s *syncMetrics) record(run *SyncRun, failed error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if run != nil {
+		s.syncs++
+		for _, repo := range run.Repos {
+			if repo.Err != nil {
+				s.errors[labelKey(repo.Repo, repo.Branch)]++
+			}
+		}
+		if failed != nil {
+			s.errors[labelKey("", "")]++
+		}
+	}
+
+	var buf bytes.Buffer
+	m := metricWriter{&buf}
+
+	if store, err := loadStore(storeFilePath()); err == nil {
+		open, overdue := map[string]int{}, map[string]int{}
+		now := time.Now()
+		for _, marker := range store.Markers {
+			if marker.State != markerOpen {
+				continue
+			}
+			open[labelKey(marker.Repo, marker.Branch, marker.Marker)]++
+			if _, late := marker.overdue(now); late {
+				overdue[labelKey(marker.Repo, marker.Branch)]++
+			}
+		}
+
+		m.help("tr4ck_markers_open", "gauge", "Open markers by repository, branch and marker.")
+		for _, key := range sortedKeys(open) {
+			values := strings.Split(key, "\x00")
+			m.sample("tr4ck_markers_open", float64(open[key]), "repo", values[0], "branch", values[1], "marker", values[2])
+		}
+		m.help("tr4ck_markers_overdue", "gauge", "Open markers past their due date by repository and branch.")
+		for _, key := range sortedKeys(overdue) {
+			values := strings.Split(key, "\x00")
+			m.sample("tr4ck_markers_overdue", float64(overdue[key]), "repo", values[0], "branch", values[1])
+		}
+	}
+
+	m.help("tr4ck_syncs_total", "counter", "Syncs run.")
+	m.sample("tr4ck_syncs_total", float64(s.syncs))
+	m.help("tr4ck_sync_errors_total", "counter", "Repositories that failed to sync, and syncs that failed, with an empty repo.")
+	for _, key := range sortedKeys(s.errors) {
+		values := strings.Split(key, "\x00")
+		m.sample("tr4ck_sync_errors_total", float64(s.errors[key]), "repo", values[0], "branch", values[1])
+	}
+
+	if run != nil {
+		m.help("tr4ck_sync_duration_seconds", "gauge", "Duration of the last sync.")
+		m.sample("tr4ck_sync_duration_seconds", run.Duration.Seconds())
+		m.help("tr4ck_sync_last_run_timestamp_seconds", "gauge", "Start of the last sync.")
+		m.sample("tr4ck_sync_last_run_timestamp_seconds", float64(run.Start.Unix()))
+		m.help("tr4ck_repo_sync_duration_seconds", "gauge", "Duration of the last sync of each repository and branch.")
+		for _, repo := range run.Repos {
+			m.sample("tr4ck_repo_sync_duration_seconds", repo.Duration.Seconds(), "repo", repo.Repo, "branch", repo.Branch)
+		}
+	}
+
+	m.help("tr4ck_clone_cache_bytes", "gauge", "Size of the clones of registered repositories.")
+	m.sample("tr4ck_clone_cache_bytes", float64(cloneCacheSize()))
+
+	s.page = buf.Bytes()
+}
+
+// labelKey joins label values into a map key
+func labelKey(values ...string) string {
+	return strings.Join(values, "\x00")
+}
+
+// sortedKeys returns the keys of a map, sorted
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ServeHTTP serves the metrics rendered after the last sync
+func (s *syncMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	page := s.page
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(page)
+}
+
+// writeTextfile atomically writes the metrics to a .prom file, so the collector never reads a partial file
+func (s *syncMetrics) writeTextfile(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := writeFileAtomic(expandHome(path), s.page, 0644); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	return nil
+}
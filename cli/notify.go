@@ -0,0 +1,146 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RepoDigest is what a sync found in a repository branch: the markers it opened and resolved, and the open
+// markers past their due date
+type RepoDigest struct {
+	Repo   string   `json:"repo"`
+	Branch string   `json:"branch,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+	// Initial is set on the first sync of the repository, which opens all of its markers
+	Initial  bool            `json:"initial"`
+	Opened   []*StoredMarker `json:"opened"`
+	Resolved []*StoredMarker `json:"resolved"`
+	Overdue  []*StoredMarker `json:"overdue"`
+}
+
+// SyncDigest is the digest of each repository branch updated by a sync
+type SyncDigest struct {
+	Time  time.Time    `json:"time"`
+	Repos []RepoDigest `json:"repos"`
+}
+
+// empty reports whether the repository has nothing to notify
+func (d RepoDigest) empty() bool {
+	return len(d.Opened) == 0 && len(d.Resolved) == 0 && len(d.Overdue) == 0
+}
+
+// counts returns the number of opened, resolved and overdue markers of all repositories
+func (d SyncDigest) counts() (opened, resolved, overdue int) {
+	for _, repo := range d.Repos {
+		opened += len(repo.Opened)
+		resolved += len(repo.Resolved)
+		overdue += len(repo.Overdue)
+	}
+	return opened, resolved, overdue
+}
+
+// splitDigest splits the markers of a repository digest by destination, e.g. by the routes matching their owners,
+// returning the destinations in order of first marker
+func splitDigest[D comparable](repo RepoDigest, destination func(m *StoredMarker) D) ([]D, map[D]RepoDigest) {
+	var order []D
+	parts := map[D]RepoDigest{}
+	part := func(m *StoredMarker) (D, RepoDigest) {
+		dest := destination(m)
+		d, ok := parts[dest]
+		if !ok {
+			order = append(order, dest)
+			d = RepoDigest{Repo: repo.Repo, Branch: repo.Branch, Labels: repo.Labels, Initial: repo.Initial}
+		}
+		return dest, d
+	}
+	for _, m := range repo.Opened {
+		dest, d := part(m)
+		d.Opened = append(d.Opened, m)
+		parts[dest] = d
+	}
+	for _, m := range repo.Resolved {
+		dest, d := part(m)
+		d.Resolved = append(d.Resolved, m)
+		parts[dest] = d
+	}
+	for _, m := range repo.Overdue {
+		dest, d := part(m)
+		d.Overdue = append(d.Overdue, m)
+		parts[dest] = d
+	}
+	return order, parts
+}
+
+// routed reports whether a route of a notifier matches a marker of a repository: by one of the labels of the
+// repository, or one of the CODEOWNERS owners of the marker
+func routed(labels, owners []string, repo RepoDigest, m *StoredMarker) bool {
+	for _, label := range labels {
+		if containsFold(repo.Labels, label) {
+			return true
+		}
+	}
+	for _, owner := range owners {
+		if containsFold(m.Owners, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// overdueMarkers returns the open markers of a repository branch past their due date, most overdue first
+func (s *Store) overdueMarkers(repo, branch string, now time.Time) []*StoredMarker {
+	repo = canonicalURI(repo)
+
+	var overdue []*StoredMarker
+	for _, m := range s.Markers {
+		if m.Repo != repo || m.Branch != branch || m.State != markerOpen {
+			continue
+		}
+		if _, late := m.overdue(now); late {
+			overdue = append(overdue, m)
+		}
+	}
+	sort.SliceStable(overdue, func(i, j int) bool {
+		a, _ := overdue[i].dueDate()
+		b, _ := overdue[j].dueDate()
+		return a.Before(b)
+	})
+	return overdue
+}
+
+// notifier sends the digest of a sync somewhere
+type notifier interface {
+	name() string
+	notify(d SyncDigest) error
+	// alert sends an alert at once, whatever the schedule of the notifier
+	alert(a Alert) error
+}
+
+// notifiers returns the notifiers set up in the config
+func notifiers() []notifier {
+	var all []notifier
+	if slackConfig != nil {
+		all = append(all, newSlackNotifier(*slackConfig))
+	}
+	if discordConfig != nil {
+		all = append(all, newDiscordNotifier(*discordConfig))
+	}
+	if emailConfig != nil {
+		all = append(all, newEmailNotifier(*emailConfig))
+	}
+	for _, c := range webhookConfigs {
+		all = append(all, newWebhookNotifier(c))
+	}
+	return all
+}
+
+// sendNotifications sends the digest of a sync to every notifier. Failures are logged.
+func sendNotifications(d SyncDigest) {
+	for _, n := range notifiers() {
+		if err := n.notify(d); err != nil {
+			log.Err(err).Str("notifier", n.name()).Msg("Failed to send sync notification")
+		}
+	}
+}
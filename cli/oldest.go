@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// reportOldest is the number of longest-lived markers listed by report --oldest, 0 for a regular report
+var reportOldest int
+
+// oldestFindings returns the n findings of results whose line is the oldest, oldest first.
+// Findings that could not be blamed are left out.
+func oldestFindings(results []ScanResult, n int) []RepoFinding {
+	var findings []RepoFinding
+	for _, result := range results {
+		for _, f := range result.Findings {
+			if f.Date != nil {
+				findings = append(findings, RepoFinding{Repo: result.Repo, Branch: result.Branch, Revision: result.To, Finding: f})
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Date.Before(*findings[j].Date) })
+	return findings[:min(n, len(findings))]
+}
+
+// runOldestReport scans like report and lists the reportOldest longest-lived markers across repositories
+func runOldestReport(uris []string) {
+	format := outputFormat
+	if format != "markdown" && format != "text" && format != "json" && format != "porcelain" {
+		log.Fatal().Str("format", format).Msg("Invalid --format, --oldest supports markdown, text, json and porcelain")
+	}
+
+	// ages come from blame
+	blameFindings = true
+
+	var results []ScanResult
+	scanAll(uris, func(result ScanResult) {
+		results = append(results, result)
+	})
+	findings := oldestFindings(results, reportOldest)
+
+	var w io.Writer = os.Stdout
+	f, err := openOutput()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open output")
+	}
+	if f != nil {
+		defer f.Close()
+		w = f
+	}
+
+	switch format {
+	case "json":
+		if findings == nil {
+			findings = []RepoFinding{}
+		}
+		PrintStruct(w, findings)
+	case "markdown":
+		writeOldestMarkdown(w, findings)
+	case "text":
+		for _, f := range findings {
+			repo := ScanResult{Repo: f.Repo, Branch: f.Branch}.title()
+			fmt.Fprintf(w, "%s\t%s %s:%d:%d\t%s\t%s\t%s\n", aurora.Yellow(f.Age), aurora.Gray(12, repo), aurora.Blue(f.File), f.Line, f.Column, aurora.BrightGreen(f.Marker), aurora.Cyan(f.Author), f.Text)
+		}
+	case "porcelain":
+		// age, author, email, repository, file, line, marker and text
+		for _, f := range findings {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", f.Age, f.Author, f.Email, f.Repo, f.File, f.Line, f.Marker, porcelainField(f.Text))
+		}
+	}
+}
+
+// writeOldestMarkdown writes a table of the oldest markers with their age, author and a link to their line
+func writeOldestMarkdown(w io.Writer, findings []RepoFinding) {
+	fmt.Fprintf(w, "# tr4ck oldest markers\n\n")
+	fmt.Fprintf(w, "Generated %s, %d markers.\n\n", time.Now().UTC().Format("2006-01-02 15:04 MST"), len(findings))
+	fmt.Fprintln(w, "| Age | Marker | Repository | Location | Author | Text |")
+	fmt.Fprintln(w, "|---:|---|---|---|---|---|")
+
+	for _, f := range findings {
+		location := fmt.Sprintf("%s:%d", f.File, f.Line)
+		if url := blobURL(f.Repo, f.Revision, f.File, f.Line); url != "" {
+			location = fmt.Sprintf("[%s](%s)", markdownEscaper.Replace(location), url)
+		} else {
+			location = markdownEscaper.Replace(location)
+		}
+		repo := ScanResult{Repo: f.Repo, Branch: f.Branch}.title()
+		fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s |\n", f.Age, markdownEscaper.Replace(f.Marker), markdownEscaper.Replace(repo), location, markdownEscaper.Replace(f.Author), markdownEscaper.Replace(f.Text))
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// outputFormat selects how findings are printed: text, json, csv, sarif, markdown, html, junit, checkstyle,
+	// badge, gh-annotations, template or porcelain
+	outputFormat = "text"
+	// outputPath is the file findings are written to instead of stdout
+	outputPath string
+	// outputTemplate is the text/template executed for each finding with --format template
+	outputTemplate string
+	// porcelain only logs errors, undecorated, and prints stable tab-separated lines
+	porcelain bool
+)
+
+// porcelainFormat is the command annotation naming the --format value used with --porcelain
+const porcelainFormat = "porcelain"
+
+// ScanResult describes the markers found in one repository or directory
+type ScanResult struct {
+	Repo   string `json:"repo"`
+	Branch string `json:"branch,omitempty"`
+	// Note is the note of the registry entry, if any
+	Note string `json:"note,omitempty"`
+	// From and To are the scanned commit range; From is empty when the whole tree at To was scanned
+	From     string    `json:"from,omitempty"`
+	To       string    `json:"to,omitempty"`
+	Findings []Finding `json:"findings"`
+	// Resolved are the findings of the previous sync that disappeared in the commit range
+	Resolved []Finding `json:"resolved,omitempty"`
+	// Removed are the files deleted in the commit range
+	Removed    []string       `json:"removed,omitempty"`
+	Skipped    map[string]int `json:"skipped,omitempty"`
+	DurationMs int64          `json:"duration_ms"`
+}
+
+// finish records the scan duration and skipped files of a result
+func (r *ScanResult) finish(start time.Time) {
+	r.DurationMs = time.Since(start).Milliseconds()
+	if len(skipped) > 0 {
+		r.Skipped = skipped
+	}
+}
+
+// title names the repository and branch of a result
+func (r ScanResult) title() string {
+	if r.Branch != "" {
+		return r.Repo + " (" + r.Branch + ")"
+	}
+	return r.Repo
+}
+
+// RepoFinding is a finding and the repository it was found in
+type RepoFinding struct {
+	Repo   string `json:"repo"`
+	Branch string `json:"branch,omitempty"`
+	// Revision is the scanned commit
+	Revision string `json:"revision,omitempty"`
+	Finding
+}
+
+// Report is the document printed by scan and sync in structured formats
+type Report struct {
+	Started    time.Time    `json:"started"`
+	DurationMs int64        `json:"duration_ms"`
+	Results    []ScanResult `json:"results"`
+}
+
+// reporter prints text findings as each repository is scanned and structured formats once all are done.
+// With an output directory, each repository is reported to its own file as it is scanned.
+type reporter struct {
+	w        io.Writer
+	file     *os.File
+	format   string
+	template *template.Template
+	report   Report
+
+	// dir is the output directory, index lists its report files and used their names
+	dir   string
+	index ReportIndex
+	used  map[string]bool
+
+	// failOn are the --fail-on conditions checked by exitOnFailure
+	failOn []failCondition
+	// markers is the number of markers of the synced registry entries, which count>N checks under sync since its
+	// findings are only the new markers, and -1 to check the findings
+	markers int
+}
+
+// templateFinding is the data of --template: a finding and the repository it was found in
+type templateFinding struct {
+	Finding
+	Repo   string
+	Branch string
+	// Revision is the scanned commit, Commit being the commit that last changed the line with --blame
+	Revision string
+}
+
+// newReporter returns a reporter writing outputFormat to outputPath, a file per repository in outputDir, or stdout
+func newReporter() (*reporter, error) {
+	r, err := configureReporter()
+	if err != nil {
+		return nil, err
+	}
+
+	if outputDir != "" {
+		r.dir = expandHome(outputDir)
+		if err := os.MkdirAll(r.dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create output directory: %w", err)
+		}
+		r.index = ReportIndex{Started: r.report.Started}
+		r.used = map[string]bool{}
+		return r, nil
+	}
+
+	f, err := openOutput()
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		r.w, r.file = f, f
+	}
+
+	return r, nil
+}
+
+// configureReporter checks the output options and returns a reporter of them writing to stdout, without creating
+// the output. The daemon and tr4ck serve check the options with it on startup.
+func configureReporter() (*reporter, error) {
+	switch outputFormat {
+	case "text":
+		if err := validateTable(); err != nil {
+			return nil, err
+		}
+	case "json", "csv", "sarif", "markdown", "html", "template", "porcelain", "gh-annotations", "checkstyle", "badge":
+	case "junit":
+		if junitCases != "marker" && junitCases != "file" {
+			return nil, fmt.Errorf("unsupported junit cases %s", junitCases)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format %s", outputFormat)
+	}
+
+	conditions, err := parseFailOn(failOn)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &reporter{
+		w:       os.Stdout,
+		format:  outputFormat,
+		report:  Report{Started: time.Now(), Results: []ScanResult{}},
+		failOn:  conditions,
+		markers: -1,
+	}
+
+	if outputFormat == "template" {
+		if outputTemplate == "" {
+			return nil, fmt.Errorf("--format template requires --template")
+		}
+		// one finding per line
+		text := outputTemplate
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		tmpl, err := template.New("finding").Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template: %w", err)
+		}
+		r.template = tmpl
+	}
+
+	if outputDir != "" && outputPath != "" {
+		return nil, fmt.Errorf("--output and --output-dir are mutually exclusive")
+	}
+
+	return r, nil
+}
+
+// openOutput creates the --output file, or returns nil to write to stdout
+func openOutput() (*os.File, error) {
+	if outputDir != "" {
+		return nil, fmt.Errorf("--output-dir is only supported by reports with a result per repository")
+	}
+	if outputPath == "" {
+		return nil, nil
+	}
+
+	f, err := os.Create(expandHome(outputPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	return f, nil
+}
+
+// add records the result of one repository
+func (r *reporter) add(result ScanResult) {
+	if result.Findings == nil {
+		result.Findings = []Finding{}
+	}
+	r.report.Results = append(r.report.Results, result)
+	if r.dir != "" {
+		r.addFile(result)
+		return
+	}
+
+	switch r.format {
+	case "text":
+		if tableSort != "" {
+			sortFindings(result.Findings, tableSort)
+		}
+		if len(tableColumns) > 0 {
+			printTable(r.w, result)
+		} else {
+			printFindings(r.w, result.Findings)
+		}
+		printResolved(r.w, result.Resolved)
+	case "porcelain":
+		printPorcelain(r.w, result)
+	case "gh-annotations":
+		printAnnotations(r.w, result.Findings)
+	case "template":
+		for _, f := range result.Findings {
+			data := templateFinding{Finding: f, Repo: result.Repo, Branch: result.Branch, Revision: result.To}
+			if err := r.template.Execute(r.w, data); err != nil {
+				log.Err(err).Str("file", f.File).Int("line", f.Line).Msg("Failed to execute template")
+			}
+		}
+	}
+}
+
+// close writes the report in structured formats and closes the output file, or writes the index of the output directory
+func (r *reporter) close() error {
+	if r.dir != "" {
+		return r.writeIndex()
+	}
+	r.report.DurationMs = time.Since(r.report.Started).Milliseconds()
+
+	var err error
+	switch r.format {
+	case "json":
+		PrintStruct(r.w, r.report)
+	case "csv":
+		err = writeCSV(r.w, r.report)
+	case "sarif":
+		writeSARIF(r.w, r.report)
+	case "markdown":
+		writeMarkdown(r.w, r.report)
+	case "html":
+		err = writeHTML(r.w, r.report)
+	case "junit":
+		err = writeJUnit(r.w, r.report)
+	case "checkstyle":
+		err = writeCheckstyle(r.w, r.report)
+	case "badge":
+		writeBadge(r.w, r.report)
+	}
+
+	if r.file != nil {
+		if cerr := r.file.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("failed to close output file: %w", cerr)
+		}
+	}
+
+	return err
+}
+
+// writeCSV writes one row per finding, e.g. for spreadsheets
+func writeCSV(w io.Writer, report Report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"repo", "file", "line", "marker", "author", "age", "text", "id"})
+
+	for _, result := range report.Results {
+		for _, f := range result.Findings {
+			cw.Write([]string{result.Repo, f.File, strconv.Itoa(f.Line), f.Marker, f.Author, f.Age, f.Text, f.ID})
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	return nil
+}
+
+// groupByFile returns the sorted files of findings and their findings by line
+func groupByFile(findings []Finding) ([]string, map[string][]Finding) {
+	byFile := map[string][]Finding{}
+	var files []string
+	for _, f := range findings {
+		if _, ok := byFile[f.File]; !ok {
+			files = append(files, f.File)
+		}
+		byFile[f.File] = append(byFile[f.File], f)
+	}
+
+	sort.Strings(files)
+	for _, file := range files {
+		sort.SliceStable(byFile[file], func(i, j int) bool { return byFile[file][i].Line < byFile[file][j].Line })
+	}
+
+	return files, byFile
+}
+
+// printPorcelain writes a tab-separated line per finding and resolved finding:
+// finding|resolved, repo, file, line, column, marker, text and ID, empty when unknown
+func printPorcelain(w io.Writer, result ScanResult) {
+	for _, f := range result.Findings {
+		fmt.Fprintf(w, "finding\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n", result.Repo, f.File, f.Line, f.Column, f.Marker, porcelainField(f.Text), f.ID)
+	}
+	for _, f := range result.Resolved {
+		fmt.Fprintf(w, "resolved\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n", result.Repo, f.File, f.Line, f.Column, f.Marker, porcelainField(f.Text), f.ID)
+	}
+}
+
+// annotationData escapes the message of a GitHub Actions workflow command
+var annotationData = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+// annotationProperty escapes a property value of a GitHub Actions workflow command
+var annotationProperty = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+
+// printAnnotations writes a GitHub Actions warning per finding, so markers show up inline on pull request diffs.
+// File paths are relative to the scanned directory, which should be the root of the workspace.
+func printAnnotations(w io.Writer, findings []Finding) {
+	for _, f := range findings {
+		message := f.Marker + " found"
+		if text := f.Description; text != "" {
+			message += ": " + text
+		} else if f.Text != "" {
+			message += ": " + f.Text
+		}
+
+		title := f.Marker
+		if f.ID != "" {
+			title += " " + f.ID
+		}
+		fmt.Fprintf(w, "::warning file=%s,line=%d,col=%d,title=%s::%s\n",
+			annotationProperty.Replace(f.File), f.Line, f.Column, annotationProperty.Replace(title), annotationData.Replace(message))
+	}
+}
+
+// porcelainField replaces the tabs of a field, which separate porcelain fields
+func porcelainField(s string) string {
+	return strings.ReplaceAll(s, "\t", " ")
+}
+
+// applyFormatDefault sets --format to the default of cmd unless given. The commands printing findings share
+// outputFormat, which holds the default of the last command registered until then.
+func applyFormatDefault(cmd *cobra.Command) {
+	if flag := cmd.Flags().Lookup("format"); flag != nil && !flag.Changed {
+		flag.Value.Set(flag.DefValue)
+	}
+}
+
+// applyPorcelain only logs errors, without colors or timestamps, and switches cmd to the format of its
+// porcelain annotation unless --format was given
+func applyPorcelain(cmd *cobra.Command) {
+	if !porcelain {
+		return
+	}
+
+	zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+	log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, NoColor: true, PartsExclude: []string{zerolog.TimestampFieldName}})
+
+	if format := cmd.Annotations[porcelainFormat]; format != "" && !cmd.Flags().Changed("format") {
+		cmd.Flags().Set("format", format)
+	}
+}
+
+// addOutputFlags registers the options of commands printing findings, in format by default
+func addOutputFlags(cmd *cobra.Command, format string) {
+	cmd.Flags().StringVar(&outputFormat, "format", format, "output format: text, json, csv, sarif, markdown, html, junit, checkstyle, badge, gh-annotations, template or porcelain")
+	cmd.Flags().StringVar(&junitCases, "junit-cases", "marker", "report each marker or each file as a failed test case with --format junit: marker or file")
+	cmd.Flags().StringSliceVar(&tableColumns, "columns", nil, "print text findings as a table of these columns, e.g. file,line,marker,age,author")
+	cmd.Flags().StringVar(&tableSort, "sort", "", "order text findings by file, marker, age, author, priority or due")
+	cmd.Flags().StringVar(&badgeLabel, "badge-label", "TODOs", "label of the badge written with --format badge")
+	cmd.Flags().StringVar(&outputTemplate, "template", "", "go text/template printed for each finding with --format template, e.g. '{{.Repo}} {{.File}}:{{.Line}} {{.Marker}}'")
+	cmd.Flags().StringVarP(&outputPath, "output", "o", "", "write findings to this file instead of stdout")
+	cmd.Flags().StringVar(&outputDir, "output-dir", "", "write a report file per repository to this directory, along with an index")
+	cmd.Flags().StringArrayVar(&failOn, "fail-on", nil, "exit with status 3 when a condition is met: new-markers, count>N or marker=NAME (repeatable)")
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// outputDir is the directory a report file per repository is written to, along with an index
+var outputDir string
+
+// formatExtensions are the file extensions of the reports written to --output-dir, by format
+var formatExtensions = map[string]string{
+	"text":           "txt",
+	"json":           "json",
+	"csv":            "csv",
+	"sarif":          "sarif",
+	"markdown":       "md",
+	"html":           "html",
+	"template":       "txt",
+	"porcelain":      "tsv",
+	"gh-annotations": "txt",
+	"junit":          "xml",
+	"checkstyle":     "xml",
+	"badge":          "json",
+}
+
+// unsafeFileChars are the characters replaced in report file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ReportIndex lists the report files written to --output-dir
+type ReportIndex struct {
+	Started    time.Time    `json:"started"`
+	DurationMs int64        `json:"duration_ms"`
+	Reports    []IndexEntry `json:"reports"`
+}
+
+// IndexEntry is the report file of one repository
+type IndexEntry struct {
+	Repo     string `json:"repo"`
+	Branch   string `json:"branch,omitempty"`
+	File     string `json:"file"`
+	Findings int    `json:"findings"`
+	Resolved int    `json:"resolved,omitempty"`
+}
+
+// reportFileName returns a file name for the report of result, unique among the names already used
+func reportFileName(result ScanResult, format string, used map[string]bool) string {
+	base := canonicalURI(result.Repo)
+	if result.Branch != "" {
+		base += "-" + result.Branch
+	}
+	base = strings.Trim(unsafeFileChars.ReplaceAllString(base, "-"), "-.")
+	if base == "" {
+		base = "repo"
+	}
+
+	name := base + "." + formatExtensions[format]
+	for n := 2; used[name] || name == indexFileName(format); n++ {
+		name = fmt.Sprintf("%s-%d.%s", base, n, formatExtensions[format])
+	}
+	used[name] = true
+	return name
+}
+
+// indexFileName returns the name of the index: markdown and html reports get an index in their format, others json
+func indexFileName(format string) string {
+	switch format {
+	case "markdown":
+		return "index.md"
+	case "html":
+		return "index.html"
+	default:
+		return "index.json"
+	}
+}
+
+// addFile writes the report of one repository to its own file in the output directory
+func (r *reporter) addFile(result ScanResult) {
+	name := reportFileName(result, r.format, r.used)
+	r.index.Reports = append(r.index.Reports, IndexEntry{
+		Repo:     result.Repo,
+		Branch:   result.Branch,
+		File:     name,
+		Findings: len(result.Findings),
+		Resolved: len(result.Resolved),
+	})
+
+	f, err := os.Create(filepath.Join(r.dir, name))
+	if err != nil {
+		log.Err(err).Str("repo", result.Repo).Msg("Failed to create report file")
+		return
+	}
+
+	repo := &reporter{
+		w:        f,
+		file:     f,
+		format:   r.format,
+		template: r.template,
+		report:   Report{Started: r.report.Started, Results: []ScanResult{}},
+	}
+	repo.add(result)
+	if err := repo.close(); err != nil {
+		log.Err(err).Str("repo", result.Repo).Msg("Failed to write report file")
+	}
+}
+
+// writeIndex writes the index of the report files to the output directory
+func (r *reporter) writeIndex() error {
+	r.index.DurationMs = time.Since(r.index.Started).Milliseconds()
+	if r.index.Reports == nil {
+		r.index.Reports = []IndexEntry{}
+	}
+
+	f, err := os.Create(filepath.Join(r.dir, indexFileName(r.format)))
+	if err != nil {
+		return fmt.Errorf("failed to create index file: %w", err)
+	}
+	defer f.Close()
+
+	switch r.format {
+	case "markdown":
+		writeMarkdownIndex(f, r.index)
+	case "html":
+		if err := htmlIndexTemplate.Execute(f, r.index); err != nil {
+			return fmt.Errorf("failed to render index: %w", err)
+		}
+	default:
+		PrintStruct(f, r.index)
+	}
+
+	return nil
+}
+
+// writeMarkdownIndex writes a table linking to the report of each repository
+func writeMarkdownIndex(w io.Writer, index ReportIndex) {
+	fmt.Fprintf(w, "# tr4ck reports\n\n")
+	fmt.Fprintf(w, "Generated %s, %d repositories.\n\n", index.Started.UTC().Format("2006-01-02 15:04 MST"), len(index.Reports))
+	fmt.Fprintln(w, "| Repository | Findings | Resolved |")
+	fmt.Fprintln(w, "|---|---:|---:|")
+	for _, entry := range index.Reports {
+		title := ScanResult{Repo: entry.Repo, Branch: entry.Branch}.title()
+		link := (&url.URL{Path: entry.File}).EscapedPath()
+		fmt.Fprintf(w, "| [%s](%s) | %d | %d |\n", markdownEscaper.Replace(title), link, entry.Findings, entry.Resolved)
+	}
+}
+
+// htmlIndexTemplate renders a page linking to the report of each repository
+var htmlIndexTemplate = htmltemplate.Must(htmltemplate.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>tr4ck reports</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+th, td { padding: .3em .8em; border-bottom: 1px solid #ddd; text-align: left; }
+td.n { text-align: right; }
+</style>
+</head>
+<body>
+<h1>tr4ck reports</h1>
+<p>Generated {{.Started.UTC.Format "2006-01-02 15:04 MST"}}, {{len .Reports}} repositories.</p>
+<table>
+<tr><th>Repository</th><th>Findings</th><th>Resolved</th></tr>
+{{range .Reports}}<tr><td><a href="{{.File}}">{{.Repo}}{{if .Branch}} ({{.Branch}}){{end}}</a></td><td class="n">{{.Findings}}</td><td class="n">{{.Resolved}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
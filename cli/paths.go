@@ -0,0 +1,116 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	// includePaths and excludePaths are glob patterns restricting the scanned files of every repository
+	includePaths []string
+	excludePaths []string
+)
+
+// pathFilter restricts the scanned files with include and exclude glob patterns. Patterns without a slash
+// match a name at any depth (*.min.js), ** matches any number of directories (src/**/generated/*) and a
+// pattern matching a directory matches every file below it.
+type pathFilter struct {
+	include []string
+	exclude []string
+}
+
+// globalPathFilter returns the filter from the config and command line flags
+func globalPathFilter() pathFilter {
+	return pathFilter{include: includePaths, exclude: excludePaths}
+}
+
+// effectivePaths returns the global filter extended with the record's own patterns
+func (r RegistryRecord) effectivePaths() pathFilter {
+	return pathFilter{
+		include: append(slices.Clone(includePaths), r.Include...),
+		exclude: append(slices.Clone(excludePaths), r.Exclude...),
+	}
+}
+
+// match reports whether file, relative to the repository root, should be scanned. Excludes win over includes.
+func (p pathFilter) match(file string) bool {
+	file = filepath.ToSlash(file)
+
+	for _, pattern := range p.exclude {
+		if pathMatch(pattern, file) {
+			return false
+		}
+	}
+
+	if len(p.include) == 0 {
+		return true
+	}
+	for _, pattern := range p.include {
+		if pathMatch(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipDir reports whether the directory is excluded as a whole. Includes only apply to files.
+func (p pathFilter) skipDir(dir string) bool {
+	dir = filepath.ToSlash(dir)
+	for _, pattern := range p.exclude {
+		if pathMatch(pattern, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// compiled path patterns
+var pathPatterns = map[string]*regexp.Regexp{}
+
+// pathMatch reports whether the slash separated file, or one of its parent directories, matches the glob pattern
+func pathMatch(pattern, file string) bool {
+	re, ok := pathPatterns[pattern]
+	if !ok {
+		re = pathPatternRegexp(pattern)
+		pathPatterns[pattern] = re
+	}
+	return re.MatchString(file)
+}
+
+// pathPatternRegexp translates a path glob to an anchored regular expression
+func pathPatternRegexp(pattern string) *regexp.Regexp {
+	pattern = strings.TrimRight(filepath.ToSlash(pattern), "/")
+
+	var expr strings.Builder
+	expr.WriteString("^")
+
+	// like .gitignore, a pattern without a slash (other than a trailing one) matches at any depth
+	if !strings.Contains(pattern, "/") {
+		expr.WriteString("(.*/)?")
+	}
+	pattern = strings.TrimLeft(pattern, "/")
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			expr.WriteString("[^/]*")
+		case pattern[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	// a matching directory matches everything below it
+	expr.WriteString("(/.*)?$")
+
+	return regexp.MustCompile(expr.String())
+}
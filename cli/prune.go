@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// PruneOptions selects what db prune removes from the marker store
+type PruneOptions struct {
+	// ResolvedOlderThan removes the markers resolved longer ago, e.g. 1y
+	ResolvedOlderThan string
+	// SnapshotsOlderThan removes the snapshots of commits synced longer ago
+	SnapshotsOlderThan string
+	// Archive is a database the removed markers and snapshots are added to
+	Archive string
+	DryRun  bool
+	// Yes skips the confirmation prompt
+	Yes bool
+}
+
+// prune removes the resolved markers older than resolvedBefore from the store, and returns them with the
+// snapshots older than snapshotsBefore, a zero time keeping them all. Markers are removed by save, snapshots by
+// deleteSnapshots.
+func (s *Store) prune(resolvedBefore, snapshotsBefore time.Time) ([]*StoredMarker, []*MarkerSnapshot, error) {
+	var kept, pruned []*StoredMarker
+	for _, m := range s.Markers {
+		if m.State == markerResolved && m.ResolvedAt != nil && m.ResolvedAt.Before(resolvedBefore) {
+			pruned = append(pruned, m)
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	s.Markers = kept
+
+	if snapshotsBefore.IsZero() {
+		return pruned, nil, nil
+	}
+	snapshots, err := s.loadSnapshots("time < ?", snapshotsBefore.UnixNano())
+	return pruned, snapshots, err
+}
+
+// deleteSnapshots removes the snapshots older than before from the database
+func (s *Store) deleteSnapshots(before time.Time) error {
+	if before.IsZero() {
+		return nil
+	}
+	if _, err := s.db.Exec("DELETE FROM snapshots WHERE time < ?", before.UnixNano()); err != nil {
+		return fmt.Errorf("failed to remove snapshots: %w", err)
+	}
+	return nil
+}
+
+// confirm asks a yes/no question on stdin, no by default
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// runPrune removes old resolved markers and snapshots from the marker store, after adding them to the archive
+func runPrune(opts PruneOptions) {
+	if opts.ResolvedOlderThan == "" && opts.SnapshotsOlderThan == "" {
+		log.Fatal().Msg("Nothing to prune, set --resolved-older-than or --snapshots-older-than")
+	}
+
+	now := time.Now()
+	cutoff := func(age string) time.Time {
+		if age == "" {
+			return time.Time{}
+		}
+		d, err := parseAge(age)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid age")
+		}
+		return now.Add(-d)
+	}
+	resolvedBefore, snapshotsBefore := cutoff(opts.ResolvedOlderThan), cutoff(opts.SnapshotsOlderThan)
+
+	path := storeFilePath()
+	store, err := loadStore(path)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load marker store")
+	}
+
+	markers, snapshots, err := store.prune(resolvedBefore, snapshotsBefore)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load snapshots")
+	}
+	summary := fmt.Sprintf("%d resolved markers and %d snapshots of %s", len(markers), len(snapshots), path)
+	if len(markers) == 0 && len(snapshots) == 0 {
+		fmt.Println("Nothing to prune")
+		return
+	}
+	if opts.DryRun {
+		for _, m := range markers {
+			fmt.Printf("%s %s %s:%d resolved %s\t%s\n", m.ID, ScanResult{Repo: m.Repo, Branch: m.Branch}.title(), m.File, m.Line, m.ResolvedAt.Format("2006-01-02"), m.Text)
+		}
+		fmt.Printf("Would prune %s\n", summary)
+		return
+	}
+	if !opts.Yes && !confirm("Prune "+summary+"?") {
+		fmt.Println("Aborted")
+		return
+	}
+
+	// archive first, so that nothing is lost if saving the store fails
+	if opts.Archive != "" {
+		archivePath := expandHome(opts.Archive)
+		archive, err := loadStore(archivePath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load archive")
+		}
+		archive.Markers = append(archive.Markers, markers...)
+		archive.snapshots = append(archive.snapshots, snapshots...)
+		if err := archive.save(); err != nil {
+			log.Fatal().Err(err).Msg("Failed to save archive")
+		}
+	}
+
+	if err := store.save(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to save marker store")
+	}
+	if err := store.deleteSnapshots(snapshotsBefore); err != nil {
+		log.Fatal().Err(err).Msg("Failed to save marker store")
+	}
+	fmt.Printf("Pruned %s\n", summary)
+}
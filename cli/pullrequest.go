@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/rs/zerolog/log"
+)
+
+// pullRequestSignature marks the comment of tr4ck on a pull request, which is updated instead of posted again
+const pullRequestSignature = "<!-- tr4ck:pull-request -->"
+
+// PullRequestConfig comments on the pull requests of GitHub and merge requests of GitLab with the markers they add
+type PullRequestConfig struct {
+	GitHub PullRequestAPI `yaml:"github"`
+	GitLab PullRequestAPI `yaml:"gitlab"`
+	// Limit caps the markers listed in a comment, 50 by default
+	Limit int `yaml:"limit"`
+}
+
+// PullRequestAPI is the API comments are posted with
+type PullRequestAPI struct {
+	// Token may comment on pull requests, GITHUB_TOKEN or GITLAB_TOKEN when empty
+	Token string `yaml:"token"`
+	// APIURL is the REST API of GitHub Enterprise Server or a GitLab instance
+	APIURL string `yaml:"api_url"`
+}
+
+// pullRequest is a pull request of GitHub, or a merge request of GitLab, to review
+type pullRequest struct {
+	forge string
+	// project is owner/name on GitHub and the project ID on GitLab
+	project string
+	number  int
+	// cloneURL is the repository the pull request targets, baseRef the branch it targets and headRef the ref of
+	// its head commit in that repository
+	cloneURL string
+	baseRef  string
+	headRef  string
+	head     string
+}
+
+// githubPullRequest reads the pull request of a pull_request event, if it got new commits
+func githubPullRequest(body []byte) (pullRequest, bool, error) {
+	var event struct {
+		Action      string `json:"action"`
+		PullRequest struct {
+			Number int `json:"number"`
+			Head   struct {
+				SHA string `json:"sha"`
+			} `json:"head"`
+			Base struct {
+				Ref  string `json:"ref"`
+				Repo struct {
+					FullName string `json:"full_name"`
+					CloneURL string `json:"clone_url"`
+				} `json:"repo"`
+			} `json:"base"`
+		} `json:"pull_request"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return pullRequest{}, false, fmt.Errorf("invalid pull_request event: %w", err)
+	}
+	if !slices.Contains([]string{"opened", "reopened", "synchronize", "ready_for_review"}, event.Action) {
+		return pullRequest{}, false, nil
+	}
+
+	pr := event.PullRequest
+	return pullRequest{
+		forge:    "github",
+		project:  pr.Base.Repo.FullName,
+		number:   pr.Number,
+		cloneURL: pr.Base.Repo.CloneURL,
+		baseRef:  "refs/heads/" + pr.Base.Ref,
+		headRef:  fmt.Sprintf("refs/pull/%d/head", pr.Number),
+		head:     pr.Head.SHA,
+	}, true, nil
+}
+
+// gitlabMergeRequest reads the merge request of a merge request event, if it got new commits
+func gitlabMergeRequest(body []byte) (pullRequest, bool, error) {
+	var event struct {
+		Project struct {
+			ID         int    `json:"id"`
+			GitHTTPURL string `json:"git_http_url"`
+		} `json:"project"`
+		ObjectAttributes struct {
+			IID          int    `json:"iid"`
+			Action       string `json:"action"`
+			TargetBranch string `json:"target_branch"`
+			// OldRev is set on updates pushing commits
+			OldRev     string `json:"oldrev"`
+			LastCommit struct {
+				ID string `json:"id"`
+			} `json:"last_commit"`
+		} `json:"object_attributes"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return pullRequest{}, false, fmt.Errorf("invalid merge request event: %w", err)
+	}
+	mr := event.ObjectAttributes
+	if mr.Action != "open" && mr.Action != "reopen" && (mr.Action != "update" || mr.OldRev == "") {
+		return pullRequest{}, false, nil
+	}
+
+	return pullRequest{
+		forge:    "gitlab",
+		project:  strconv.Itoa(event.Project.ID),
+		number:   mr.IID,
+		cloneURL: event.Project.GitHTTPURL,
+		baseRef:  "refs/heads/" + mr.TargetBranch,
+		headRef:  fmt.Sprintf("refs/merge-requests/%d/head", mr.IID),
+		head:     mr.LastCommit.ID,
+	}, true, nil
+}
+
+// scanPullRequest scans the markers a pull request adds, from the merge base of its head and target branch
+func scanPullRequest(pr pullRequest) (ScanResult, error) {
+	scanMu.Lock()
+	defer scanMu.Unlock()
+	resetSkipped()
+
+	// registered repositories share their clone and settings
+	record, _ := findRecord(pr.cloneURL)
+	clone := record
+	if clone == nil {
+		rootHash, err := getRootHashFromFirstCommit(pr.cloneURL)
+		if err != nil {
+			return ScanResult{}, fmt.Errorf("failed to get root commit hash: %w", err)
+		}
+		clone = &RegistryRecord{URI: pr.cloneURL, RootHash: rootHash}
+	}
+	repo, err := cloneRepo(clone)
+	if err != nil {
+		return ScanResult{}, err
+	}
+
+	prefix := fmt.Sprintf("refs/tr4ck/%s/%d/", pr.forge, pr.number)
+	err = repo.Fetch(&git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{config.RefSpec("+" + pr.baseRef + ":" + prefix + "base"), config.RefSpec("+" + pr.headRef + ":" + prefix + "head")},
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return ScanResult{}, fmt.Errorf("failed to fetch pull request: %w", err)
+	}
+
+	defer applyRepoConfig(readRepoConfig(repo, pr.head))()
+	scanMarkers, scanPaths := scanSettings(record)
+
+	scanDiff = prefix + "base..." + pr.head
+	defer func() { scanDiff = "" }()
+	result := ScanResult{Repo: pr.cloneURL}
+	diffFindings(repo, &result, scanMarkers, scanPaths)
+	if result.To == "" {
+		return result, fmt.Errorf("failed to scan %s", scanDiff)
+	}
+
+	branch := ""
+	if record != nil {
+		branch = record.Branch
+	}
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		log.Err(err).Msg("Failed to load marker store")
+		store = &Store{}
+	}
+	result.Findings = store.dropIgnored(result.Repo, branch, result.Findings)
+	store.identify(result.Repo, branch, result.Findings)
+	return result, nil
+}
+
+// pullRequestComment lists the markers added by a pull request, at most limit, linked to their lines
+func pullRequestComment(result ScanResult, limit int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n## tr4ck\n\n", pullRequestSignature)
+	if len(result.Findings) == 0 {
+		fmt.Fprintf(&b, "No new markers as of `%.7s`.\n", result.To)
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "**%d** new markers as of `%.7s`:\n\n", len(result.Findings), result.To)
+	for _, f := range result.Findings[:min(limit, len(result.Findings))] {
+		location := fmt.Sprintf("`%s:%d`", f.File, f.Line)
+		if url := blobURL(result.Repo, result.To, f.File, f.Line); url != "" {
+			location = fmt.Sprintf("[%s:%d](%s)", markdownEscaper.Replace(f.File), f.Line, url)
+		}
+		fmt.Fprintf(&b, "- %s **%s** %s", location, f.Marker, markdownEscaper.Replace(f.Text))
+		if f.ID != "" {
+			fmt.Fprintf(&b, " `%s`", f.ID)
+		}
+		b.WriteString("\n")
+	}
+	if len(result.Findings) > limit {
+		fmt.Fprintf(&b, "- … and %d more\n", len(result.Findings)-limit)
+	}
+	return b.String()
+}
+
+// pullRequestBot comments on pull requests with the markers they add
+type pullRequestBot struct {
+	githubAPI   string
+	githubToken string
+	gitlabAPI   string
+	gitlabToken string
+	limit       int
+}
+
+func newPullRequestBot(c PullRequestConfig) *pullRequestBot {
+	b := &pullRequestBot{
+		githubAPI:   strings.TrimRight(c.GitHub.APIURL, "/"),
+		githubToken: c.GitHub.Token,
+		gitlabAPI:   strings.TrimRight(c.GitLab.APIURL, "/"),
+		gitlabToken: c.GitLab.Token,
+		limit:       c.Limit,
+	}
+	if b.githubAPI == "" {
+		b.githubAPI = "https://api.github.com"
+	}
+	if b.githubToken == "" {
+		b.githubToken = os.Getenv("GITHUB_TOKEN")
+	}
+	if b.gitlabAPI == "" {
+		b.gitlabAPI = "https://gitlab.com/api/v4"
+	}
+	if b.gitlabToken == "" {
+		b.gitlabToken = os.Getenv("GITLAB_TOKEN")
+	}
+	if b.limit <= 0 {
+		b.limit = 50
+	}
+	return b
+}
+
+// review scans a pull request and comments on it, updating its previous comment. Pull requests adding no markers
+// are only commented on to update a previous comment. Failures are logged.
+func (b *pullRequestBot) review(pr pullRequest) {
+	logger := log.With().Str("forge", pr.forge).Str("project", pr.project).Int("number", pr.number).Str("head", pr.head).Logger()
+
+	result, err := scanPullRequest(pr)
+	if err != nil {
+		logger.Err(err).Msg("Failed to scan pull request")
+		return
+	}
+	body := pullRequestComment(result, b.limit)
+
+	if pr.forge == "gitlab" {
+		err = b.commentGitLab(pr, body, len(result.Findings) > 0)
+	} else {
+		err = b.commentGitHub(pr, body, len(result.Findings) > 0)
+	}
+	if err != nil {
+		logger.Err(err).Msg("Failed to comment on pull request")
+		return
+	}
+	logger.Info().Int("markers", len(result.Findings)).Msg("Reviewed pull request")
+}
+
+// commentGitHub updates the comment of tr4ck on a pull request, or posts it when create is set
+func (b *pullRequestBot) commentGitHub(pr pullRequest, body string, create bool) error {
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github+json")
+	header.Set("X-GitHub-Api-Version", "2022-11-28")
+	header.Set("Authorization", "Bearer "+b.githubToken)
+
+	issue := fmt.Sprintf("%s/repos/%s/issues/%d", b.githubAPI, pr.project, pr.number)
+	for page := 1; ; page++ {
+		var comments []struct {
+			ID   int64  `json:"id"`
+			Body string `json:"body"`
+		}
+		if err := callJSON("github", http.MethodGet, fmt.Sprintf("%s/comments?per_page=100&page=%d", issue, page), header, nil, &comments); err != nil {
+			return err
+		}
+		for _, c := range comments {
+			if strings.Contains(c.Body, pullRequestSignature) {
+				path := fmt.Sprintf("%s/repos/%s/issues/comments/%d", b.githubAPI, pr.project, c.ID)
+				return callJSON("github", http.MethodPatch, path, header, map[string]string{"body": body}, nil)
+			}
+		}
+		if len(comments) < 100 {
+			break
+		}
+	}
+
+	if !create {
+		return nil
+	}
+	return callJSON("github", http.MethodPost, issue+"/comments", header, map[string]string{"body": body}, nil)
+}
+
+// commentGitLab updates the note of tr4ck on a merge request, or adds it when create is set
+func (b *pullRequestBot) commentGitLab(pr pullRequest, body string, create bool) error {
+	header := http.Header{}
+	header.Set("PRIVATE-TOKEN", b.gitlabToken)
+
+	notes := fmt.Sprintf("%s/projects/%s/merge_requests/%d/notes", b.gitlabAPI, url.PathEscape(pr.project), pr.number)
+	for page := 1; ; page++ {
+		var existing []struct {
+			ID   int64  `json:"id"`
+			Body string `json:"body"`
+		}
+		if err := callJSON("gitlab", http.MethodGet, fmt.Sprintf("%s?per_page=100&page=%d", notes, page), header, nil, &existing); err != nil {
+			return err
+		}
+		for _, note := range existing {
+			if strings.Contains(note.Body, pullRequestSignature) {
+				return callJSON("gitlab", http.MethodPut, fmt.Sprintf("%s/%d", notes, note.ID), header, map[string]string{"body": body}, nil)
+			}
+		}
+		if len(existing) < 100 {
+			break
+		}
+	}
+
+	if !create {
+		return nil
+	}
+	return callJSON("gitlab", http.MethodPost, notes, header, map[string]string{"body": body}, nil)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// MarkerQuery filters stored markers; empty fields match every marker
+type MarkerQuery struct {
+	// Repo is a canonical URI or a glob matched against it
+	Repo    string
+	Markers []string
+	// Author is matched case-insensitively within the author name or email
+	Author string
+	// State is open, resolved, ignored or all
+	State string
+	// OlderThan only keeps markers whose line, or else first sighting, is older, e.g. 30d
+	OlderThan string
+	// Paths are globs matched against the file
+	Paths []string
+	// At looks at the markers as they were at a synced commit or a date instead of now, see snapshotsAt
+	At string
+	// Overdue only keeps markers whose due date has passed, most overdue first
+	Overdue bool
+	// Zombie only keeps markers referencing an issue that was closed as of the last check
+	Zombie bool
+}
+
+// query returns the stored markers matching q, by repository, branch, file and line
+func (s *Store) query(q MarkerQuery, now time.Time) ([]*StoredMarker, error) {
+	var minAge time.Duration
+	if q.OlderThan != "" {
+		var err error
+		if minAge, err = parseAge(q.OlderThan); err != nil {
+			return nil, err
+		}
+	}
+	if q.State != "" && q.State != "all" && q.State != markerOpen && q.State != markerResolved && q.State != markerIgnored {
+		return nil, fmt.Errorf("unsupported state %s, expected open, resolved, ignored or all", q.State)
+	}
+
+	markers := s.Markers
+	if q.At != "" {
+		snapshots, err := s.snapshotsAt(q.At)
+		if err != nil {
+			return nil, err
+		}
+		markers = s.markersAt(snapshots)
+	}
+
+	var found []*StoredMarker
+	for _, m := range markers {
+		if q.State != "" && q.State != "all" && m.State != q.State {
+			continue
+		}
+		if q.Repo != "" && m.Repo != canonicalURI(q.Repo) && !globMatch(q.Repo, m.Repo) {
+			continue
+		}
+		if len(q.Markers) > 0 && !containsFold(q.Markers, m.Marker) {
+			continue
+		}
+		if q.Author != "" && !strings.Contains(strings.ToLower(m.Author+" "+m.Email), strings.ToLower(q.Author)) {
+			continue
+		}
+		if q.OlderThan != "" && m.since(now) < minAge {
+			continue
+		}
+		if len(q.Paths) > 0 && !matchAny(q.Paths, m.File) {
+			continue
+		}
+		if _, overdue := m.overdue(now); q.Overdue && !overdue {
+			continue
+		}
+		if q.Zombie && len(m.closedReferences()) == 0 {
+			continue
+		}
+		found = append(found, m)
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		if a.Branch != b.Branch {
+			return a.Branch < b.Branch
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	if q.Overdue {
+		sort.SliceStable(found, func(i, j int) bool { return found[i].Due < found[j].Due })
+	}
+
+	return found, nil
+}
+
+// overdue returns how long ago the due date of the marker passed, at the end of the due day
+func (m *StoredMarker) overdue(now time.Time) (time.Duration, bool) {
+	due, ok := m.dueDate()
+	if !ok {
+		return 0, false
+	}
+	late := now.Sub(due.AddDate(0, 0, 1))
+	return late, late > 0
+}
+
+// since returns how long the marker has existed: since the blame date of its line, or else its first sighting
+func (m *StoredMarker) since(now time.Time) time.Duration {
+	if m.Date != nil {
+		return now.Sub(*m.Date)
+	}
+	return now.Sub(m.FirstSeen)
+}
+
+// containsFold reports whether s is in list, regardless of case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether s matches any of the glob patterns
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if globMatch(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// runQuery prints the stored markers matching q in the given format: table, json or porcelain
+func runQuery(q MarkerQuery, format string) {
+	if format != "table" && format != "json" && format != "porcelain" {
+		log.Fatal().Str("format", format).Msg("Invalid --format, expected table, json or porcelain")
+	}
+
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load marker store")
+	}
+
+	found, err := store.query(q, time.Now())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid query")
+	}
+
+	printStoredMarkers(os.Stdout, found, format)
+}
+
+// printStoredMarkers writes markers in the given format: table (colored, human-readable), json or porcelain
+func printStoredMarkers(w io.Writer, markers []*StoredMarker, format string) {
+	now := time.Now()
+
+	switch format {
+	case "json":
+		if markers == nil {
+			markers = []*StoredMarker{}
+		}
+		PrintStruct(w, markers)
+
+	case "porcelain":
+		// state, repository, branch, file, line, marker, author, age, text, ID and due date
+		for _, m := range markers {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", m.State, m.Repo, m.Branch, m.File, m.Line, m.Marker, m.Author, formatAge(m.since(now)), porcelainField(m.Text), m.ID, m.Due)
+		}
+
+	default:
+		// every cell of a column is colored so that escape codes do not break the alignment
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, m := range markers {
+			repo := ScanResult{Repo: m.Repo, Branch: m.Branch}.title()
+			due := ""
+			if late, overdue := m.overdue(now); overdue {
+				due = fmt.Sprintf("due:%s, %s overdue", m.Due, formatAge(late))
+			} else if m.Due != "" {
+				due = "due:" + m.Due
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				aurora.Gray(12, m.ID), aurora.BrightYellow(m.State), aurora.Gray(12, repo), aurora.Blue(fmt.Sprintf("%s:%d", m.File, m.Line)),
+				aurora.BrightGreen(m.Marker), aurora.Cyan(m.Author), aurora.Yellow(formatAge(m.since(now))), aurora.Red(due), m.Text)
+		}
+		tw.Flush()
+	}
+}
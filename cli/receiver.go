@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// receiverConfig is the receiver section of the config, nil when the daemon does not accept webhooks
+var receiverConfig *ReceiverConfig
+
+const (
+	// maxWebhookBody is the largest webhook payload read, GitHub sends at most 25MB
+	maxWebhookBody = 25 << 20
+	// receiverQueueSize is the number of webhooks waiting for the worker before new ones are refused
+	receiverQueueSize = 100
+)
+
+// ReceiverConfig accepts the webhooks of GitHub and GitLab on the address of the daemon, at /hooks/github and
+// /hooks/gitlab
+type ReceiverConfig struct {
+	// Secret verifies the webhooks, TR4CK_WEBHOOK_SECRET when empty: GitHub signs payloads with it and GitLab sends
+	// it as a token
+	Secret string `yaml:"secret"`
+	// PullRequests comments on pull requests with the markers they add
+	PullRequests *PullRequestConfig `yaml:"pull_requests"`
+	// Push syncs the registered branches pushed to right away instead of at the next scheduled sync
+	Push bool `yaml:"push"`
+}
+
+// receiver handles webhooks, queueing the work they trigger for a single worker since scans share global settings
+type receiver struct {
+	secret       string
+	pullRequests *pullRequestBot
+	push         bool
+	jobs         chan func()
+
+	// queued holds the branches with a sync queued, so that bursts of pushes sync them once
+	mu     sync.Mutex
+	queued map[string]bool
+}
+
+func newReceiver(c ReceiverConfig) (*receiver, error) {
+	r := &receiver{secret: c.Secret, push: c.Push, jobs: make(chan func(), receiverQueueSize), queued: map[string]bool{}}
+	if r.secret == "" {
+		r.secret = os.Getenv("TR4CK_WEBHOOK_SECRET")
+	}
+	if r.secret == "" {
+		return nil, fmt.Errorf("the receiver requires a secret, set it in the config or TR4CK_WEBHOOK_SECRET")
+	}
+	if c.PullRequests != nil {
+		r.pullRequests = newPullRequestBot(*c.PullRequests)
+	}
+	return r, nil
+}
+
+// handle registers the webhook endpoints
+func (rc *receiver) handle(mux *http.ServeMux) {
+	mux.HandleFunc("/hooks/github", rc.serveGitHub)
+	mux.HandleFunc("/hooks/gitlab", rc.serveGitLab)
+}
+
+// run runs the queued jobs until ctx is done
+func (rc *receiver) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-rc.jobs:
+			job()
+		}
+	}
+}
+
+// enqueue queues a job and accepts the webhook, or refuses it when the queue is full
+func (rc *receiver) enqueue(w http.ResponseWriter, job func()) bool {
+	select {
+	case rc.jobs <- job:
+		w.WriteHeader(http.StatusAccepted)
+		return true
+	default:
+		http.Error(w, "too many webhooks queued", http.StatusServiceUnavailable)
+		return false
+	}
+}
+
+// push is a push to a branch of a repository
+type push struct {
+	cloneURL      string
+	branch        string
+	defaultBranch string
+}
+
+// match reports whether a registry record tracks the branch pushed to, records without a branch tracking the
+// default branch
+func (p push) match(record RegistryRecord) bool {
+	if record.Disabled || !sameURI(record.URI, p.cloneURL) {
+		return false
+	}
+	if record.Branch == "" {
+		return p.branch == p.defaultBranch
+	}
+	return record.Branch == p.branch
+}
+
+// githubPush reads the branch of a push event, unless it deleted it or pushed a tag
+func githubPush(body []byte) (push, bool, error) {
+	var event struct {
+		Ref        string `json:"ref"`
+		Deleted    bool   `json:"deleted"`
+		Repository struct {
+			CloneURL      string `json:"clone_url"`
+			DefaultBranch string `json:"default_branch"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return push{}, false, fmt.Errorf("invalid push event: %w", err)
+	}
+	branch, ok := strings.CutPrefix(event.Ref, "refs/heads/")
+	if !ok || event.Deleted {
+		return push{}, false, nil
+	}
+	return push{cloneURL: event.Repository.CloneURL, branch: branch, defaultBranch: event.Repository.DefaultBranch}, true, nil
+}
+
+// gitlabPush reads the branch of a push event, unless it deleted it
+func gitlabPush(body []byte) (push, bool, error) {
+	var event struct {
+		Ref string `json:"ref"`
+		// After is all zeros when the branch is deleted
+		After   string `json:"after"`
+		Project struct {
+			GitHTTPURL    string `json:"git_http_url"`
+			DefaultBranch string `json:"default_branch"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return push{}, false, fmt.Errorf("invalid push event: %w", err)
+	}
+	branch, ok := strings.CutPrefix(event.Ref, "refs/heads/")
+	if !ok || strings.Trim(event.After, "0") == "" {
+		return push{}, false, nil
+	}
+	return push{cloneURL: event.Project.GitHTTPURL, branch: branch, defaultBranch: event.Project.DefaultBranch}, true, nil
+}
+
+// queueSync queues a sync of the registry records tracking the branch pushed to, unless one is already queued.
+// Pushes to other branches and repositories are ignored.
+func (rc *receiver) queueSync(w http.ResponseWriter, p push) {
+	records, err := loadRegistry()
+	if err != nil {
+		log.Err(err).Msg("Failed to load registry")
+		http.Error(w, "failed to load registry", http.StatusInternalServerError)
+		return
+	}
+	if !slices.ContainsFunc(*records, p.match) {
+		log.Debug().Str("uri", p.cloneURL).Str("branch", p.branch).Msg("Ignoring push to an untracked branch")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	key := canonicalURI(p.cloneURL) + "#" + p.branch
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.queued[key] {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	queued := rc.enqueue(w, func() {
+		rc.mu.Lock()
+		delete(rc.queued, key)
+		rc.mu.Unlock()
+
+		log.Info().Str("uri", p.cloneURL).Str("branch", p.branch).Msg("Syncing pushed branch")
+		syncOnce(p.match)
+	})
+	rc.queued[key] = queued
+}
+
+// read reads the payload of a webhook, replying with an error unless it is a POST
+func (rc *receiver) read(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "failed to read payload", http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// validGitHubSignature checks the X-Hub-Signature-256 header, the hex HMAC-SHA256 of the payload
+func validGitHubSignature(secret string, body []byte, header string) bool {
+	signature, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func (rc *receiver) serveGitHub(w http.ResponseWriter, r *http.Request) {
+	body, ok := rc.read(w, r)
+	if !ok {
+		return
+	}
+	if !validGitHubSignature(rc.secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	log.Debug().Str("event", event).Str("delivery", r.Header.Get("X-GitHub-Delivery")).Msg("Received GitHub webhook")
+	switch {
+	case event == "pull_request" && rc.pullRequests != nil:
+		pr, ok, err := githubPullRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ok {
+			rc.enqueue(w, func() { rc.pullRequests.review(pr) })
+			return
+		}
+	case event == "push" && rc.push:
+		p, ok, err := githubPush(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ok {
+			rc.queueSync(w, p)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rc *receiver) serveGitLab(w http.ResponseWriter, r *http.Request) {
+	body, ok := rc.read(w, r)
+	if !ok {
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(rc.secret)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	event := r.Header.Get("X-Gitlab-Event")
+	log.Debug().Str("event", event).Msg("Received GitLab webhook")
+	switch {
+	case event == "Merge Request Hook" && rc.pullRequests != nil:
+		pr, ok, err := gitlabMergeRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ok {
+			rc.enqueue(w, func() { rc.pullRequests.review(pr) })
+			return
+		}
+	case event == "Push Hook" && rc.push:
+		p, ok, err := gitlabPush(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ok {
+			rc.queueSync(w, p)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,70 +2,366 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/logrusorgru/aurora/v4"
 	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
 )
 
 // RegistryRecord represents a record in the registry file. It contains the root hash, the latest hash, and the URI of the repository being tracked.
 type RegistryRecord struct {
-	RootHash    string
-	LastestHash string
-	URI         string
-	// tr@ck: also track the branch
+	RootHash    string `json:"root_hash" yaml:"root_hash"`
+	LastestHash string `json:"latest_hash" yaml:"latest_hash"`
+	URI         string `json:"uri" yaml:"uri"`
+	// Markers overrides the global markers for this repository when set
+	Markers []string `json:"markers,omitempty" yaml:"markers,omitempty"`
+	// Disabled records are skipped by sync but kept in the registry
+	Disabled bool `json:"disabled" yaml:"disabled"`
+	// Labels group records for filtering
+	Labels []string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	// Note is a free-form, human-readable description of the repository
+	Note string `json:"note,omitempty" yaml:"note,omitempty"`
+	// Branch is the tracked branch, the default branch when empty. A URI may be registered once per branch.
+	Branch string `json:"branch,omitempty" yaml:"branch,omitempty"`
+	// Include and Exclude are path glob patterns added to the global ones for this repository
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	// Source is the forge organization the record was discovered in, e.g. github:acme, kept in sync by later
+	// discoveries
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+	// Schedule is a cron expression the daemon syncs the record on instead of its --interval, e.g. 0 */6 * * *
+	Schedule string `json:"schedule,omitempty" yaml:"schedule,omitempty"`
 }
 
-func loadRegistry() (*[]RegistryRecord, error) {
-	if registryFilePath[0] == '~' {
-		registryFilePath = filepath.Join(homeDir, registryFilePath[1:])
+// effectiveMarkers returns the record's marker overrides or the global markers when none are set
+func (r RegistryRecord) effectiveMarkers() []string {
+	if len(r.Markers) > 0 {
+		return r.Markers
+	}
+	return markers
+}
+
+// splitRecordAttrs separates the trailing key=value attributes from the positional fields of a registry line
+func splitRecordAttrs(parts []string) ([]string, map[string]string) {
+	attrs := make(map[string]string)
+	for len(parts) > 1 {
+		key, value, ok := strings.Cut(parts[len(parts)-1], "=")
+		if !ok || !isRecordAttr(key) {
+			break
+		}
+		attrs[key] = value
+		parts = parts[:len(parts)-1]
+	}
+	return parts, attrs
+}
+
+func isRecordAttr(key string) bool {
+	switch key {
+	case "markers", "disabled", "labels", "note", "branch", "include", "exclude", "source", "schedule":
+		return true
+	}
+	return false
+}
+
+// parseRecord parses a single registry line
+func parseRecord(line string) (RegistryRecord, error) {
+	parts, attrs := splitRecordAttrs(strings.Fields(line))
+
+	var record RegistryRecord
+	switch {
+	// invalid line
+	case len(parts) > 3:
+		return record, fmt.Errorf("invalid registry entry: %s", line)
+
+	// uri only
+	case len(parts) == 1:
+		// tr@ck: validate git uri format. can be url or path
+		record.URI = parts[0]
+
+	// uri and root hash
+	case len(parts) == 2:
+		// tr@ck: validate git uri format. can be url or path
+		// tr@ck: validate commit hash format
+		record.RootHash = parts[0]
+		record.URI = parts[1]
+
+	// complete record
+	default:
+		record.RootHash = parts[0]
+		record.LastestHash = parts[1]
+		record.URI = parts[2]
+	}
+
+	if v, ok := attrs["markers"]; ok {
+		m, err := decodeAttrList(v)
+		if err != nil {
+			return record, fmt.Errorf("invalid markers in registry entry %s: %w", line, err)
+		}
+		record.Markers = m
+	}
+
+	if v, ok := attrs["labels"]; ok {
+		l, err := decodeAttrList(v)
+		if err != nil {
+			return record, fmt.Errorf("invalid labels in registry entry %s: %w", line, err)
+		}
+		record.Labels = l
+	}
+
+	if v, ok := attrs["include"]; ok {
+		p, err := decodeAttrList(v)
+		if err != nil {
+			return record, fmt.Errorf("invalid include paths in registry entry %s: %w", line, err)
+		}
+		record.Include = p
+	}
+
+	if v, ok := attrs["exclude"]; ok {
+		p, err := decodeAttrList(v)
+		if err != nil {
+			return record, fmt.Errorf("invalid exclude paths in registry entry %s: %w", line, err)
+		}
+		record.Exclude = p
+	}
+
+	if v, ok := attrs["branch"]; ok {
+		branch, err := url.QueryUnescape(v)
+		if err != nil {
+			return record, fmt.Errorf("invalid branch in registry entry %s: %w", line, err)
+		}
+		record.Branch = branch
+	}
+
+	if v, ok := attrs["note"]; ok {
+		note, err := url.QueryUnescape(v)
+		if err != nil {
+			return record, fmt.Errorf("invalid note in registry entry %s: %w", line, err)
+		}
+		record.Note = note
+	}
+
+	if v, ok := attrs["source"]; ok {
+		source, err := url.QueryUnescape(v)
+		if err != nil {
+			return record, fmt.Errorf("invalid source in registry entry %s: %w", line, err)
+		}
+		record.Source = source
+	}
+
+	if v, ok := attrs["schedule"]; ok {
+		schedule, err := url.QueryUnescape(v)
+		if err != nil {
+			return record, fmt.Errorf("invalid schedule in registry entry %s: %w", line, err)
+		}
+		record.Schedule = schedule
+	}
+
+	if v, ok := attrs["disabled"]; ok {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return record, fmt.Errorf("invalid disabled flag in registry entry %s: %w", line, err)
+		}
+		record.Disabled = disabled
+	}
+
+	return record, nil
+}
+
+// encodeAttrList escapes and joins a list attribute value
+func encodeAttrList(values []string) string {
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		escaped[i] = url.QueryEscape(v)
+	}
+	return strings.Join(escaped, ",")
+}
+
+// decodeAttrList splits and unescapes a list attribute value, dropping empty items
+func decodeAttrList(value string) ([]string, error) {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		item, err := url.QueryUnescape(v)
+		if err != nil {
+			return nil, err
+		}
+		if item != "" {
+			values = append(values, item)
+		}
+	}
+	return values, nil
+}
+
+// formatRecord renders a record as a registry line
+func formatRecord(record RegistryRecord) string {
+	line := fmt.Sprintf("%s    %s    %s", record.RootHash, record.LastestHash, record.URI)
+
+	if len(record.Markers) > 0 {
+		line += "    markers=" + encodeAttrList(record.Markers)
+	}
+
+	if len(record.Labels) > 0 {
+		line += "    labels=" + encodeAttrList(record.Labels)
+	}
+
+	if len(record.Include) > 0 {
+		line += "    include=" + encodeAttrList(record.Include)
+	}
+
+	if len(record.Exclude) > 0 {
+		line += "    exclude=" + encodeAttrList(record.Exclude)
 	}
 
+	if record.Branch != "" {
+		line += "    branch=" + url.QueryEscape(record.Branch)
+	}
+
+	if record.Note != "" {
+		line += "    note=" + url.QueryEscape(record.Note)
+	}
+
+	if record.Source != "" {
+		line += "    source=" + url.QueryEscape(record.Source)
+	}
+
+	if record.Schedule != "" {
+		line += "    schedule=" + url.QueryEscape(record.Schedule)
+	}
+
+	if record.Disabled {
+		line += "    disabled=true"
+	}
+
+	return line + "\n"
+}
+
+// canonicalURI normalizes a repository URI so that equivalent forms compare equal: the scheme, user
+// info and default ports are dropped, the host is lowercased and trailing slashes and .git suffixes are
+// removed. scp-like URIs (git@host:org/repo.git) are treated as ssh URIs and local paths are made absolute.
+// e.g. https://GitHub.com/a/b, ssh://git@github.com/a/b.git and git@github.com:a/b.git all become github.com/a/b
+func canonicalURI(uri string) string {
+	uri = strings.TrimSpace(uri)
+
+	var host, path string
+	if strings.Contains(uri, "://") {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return uri
+		}
+		if u.Scheme == "file" {
+			return canonicalPath(u.Path)
+		}
+		host = u.Hostname()
+		if port := u.Port(); port != "" && port != "22" && port != "80" && port != "443" && port != "9418" {
+			host += ":" + port
+		}
+		path = u.Path
+	} else if h, p, ok := strings.Cut(uri, ":"); ok && !strings.Contains(h, "/") && len(h) > 1 {
+		// scp-like syntax, a single letter host is a windows drive
+		if _, after, found := strings.Cut(h, "@"); found {
+			h = after
+		}
+		host, path = h, p
+	} else {
+		return canonicalPath(uri)
+	}
+
+	path = strings.TrimSuffix(strings.TrimRight(path, "/"), ".git")
+	path = strings.TrimRight(path, "/")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return strings.ToLower(host) + path
+}
+
+func canonicalPath(path string) string {
+	path = expandHome(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	path = filepath.Clean(path)
+	if filepath.Base(path) == ".git" {
+		path = filepath.Dir(path)
+	}
+	return path
+}
+
+// sameURI reports whether two URIs refer to the same repository
+func sameURI(a, b string) bool {
+	return canonicalURI(a) == canonicalURI(b)
+}
+
+// sameRecord reports whether two records track the same branch of the same repository
+func sameRecord(a, b RegistryRecord) bool {
+	return a.Branch == b.Branch && sameURI(a.URI, b.URI)
+}
+
+// recordKey identifies a record by its canonical URI and branch
+func recordKey(record RegistryRecord) string {
+	return canonicalURI(record.URI) + "#" + record.Branch
+}
+
+// findRecord returns the first registry record for the given URI or nil if it is not registered
+func findRecord(uri string) (*RegistryRecord, error) {
+	records, err := loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range *records {
+		if sameURI(record.URI, uri) {
+			return &record, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func loadRegistry() (*[]RegistryRecord, error) {
+	registryFilePath = expandHome(registryFilePath)
+
 	file, err := os.Open(registryFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open registry file: %w", err)
 	}
 	defer file.Close()
 
-	var records []RegistryRecord
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Fields(line)
+	records, err := parseRegistry(file)
+	if err != nil {
+		return nil, err
+	}
 
-		// invalid line
-		if len(parts) > 3 {
-			return nil, fmt.Errorf("invalid registry entry: %s", line)
-		}
+	// PrintStruct(os.Stdout, records)
 
-		// uri only
-		if len(parts) == 1 {
-			// tr@ck: validate git uri format. can be url or path
-			uri := strings.Trim(line, " ")
-			records = append(records, RegistryRecord{URI: uri})
-			continue
-		}
+	return &records, nil
+}
 
-		// uri and root hash
-		if len(parts) == 2 {
-			// tr@ck: validate git uri format. can be url or path
-			// tr@ck: validate commit hash format
-			commitHash := parts[0]
-			uri := strings.Join(parts[1:], " ") // Join the remaining parts to form the URL
-			records = append(records, RegistryRecord{URI: uri, RootHash: commitHash})
+// parseRegistry reads registry records, one per line, skipping blank lines
+func parseRegistry(r io.Reader) ([]RegistryRecord, error) {
+	var records []RegistryRecord
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
 			continue
 		}
 
-		// complete record
-		commitHash := parts[0]
-		lastProcessedCommit := parts[1]
-		uri := strings.Join(parts[2:], " ") // Join the remaining parts to form the URL
-		record := RegistryRecord{
-			RootHash:    commitHash,
-			LastestHash: lastProcessedCommit,
-			URI:         uri,
+		record, err := parseRecord(line)
+		if err != nil {
+			return nil, err
 		}
 		records = append(records, record)
 	}
@@ -74,112 +370,402 @@ func loadRegistry() (*[]RegistryRecord, error) {
 		return nil, fmt.Errorf("error reading registry file: %w", err)
 	}
 
-	// PrintStruct(os.Stdout, records)
+	return records, nil
+}
 
-	return &records, nil
+// writeRegistry replaces the content of the registry file with the given records. The previous
+// version is kept as a .bak file and the new one is written to a temp file and renamed into place,
+// so a crash mid-write never leaves a truncated registry.
+func writeRegistry(records []RegistryRecord) error {
+	var buf bytes.Buffer
+	for _, record := range records {
+		buf.WriteString(formatRecord(record))
+	}
+
+	if err := backupFile(registryFilePath); err != nil {
+		return fmt.Errorf("failed to back up registry file: %w", err)
+	}
+
+	if err := writeFileAtomic(registryFilePath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write registry file: %w", err)
+	}
+
+	return nil
+}
+
+// errRecordNotFound is wrapped by the registry changes of an entry that is not registered
+var errRecordNotFound = errors.New("not found in the registry")
+
+// errRecordExists is wrapped when adding an entry that is already registered
+var errRecordExists = errors.New("already exists in the registry")
+
+// errRegistryReadOnly is wrapped by the registry changes of a shared registry without a write credential
+var errRegistryReadOnly = errors.New("read-only")
+
+// checkRegistryWritable returns an error wrapping errRegistryReadOnly when the registry is shared and no write
+// credential was provided
+func checkRegistryWritable() error {
+	if registryRemoteURI != "" && registryWriteCredential == "" {
+		return fmt.Errorf("registry %s is %w: provide a --write credential to update it", registryRemoteURI, errRegistryReadOnly)
+	}
+	return nil
+}
+
+// saveRegistry persists the records of a registry change. A shared registry is pushed first and the local copy only
+// written once the remote took the change, so that a rejected push leaves both as they were.
+func saveRegistry(records []RegistryRecord) error {
+	if err := checkRegistryWritable(); err != nil {
+		return err
+	}
+
+	if registryRemoteURI != "" {
+		if err := pushRemoteRegistry(records); err != nil {
+			return err
+		}
+	}
+
+	return writeRegistry(records)
 }
 
-func appendToRegistry(record *RegistryRecord) error {
-	file, err := os.OpenFile(registryFilePath, os.O_RDWR|os.O_APPEND, 0644)
+// updateRegistryCursor sets the latest hash of the registry record of rec to latestHash. Only the cursor is
+// written, so changes made to the record since it was loaded, e.g. through the REST API, are kept.
+func updateRegistryCursor(rec RegistryRecord, latestHash string) error {
+	records, err := loadRegistry()
 	if err != nil {
-		return fmt.Errorf("failed to open registry file: %w", err)
+		return fmt.Errorf("failed to load registry: %w", err)
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, record.URI) {
-			return fmt.Errorf("URL %s already exists in the registry", record.URI)
+	i := slices.IndexFunc(*records, func(record RegistryRecord) bool { return sameRecord(record, rec) })
+	if i < 0 {
+		return fmt.Errorf("URI %s %w", rec.URI, errRecordNotFound)
+	}
+	(*records)[i].LastestHash = latestHash
+
+	return writeRegistry(*records)
+}
+
+// addToRegistry adds the URI of the given record to the registry. Optional settings such as markers
+// and labels are copied from the record while the hashes are resolved from the repository.
+// Each of the given branches is registered as its own record; glob patterns are expanded against the
+// remote branches. The default branch is tracked when no branch is given.
+func addToRegistry(rec RegistryRecord, branches ...string) error {
+	uri := rec.URI
+
+	// fail before cloning, a shared registry is read-only unless a write credential is provided
+	if err := checkRegistryWritable(); err != nil {
+		return err
+	}
+
+	if rec.Schedule != "" {
+		if _, err := parseSchedule(rec.Schedule); err != nil {
+			return err
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading registry file: %w", err)
+
+	commitHash, err := getRootHashFromFirstCommit(uri)
+	if err != nil {
+		return fmt.Errorf("failed to clone repository: %v", err)
+	}
+
+	// without a cursor, the first sync scans the whole tree so that the markers already there are not new
+	rec.RootHash = commitHash
+	rec.LastestHash = ""
+	additions := []RegistryRecord{rec}
+
+	if len(branches) > 0 {
+		heads, err := listRemoteBranches(uri)
+		if err != nil {
+			return err
+		}
+
+		// globs match branches in name order, so that the registry keeps the same order from run to run
+		var names []string
+		for name := range heads {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		additions = nil
+		for _, pattern := range branches {
+			matched := false
+			for _, name := range names {
+				if name != pattern && !globMatch(pattern, name) {
+					continue
+				}
+				matched = true
+
+				branchRec := rec
+				branchRec.Branch = name
+				additions = append(additions, branchRec)
+			}
+			if !matched {
+				return fmt.Errorf("branch %s not found in %s", pattern, uri)
+			}
+		}
 	}
 
-	writer := bufio.NewWriter(file)
-	_, err = writer.WriteString(fmt.Sprintf("%s    %s    %s\n", record.RootHash, record.LastestHash, record.URI))
+	// Check if the URI already exists
+	records, err := loadRegistry()
 	if err != nil {
-		return fmt.Errorf("failed to write to registry file: %w", err)
+		return err
+	}
+	for _, record := range *records {
+		for _, add := range additions {
+			if sameRecord(record, add) {
+				return fmt.Errorf("URI %s %w", describeRecord(add), errRecordExists)
+			}
+		}
+	}
+
+	for _, add := range additions {
+		log.Debug().Str("uri", uri).Str("branch", add.Branch).Str("commitHash", commitHash).Msg("Adding")
+	}
+
+	if err := saveRegistry(append(*records, additions...)); err != nil {
+		return fmt.Errorf("failed to update registry: %w", err)
 	}
-	return writer.Flush()
+
+	return nil
 }
 
-// updateRegistry updates a registry record for a given URI
-func updateRegistry(rec RegistryRecord) error {
+// describeRecord returns the URI of the record, suffixed with its branch when one is tracked
+func describeRecord(record RegistryRecord) string {
+	if record.Branch == "" {
+		return record.URI
+	}
+	return fmt.Sprintf("%s [%s]", record.URI, record.Branch)
+}
+
+// refreshRegistry re-resolves the root hash of the given URI, or of every record when uri is empty.
+// When reset is true the latest hash is cleared so the next sync rescans the whole tree.
+func refreshRegistry(uri string, reset bool) error {
+	if err := checkRegistryWritable(); err != nil {
+		return err
+	}
+
 	records, err := loadRegistry()
 	if err != nil {
 		return fmt.Errorf("failed to load registry: %w", err)
 	}
 
-	updated := false
+	found := false
 	for i, record := range *records {
-		if record.URI == rec.URI {
-			(*records)[i] = RegistryRecord{
-				RootHash:    rec.RootHash,
-				LastestHash: rec.LastestHash,
-				URI:         rec.URI,
-			}
-			updated = true
-			break
+		if uri != "" && !sameURI(record.URI, uri) {
+			continue
+		}
+		found = true
+
+		rootHash, err := getRootHashFromFirstCommit(record.URI)
+		if err != nil {
+			return fmt.Errorf("failed to resolve root hash for %s: %w", record.URI, err)
+		}
+
+		if rootHash != record.RootHash {
+			log.Debug().Str("uri", record.URI).Str("old", record.RootHash).Str("new", rootHash).Msg("Refreshed")
+		}
+
+		(*records)[i].RootHash = rootHash
+		if reset {
+			(*records)[i].LastestHash = ""
 		}
 	}
 
-	if !updated {
-		return fmt.Errorf("URI %s not found in the registry", rec.URI)
+	if !found {
+		return fmt.Errorf("URI %s %w", uri, errRecordNotFound)
 	}
 
-	file, err := os.OpenFile(registryFilePath, os.O_WRONLY|os.O_TRUNC, 0644)
+	return saveRegistry(*records)
+}
+
+// modifyBranch applies fn to the record tracking the branch of the given URI, or to every record for the URI when
+// branch is empty, and persists the result, pushing it to the shared registry if any
+func modifyBranch(uri, branch string, fn func(*RegistryRecord)) error {
+	records, err := loadRegistry()
 	if err != nil {
-		return fmt.Errorf("failed to open registry file for writing: %w", err)
+		return fmt.Errorf("failed to load registry: %w", err)
 	}
-	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-	for _, record := range *records {
-		_, err = writer.WriteString(fmt.Sprintf("%s    %s    %s\n", record.RootHash, record.LastestHash, record.URI))
-		if err != nil {
-			return fmt.Errorf("failed to write to registry file: %w", err)
+	found := false
+	for i := range *records {
+		if sameURI((*records)[i].URI, uri) && (branch == "" || (*records)[i].Branch == branch) {
+			fn(&(*records)[i])
+			found = true
 		}
 	}
-	return writer.Flush()
+
+	if !found {
+		return fmt.Errorf("URI %s %w", describeRecord(RegistryRecord{URI: uri, Branch: branch}), errRecordNotFound)
+	}
+
+	return saveRegistry(*records)
 }
 
-// addToRegistry adds the given URI to the registry
-func addToRegistry(uri string) error {
-	// Open the registry file in read-write mode
-	file, err := os.OpenFile(registryFilePath, os.O_RDWR|os.O_APPEND, 0644)
+// removeFromRegistry removes the record tracking the branch of the given URI, or every record for the URI when
+// branch is empty
+func removeFromRegistry(uri, branch string) error {
+	records, err := loadRegistry()
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to load registry: %w", err)
 	}
-	defer file.Close()
 
-	// Check if the URI already exists
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, uri) {
-			return fmt.Errorf("URI %s already exists in the registry", uri)
+	count := len(*records)
+	kept := slices.DeleteFunc(*records, func(record RegistryRecord) bool {
+		return sameURI(record.URI, uri) && (branch == "" || record.Branch == branch)
+	})
+	if len(kept) == count {
+		return fmt.Errorf("URI %s %w", describeRecord(RegistryRecord{URI: uri, Branch: branch}), errRecordNotFound)
+	}
+	log.Debug().Str("uri", uri).Str("branch", branch).Int("records", count-len(kept)).Msg("Removing")
+
+	return saveRegistry(kept)
+}
+
+// setRecordDisabled enables or disables the record tracking the branch of the given URI, or every record for the
+// URI when branch is empty
+func setRecordDisabled(uri, branch string, disabled bool) error {
+	return modifyBranch(uri, branch, func(r *RegistryRecord) { r.Disabled = disabled })
+}
+
+// setRecordLabels replaces the labels of the record tracking the branch of the given URI, or of every record for
+// the URI when branch is empty
+func setRecordLabels(uri, branch string, labels []string) error {
+	return modifyBranch(uri, branch, func(r *RegistryRecord) { r.Labels = labels })
+}
+
+// setRecordNote replaces the note of the record tracking the branch of the given URI, or of every record for the
+// URI when branch is empty
+func setRecordNote(uri, branch, note string) error {
+	return modifyBranch(uri, branch, func(r *RegistryRecord) { r.Note = note })
+}
+
+// setRecordSchedule replaces the sync schedule of the record tracking the branch of the given URI, or of every
+// record for the URI when branch is empty. An empty schedule syncs it every --interval again.
+func setRecordSchedule(uri, branch, schedule string) error {
+	if schedule != "" {
+		if _, err := parseSchedule(schedule); err != nil {
+			return err
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return err
+	return modifyBranch(uri, branch, func(r *RegistryRecord) { r.Schedule = schedule })
+}
+
+// registryFilter selects registry records when listing
+type registryFilter struct {
+	uriGlob string
+	label   string
+	// staleDays matches records whose latest hash is older than this many days
+	staleDays    int
+	missingCache bool
+}
+
+func (f registryFilter) match(record RegistryRecord) bool {
+	if f.uriGlob != "" && !globMatch(f.uriGlob, record.URI) {
+		return false
 	}
 
-	commitHash, err := getRootHashFromFirstCommit(uri)
-	if err != nil {
-		return fmt.Errorf("failed to clone repository: %v", err)
+	if f.label != "" && !slices.Contains(record.Labels, f.label) {
+		return false
 	}
 
-	log.Debug().Str("uri", uri).Str("commitHash", commitHash).Msg("Adding")
+	if f.missingCache {
+		if _, err := os.Stat(archivePath(record)); !os.IsNotExist(err) {
+			return false
+		}
+	}
 
-	err = appendToRegistry(&RegistryRecord{
-		RootHash:    commitHash,
-		LastestHash: commitHash,
-		URI:         uri,
-	})
+	if f.staleDays > 0 {
+		// records whose latest commit cannot be resolved from the cache are reported as stale
+		if when, err := latestCommitTime(record); err == nil && time.Since(when) < time.Duration(f.staleDays)*24*time.Hour {
+			return false
+		}
+	}
+
+	return true
+}
+
+// latestCommitTime returns the commit time of the record's latest hash from the cached clone
+func latestCommitTime(record RegistryRecord) (time.Time, error) {
+	hash := record.LastestHash
+	if hash == "" {
+		hash = record.RootHash
+	}
+
+	repo, err := git.PlainOpen(archivePath(record))
 	if err != nil {
-		return fmt.Errorf("failed to update registry: %v", err)
+		return time.Time{}, err
+	}
+
+	commit, err := repo.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return commit.Committer.When, nil
+}
+
+// tsvField replaces the tabs and line breaks of a tsv field, which separate fields and records
+var tsvField = strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ")
+
+// printRegistry writes the records in the given format: table (colored, human-readable), tsv, json or yaml
+func printRegistry(w io.Writer, records []RegistryRecord, format string, verbose bool) error {
+	switch format {
+	case "json":
+		if records == nil {
+			records = []RegistryRecord{}
+		}
+		PrintStruct(w, records)
+
+	case "yaml":
+		data, err := yaml.Marshal(records)
+		if err != nil {
+			return fmt.Errorf("failed to marshal registry: %w", err)
+		}
+		w.Write(data)
+
+	case "tsv":
+		// columns are appended, so that scripts reading the earlier ones keep working
+		fmt.Fprintln(w, "root_hash\tlatest_hash\turi\tbranch\tdisabled\tmarkers\tlabels\tnote\tinclude\texclude\tsource\tschedule")
+		for _, record := range records {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", record.RootHash, record.LastestHash, record.URI, record.Branch, record.Disabled,
+				strings.Join(record.Markers, ","), strings.Join(record.Labels, ","), tsvField.Replace(record.Note),
+				strings.Join(record.Include, ","), strings.Join(record.Exclude, ","), record.Source, record.Schedule)
+		}
+
+	case "table", "":
+		for _, record := range records {
+			if record.Disabled {
+				fmt.Fprintf(w, "%s	%s	%s	%s\n", aurora.Gray(12, record.RootHash), record.LastestHash, aurora.Gray(12, describeRecord(record)), aurora.Yellow("disabled"))
+			} else {
+				fmt.Fprintf(w, "%s	%s	%s\n", aurora.Green(record.RootHash), record.LastestHash, aurora.Blue(describeRecord(record)))
+			}
+
+			if verbose {
+				if record.Note != "" {
+					fmt.Fprintf(w, "	note: %s\n", record.Note)
+				}
+				if len(record.Labels) > 0 {
+					fmt.Fprintf(w, "	labels: %s\n", strings.Join(record.Labels, ", "))
+				}
+				if len(record.Markers) > 0 {
+					fmt.Fprintf(w, "	markers: %s\n", strings.Join(record.Markers, ", "))
+				}
+				if len(record.Include) > 0 {
+					fmt.Fprintf(w, "	include: %s\n", strings.Join(record.Include, ", "))
+				}
+				if len(record.Exclude) > 0 {
+					fmt.Fprintf(w, "	exclude: %s\n", strings.Join(record.Exclude, ", "))
+				}
+				if record.Source != "" {
+					fmt.Fprintf(w, "	source: %s\n", record.Source)
+				}
+				if record.Schedule != "" {
+					fmt.Fprintf(w, "	schedule: %s\n", record.Schedule)
+				}
+			}
+		}
+
+	default:
+		return fmt.Errorf("unsupported format %s", format)
 	}
 
 	return nil
@@ -189,12 +775,10 @@ func initRegistry() {
 	// read registry file
 	_, err := os.Stat(registryFilePath)
 	if os.IsNotExist(err) {
-		file, err := os.Create(registryFilePath)
-		if err != nil {
+		if err := writeFileAtomic(registryFilePath, nil, 0644); err != nil {
 			fmt.Printf("Error creating registry file %s: %v\n", registryFilePath, err)
 			os.Exit(1)
 		}
-		defer file.Close()
 		fmt.Printf("Registry file %s created\n", registryFilePath)
 	} else {
 		fmt.Printf("Registry file %s already exists\n", registryFilePath)
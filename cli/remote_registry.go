@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/rs/zerolog/log"
+)
+
+// errRemoteNotModified is returned by a registry remote when the cached version is still current
+var errRemoteNotModified = errors.New("remote registry not modified")
+
+// errRemoteConflict is returned by a registry remote when a push is based on a version that is no longer current
+var errRemoteConflict = errors.New("remote registry changed since last sync, run again to refresh")
+
+// registryRemote is a shared, canonical registry location. Versions are opaque strings
+// (an ETag for HTTP and S3, a commit hash for git) used to avoid needless downloads
+// and to detect concurrent updates when pushing.
+type registryRemote interface {
+	fetch(version, credential string) ([]byte, string, error)
+	push(data []byte, version, credential string) (string, error)
+}
+
+// newRegistryRemote returns the remote implementation matching the URI scheme:
+// https://host/path, s3://bucket/key or git+https://host/repo.git#path/in/repo
+func newRegistryRemote(uri string) (registryRemote, error) {
+	switch {
+	case strings.HasPrefix(uri, "git+"):
+		repoURI, path, _ := strings.Cut(strings.TrimPrefix(uri, "git+"), "#")
+		if path == "" {
+			path = "tr4ck.registry"
+		}
+		return &gitRegistryRemote{uri: repoURI, path: path}, nil
+	case strings.HasPrefix(uri, "s3://"):
+		bucket, key, ok := strings.Cut(strings.TrimPrefix(uri, "s3://"), "/")
+		if !ok || bucket == "" || key == "" {
+			return nil, fmt.Errorf("invalid s3 registry uri %s: expected s3://bucket/key", uri)
+		}
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		return &httpRegistryRemote{
+			url: fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, key),
+			s3:  &s3Signer{region: region},
+		}, nil
+	case strings.HasPrefix(uri, "https://"), strings.HasPrefix(uri, "http://"):
+		return &httpRegistryRemote{url: uri}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported registry remote %s", uri)
+}
+
+// registryVersionPath is the sidecar file holding the remote URI and version of the cached registry
+func registryVersionPath() string {
+	return registryFilePath + ".remote"
+}
+
+func readRegistryVersion() string {
+	data, err := os.ReadFile(registryVersionPath())
+	if err != nil {
+		return ""
+	}
+
+	uri, version, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+	// the cached version is meaningless if the remote changed
+	if uri != registryRemoteURI {
+		return ""
+	}
+
+	return version
+}
+
+// registryReadCredential returns the credential reading the remote registry, the --read one or else the --write one
+func registryReadCredential() string {
+	if registryReadToken != "" {
+		return registryReadToken
+	}
+	return registryWriteCredential
+}
+
+func writeRegistryVersion(version string) error {
+	return writeFileAtomic(registryVersionPath(), []byte(registryRemoteURI+"\n"+version+"\n"), 0644)
+}
+
+// preRunRemoteRegistry syncs the remote registry when one is configured. Failures fall back to the cached copy.
+func preRunRemoteRegistry() {
+	if registryRemoteURI == "" {
+		return
+	}
+
+	if err := syncRemoteRegistry(); err != nil {
+		log.Warn().Err(err).Str("remote", registryRemoteURI).Msg("Failed to sync remote registry, using local copy")
+	}
+}
+
+// syncRemoteRegistry refreshes the local registry from the remote. The remote owns the list of
+// repositories while the local copy keeps its own latest hash cursors.
+func syncRemoteRegistry() error {
+	remote, err := newRegistryRemote(registryRemoteURI)
+	if err != nil {
+		return err
+	}
+
+	data, version, err := remote.fetch(readRegistryVersion(), registryReadCredential())
+	if errors.Is(err, errRemoteNotModified) {
+		log.Trace().Str("remote", registryRemoteURI).Msg("remote registry not modified")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	records, err := parseRegistry(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("invalid remote registry: %w", err)
+	}
+
+	// keep local cursors for repositories that are already tracked
+	cursors := make(map[string]string)
+	if local, err := loadRegistry(); err == nil {
+		for _, record := range *local {
+			cursors[recordKey(record)] = record.LastestHash
+		}
+	}
+	for i, record := range records {
+		if cursor := cursors[recordKey(record)]; cursor != "" {
+			records[i].LastestHash = cursor
+		}
+	}
+
+	if err := writeRegistry(records); err != nil {
+		return err
+	}
+
+	log.Debug().Str("remote", registryRemoteURI).Str("version", version).Int("records", len(records)).Msg("remote registry updated")
+
+	return writeRegistryVersion(version)
+}
+
+// pushRemoteRegistry publishes the records to the remote, see saveRegistry. Cursors are local state and are not
+// shared.
+func pushRemoteRegistry(records []RegistryRecord) error {
+	remote, err := newRegistryRemote(registryRemoteURI)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, record := range records {
+		record.LastestHash = ""
+		buf.WriteString(formatRecord(record))
+	}
+
+	version, err := remote.push(buf.Bytes(), readRegistryVersion(), registryWriteCredential)
+	if err != nil {
+		return fmt.Errorf("failed to push registry to %s: %w", registryRemoteURI, err)
+	}
+
+	return writeRegistryVersion(version)
+}
+
+// httpRegistryRemote stores the registry as a single HTTP resource, optionally signed for S3
+type httpRegistryRemote struct {
+	url string
+	s3  *s3Signer
+}
+
+func (r *httpRegistryRemote) fetch(version, credential string) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if version != "" {
+		req.Header.Set("If-None-Match", version)
+	}
+	if r.s3 != nil {
+		// reads use the AWS environment variables without a credential, and anonymous access without either
+		creds, err := s3Credentials(credential)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := r.s3.sign(req, nil, creds); err != nil {
+			return nil, "", err
+		}
+	} else if credential != "" {
+		req.Header.Set("Authorization", "Bearer "+credential)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch remote registry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, version, errRemoteNotModified
+	case http.StatusOK:
+	default:
+		return nil, "", fmt.Errorf("failed to fetch remote registry: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read remote registry: %w", err)
+	}
+
+	return data, resp.Header.Get("ETag"), nil
+}
+
+func (r *httpRegistryRemote) push(data []byte, version, credential string) (string, error) {
+	req, err := http.NewRequest(http.MethodPut, r.url, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	// guard against overwriting a concurrent update, which S3 honors as a conditional write
+	if version != "" {
+		req.Header.Set("If-Match", version)
+	}
+
+	if r.s3 != nil {
+		creds, err := s3Credentials(credential)
+		if err != nil {
+			return "", err
+		}
+		if err := r.s3.sign(req, data, creds); err != nil {
+			return "", err
+		}
+	} else {
+		req.Header.Set("Authorization", "Bearer "+credential)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+	case http.StatusPreconditionFailed:
+		return "", errRemoteConflict
+	default:
+		return "", fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	return resp.Header.Get("ETag"), nil
+}
+
+// s3Signer signs requests with AWS Signature Version 4
+type s3Signer struct {
+	region string
+}
+
+// s3Credentials parses a credential given as ACCESS_KEY_ID:SECRET_ACCESS_KEY, or reads AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN when empty
+func s3Credentials(credential string) (aws.Credentials, error) {
+	if credential == "" {
+		return aws.Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	accessKey, secretKey, ok := strings.Cut(credential, ":")
+	if !ok {
+		return aws.Credentials{}, fmt.Errorf("s3 credential must be ACCESS_KEY_ID:SECRET_ACCESS_KEY")
+	}
+	return aws.Credentials{AccessKeyID: accessKey, SecretAccessKey: secretKey}, nil
+}
+
+// sign signs the request with its payload, leaving it anonymous without credentials
+func (s *s3Signer) sign(req *http.Request, payload []byte, creds aws.Credentials) error {
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil
+	}
+
+	// S3 requires the payload hash header and does not escape the path twice
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signer := v4.NewSigner(func(o *v4.SignerOptions) { o.DisableURIPathEscaping = true })
+	if err := signer.SignHTTP(context.Background(), creds, req, payloadHash, "s3", s.region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign s3 request: %w", err)
+	}
+	return nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// gitRegistryRemote stores the registry as a file in a git repository
+type gitRegistryRemote struct {
+	uri  string
+	path string
+}
+
+func (r *gitRegistryRemote) dir() string {
+	return filepath.Join(os.TempDir(), "tr4ck", "registry", sha256Hex([]byte(r.uri))[:16])
+}
+
+// open clones the registry repository or pulls the latest changes into the local cache
+func (r *gitRegistryRemote) open(credential string) (*git.Repository, error) {
+	var auth *githttp.BasicAuth
+	if credential != "" {
+		auth = &githttp.BasicAuth{Username: "tr4ck", Password: credential}
+	}
+
+	dst := r.dir()
+	if _, err := os.Stat(dst); os.IsNotExist(err) {
+		opts := &git.CloneOptions{URL: r.uri, SingleBranch: true}
+		if auth != nil {
+			opts.Auth = auth
+		}
+		repo, err := git.PlainClone(dst, false, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to clone registry repository: %w", err)
+		}
+		return repo, nil
+	}
+
+	repo, err := git.PlainOpen(dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open registry repository: %w", err)
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	opts := &git.PullOptions{RemoteName: "origin"}
+	if auth != nil {
+		opts.Auth = auth
+	}
+	if err := w.Pull(opts); err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, fmt.Errorf("failed to pull registry repository: %w", err)
+	}
+
+	return repo, nil
+}
+
+func (r *gitRegistryRemote) fetch(version, credential string) ([]byte, string, error) {
+	repo, err := r.open(credential)
+	if err != nil {
+		return nil, "", err
+	}
+
+	head, err := getLatestCommit(repo)
+	if err != nil {
+		return nil, "", err
+	}
+	if head == version {
+		return nil, version, errRemoteNotModified
+	}
+
+	data, err := os.ReadFile(filepath.Join(r.dir(), r.path))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read registry from repository: %w", err)
+	}
+
+	return data, head, nil
+}
+
+func (r *gitRegistryRemote) push(data []byte, version, credential string) (pushed string, err error) {
+	repo, err := r.open(credential)
+	if err != nil {
+		return "", err
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HEAD reference: %w", err)
+	}
+	// as If-Match over HTTP, the change must be based on the commit pulled
+	if version != "" && head.Hash().String() != version {
+		return "", errRemoteConflict
+	}
+	// a failed push resets the clone, so that a commit the remote rejected does not stay ahead of it
+	defer func() {
+		if err == nil {
+			return
+		}
+		if resetErr := w.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.HardReset}); resetErr != nil {
+			log.Warn().Err(resetErr).Str("remote", r.uri).Msg("Failed to reset registry repository")
+		}
+	}()
+
+	if err := os.WriteFile(filepath.Join(r.dir(), r.path), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write registry to repository: %w", err)
+	}
+
+	if _, err := w.Add(r.path); err != nil {
+		return "", fmt.Errorf("failed to stage registry: %w", err)
+	}
+
+	// a change that leaves the registry as it was, e.g. enabling an enabled record, has nothing to commit
+	status, err := w.Status()
+	if err != nil {
+		return "", fmt.Errorf("failed to get worktree status: %w", err)
+	}
+	if status.IsClean() {
+		return head.Hash().String(), nil
+	}
+
+	hash, err := w.Commit("Update tr4ck registry", &git.CommitOptions{
+		Author: &object.Signature{Name: "tr4ck", Email: "tr4ck@localhost", When: time.Now()},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to commit registry: %w", err)
+	}
+
+	err = repo.Push(&git.PushOptions{
+		RemoteName: "origin",
+		Auth:       &githttp.BasicAuth{Username: "tr4ck", Password: credential},
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return "", err
+	}
+
+	return hash.String(), nil
+}
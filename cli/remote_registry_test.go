@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+)
+
+// TestGitRegistryPushConflict checks that a push to a git registry based on a commit that is no longer the head
+// of the repository fails rather than overwrite the change committed since
+func TestGitRegistryPushConflict(t *testing.T) {
+	tmp := t.TempDir()
+	// the registry repository is cloned in the temp dir
+	t.Setenv("TMPDIR", tmp)
+
+	bareDir := filepath.Join(tmp, "registry.git")
+	if _, err := git.PlainInit(bareDir, true); err != nil {
+		t.Fatal(err)
+	}
+	// another writer of the registry
+	otherDir := filepath.Join(tmp, "other")
+	other, err := git.PlainInit(otherDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{bareDir}}); err != nil {
+		t.Fatal(err)
+	}
+	pushOther := func(content string) {
+		t.Helper()
+		commitFile(t, other, otherDir, "tr4ck.registry", content)
+		if err := other.Push(&git.PushOptions{RemoteName: "origin"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pushOther("a\n")
+
+	remote, err := newRegistryRemote("git+" + bareDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, version, err := remote.fetch("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pushOther("a\nb\n")
+	if _, err := remote.push([]byte("a\nc\n"), version, ""); !errors.Is(err, errRemoteConflict) {
+		t.Fatalf("push based on a stale version returned %v, expected errRemoteConflict", err)
+	}
+
+	data, version, err := remote.fetch(version, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a\nb\n" {
+		t.Fatalf("registry is %q after the conflict, expected the change of the other writer", data)
+	}
+	if _, err := remote.push([]byte("a\nb\nc\n"), version, ""); err != nil {
+		t.Fatalf("push based on the current version: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
+)
+
+// repoConfigFile is the repository-local configuration read from the root of scanned repositories
+const repoConfigFile = ".tr4ck.yml"
+
+// RepoConfig is the part of the configuration a repository can set for itself. It is merged over the global
+// configuration for that repository only; markers set on its registry entry still take precedence.
+type RepoConfig struct {
+	Markers           []MarkerConfig `yaml:"markers"`
+	IgnoreDirs        []string       `yaml:"ignore_dirs"`
+	IgnoredExtensions []string       `yaml:"ignore_extensions"`
+	IncludePaths      []string       `yaml:"include_paths"`
+	ExcludePaths      []string       `yaml:"exclude_paths"`
+}
+
+// readRepoConfig reads the repository-local configuration at commit hash, nil when there is none
+func readRepoConfig(repo *git.Repository, hash string) (*RepoConfig, error) {
+	commit, err := repo.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", hash, err)
+	}
+
+	f, err := commit.File(repoConfigFile)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", repoConfigFile, err)
+	}
+
+	data, err := f.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", repoConfigFile, err)
+	}
+
+	return parseRepoConfig([]byte(data))
+}
+
+// readDirRepoConfig reads the repository-local configuration in the root directory, nil when there is none
+func readDirRepoConfig(root string) (*RepoConfig, error) {
+	data, err := os.ReadFile(filepath.Join(root, repoConfigFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", repoConfigFile, err)
+	}
+
+	return parseRepoConfig(data)
+}
+
+func parseRepoConfig(data []byte) (*RepoConfig, error) {
+	var config RepoConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", repoConfigFile, err)
+	}
+	return &config, nil
+}
+
+// applyRepoConfig merges the repository-local configuration over the global settings and returns a function
+// restoring them. A missing or invalid configuration leaves the settings untouched.
+func applyRepoConfig(config *RepoConfig, err error) func() {
+	if err != nil {
+		log.Warn().Err(err).Msg("Ignoring repository configuration")
+		return func() {}
+	}
+	if config == nil {
+		return func() {}
+	}
+
+	savedMarkers, savedCaseInsensitive := markers, caseInsensitiveMarkers
+	savedDirs, savedExts := ignoreDirs, ignoredExtensions
+	savedInclude, savedExclude := includePaths, excludePaths
+
+	if len(config.Markers) > 0 {
+		applyMarkerConfig(config.Markers)
+	}
+
+	ignoreDirs = maps.Clone(ignoreDirs)
+	for _, dir := range config.IgnoreDirs {
+		ignoreDirs[dir] = struct{}{}
+	}
+	ignoredExtensions = maps.Clone(ignoredExtensions)
+	for _, ext := range config.IgnoredExtensions {
+		ignoredExtensions[ext] = struct{}{}
+	}
+
+	includePaths = append(slices.Clone(includePaths), config.IncludePaths...)
+	excludePaths = append(slices.Clone(excludePaths), config.ExcludePaths...)
+
+	log.Debug().Any("config", config).Msg("Applied repository configuration")
+
+	return func() {
+		markers, caseInsensitiveMarkers = savedMarkers, savedCaseInsensitive
+		ignoreDirs, ignoredExtensions = savedDirs, savedExts
+		includePaths, excludePaths = savedInclude, savedExclude
+	}
+}
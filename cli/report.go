@@ -0,0 +1,81 @@
+package main
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// runReport scans the given repositories or directories, or the latest commit of every enabled registry entry,
+// and prints a single report
+func runReport(uris []string) {
+	out, err := newReporter()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid output options")
+	}
+
+	scanAll(uris, out.add)
+
+	if err := out.close(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to print report")
+	}
+	out.exitOnFailure()
+}
+
+// scanAll scans the given repositories or directories, or the latest commit of every enabled registry entry,
+// and passes each result to fn without the ignored markers
+func scanAll(uris []string, fn func(ScanResult)) {
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		log.Err(err).Msg("Failed to load marker store")
+		store = &Store{}
+	}
+	report := func(result ScanResult) {
+		result.Findings = store.dropIgnored(result.Repo, result.Branch, result.Findings)
+		store.identify(result.Repo, result.Branch, result.Findings)
+		fn(result)
+	}
+
+	if len(uris) > 0 {
+		for _, uri := range uris {
+			resetSkipped()
+			result, err := scanFindings(uri)
+			if err != nil {
+				log.Err(err).Str("uri", uri).Msg("Failed to scan")
+				continue
+			}
+			report(result)
+		}
+		return
+	}
+
+	registry, err := loadRegistry()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load registry")
+	}
+
+	for _, record := range *registry {
+		if record.Disabled {
+			continue
+		}
+		resetSkipped()
+		report(recordFindings(record))
+	}
+}
+
+// recordFindings scans the latest commit of the tracked branch of a registry entry
+func recordFindings(record RegistryRecord) (result ScanResult) {
+	defer result.finish(time.Now())
+	result.Repo, result.Branch, result.Note = record.URI, record.Branch, record.Note
+
+	repo, err := cloneRepo(&record)
+	if err != nil {
+		log.Err(err).Str("uri", record.URI).Str("branch", record.Branch).Msg("Failed to clone repository")
+		return result
+	}
+
+	if err := repoFindings(repo, &result, &record); err != nil {
+		log.Err(err).Str("uri", record.URI).Str("branch", record.Branch).Msg("Failed to scan repository")
+	}
+	return result
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// the subset of SARIF 2.1 needed to report findings, see https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool                     sarifTool             `json:"tool"`
+	VersionControlProvenance []sarifVersionControl `json:"versionControlProvenance,omitempty"`
+	ColumnKind               string                `json:"columnKind"`
+	Results                  []sarifResult         `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string       `json:"id"`
+	Name                 string       `json:"name"`
+	ShortDescription     sarifMessage `json:"shortDescription"`
+	DefaultConfiguration struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+type sarifVersionControl struct {
+	RepositoryURI string `json:"repositoryUri"`
+	RevisionID    string `json:"revisionId,omitempty"`
+	Branch        string `json:"branch,omitempty"`
+}
+
+type sarifArtifact struct {
+	URI       string `json:"uri,omitempty"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+	// PartialFingerprints lets code scanning track a marker across runs by its ID
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation sarifArtifact `json:"artifactLocation"`
+		Region           sarifRegion   `json:"region"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// writeSARIF writes the report as a SARIF log with a run per repository, each marker being a rule
+func writeSARIF(w io.Writer, report Report) {
+	doc := sarifLog{
+		Schema:  sarifSchema,
+		Version: "2.1.0",
+		Runs:    []sarifRun{},
+	}
+
+	for _, result := range report.Results {
+		doc.Runs = append(doc.Runs, sarifRunOf(result))
+	}
+
+	PrintStruct(w, doc)
+}
+
+// sarifRunOf converts the findings of one repository to a SARIF run
+func sarifRunOf(result ScanResult) sarifRun {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "tr4ck",
+			Version:        version,
+			InformationURI: "https://github.com/cyber-nic/tr4ck",
+			Rules:          []sarifRule{},
+		}},
+		// finding columns count characters
+		ColumnKind: "unicodeCodePoints",
+		Results:    []sarifResult{},
+	}
+
+	// local scans have a path rather than a repository uri
+	if result.To != "" && !filepath.IsAbs(result.Repo) {
+		run.VersionControlProvenance = []sarifVersionControl{{
+			RepositoryURI: result.Repo,
+			RevisionID:    result.To,
+			Branch:        result.Branch,
+		}}
+	}
+
+	// one rule per marker, in a stable order
+	ruleIndex := map[string]int{}
+	var ids []string
+	for _, f := range result.Findings {
+		if _, ok := ruleIndex[f.Marker]; !ok {
+			ruleIndex[f.Marker] = 0
+			ids = append(ids, f.Marker)
+		}
+	}
+	sort.Strings(ids)
+	for i, id := range ids {
+		ruleIndex[id] = i
+		rule := sarifRule{ID: id, Name: id, ShortDescription: sarifMessage{Text: id + " marker"}}
+		rule.DefaultConfiguration.Level = "note"
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+	}
+
+	for _, f := range result.Findings {
+		message := f.Description
+		if message == "" {
+			message = f.Text
+		}
+
+		var location sarifLocation
+		location.PhysicalLocation.ArtifactLocation = sarifArtifact{URI: f.File, URIBaseID: "%SRCROOT%"}
+		location.PhysicalLocation.Region = sarifRegion{StartLine: f.Line, StartColumn: f.Column}
+
+		sr := sarifResult{
+			RuleID:    f.Marker,
+			RuleIndex: ruleIndex[f.Marker],
+			Level:     "note",
+			Message:   sarifMessage{Text: message},
+			Locations: []sarifLocation{location},
+		}
+		if f.ID != "" {
+			sr.PartialFingerprints = map[string]string{"tr4ckId/v1": f.ID}
+		}
+		run.Results = append(run.Results, sr)
+	}
+
+	return run
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// scanLocal scans a local directory in place instead of cloning
+	scanLocal bool
+	// scanRef is the branch, tag or commit to scan instead of the latest commit
+	scanRef string
+	// scanDirty only scans the modified and untracked files of a local repository
+	scanDirty bool
+	// scanDiff only reports markers added in the base..head range
+	scanDiff string
+)
+
+// runScan scans a remote repository or a local directory and prints the findings
+func runScan(uri string) {
+	out, err := newReporter()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid output options")
+	}
+
+	result, err := scanFindings(uri)
+	if err != nil {
+		log.Fatal().Err(err).Str("uri", uri).Msg("Failed to scan")
+	}
+	result.Findings = storeFindings(result)
+
+	result.Findings, err = filterBaseline(result.Findings)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to apply baseline")
+	}
+
+	out.add(result)
+	if err := out.close(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to print report")
+	}
+	out.exitOnFailure()
+}
+
+// scanFindings scans a remote repository or a local directory and returns the findings, or why the repository or
+// directory could not be scanned
+func scanFindings(uri string) (result ScanResult, err error) {
+	defer result.finish(time.Now())
+	result.Repo = uri
+
+	record, _ := findRecord(uri)
+	if record != nil {
+		result.Note = record.Note
+	}
+
+	// scan an existing checkout in place
+	if scanLocal || isLocalDir(uri) {
+		err = localFindings(&result, record)
+		return result, err
+	}
+
+	if scanDirty {
+		return result, fmt.Errorf("--dirty requires a local repository")
+	}
+
+	rootHash, err := getRootHashFromFirstCommit(uri)
+	if err != nil {
+		log.Err(err).Msg("Failed to get root commit hash")
+	}
+
+	repo, err := cloneRepo(&RegistryRecord{
+		RootHash: rootHash,
+		URI:      uri,
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to clone repository: %w", err)
+	}
+
+	err = repoFindings(repo, &result, record)
+	return result, err
+}
+
+// repoFindings scans the latest commit of a cloned repository, or the commits selected by --ref or --diff.
+// record is the registry entry of the repository, if any.
+func repoFindings(repo *git.Repository, result *ScanResult, record *RegistryRecord) error {
+	// get latest hash
+	latestHash, err := getLatestCommit(repo)
+	if err != nil {
+		return fmt.Errorf("failed to get latest commit: %w", err)
+	}
+
+	// repository-local settings only apply to this scan
+	defer applyRepoConfig(readRepoConfig(repo, latestHash))()
+	scanMarkers, scanPaths := scanSettings(record)
+
+	if scanDiff != "" {
+		return diffFindings(repo, result, scanMarkers, scanPaths)
+	}
+
+	if scanRef != "" {
+		return refFindings(repo, result, scanMarkers, scanPaths)
+	}
+
+	result.To = latestHash
+	findings, err := listFindings(repo, scanMarkers, scanPaths)
+	if err != nil {
+		return fmt.Errorf("failed to list files with markers: %w", err)
+	}
+
+	if findings == nil {
+		log.Debug().Str("uri", result.Repo).Str("latest", latestHash).Any("skipped", skipped).Msg(aurora.BrightYellow("Skip").String())
+		return nil
+	}
+
+	result.Findings = attributeAndFilter(repo, latestHash, "", findings)
+
+	log.Debug().Int("findings", len(result.Findings)).Any("skipped", skipped).Str("uri", result.Repo).Str("latest", latestHash).Str("hash", latestHash).Msg(aurora.BrightYellow("Update").String())
+	return nil
+}
+
+// localFindings scans the local directory of result.Repo, which does not have to be a git repository
+func localFindings(result *ScanResult, record *RegistryRecord) error {
+	root, err := filepath.Abs(expandHome(result.Repo))
+	if err != nil {
+		return fmt.Errorf("failed to resolve local path: %w", err)
+	}
+
+	repo, repoErr := git.PlainOpenWithOptions(root, &git.PlainOpenOptions{DetectDotGit: true})
+
+	// repository-local settings live at the repository root, or the scanned directory outside of a repository
+	configRoot := root
+	if repoErr == nil {
+		if worktree, err := repo.Worktree(); err == nil {
+			configRoot = worktree.Filesystem.Root()
+		}
+	}
+	defer applyRepoConfig(readDirRepoConfig(configRoot))()
+	scanMarkers, scanPaths := scanSettings(record)
+
+	if scanRef != "" || scanDirty || scanDiff != "" {
+		if repoErr != nil {
+			return fmt.Errorf("failed to open repository %s: %w", root, repoErr)
+		}
+	}
+	result.Repo = root
+	if scanDiff != "" {
+		return diffFindings(repo, result, scanMarkers, scanPaths)
+	}
+	if scanRef != "" {
+		return refFindings(repo, result, scanMarkers, scanPaths)
+	}
+
+	// the scanned directory may be below the repository root
+	var latestHash, dir string
+	if repoErr == nil {
+		var err error
+		if latestHash, err = getLatestCommit(repo); err != nil {
+			log.Err(err).Str("path", root).Msg("Failed to get latest commit")
+		}
+		if worktree, err := repo.Worktree(); err == nil {
+			if rel, err := filepath.Rel(worktree.Filesystem.Root(), root); err == nil && rel != "." {
+				dir = filepath.ToSlash(rel)
+			}
+		}
+	}
+
+	var findings []Finding
+	if scanDirty {
+		findings, err = scanChanges(repo, dir, scanMarkers, scanPaths)
+	} else {
+		findings, err = scanDir(root, scanMarkers, scanPaths)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list files with markers: %w", err)
+	}
+
+	result.To = latestHash
+	result.Findings = attributeAndFilter(repo, latestHash, dir, findings)
+
+	log.Debug().Int("findings", len(result.Findings)).Any("skipped", skipped).Str("path", root).Str("latest", latestHash).Msg(aurora.BrightYellow("Scan").String())
+	return nil
+}
+
+// refFindings scans the tree at scanRef without checking it out
+func refFindings(repo *git.Repository, result *ScanResult, scanMarkers []string, scanPaths pathFilter) error {
+	commit, err := resolveRef(repo, scanRef)
+	if err != nil {
+		return fmt.Errorf("failed to resolve ref: %w", err)
+	}
+	result.To = commit.Hash.String()
+
+	findings, err := scanTree(commit, scanMarkers, scanPaths)
+	if err != nil {
+		return fmt.Errorf("failed to list files with markers: %w", err)
+	}
+
+	result.Findings = attributeAndFilter(repo, commit.Hash.String(), "", findings)
+
+	log.Debug().Int("findings", len(result.Findings)).Any("skipped", skipped).Str("uri", result.Repo).Str("ref", scanRef).Str("hash", commit.Hash.String()).Msg(aurora.BrightYellow("Scan").String())
+	return nil
+}
+
+// diffFindings reports the markers added in the scanDiff range, e.g. to flag new markers in a pull request
+func diffFindings(repo *git.Repository, result *ScanResult, scanMarkers []string, scanPaths pathFilter) error {
+	base, head, err := resolveRange(repo, scanDiff)
+	if err != nil {
+		return fmt.Errorf("failed to resolve range: %w", err)
+	}
+	result.From, result.To = base.Hash.String(), head.Hash.String()
+
+	findings, err := scanRange(base, head, scanMarkers, scanPaths)
+	if err != nil {
+		return fmt.Errorf("failed to list added markers: %w", err)
+	}
+
+	result.Findings = attributeAndFilter(repo, head.Hash.String(), "", findings)
+
+	log.Debug().Int("findings", len(result.Findings)).Any("skipped", skipped).Str("uri", result.Repo).Str("base", base.Hash.String()).Str("head", head.Hash.String()).Msg(aurora.BrightYellow("Scan").String())
+	return nil
+}
+
+// scanSettings returns the markers and path filter of a scan, honoring the overrides of a registered repository
+func scanSettings(record *RegistryRecord) ([]string, pathFilter) {
+	if record != nil {
+		return record.effectiveMarkers(), record.effectivePaths()
+	}
+	return markers, globalPathFilter()
+}
+
+// attributeAndFilter applies blame attribution, CODEOWNERS ownership and the age filters to findings at commit hash
+func attributeAndFilter(repo *git.Repository, hash, dir string, findings []Finding) []Finding {
+	attributeFindings(repo, hash, dir, findings)
+	assignOwners(repo, hash, dir, findings)
+
+	return filterFindingsByAge(findings)
+}
+
+// addScanFlags registers the options of commands scanning a single repository or directory
+func addScanFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&scanLocal, "local", false, "scan a local directory in place instead of cloning (implied when the path exists)")
+	cmd.Flags().BoolVar(&scanDirty, "dirty", false, "only scan modified and untracked files of a local repository")
+	cmd.Flags().StringVar(&scanDiff, "diff", "", "only report markers added in a base..head range, or base...head from their merge base")
+	cmd.Flags().StringVar(&scanRef, "ref", "", "scan the tree at a branch, tag or commit instead of the latest commit")
+	cmd.Flags().StringSliceVar(&includePaths, "path", nil, "only scan paths matching these glob patterns, e.g. src/**/*.go")
+	cmd.Flags().StringSliceVar(&excludePaths, "exclude", nil, "skip paths matching these glob patterns, e.g. *.min.js")
+	cmd.Flags().IntVar(&contextLines, "context", 0, "capture this many lines before and after each marker")
+	cmd.Flags().Int64Var(&maxFileSize, "max-file-size", defaultMaxFileSize, "skip files larger than this many bytes, 0 for no limit")
+	cmd.Flags().BoolVar(&submodules, "submodules", false, "initialize, update and scan submodules of cloned repositories")
+	cmd.Flags().BoolVar(&blameFindings, "blame", false, "attribute each marker to the author and commit of its line")
+	cmd.Flags().StringVar(&olderThan, "older-than", "", "only report markers older than this age, e.g. 90d, 12w or 1y (implies --blame)")
+	cmd.Flags().BoolVar(&oldestFirst, "oldest-first", false, "sort markers by age, oldest first (implies --blame)")
+	cmd.Flags().BoolVar(&introducedFindings, "introduced", false, "find the commit where each marker first appeared, following renames")
+	cmd.Flags().BoolVar(&noGitignore, "no-gitignore", false, "scan files matched by .gitignore")
+	cmd.Flags().BoolVar(&commentsOnly, "comments-only", false, "only report markers within comments for known languages")
+}
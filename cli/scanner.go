@@ -0,0 +1,645 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// noGitignore disables .gitignore handling during worktree scans
+	noGitignore bool
+	// commentsOnly only reports markers found within comments for known languages
+	commentsOnly bool
+	// maxFileSize is the size in bytes above which files are skipped, no limit when not positive
+	maxFileSize int64 = defaultMaxFileSize
+	// skipped counts the files skipped by the current scan by reason, for the run summary
+	skipped = map[string]int{}
+	// contextLines is the number of lines captured before and after each finding
+	contextLines int
+	// onScanned is called with each file read by the current scan and its findings, e.g. to stream the progress of
+	// long scans
+	onScanned func(file string, findings []Finding)
+)
+
+const defaultMaxFileSize = 1 << 20
+
+// skipFile records a file skipped by the current scan
+func skipFile(file, reason string) {
+	skipped[reason]++
+	log.Debug().Str("file", file).Str("reason", reason).Msg("Skipped file")
+}
+
+// resetSkipped clears the skipped file counts before scanning another repository
+func resetSkipped() {
+	skipped = map[string]int{}
+}
+
+// oversized reports whether a file of the given size exceeds maxFileSize
+func oversized(size int64) bool {
+	return maxFileSize > 0 && size > maxFileSize
+}
+
+// Finding is a single marker occurrence within a file
+type Finding struct {
+	// ID is a short stable identifier of the marker, see markerID
+	ID string `json:"id,omitempty"`
+	// File is the path relative to the repository root
+	File string `json:"file"`
+	// Line and Column are 1-based; the column counts characters, not bytes
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Marker string `json:"marker"`
+	// Text is the trimmed content of the matching line
+	Text string `json:"text"`
+	// Before and After are the surrounding lines when context is requested
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+
+	// structured metadata parsed from marker(assignee, due:2025-09-01, p1): description
+	Assignee    string            `json:"assignee,omitempty"`
+	Due         string            `json:"due,omitempty"`
+	Priority    string            `json:"priority,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	// Issues are the issue references found in the metadata or description, e.g. #123 or JIRA-456
+	Issues []string `json:"issues,omitempty"`
+	// Owners are the owners of the file in the CODEOWNERS of the repository
+	Owners []string `json:"owners,omitempty"`
+
+	// blame attribution of the line
+	Author string     `json:"author,omitempty"`
+	Email  string     `json:"email,omitempty"`
+	Commit string     `json:"commit,omitempty"`
+	Date   *time.Time `json:"date,omitempty"`
+	// Age is the number of days since Date at scan time, e.g. 142d
+	Age string `json:"age,omitempty"`
+
+	Introduced *Introduction `json:"introduced,omitempty"`
+	// ResolvedBy is the commit that removed the marker, for resolved findings
+	ResolvedBy *Resolution `json:"resolved_by,omitempty"`
+}
+
+// scanReader returns every marker occurrence in r. file is only used to label the findings.
+func scanReader(r io.Reader, file string, matcher *markerMatcher) ([]Finding, error) {
+	findings, err := readFindings(r, file, matcher)
+	if err == nil && onScanned != nil {
+		onScanned(file, findings)
+	}
+	return findings, err
+}
+
+// readFindings returns every marker occurrence in r, see scanReader
+func readFindings(r io.Reader, file string, matcher *markerMatcher) ([]Finding, error) {
+	var findings []Finding
+	matcher = matcher.forFile(file)
+
+	// unknown languages fall back to raw matching
+	syntax := commentSyntaxFor(file)
+	var comments *commentState
+	if commentsOnly && syntax != nil {
+		comments = newCommentState(syntax)
+	}
+
+	decoded, err := newDecodingReader(r)
+	if errors.Is(err, errUndecodable) {
+		skipFile(file, "undecodable")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", file, err)
+	}
+
+	// the lines preceding the current one, and the findings still collecting lines after them
+	var previous []string
+	var pending []int
+	// findings whose description may continue on the next comment lines
+	var continuing []continuation
+
+	reader := bufio.NewReader(decoded)
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadString('\n')
+		if errors.Is(err, errUndecodable) {
+			skipFile(file, "undecodable")
+			return nil, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading file %s: %w", file, err)
+		}
+		// a trailing newline does not start another line
+		if line == "" && err == io.EOF {
+			break
+		}
+		line = decodeLine(line)
+
+		text := strings.TrimRight(line, "\r\n")
+		if contextLines > 0 {
+			for _, i := range pending {
+				findings[i].After = append(findings[i].After, text)
+			}
+			pending = slices.DeleteFunc(pending, func(i int) bool { return len(findings[i].After) >= contextLines })
+		}
+
+		var ranges [][2]int
+		if comments != nil {
+			ranges = comments.commentRanges(line)
+		}
+
+		matches := matcher.find(line)
+
+		// another marker starts a new description
+		if len(matches) > 0 {
+			continuing = nil
+		} else if len(continuing) > 0 {
+			continuing = continueDescriptions(findings, continuing, text)
+		}
+
+		for _, match := range matches {
+			if comments != nil && !inRanges(ranges, match.index) {
+				continue
+			}
+
+			finding := Finding{
+				File:   file,
+				Line:   lineNum,
+				Column: utf8.RuneCountInString(line[:match.index]) + 1,
+				Marker: match.marker,
+				Text:   strings.TrimSpace(line),
+			}
+			parseMarkerMetadata(&finding, line[match.index+len(match.marker):])
+			if contextLines > 0 {
+				finding.Before = slices.Clone(previous)
+				pending = append(pending, len(findings))
+			}
+			if syntax != nil {
+				if c, ok := commentContinuation(syntax, line, match.index); ok {
+					c.index = len(findings)
+					continuing = append(continuing, c)
+				}
+			}
+			findings = append(findings, finding)
+		}
+
+		if contextLines > 0 {
+			previous = append(previous, text)
+			if len(previous) > contextLines {
+				previous = previous[1:]
+			}
+		}
+
+		// the last line may not end with a newline
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return findings, nil
+}
+
+// scanFile returns every marker occurrence in the file at path, labelled with the relative name file
+func scanFile(path, file string, matcher *markerMatcher) ([]Finding, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err == nil && oversized(info.Size()) {
+		skipFile(file, "oversized")
+		return nil, nil
+	}
+
+	// binary files are skipped as in scanBlob, so that local and cloned scans agree
+	r, isBinary, err := peekBinary(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	if isBinary {
+		return nil, nil
+	}
+
+	return scanReader(r, file, matcher)
+}
+
+// listFindings lists every marker occurrence at the latest commit of the repository. Blobs are read from the
+// object store, unless submodules are scanned, which requires the checked out worktree.
+func listFindings(repo *git.Repository, markers []string, paths pathFilter) ([]Finding, error) {
+	if submodules {
+		worktree, err := repo.Worktree()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get worktree: %w", err)
+		}
+		return scanDir(worktree.Filesystem.Root(), markers, paths)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HEAD reference: %w", err)
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest commit: %w", err)
+	}
+
+	return scanTree(commit, markers, paths)
+}
+
+// scanDir lists every marker occurrence in the files below root, which need not be a git repository
+func scanDir(root string, markers []string, paths pathFilter) ([]Finding, error) {
+	// skip files matched by the .gitignore chain below root
+	var gitignored gitignore.Matcher
+	if !noGitignore {
+		patterns, err := gitignore.ReadPatterns(osfs.New(root), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read .gitignore patterns: %w", err)
+		}
+		gitignored = gitignore.NewMatcher(patterns)
+	}
+
+	matcher := newMarkerMatcher(markers)
+
+	var findings []Finding
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		file, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			// never skip the root itself
+			if file == "." {
+				return nil
+			}
+			if _, ignore := ignoreDirs[info.Name()]; ignore {
+				return filepath.SkipDir
+			}
+			// submodule worktrees have a .git file and are only scanned on request
+			if !submodules && isSubmoduleDir(path) {
+				return filepath.SkipDir
+			}
+			if gitignored != nil && gitignored.Match(strings.Split(filepath.ToSlash(file), "/"), true) {
+				return filepath.SkipDir
+			}
+			if paths.skipDir(file) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// filter
+		ext := filepath.Ext(path)
+		if _, ignore := ignoredExtensions[ext]; ignore {
+			return nil
+		}
+		if gitignored != nil && gitignored.Match(strings.Split(filepath.ToSlash(file), "/"), false) {
+			return nil
+		}
+		if !paths.match(file) {
+			return nil
+		}
+
+		hits, err := scanFile(path, file, matcher)
+		if err != nil {
+			return err
+		}
+		for _, hit := range hits {
+			log.Trace().Str("file", file).Int("line", hit.Line).Str("marker", hit.Marker).Msg(aurora.BrightGreen("tr4ck").String())
+		}
+		findings = append(findings, hits...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking the file tree: %w", err)
+	}
+
+	return findings, nil
+}
+
+// isSubmoduleDir reports whether dir is a submodule worktree, whose .git is a file pointing to the superproject
+func isSubmoduleDir(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil && !info.IsDir()
+}
+
+// resolveRef resolves a branch, tag or commit hash to a commit, fetching all branches and tags
+// from origin when the ref is not known locally (e.g. in a single branch clone)
+func resolveRef(repo *git.Repository, ref string) (*object.Commit, error) {
+	candidates := []plumbing.Revision{plumbing.Revision(ref), plumbing.Revision("origin/" + ref)}
+
+	resolve := func() *plumbing.Hash {
+		for _, rev := range candidates {
+			if hash, err := repo.ResolveRevision(rev); err == nil {
+				return hash
+			}
+		}
+		return nil
+	}
+
+	hash := resolve()
+	if hash == nil {
+		err := repo.Fetch(&git.FetchOptions{
+			RemoteName: "origin",
+			RefSpecs:   []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*", "+refs/tags/*:refs/tags/*"},
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return nil, fmt.Errorf("failed to fetch references: %w", err)
+		}
+		hash = resolve()
+	}
+	if hash == nil {
+		return nil, fmt.Errorf("failed to resolve ref %s", ref)
+	}
+
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit for ref %s: %w", ref, err)
+	}
+
+	return commit, nil
+}
+
+// scanTree lists every marker occurrence in the tree of the given commit, reading blobs from the
+// object store so that the worktree is left untouched
+func scanTree(commit *object.Commit, markers []string, paths pathFilter) ([]Finding, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree of commit %s: %w", commit.Hash, err)
+	}
+
+	matcher := newMarkerMatcher(markers)
+
+	var findings []Finding
+	err = tree.Files().ForEach(func(f *object.File) error {
+		hits, err := scanBlob(f, matcher, paths)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, hits...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking the tree: %w", err)
+	}
+
+	return findings, nil
+}
+
+// scanBlob lists every marker occurrence in a file read from the object store, applying the same filters
+// as worktree scans
+func scanBlob(f *object.File, matcher *markerMatcher, paths pathFilter) ([]Finding, error) {
+	if !f.Mode.IsFile() {
+		return nil, nil
+	}
+
+	// filter
+	for _, dir := range strings.Split(filepath.Dir(f.Name), "/") {
+		if _, ignore := ignoreDirs[dir]; ignore {
+			return nil, nil
+		}
+	}
+	if _, ignore := ignoredExtensions[filepath.Ext(f.Name)]; ignore {
+		return nil, nil
+	}
+	if !paths.match(f.Name) {
+		return nil, nil
+	}
+
+	if oversized(f.Size) {
+		skipFile(f.Name, "oversized")
+		return nil, nil
+	}
+
+	reader, err := f.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	defer reader.Close()
+
+	r, isBinary, err := peekBinary(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	if isBinary {
+		return nil, nil
+	}
+
+	hits, err := scanReader(r, f.Name, matcher)
+	if err != nil {
+		return nil, err
+	}
+	for _, hit := range hits {
+		log.Trace().Str("file", f.Name).Int("line", hit.Line).Str("marker", hit.Marker).Msg(aurora.BrightGreen("tr4ck").String())
+	}
+
+	return hits, nil
+}
+
+// listFindingsSinceCommit lists marker occurrences in files that have changed since the specified commit,
+// along with the files that were removed and the previous paths of those renamed
+func listFindingsSinceCommit(repo *git.Repository, firstHash, latestHash string, markers []string, paths pathFilter) ([]Finding, []string, []string, []string, error) {
+	changedFiles, removedFiles, renamedFiles, err := listChangedFilesSinceCommit(repo, firstHash, latestHash)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	commit, err := repo.CommitObject(plumbing.NewHash(latestHash))
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to get commit object for new hash %s: %w", latestHash, err)
+	}
+
+	matcher := newMarkerMatcher(markers)
+
+	var findings []Finding
+	for _, file := range changedFiles {
+		f, err := commit.File(file)
+		if errors.Is(err, object.ErrFileNotFound) {
+			// a changed submodule commit is rescanned as a whole from the worktree
+			if submodules {
+				hits, err := scanSubmodule(repo, file, markers, paths)
+				if err != nil {
+					return nil, nil, nil, nil, err
+				}
+				findings = append(findings, hits...)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("failed to get %s at %s: %w", file, latestHash, err)
+		}
+
+		hits, err := scanBlob(f, matcher, paths)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		findings = append(findings, hits...)
+	}
+
+	return findings, changedFiles, removedFiles, renamedFiles, nil
+}
+
+// scanChanges lists every marker occurrence in the modified, staged and untracked files of the worktree below
+// dir, which is relative to the repository root. Findings are relative to dir, as in scanDir.
+func scanChanges(repo *git.Repository, dir string, markers []string, paths pathFilter) ([]Finding, error) {
+	w, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree status: %w", err)
+	}
+
+	var files []string
+	for file, s := range status {
+		if s.Worktree == git.Deleted || (s.Worktree == git.Unmodified && (s.Staging == git.Unmodified || s.Staging == git.Deleted)) {
+			continue
+		}
+		files = append(files, file)
+	}
+	slices.Sort(files)
+
+	matcher := newMarkerMatcher(markers)
+
+	var findings []Finding
+	for _, file := range files {
+		rel := file
+		if dir != "" {
+			var ok bool
+			if rel, ok = strings.CutPrefix(file, dir+"/"); !ok {
+				continue
+			}
+		}
+
+		// filter
+		if _, ignore := ignoredExtensions[filepath.Ext(rel)]; ignore {
+			continue
+		}
+		if !paths.match(rel) {
+			continue
+		}
+
+		// modified submodules are directories
+		path := filepath.Join(w.Filesystem.Root(), file)
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+
+		hits, err := scanFile(path, rel, matcher)
+		if err != nil {
+			return nil, err
+		}
+		for _, hit := range hits {
+			log.Trace().Str("file", rel).Int("line", hit.Line).Str("marker", hit.Marker).Msg(aurora.BrightGreen("tr4ck").String())
+		}
+		findings = append(findings, hits...)
+	}
+
+	return findings, nil
+}
+
+// scanSubmodule lists every marker occurrence in the checked out submodule at dir, with findings relative to
+// the superproject
+func scanSubmodule(repo *git.Repository, dir string, markers []string, paths pathFilter) ([]Finding, error) {
+	w, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	root := filepath.Join(w.Filesystem.Root(), dir)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, nil
+	}
+
+	// patterns are relative to the superproject, so they are applied once the paths are prefixed
+	hits, err := scanDir(root, markers, pathFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, hit := range hits {
+		hit.File = filepath.ToSlash(filepath.Join(dir, hit.File))
+		if paths.match(hit.File) {
+			findings = append(findings, hit)
+		}
+	}
+	return findings, nil
+}
+
+// printFindings writes one line per finding: file:line:column, marker, metadata and the matching line
+func printFindings(w io.Writer, findings []Finding) {
+	for _, f := range findings {
+		var meta []string
+		if f.Assignee != "" {
+			meta = append(meta, "@"+f.Assignee)
+		}
+		if f.Priority != "" {
+			meta = append(meta, f.Priority)
+		}
+		if f.Due != "" {
+			meta = append(meta, "due:"+f.Due)
+		}
+		meta = append(meta, f.Issues...)
+
+		marker := aurora.BrightGreen(f.Marker).String()
+		if f.ID != "" {
+			marker += " " + aurora.Gray(12, f.ID).String()
+		}
+		if len(meta) > 0 {
+			marker += " " + aurora.Yellow("["+strings.Join(meta, " ")+"]").String()
+		}
+		if f.Commit != "" {
+			marker += " " + aurora.Cyan(fmt.Sprintf("(%s <%s> %.7s %s)", f.Author, f.Email, f.Commit, f.Age)).String()
+		}
+		if f.Introduced != nil {
+			marker += " " + aurora.Magenta(fmt.Sprintf("(introduced %.7s by %s on %s)", f.Introduced.Commit, f.Introduced.Author, f.Introduced.Date.Format("2006-01-02"))).String()
+		}
+
+		fmt.Fprintf(w, "%s:%d:%d\t%s\t%s\n", aurora.Blue(f.File), f.Line, f.Column, marker, f.Text)
+
+		// surrounding lines, numbered
+		for i, line := range f.Before {
+			fmt.Fprintf(w, "\t%s\n", aurora.Gray(12, fmt.Sprintf("%5d| %s", f.Line-len(f.Before)+i, line)))
+		}
+		if len(f.Before) > 0 || len(f.After) > 0 {
+			fmt.Fprintf(w, "\t%5d> %s\n", f.Line, f.Text)
+		}
+		for i, line := range f.After {
+			fmt.Fprintf(w, "\t%s\n", aurora.Gray(12, fmt.Sprintf("%5d| %s", f.Line+1+i, line)))
+		}
+	}
+}
+
+// printResolved writes one line per finding that disappeared since the previous sync
+func printResolved(w io.Writer, findings []Finding) {
+	for _, f := range findings {
+		marker := aurora.BrightRed("resolved " + f.Marker).String()
+		if by := f.ResolvedBy; by != nil {
+			marker += " " + aurora.Cyan(fmt.Sprintf("(by %s <%s> %.7s)", by.Author, by.Email, by.Commit)).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", aurora.Gray(12, fmt.Sprintf("%s:%d:%d", f.File, f.Line, f.Column)), marker, aurora.Gray(12, f.Text))
+	}
+}
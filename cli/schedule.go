@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// scheduleCheck is the longest the daemon sleeps between checks of the schedules, so that registry changes are
+// picked up
+const scheduleCheck = time.Minute
+
+// parseSchedule parses the cron expression of a registry record: five fields (minute, hour, day of month, month
+// and day of week) or a descriptor such as @daily, in local time unless prefixed with CRON_TZ=
+func parseSchedule(expr string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", expr, err)
+	}
+	return schedule, nil
+}
+
+// syncScheduler tells the daemon which registry records are due: those with a schedule at its next time, and the
+// others together every interval
+type syncScheduler struct {
+	interval time.Duration
+	// unscheduled is when the records without a schedule are due next
+	unscheduled time.Time
+	// next is when the records with a schedule are due next, by record key and schedule
+	next map[string]time.Time
+	// invalid holds the schedules that failed to parse, by record key and schedule, so that they are logged once
+	invalid map[string]bool
+}
+
+func newSyncScheduler(interval time.Duration) *syncScheduler {
+	return &syncScheduler{interval: interval, next: map[string]time.Time{}, invalid: map[string]bool{}}
+}
+
+// due returns the keys of the records due at now, and schedules their next sync. Records without a schedule are
+// due right away the first time, those with a schedule at its next time, so that restarting the daemon does not
+// sync them all. Invalid schedules are logged and fall back to the interval.
+func (s *syncScheduler) due(records []RegistryRecord, now time.Time) map[string]bool {
+	due := map[string]bool{}
+	unscheduled := !now.Before(s.unscheduled)
+	if unscheduled {
+		s.unscheduled = now.Add(s.interval)
+	}
+
+	seen := map[string]bool{}
+	for _, record := range records {
+		if record.Disabled {
+			continue
+		}
+		key := recordKey(record)
+
+		// a changed schedule replaces the previous one
+		slot := key + " " + record.Schedule
+
+		var schedule cron.Schedule
+		if record.Schedule != "" {
+			var err error
+			if schedule, err = parseSchedule(record.Schedule); err != nil && !s.invalid[slot] {
+				s.invalid[slot] = true
+				log.Warn().Err(err).Str("uri", describeRecord(record)).Msg("Syncing every --interval instead")
+			}
+		}
+		if schedule == nil {
+			if unscheduled {
+				due[key] = true
+			}
+			continue
+		}
+
+		seen[slot] = true
+		next, ok := s.next[slot]
+		if !ok {
+			s.next[slot] = schedule.Next(now)
+			continue
+		}
+		if !now.Before(next) {
+			due[key] = true
+			s.next[slot] = schedule.Next(now)
+		}
+	}
+
+	for slot := range s.next {
+		if !seen[slot] {
+			delete(s.next, slot)
+		}
+	}
+	return due
+}
+
+// wake returns when to check the schedules next: when the next records are due, within scheduleCheck
+func (s *syncScheduler) wake(now time.Time) time.Time {
+	wake := now.Add(scheduleCheck)
+	if s.unscheduled.Before(wake) {
+		wake = s.unscheduled
+	}
+	for _, next := range s.next {
+		if next.Before(wake) {
+			wake = next
+		}
+	}
+	return wake
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SearchMatch is a stored marker matching a search with its relevance score
+type SearchMatch struct {
+	Score float64 `json:"score"`
+	*StoredMarker
+}
+
+// searchTokens splits text into lowercase words
+func searchTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchField is a text of a marker searched and the weight of its words
+type searchField struct {
+	weight float64
+	text   string
+}
+
+// searchFields returns the texts of a marker searched: its line and description count more than the surrounding
+// lines and the file path
+func searchFields(m *StoredMarker) []searchField {
+	return []searchField{
+		{3, m.Text + " " + m.Description},
+		{1, strings.Join(m.Before, " ") + " " + strings.Join(m.After, " ")},
+		{0.5, m.File + " " + m.Marker},
+	}
+}
+
+// search ranks the markers by relevance to the text: each word of the text scores its weighted number of
+// occurrences in a marker, scaled by how rare the word is across markers, and markers containing the whole
+// text score double. Markers matching none of the words are left out.
+func search(markers []*StoredMarker, text string) []SearchMatch {
+	terms := searchTokens(text)
+	if len(terms) == 0 {
+		return nil
+	}
+	phrase := strings.Join(terms, " ")
+
+	// term frequencies by marker, weighted by field
+	frequencies := make([]map[string]float64, len(markers))
+	documents := map[string]int{}
+	for i, m := range markers {
+		frequencies[i] = map[string]float64{}
+		for _, field := range searchFields(m) {
+			for _, token := range searchTokens(field.text) {
+				frequencies[i][token] += field.weight
+			}
+		}
+		for _, term := range terms {
+			if frequencies[i][term] > 0 {
+				documents[term]++
+			}
+		}
+	}
+
+	var matches []SearchMatch
+	for i, m := range markers {
+		score := 0.0
+		for _, term := range terms {
+			if tf := frequencies[i][term]; tf > 0 {
+				idf := math.Log(1 + float64(len(markers))/float64(documents[term]))
+				score += (1 + math.Log(tf)) * idf
+			}
+		}
+		if score == 0 {
+			continue
+		}
+		if strings.Contains(strings.Join(searchTokens(m.Text+" "+m.Description), " "), phrase) {
+			score *= 2
+		}
+		matches = append(matches, SearchMatch{Score: math.Round(score*1000) / 1000, StoredMarker: m})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches
+}
+
+// runSearch prints the stored markers matching q ranked by relevance to text, at most limit of them
+func runSearch(text string, q MarkerQuery, limit int, format string) {
+	if format != "table" && format != "json" && format != "porcelain" {
+		log.Fatal().Str("format", format).Msg("Invalid --format, expected table, json or porcelain")
+	}
+
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load marker store")
+	}
+
+	candidates, err := store.query(q, time.Now())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid query")
+	}
+
+	matches := search(candidates, text)
+	if limit > 0 {
+		matches = matches[:min(limit, len(matches))]
+	}
+
+	if format == "json" {
+		if matches == nil {
+			matches = []SearchMatch{}
+		}
+		PrintStruct(os.Stdout, matches)
+		return
+	}
+
+	markers := make([]*StoredMarker, len(matches))
+	for i, match := range matches {
+		markers[i] = match.StoredMarker
+	}
+	printStoredMarkers(os.Stdout, markers, format)
+}
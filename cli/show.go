@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// MarkerTimeline is a stored marker with its timeline, from the commit that introduced it
+type MarkerTimeline struct {
+	*StoredMarker
+	Timeline []MarkerEvent `json:"timeline"`
+}
+
+// timeline returns the events of the marker, preceded by its introduction when known, oldest first
+func (m *StoredMarker) timeline() []MarkerEvent {
+	var events []MarkerEvent
+	if intro := m.Introduced; intro != nil {
+		events = append(events, MarkerEvent{
+			Time:     intro.Date,
+			Kind:     "introduced",
+			Revision: intro.Commit,
+			File:     intro.File,
+			Author:   intro.Author,
+		})
+	}
+	events = append(events, m.Events...)
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
+
+// openStoredRepo opens the repository of a stored marker: the local checkout, or the clone of its registry
+// entry. It also returns the directory that was scanned, relative to the repository root.
+func openStoredRepo(m *StoredMarker) (*git.Repository, string, error) {
+	if filepath.IsAbs(m.Repo) {
+		repo, err := git.PlainOpenWithOptions(m.Repo, &git.PlainOpenOptions{DetectDotGit: true})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		dir := ""
+		if worktree, err := repo.Worktree(); err == nil {
+			if rel, err := filepath.Rel(worktree.Filesystem.Root(), m.Repo); err == nil && rel != "." {
+				dir = filepath.ToSlash(rel)
+			}
+		}
+		return repo, dir, nil
+	}
+
+	records, err := loadRegistry()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, record := range *records {
+		if sameURI(record.URI, m.Repo) && record.Branch == m.Branch {
+			repo, err := cloneRepo(&record)
+			return repo, "", err
+		}
+	}
+
+	return nil, "", fmt.Errorf("repository is not in the registry")
+}
+
+// introduce looks up the commit that introduced the marker, walking history back from the revision
+// it was last seen at
+func (m *StoredMarker) introduce() error {
+	if m.Revision == "" {
+		return fmt.Errorf("marker was not found in a commit")
+	}
+
+	repo, dir, err := openStoredRepo(m)
+	if err != nil {
+		return err
+	}
+
+	commit, err := repo.CommitObject(plumbing.NewHash(m.Revision))
+	if err != nil {
+		return fmt.Errorf("failed to get commit %s: %w", m.Revision, err)
+	}
+
+	intro, err := newLineHistory().introducingCommit(commit, path.Join(dir, m.File), m.Text)
+	if err != nil {
+		return fmt.Errorf("failed to find introducing commit: %w", err)
+	}
+
+	m.Introduced = intro
+	return nil
+}
+
+// runShow prints the timeline of the stored markers designated by args, see lookup, in text or json
+func runShow(args []string, branch, format string) {
+	if format != "text" && format != "json" {
+		log.Fatal().Str("format", format).Msg("Invalid --format, expected text or json")
+	}
+
+	store, err := openStore(storeFilePath())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load marker store")
+	}
+
+	found, err := store.lookup(args, branch, true)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid marker")
+	}
+	if len(found) == 0 {
+		log.Fatal().Strs("marker", args).Msg("No stored marker found, scan or sync the repository first")
+	}
+
+	// the introducing commit is kept once found
+	introduced := false
+	for _, m := range found {
+		if m.Introduced != nil {
+			continue
+		}
+		if err := m.introduce(); err != nil {
+			log.Debug().Err(err).Str("repo", m.Repo).Str("file", m.File).Msg("Failed to reconstruct the introduction of the marker")
+			continue
+		}
+		introduced = true
+	}
+	if introduced {
+		if err := store.save(); err != nil {
+			log.Err(err).Msg("Failed to save marker store")
+		}
+	}
+
+	timelines := make([]MarkerTimeline, len(found))
+	for i, m := range found {
+		timelines[i] = MarkerTimeline{StoredMarker: m, Timeline: m.timeline()}
+	}
+
+	if format == "json" {
+		PrintStruct(os.Stdout, timelines)
+		return
+	}
+	for _, t := range timelines {
+		printTimeline(os.Stdout, t)
+	}
+}
+
+// printTimeline writes a marker followed by a line per event of its timeline
+func printTimeline(w io.Writer, t MarkerTimeline) {
+	m := t.StoredMarker
+	repo := ScanResult{Repo: m.Repo, Branch: m.Branch}.title()
+	fmt.Fprintf(w, "%s %s %s:%d\t%s\t%s\t%s\n", aurora.Gray(12, m.ID), aurora.Gray(12, repo), aurora.Blue(m.File), m.Line, aurora.BrightGreen(m.Marker), aurora.BrightYellow(m.State), m.Text)
+	for _, t := range m.Tickets {
+		fmt.Fprintf(w, "\t%s %s %s %s\n", aurora.Cyan(t.Tracker), t.Key, aurora.BrightYellow(t.State), aurora.Gray(12, t.URL))
+	}
+
+	for _, e := range t.Timeline {
+		var detail string
+		switch e.Kind {
+		case "introduced":
+			detail = fmt.Sprintf("in %s by %s", e.File, e.Author)
+		case "opened":
+			detail = fmt.Sprintf("first seen at %s:%d", e.File, e.Line)
+		case "moved":
+			detail = fmt.Sprintf("to %s:%d", e.File, e.Line)
+		case "changed":
+			detail = fmt.Sprintf("to %s", e.Text)
+		case "resolved":
+			if e.Author != "" {
+				detail = "by " + e.Author
+			}
+		case "ignored":
+			detail = e.Note
+		}
+		fmt.Fprintf(w, "\t%s  %-10s %.7s\t%s\n", e.Time.Local().Format("2006-01-02 15:04"), aurora.Cyan(e.Kind), e.Revision, detail)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// slackConfig is the slack section of the config, nil when sync digests are not posted to Slack
+var slackConfig *SlackConfig
+
+// slackPostMessage is the Web API method posting a message with a bot token
+const slackPostMessage = "https://slack.com/api/chat.postMessage"
+
+// SlackConfig posts a digest of each sync to Slack, with an incoming webhook or a bot token
+type SlackConfig struct {
+	// WebhookURL is an incoming webhook, SLACK_WEBHOOK_URL when empty
+	WebhookURL string `yaml:"webhook_url"`
+	// Token is a bot token with the chat:write scope, SLACK_BOT_TOKEN when empty, used to post to Channel
+	Token   string `yaml:"token"`
+	Channel string `yaml:"channel"`
+	// Routes send the repositories with one of their labels, or the markers with one of their owners, elsewhere,
+	// the first matching route wins
+	Routes []SlackRoute `yaml:"routes"`
+	// Limit caps the markers listed per section of a repository, 10 by default
+	Limit int `yaml:"limit"`
+}
+
+// SlackRoute is a channel, or a webhook, for the repositories with one of the labels and the markers of files with
+// one of the CODEOWNERS owners, e.g. @org/team
+type SlackRoute struct {
+	Labels     []string `yaml:"labels"`
+	Owners     []string `yaml:"owners"`
+	Channel    string   `yaml:"channel"`
+	WebhookURL string   `yaml:"webhook_url"`
+}
+
+// slackDestination is where a digest is posted: a webhook, or else a channel
+type slackDestination struct {
+	webhook string
+	channel string
+}
+
+type slackNotifier struct {
+	c     SlackConfig
+	token string
+}
+
+func newSlackNotifier(c SlackConfig) *slackNotifier {
+	n := &slackNotifier{c: c, token: c.Token}
+	if n.c.WebhookURL == "" {
+		n.c.WebhookURL = os.Getenv("SLACK_WEBHOOK_URL")
+	}
+	if n.token == "" {
+		n.token = os.Getenv("SLACK_BOT_TOKEN")
+	}
+	if n.c.Limit <= 0 {
+		n.c.Limit = 10
+	}
+	return n
+}
+
+func (n *slackNotifier) name() string {
+	return "slack"
+}
+
+// destination routes a marker by the labels of its repository and its owners
+func (n *slackNotifier) destination(repo RepoDigest, m *StoredMarker) slackDestination {
+	for _, route := range n.c.Routes {
+		if routed(route.Labels, route.Owners, repo, m) {
+			return slackDestination{webhook: route.WebhookURL, channel: route.Channel}
+		}
+	}
+	return slackDestination{webhook: n.c.WebhookURL, channel: n.c.Channel}
+}
+
+// notify posts a message per destination listing its repositories with new, resolved or overdue markers
+func (n *slackNotifier) notify(d SyncDigest) error {
+	var order []slackDestination
+	repos := map[slackDestination][]RepoDigest{}
+	for _, repo := range d.Repos {
+		if repo.empty() {
+			continue
+		}
+		dests, parts := splitDigest(repo, func(m *StoredMarker) slackDestination { return n.destination(repo, m) })
+		for _, dest := range dests {
+			if _, ok := repos[dest]; !ok {
+				order = append(order, dest)
+			}
+			repos[dest] = append(repos[dest], parts[dest])
+		}
+	}
+
+	var errs []string
+	for _, dest := range order {
+		if err := n.post(dest, slackDigest(repos[dest], n.c.Limit)); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to post to slack: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// post sends a message to a webhook, or to a channel with the bot token
+func (n *slackNotifier) post(dest slackDestination, text string) error {
+	if dest.webhook != "" {
+		return callJSON("slack", http.MethodPost, dest.webhook, nil, map[string]any{"text": text, "unfurl_links": false}, nil)
+	}
+	if dest.channel == "" || n.token == "" {
+		return fmt.Errorf("no webhook, nor channel and bot token to post to")
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+n.token)
+	var resp struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	in := map[string]any{"channel": dest.channel, "text": text, "unfurl_links": false}
+	if err := callJSON("slack", http.MethodPost, slackPostMessage, header, in, &resp); err != nil {
+		return err
+	}
+	if !resp.OK {
+		return fmt.Errorf("slack chat.postMessage to %s: %s", dest.channel, resp.Error)
+	}
+	return nil
+}
+
+// alert posts the markers of an alert to their destinations
+func (n *slackNotifier) alert(a Alert) error {
+	dests, parts := splitAlert(a, n.destination)
+	var errs []string
+	for _, dest := range dests {
+		if err := n.post(dest, slackAlert(parts[dest], n.c.Limit)); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to post to slack: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// slackEscaper escapes the control characters of Slack mrkdwn
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackDigest formats the digest of repositories in Slack mrkdwn, listing at most limit markers per section
+func slackDigest(repos []RepoDigest, limit int) string {
+	d := SyncDigest{Repos: repos}
+	opened, resolved, overdue := d.counts()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*tr4ck sync*: %d new, %d resolved, %d overdue markers\n", opened, resolved, overdue)
+
+	line := func(emoji string, m *StoredMarker, detail string) {
+		location := slackEscaper.Replace(fmt.Sprintf("%s:%d", m.File, m.Line))
+		if url := markerURL(m); url != "" {
+			location = "<" + url + "|" + location + ">"
+		}
+		fmt.Fprintf(&b, "%s %s %s%s\n", emoji, location, slackEscaper.Replace(m.Text), detail)
+	}
+	more := func(markers []*StoredMarker, kind string) {
+		if len(markers) > limit {
+			fmt.Fprintf(&b, "… and %d more %s markers\n", len(markers)-limit, kind)
+		}
+	}
+
+	for _, repo := range repos {
+		fmt.Fprintf(&b, "\n*%s*\n", slackEscaper.Replace(ScanResult{Repo: repo.Repo, Branch: repo.Branch}.title()))
+
+		if repo.Initial && len(repo.Opened) > 0 {
+			fmt.Fprintf(&b, ":new: first sync, %d markers\n", len(repo.Opened))
+		} else {
+			for _, m := range repo.Opened[:min(limit, len(repo.Opened))] {
+				line(":new:", m, "")
+			}
+			more(repo.Opened, "new")
+		}
+
+		for _, m := range repo.Resolved[:min(limit, len(repo.Resolved))] {
+			detail := ""
+			if by := m.ResolvedBy; by != nil {
+				detail = " — resolved by " + slackEscaper.Replace(by.Author)
+			}
+			line(":white_check_mark:", m, detail)
+		}
+		more(repo.Resolved, "resolved")
+
+		for _, m := range repo.Overdue[:min(limit, len(repo.Overdue))] {
+			line(":alarm_clock:", m, " — due "+slackEscaper.Replace(m.Due))
+		}
+		more(repo.Overdue, "overdue")
+	}
+	return b.String()
+}
+
+// slackAlert formats an alert in Slack mrkdwn, listing at most limit markers
+func slackAlert(a Alert, limit int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, ":rotating_light: *tr4ck alert* %s\n", slackEscaper.Replace(a.summary()))
+	for _, m := range a.Markers[:min(limit, len(a.Markers))] {
+		location := slackEscaper.Replace(fmt.Sprintf("%s:%d", m.File, m.Line))
+		if url := markerURL(m); url != "" {
+			location = "<" + url + "|" + location + ">"
+		}
+		fmt.Fprintf(&b, "• %s %s — %s\n", location, slackEscaper.Replace(m.Text), slackEscaper.Replace(a.detail(m)))
+	}
+	if len(a.Markers) > limit {
+		fmt.Fprintf(&b, "… and %d more markers\n", len(a.Markers)-limit)
+	}
+	return b.String()
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// revisionPrefix matches an abbreviated or full commit hash
+var revisionPrefix = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+
+// MarkerSnapshot is the markers of a repository branch at a synced commit, so that queries can look back
+// at any synced commit without cloning and scanning it again
+type MarkerSnapshot struct {
+	// Repo is the canonical URI of the repository
+	Repo     string `json:"repo"`
+	Branch   string `json:"branch,omitempty"`
+	Revision string `json:"revision"`
+	// Date is the commit date, Time when the commit was synced
+	Date    time.Time        `json:"date"`
+	Time    time.Time        `json:"time"`
+	Markers []SnapshotMarker `json:"markers"`
+}
+
+// SnapshotMarker is a stored marker as it was at a snapshot
+type SnapshotMarker struct {
+	ID     string `json:"id"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Marker string `json:"marker"`
+	Text   string `json:"text"`
+}
+
+// snapshot records the findings of a repository branch at a synced revision, replacing an earlier snapshot
+// of the same revision. Findings must have been observed first, so that they match stored markers.
+func (s *Store) snapshot(repo, branch, revision string, date, now time.Time, findings []Finding) {
+	repo = canonicalURI(repo)
+
+	current := make([]Finding, len(findings))
+	copy(current, findings)
+	s.identify(repo, branch, current)
+
+	snapshot := &MarkerSnapshot{Repo: repo, Branch: branch, Revision: revision, Date: date.UTC(), Time: now, Markers: []SnapshotMarker{}}
+	for _, f := range current {
+		snapshot.Markers = append(snapshot.Markers, SnapshotMarker{ID: f.ID, File: f.File, Line: f.Line, Marker: f.Marker, Text: f.Text})
+	}
+
+	for i, existing := range s.snapshots {
+		if existing.Repo == repo && existing.Branch == branch && existing.Revision == revision {
+			s.snapshots[i] = snapshot
+			return
+		}
+	}
+	s.snapshots = append(s.snapshots, snapshot)
+}
+
+// writeSnapshot adds a snapshot to the database, replacing an earlier one of the same revision
+func writeSnapshot(db dbExecer, snapshot *MarkerSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	_, err = db.Exec("INSERT OR REPLACE INTO snapshots (repo, branch, revision, date, time, data) VALUES (?, ?, ?, ?, ?, ?)",
+		snapshot.Repo, snapshot.Branch, snapshot.Revision, snapshot.Date.UnixNano(), snapshot.Time.UnixNano(), data)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot of %s: %w", snapshot.Revision, err)
+	}
+	return nil
+}
+
+// loadSnapshots returns the saved snapshots matching a condition on the columns of the snapshots table, all of
+// them when empty, oldest first
+func (s *Store) loadSnapshots(where string, args ...any) ([]*MarkerSnapshot, error) {
+	query := "SELECT data FROM snapshots"
+	if where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := s.db.Query(query+" ORDER BY time", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []*MarkerSnapshot
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read snapshots: %w", err)
+		}
+		snapshot := &MarkerSnapshot{}
+		if err := json.Unmarshal(data, snapshot); err != nil {
+			return nil, fmt.Errorf("failed to parse snapshot: %w", err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read snapshots: %w", err)
+	}
+	return snapshots, nil
+}
+
+// snapshotsAt returns the snapshots at a commit, given by its hash or a prefix of it, or else at a date,
+// 2006-01-02 for the end of that day or RFC 3339: the last commit synced of each repository branch at that date
+func (s *Store) snapshotsAt(at string) ([]*MarkerSnapshot, error) {
+	date, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		if day, dayErr := time.ParseInLocation("2006-01-02", at, time.Local); dayErr == nil {
+			date, err = day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+		}
+	}
+	if err != nil {
+		if !revisionPrefix.MatchString(at) {
+			return nil, fmt.Errorf("unsupported point in time %s, expected a commit, a date like 2006-01-02 or an RFC 3339 time", at)
+		}
+		found, err := s.loadSnapshots("revision LIKE ?", at+"%")
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("no snapshot of commit %s, only synced commits are kept", at)
+		}
+		return found, nil
+	}
+
+	// the latest commit of each repository branch by that date
+	latest, err := s.loadSnapshots(`date = (SELECT max(date) FROM snapshots AS previous
+		WHERE previous.repo = snapshots.repo AND previous.branch = snapshots.branch AND previous.date <= ?)`, date.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+
+	var found []*MarkerSnapshot
+	seen := map[string]bool{}
+	for _, snapshot := range latest {
+		key := snapshot.Repo + "\x00" + snapshot.Branch
+		if !seen[key] {
+			seen[key] = true
+			found = append(found, snapshot)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Repo+"\x00"+found[i].Branch < found[j].Repo+"\x00"+found[j].Branch
+	})
+	return found, nil
+}
+
+// markersAt returns the stored markers as they were at the snapshots: with the location and text of the
+// snapshot, seen at its commit and open unless they were already ignored
+func (s *Store) markersAt(snapshots []*MarkerSnapshot) []*StoredMarker {
+	byID := map[string]*StoredMarker{}
+	for _, m := range s.Markers {
+		byID[m.ID] = m
+	}
+
+	var markers []*StoredMarker
+	for _, snapshot := range snapshots {
+		for _, sm := range snapshot.Markers {
+			m := &StoredMarker{Repo: snapshot.Repo, Branch: snapshot.Branch, FirstSeen: snapshot.Time}
+			if stored, ok := byID[sm.ID]; ok {
+				copied := *stored
+				m = &copied
+			}
+			m.ID, m.File, m.Line, m.Marker, m.Text = sm.ID, sm.File, sm.Line, sm.Marker, sm.Text
+			m.Revision = snapshot.Revision
+			m.LastSeen = snapshot.Time
+			m.ResolvedAt, m.ResolvedRevision = nil, ""
+			m.Events = nil
+
+			m.State = markerOpen
+			if m.IgnoredAt != nil && !m.IgnoredAt.After(snapshot.Time) {
+				m.State = markerIgnored
+			} else {
+				m.IgnoredAt, m.IgnoreReason = nil, ""
+			}
+			markers = append(markers, m)
+		}
+	}
+	return markers
+}
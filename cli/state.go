@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path"
+)
+
+// findingsState keeps the findings of each registry entry at its latest synced commit, by record key,
+// so that sync can tell the markers added since the previous run from the resolved ones
+type findingsState map[string][]Finding
+
+// loadFindingsState reads the findings state from the database, which is empty before the first sync
+func loadFindingsState(db *sql.DB) (findingsState, error) {
+	rows, err := db.Query("SELECT record, data FROM findings")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read findings state: %w", err)
+	}
+	defer rows.Close()
+
+	state := findingsState{}
+	for rows.Next() {
+		var key string
+		var data []byte
+		if err := rows.Scan(&key, &data); err != nil {
+			return nil, fmt.Errorf("failed to read findings state: %w", err)
+		}
+		var findings []Finding
+		if err := json.Unmarshal(data, &findings); err != nil {
+			return nil, fmt.Errorf("failed to parse findings state of %s: %w", key, err)
+		}
+		state[key] = findings
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read findings state: %w", err)
+	}
+
+	return state, nil
+}
+
+// saveRecord writes the findings of a record to the database
+func (s findingsState) saveRecord(db dbExecer, key string) error {
+	data, err := json.Marshal(s[key])
+	if err != nil {
+		return fmt.Errorf("failed to marshal findings state: %w", err)
+	}
+
+	if _, err := db.Exec("INSERT OR REPLACE INTO findings (record, data) VALUES (?, ?)", key, data); err != nil {
+		return fmt.Errorf("failed to write findings state: %w", err)
+	}
+
+	return nil
+}
+
+// update replaces the findings of the changed and removed files of a record with the current findings of those
+// files, and returns the findings that are new and those that were resolved. Findings are reconciled, so markers
+// moved by unrelated edits, in renamed files or with their text edited are neither new nor resolved.
+// A changed path may be a submodule, whose findings are below it.
+func (s findingsState) update(key string, changed, removed []string, current []Finding) (added, resolved []Finding) {
+	touched := make(map[string]bool)
+	for _, file := range append(append([]string{}, changed...), removed...) {
+		touched[file] = true
+	}
+	inTouched := func(file string) bool {
+		for ; file != "." && file != "/"; file = path.Dir(file) {
+			if touched[file] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var kept, previous []Finding
+	for _, f := range s[key] {
+		if inTouched(f.File) {
+			previous = append(previous, f)
+		} else {
+			kept = append(kept, f)
+		}
+	}
+	s[key] = append(kept, current...)
+
+	_, newIndexes, goneIndexes := reconcile(previous, current, true)
+	for _, i := range newIndexes {
+		added = append(added, current[i])
+	}
+	for _, i := range goneIndexes {
+		resolved = append(resolved, previous[i])
+	}
+
+	return added, resolved
+}
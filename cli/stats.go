@@ -0,0 +1,308 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// statsTop is the number of directories and files listed as top offenders
+	statsTop = 10
+)
+
+// Count is the number of findings of a marker, repository, directory or file
+type Count struct {
+	Repo  string `json:"repo,omitempty"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Stats summarizes the registry and the findings of a run
+type Stats struct {
+	Created time.Time `json:"created"`
+	// Records, Disabled and Unsynced count the registry entries
+	Records  int `json:"records"`
+	Disabled int `json:"disabled"`
+	Unsynced int `json:"unsynced"`
+
+	Total    int     `json:"total"`
+	ByMarker []Count `json:"by_marker"`
+	ByRepo   []Count `json:"by_repo"`
+	// ByDir and ByFile are the top offenders
+	ByDir  []Count `json:"by_dir"`
+	ByFile []Count `json:"by_file"`
+
+	// Delta compares the run to the previous one, when the registry was scanned before
+	Delta *StatsDelta `json:"delta,omitempty"`
+}
+
+// StatsDelta is the change in findings since a previous run
+type StatsDelta struct {
+	Since    time.Time `json:"since"`
+	Total    int       `json:"total"`
+	ByMarker []Count   `json:"by_marker"`
+	ByRepo   []Count   `json:"by_repo"`
+}
+
+// runStats scans the given repositories or directories, or every enabled registry entry, and prints their stats.
+// Registry stats are kept to report the changes since the previous run.
+func runStats(uris []string, format string) {
+	if format != "table" && format != "tsv" && format != "json" {
+		log.Fatal().Str("format", format).Msg("Invalid --format")
+	}
+
+	var results []ScanResult
+	scanAll(uris, func(result ScanResult) {
+		results = append(results, result)
+	})
+
+	stats := computeStats(results)
+	if registry, err := loadRegistry(); err == nil {
+		stats.countRegistry(*registry)
+	}
+
+	if len(uris) == 0 {
+		db, err := storeDB()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to open database")
+		}
+		prev, err := loadStats(db)
+		if err == nil {
+			stats.compare(prev)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			log.Warn().Err(err).Msg("Failed to load previous stats")
+		}
+
+		if err := saveStats(db, stats); err != nil {
+			log.Err(err).Msg("Failed to save stats")
+		}
+	}
+
+	if err := printStats(os.Stdout, stats, format); err != nil {
+		log.Fatal().Err(err).Msg("Failed to print stats")
+	}
+}
+
+// computeStats counts the findings of results by marker, repository, directory and file
+func computeStats(results []ScanResult) Stats {
+	stats := Stats{Created: time.Now()}
+
+	markers := map[string]int{}
+	dirs := map[[2]string]int{}
+	files := map[[2]string]int{}
+	for _, result := range results {
+		stats.Total += len(result.Findings)
+		stats.ByRepo = append(stats.ByRepo, Count{Name: result.title(), Count: len(result.Findings)})
+
+		for _, f := range result.Findings {
+			markers[f.Marker]++
+			dirs[[2]string{result.Repo, path.Dir(f.File)}]++
+			files[[2]string{result.Repo, f.File}]++
+		}
+	}
+
+	for marker, n := range markers {
+		stats.ByMarker = append(stats.ByMarker, Count{Name: marker, Count: n})
+	}
+	for key, n := range dirs {
+		stats.ByDir = append(stats.ByDir, Count{Repo: key[0], Name: key[1], Count: n})
+	}
+	for key, n := range files {
+		stats.ByFile = append(stats.ByFile, Count{Repo: key[0], Name: key[1], Count: n})
+	}
+
+	sortCounts(stats.ByMarker)
+	sortCounts(stats.ByRepo)
+	sortCounts(stats.ByDir)
+	sortCounts(stats.ByFile)
+	stats.ByDir = stats.ByDir[:min(statsTop, len(stats.ByDir))]
+	stats.ByFile = stats.ByFile[:min(statsTop, len(stats.ByFile))]
+
+	return stats
+}
+
+// countRegistry counts the registry entries, disabled ones and those never synced
+func (s *Stats) countRegistry(records []RegistryRecord) {
+	for _, record := range records {
+		s.Records++
+		if record.Disabled {
+			s.Disabled++
+		}
+		if record.LastestHash == "" {
+			s.Unsynced++
+		}
+	}
+}
+
+// compare sets the delta of the markers and repositories since prev
+func (s *Stats) compare(prev Stats) {
+	s.Delta = &StatsDelta{
+		Since:    prev.Created,
+		Total:    s.Total - prev.Total,
+		ByMarker: diffCounts(s.ByMarker, prev.ByMarker),
+		ByRepo:   diffCounts(s.ByRepo, prev.ByRepo),
+	}
+}
+
+// diffCounts returns the non-zero changes from prev to cur, by name
+func diffCounts(cur, prev []Count) []Count {
+	delta := map[string]int{}
+	for _, c := range cur {
+		delta[c.Name] += c.Count
+	}
+	for _, c := range prev {
+		delta[c.Name] -= c.Count
+	}
+
+	counts := []Count{}
+	for name, n := range delta {
+		if n != 0 {
+			counts = append(counts, Count{Name: name, Count: n})
+		}
+	}
+	sortCounts(counts)
+	return counts
+}
+
+// sortCounts orders counts by count, largest first, then by name
+func sortCounts(counts []Count) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		if counts[i].Repo != counts[j].Repo {
+			return counts[i].Repo < counts[j].Repo
+		}
+		return counts[i].Name < counts[j].Name
+	})
+}
+
+// loadStats reads the stats of a previous run, sql.ErrNoRows before the first one
+func loadStats(db *sql.DB) (Stats, error) {
+	var stats Stats
+
+	var data []byte
+	if err := db.QueryRow("SELECT data FROM stats WHERE id = 1").Scan(&data); err != nil {
+		return stats, fmt.Errorf("failed to read stats: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return stats, fmt.Errorf("failed to parse stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// saveStats keeps the stats of this run to compute the deltas of the next one
+func saveStats(db dbExecer, stats Stats) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stats: %w", err)
+	}
+
+	if _, err := db.Exec("INSERT OR REPLACE INTO stats (id, data) VALUES (1, ?)", data); err != nil {
+		return fmt.Errorf("failed to write stats: %w", err)
+	}
+
+	return nil
+}
+
+// printStats writes the stats in the given format: table (colored, human-readable), tsv or json
+func printStats(w io.Writer, stats Stats, format string) error {
+	switch format {
+	case "json":
+		PrintStruct(w, stats)
+
+	case "tsv":
+		// kind, repository, name, count and change
+		fmt.Fprintf(w, "registry\t\trecords\t%d\t\n", stats.Records)
+		fmt.Fprintf(w, "registry\t\tdisabled\t%d\t\n", stats.Disabled)
+		fmt.Fprintf(w, "registry\t\tunsynced\t%d\t\n", stats.Unsynced)
+		total := ""
+		if stats.Delta != nil {
+			total = signed(stats.Delta.Total)
+		}
+		fmt.Fprintf(w, "total\t\tfindings\t%d\t%s\n", stats.Total, total)
+		printCountsTSV(w, "marker", stats.ByMarker, deltaOf(stats.Delta, func(d *StatsDelta) []Count { return d.ByMarker }))
+		printCountsTSV(w, "repo", stats.ByRepo, deltaOf(stats.Delta, func(d *StatsDelta) []Count { return d.ByRepo }))
+		printCountsTSV(w, "dir", stats.ByDir, nil)
+		printCountsTSV(w, "file", stats.ByFile, nil)
+
+	case "table", "":
+		fmt.Fprintf(w, "%s %d records, %d disabled, %d never synced\n", aurora.Bold("Registry"), stats.Records, stats.Disabled, stats.Unsynced)
+		fmt.Fprintf(w, "%s %d", aurora.Bold("Findings"), stats.Total)
+		if stats.Delta != nil {
+			fmt.Fprintf(w, " (%s since %s)", signed(stats.Delta.Total), stats.Delta.Since.Format("2006-01-02 15:04"))
+		}
+		fmt.Fprintln(w)
+
+		printCounts(w, "By marker", stats.ByMarker, deltaOf(stats.Delta, func(d *StatsDelta) []Count { return d.ByMarker }))
+		printCounts(w, "By repository", stats.ByRepo, deltaOf(stats.Delta, func(d *StatsDelta) []Count { return d.ByRepo }))
+		printCounts(w, "Top directories", stats.ByDir, nil)
+		printCounts(w, "Top files", stats.ByFile, nil)
+
+	default:
+		return fmt.Errorf("unsupported format %s", format)
+	}
+
+	return nil
+}
+
+// deltaOf returns the changes by name of one dimension of delta, nil without a previous run
+func deltaOf(delta *StatsDelta, dimension func(*StatsDelta) []Count) map[string]int {
+	if delta == nil {
+		return nil
+	}
+	changes := map[string]int{}
+	for _, c := range dimension(delta) {
+		changes[c.Name] = c.Count
+	}
+	return changes
+}
+
+// printCounts writes a titled table of counts, with their change when delta is set
+func printCounts(w io.Writer, title string, counts []Count, delta map[string]int) {
+	fmt.Fprintf(w, "\n%s\n", aurora.Bold(title))
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	for _, c := range counts {
+		name := c.Name
+		if c.Repo != "" {
+			name = c.Repo + " " + name
+		}
+
+		change := ""
+		if n := delta[c.Name]; n != 0 {
+			change = signed(n)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t %s\n", c.Count, change, name)
+	}
+	tw.Flush()
+}
+
+// printCountsTSV writes a tab-separated line per count: kind, repository, name, count and change
+func printCountsTSV(w io.Writer, kind string, counts []Count, delta map[string]int) {
+	for _, c := range counts {
+		change := ""
+		if n := delta[c.Name]; n != 0 {
+			change = signed(n)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", kind, c.Repo, c.Name, c.Count, change)
+	}
+}
+
+// signed formats a change with its sign, e.g. +3 or -1
+func signed(n int) string {
+	return fmt.Sprintf("%+d", n)
+}
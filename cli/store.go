@@ -0,0 +1,603 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// storePath is the database file set in the config, see storeFilePath
+var storePath string
+
+// lifecycle states of stored markers
+const (
+	// markerOpen markers were seen at the latest scan of their repository
+	markerOpen = "open"
+	// markerResolved markers disappeared from their repository
+	markerResolved = "resolved"
+	// markerIgnored markers were set aside with tr4ck ignore and are no longer reported
+	markerIgnored = "ignored"
+)
+
+// Store is the persistent database of every marker seen by scan and sync. Markers are loaded in memory, all of
+// them or those queried, and save only writes back those added, changed or removed.
+type Store struct {
+	Markers []*StoredMarker
+
+	db *sql.DB
+	// saved are the markers as loaded or last saved, by row ID
+	saved map[int64]savedMarker
+	// snapshots are those taken since the store was loaded, written by save
+	snapshots []*MarkerSnapshot
+}
+
+// savedMarker is a marker of the store with its JSON and row version as loaded or last saved
+type savedMarker struct {
+	marker  *StoredMarker
+	data    []byte
+	version int64
+}
+
+// StoredMarker is a marker of a repository branch with the commits and times it was first and last seen at
+type StoredMarker struct {
+	// Repo is the canonical URI of the repository
+	Repo   string `json:"repo"`
+	Branch string `json:"branch,omitempty"`
+	Finding
+	// FirstRevision and Revision are the scanned commits the marker was first and last seen at,
+	// empty for directories that are not repositories
+	FirstRevision string    `json:"first_revision,omitempty"`
+	Revision      string    `json:"revision,omitempty"`
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+
+	// State is open, resolved or ignored
+	State string `json:"state"`
+	// ResolvedAt is when the marker was found missing, at ResolvedRevision
+	ResolvedAt       *time.Time `json:"resolved_at,omitempty"`
+	ResolvedRevision string     `json:"resolved_revision,omitempty"`
+	// IgnoredAt is when the marker was ignored, for IgnoreReason
+	IgnoredAt    *time.Time `json:"ignored_at,omitempty"`
+	IgnoreReason string     `json:"ignore_reason,omitempty"`
+
+	// Events are the changes of the marker seen by scan and sync, oldest first
+	Events []MarkerEvent `json:"events,omitempty"`
+	// Tickets are the issues opened for the marker by sync
+	Tickets []Ticket `json:"tickets,omitempty"`
+	// References are the issues referenced by the marker, with their state as of the last check
+	References []Ticket `json:"references,omitempty"`
+
+	// row is the ID of the database row of the marker, 0 before it is saved
+	row int64
+}
+
+// MarkerEvent is a change of a stored marker: opened, moved, changed, resolved, ignored or unignored, or
+// introduced for the commit reconstructed by show
+type MarkerEvent struct {
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"`
+	// Revision is the scanned commit the change was seen at, or the introducing or resolving commit
+	Revision string `json:"revision,omitempty"`
+	// File, Line and Text are the new location and text of the marker, if they changed
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+	Text string `json:"text,omitempty"`
+	// Author introduced or resolved the marker, Note is why it was ignored
+	Author string `json:"author,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+// loadStore reads the markers of the database at path, which is empty before the first scan
+func loadStore(path string) (*Store, error) {
+	store, err := openStore(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.load(""); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// openStore opens the database at path without reading any marker, see load
+func openStore(path string) (*Store, error) {
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db, saved: map[int64]savedMarker{}}, nil
+}
+
+// load reads the markers matching the SQL condition where, all of them when empty, except those already loaded
+func (s *Store) load(where string, args ...any) error {
+	query := "SELECT id, version, data FROM markers"
+	if where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := s.db.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		return fmt.Errorf("failed to read marker store: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row, version int64
+		var data []byte
+		if err := rows.Scan(&row, &version, &data); err != nil {
+			return fmt.Errorf("failed to read marker store: %w", err)
+		}
+		if _, ok := s.saved[row]; ok {
+			continue
+		}
+		m := &StoredMarker{row: row}
+		if err := json.Unmarshal(data, m); err != nil {
+			return fmt.Errorf("failed to parse marker %d: %w", row, err)
+		}
+		s.saved[row] = savedMarker{m, data, version}
+		s.Markers = append(s.Markers, m)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read marker store: %w", err)
+	}
+
+	return nil
+}
+
+// loadBranch reads the markers of a repository branch, see load
+func (s *Store) loadBranch(repo, branch string) error {
+	return s.load("repo = ? AND branch = ?", canonicalURI(repo), branch)
+}
+
+// save writes the markers added, changed and removed since the store was loaded, and the snapshots taken, in a
+// transaction
+func (s *Store) save() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	saved, err := s.write(tx)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write marker store: %w", err)
+	}
+
+	s.saved, s.snapshots = saved, nil
+	return nil
+}
+
+// write writes the changes of the store in tx, see save, and returns its markers by row ID. Markers without a row
+// of this store, such as those archived from another one, are added. A marker whose row was updated by another
+// process since it was loaded, e.g. by tr4ck ignore during a sync, gets the changes of both, see mergeMarker, and
+// one whose row was removed, e.g. by db prune, is dropped. Rows updated since they were loaded are not removed.
+func (s *Store) write(tx *sql.Tx) (map[int64]savedMarker, error) {
+	saved := make(map[int64]savedMarker, len(s.Markers))
+	for _, m := range s.Markers {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal marker %s: %w", m.ID, err)
+		}
+
+		previous, ok := s.saved[m.row]
+		switch {
+		case !ok || previous.marker != m:
+			result, err := tx.Exec("INSERT INTO markers (repo, branch, marker_id, state, data) VALUES (?, ?, ?, ?, ?)", m.Repo, m.Branch, m.ID, m.State, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to add marker %s: %w", m.ID, err)
+			}
+			if m.row, err = result.LastInsertId(); err != nil {
+				return nil, fmt.Errorf("failed to add marker %s: %w", m.ID, err)
+			}
+			saved[m.row] = savedMarker{m, data, 0}
+		case !bytes.Equal(previous.data, data):
+			version, written, err := updateMarker(tx, m, previous, data)
+			if err != nil {
+				return nil, err
+			}
+			if written != nil {
+				saved[m.row] = savedMarker{m, written, version}
+			}
+		default:
+			saved[m.row] = previous
+		}
+	}
+
+	for row, previous := range s.saved {
+		if _, ok := saved[row]; ok {
+			continue
+		}
+		result, err := tx.Exec("DELETE FROM markers WHERE id = ? AND version = ?", row, previous.version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove marker: %w", err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			log.Warn().Str("id", previous.marker.ID).Msg("Marker changed since it was loaded, not removed")
+		}
+	}
+
+	for _, snapshot := range s.snapshots {
+		if err := writeSnapshot(tx, snapshot); err != nil {
+			return nil, err
+		}
+	}
+
+	return saved, nil
+}
+
+// updateMarker writes the changed marker m, as previous when loaded, in tx, and returns the version and JSON of its
+// row, nil when the row was removed since
+func updateMarker(tx *sql.Tx, m *StoredMarker, previous savedMarker, data []byte) (int64, []byte, error) {
+	version := previous.version
+	for {
+		result, err := tx.Exec("UPDATE markers SET repo = ?, branch = ?, marker_id = ?, state = ?, data = ?, version = ? WHERE id = ? AND version = ?",
+			m.Repo, m.Branch, m.ID, m.State, data, version+1, m.row, version)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to update marker %s: %w", m.ID, err)
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return 0, nil, fmt.Errorf("failed to update marker %s: %w", m.ID, err)
+		} else if n == 1 {
+			return version + 1, data, nil
+		}
+
+		// the row changed since it was loaded, the writes are serialized so it does not change again in tx
+		var current []byte
+		err = tx.QueryRow("SELECT version, data FROM markers WHERE id = ?", m.row).Scan(&version, &current)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Debug().Str("id", m.ID).Msg("Marker removed since it was loaded")
+			return 0, nil, nil
+		}
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to read marker %s: %w", m.ID, err)
+		}
+		if data, err = mergeMarker(previous.data, current, data); err != nil {
+			return 0, nil, fmt.Errorf("failed to merge marker %s: %w", m.ID, err)
+		}
+		merged := &StoredMarker{row: m.row}
+		if err := json.Unmarshal(data, merged); err != nil {
+			return 0, nil, fmt.Errorf("failed to merge marker %s: %w", m.ID, err)
+		}
+		*m = *merged
+		if data, err = json.Marshal(m); err != nil {
+			return 0, nil, fmt.Errorf("failed to marshal marker %s: %w", m.ID, err)
+		}
+	}
+}
+
+// mergeMarker merges the JSON of a marker changed concurrently from base, as theirs and ours: the fields ours left
+// as in base take their value, others keep ours, and the events both added are kept, theirs first
+func mergeMarker(base, theirs, ours []byte) ([]byte, error) {
+	var b, t, o map[string]json.RawMessage
+	for _, doc := range []struct {
+		data []byte
+		into *map[string]json.RawMessage
+	}{{base, &b}, {theirs, &t}, {ours, &o}} {
+		if err := json.Unmarshal(doc.data, doc.into); err != nil {
+			return nil, err
+		}
+	}
+
+	var baseEvents, theirEvents, ourEvents []json.RawMessage
+	for _, events := range []struct {
+		data json.RawMessage
+		into *[]json.RawMessage
+	}{{b["events"], &baseEvents}, {t["events"], &theirEvents}, {o["events"], &ourEvents}} {
+		if events.data == nil {
+			continue
+		}
+		if err := json.Unmarshal(events.data, events.into); err != nil {
+			return nil, err
+		}
+	}
+
+	// theirs is merged into
+	merged := t
+	for key := range mergeKeys(b, o) {
+		if bytes.Equal(b[key], o[key]) {
+			continue
+		}
+		if _, ok := o[key]; ok {
+			merged[key] = o[key]
+		} else {
+			delete(merged, key)
+		}
+	}
+
+	if len(ourEvents) > len(baseEvents) {
+		events, err := json.Marshal(append(theirEvents, ourEvents[len(baseEvents):]...))
+		if err != nil {
+			return nil, err
+		}
+		merged["events"] = events
+	}
+
+	return json.Marshal(merged)
+}
+
+// mergeKeys returns the keys of both documents
+func mergeKeys(a, b map[string]json.RawMessage) map[string]struct{} {
+	keys := make(map[string]struct{}, len(a)+len(b))
+	for key := range a {
+		keys[key] = struct{}{}
+	}
+	for key := range b {
+		keys[key] = struct{}{}
+	}
+	return keys
+}
+
+// observe records the findings of a repository branch at revision. Findings are reconciled with the open and
+// ignored markers, so that a marker keeps its identity when its line moves, its file is renamed or its text is
+// edited: matches get their location, text, revision and last seen time updated, keeping the blame attribution
+// of earlier scans while their text is unchanged. Other findings are added as open markers. When findings are
+// complete, i.e. all the markers of the branch, the markers left unmatched are resolved. Otherwise findings are only
+// matched by file and text, since the scan may have missed where a marker went.
+// It returns the markers opened and resolved.
+func (s *Store) observe(repo, branch, revision string, findings []Finding, now time.Time, complete bool) (opened, resolved []*StoredMarker) {
+	repo = canonicalURI(repo)
+
+	var known []*StoredMarker
+	var previous []Finding
+	used := s.usedIDs(repo, branch)
+	for _, m := range s.Markers {
+		if m.Repo == repo && m.Branch == branch && m.State != markerResolved {
+			known = append(known, m)
+			previous = append(previous, m.Finding)
+		}
+	}
+
+	// the relative age is computed at scan time, Date is kept instead
+	current := make([]Finding, len(findings))
+	for i, f := range findings {
+		f.Age = ""
+		current[i] = f
+	}
+
+	matches, added, gone := reconcile(previous, current, complete)
+	for _, match := range matches {
+		m, f := known[match.prev], current[match.cur]
+
+		if f.Text == m.Text {
+			if f.Commit == "" {
+				f.Author, f.Email, f.Commit, f.Date = m.Author, m.Email, m.Commit, m.Date
+			}
+		} else {
+			m.record(MarkerEvent{Kind: "changed", Revision: revision, Text: f.Text}, now)
+		}
+		if f.File != m.File || f.Line != m.Line {
+			m.record(MarkerEvent{Kind: "moved", Revision: revision, File: f.File, Line: f.Line}, now)
+		}
+		if f.Introduced == nil {
+			f.Introduced = m.Introduced
+		}
+		f.ID = m.ID
+		m.Finding = f
+		m.Revision = revision
+		m.LastSeen = now
+	}
+
+	for _, i := range added {
+		f := current[i]
+		f.ID = newID(repo, f, used)
+		m := &StoredMarker{
+			Repo:          repo,
+			Branch:        branch,
+			Finding:       f,
+			FirstRevision: revision,
+			Revision:      revision,
+			FirstSeen:     now,
+			LastSeen:      now,
+			State:         markerOpen,
+		}
+		m.record(MarkerEvent{Kind: "opened", Revision: revision, File: f.File, Line: f.Line, Text: f.Text}, now)
+		s.Markers = append(s.Markers, m)
+		opened = append(opened, m)
+	}
+
+	if !complete {
+		return opened, nil
+	}
+
+	for _, i := range gone {
+		m := known[i]
+		resolvedAt := now
+		m.State = markerResolved
+		m.ResolvedAt = &resolvedAt
+		m.ResolvedRevision = revision
+		m.record(MarkerEvent{Kind: "resolved", Revision: revision}, now)
+		resolved = append(resolved, m)
+	}
+
+	return opened, resolved
+}
+
+// attributeResolution adds the commit and author of ResolvedBy to the resolved event of the marker
+func (m *StoredMarker) attributeResolution() {
+	if m.ResolvedBy == nil {
+		return
+	}
+	for i := len(m.Events) - 1; i >= 0; i-- {
+		if e := &m.Events[i]; e.Kind == "resolved" {
+			e.Revision, e.Author = m.ResolvedBy.Commit, m.ResolvedBy.Author
+			return
+		}
+	}
+}
+
+// record appends an event to the timeline of the marker
+func (m *StoredMarker) record(event MarkerEvent, now time.Time) {
+	event.Time = now
+	m.Events = append(m.Events, event)
+}
+
+// dropIgnored returns the findings of a repository branch that do not match an ignored marker
+func (s *Store) dropIgnored(repo, branch string, findings []Finding) []Finding {
+	repo = canonicalURI(repo)
+
+	ignored := map[BaselineEntry]int{}
+	for _, m := range s.Markers {
+		if m.Repo == repo && m.Branch == branch && m.State == markerIgnored {
+			ignored[baselineEntry(m.Finding)]++
+		}
+	}
+	if len(ignored) == 0 {
+		return findings
+	}
+
+	var kept []Finding
+	for _, f := range findings {
+		entry := baselineEntry(f)
+		if ignored[entry] > 0 {
+			ignored[entry]--
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// findMarkers returns the open and ignored markers of a repository at a file and line, and the resolved ones
+// with withResolved, on any branch unless one is given
+func (s *Store) findMarkers(repo, branch, file string, line int, withResolved bool) []*StoredMarker {
+	repo = canonicalURI(repo)
+
+	var found []*StoredMarker
+	for _, m := range s.Markers {
+		if m.Repo == repo && (branch == "" || m.Branch == branch) && m.File == file && m.Line == line && (withResolved || m.State != markerResolved) {
+			found = append(found, m)
+		}
+	}
+	return found
+}
+
+// ignore sets a marker aside so that it is no longer reported
+func (m *StoredMarker) ignore(reason string, now time.Time) {
+	m.State = markerIgnored
+	m.IgnoredAt = &now
+	m.IgnoreReason = reason
+	m.record(MarkerEvent{Kind: "ignored", Note: reason}, now)
+}
+
+// unignore reports an ignored marker again
+func (m *StoredMarker) unignore(now time.Time) {
+	if m.State != markerIgnored {
+		return
+	}
+	m.State = markerOpen
+	m.IgnoredAt = nil
+	m.IgnoreReason = ""
+	m.record(MarkerEvent{Kind: "unignored"}, now)
+}
+
+// storeFindings records the findings of a scan in the marker store and returns them without the ignored markers.
+// Scans may be limited to some files or commits, so they never resolve markers. Errors are logged, the store is
+// an addition to the scan.
+func storeFindings(result ScanResult) []Finding {
+	store, err := openStore(storeFilePath())
+	if err == nil {
+		err = store.loadBranch(result.Repo, result.Branch)
+	}
+	if err != nil {
+		log.Err(err).Msg("Failed to load marker store")
+		store = &Store{}
+	} else {
+		store.observe(result.Repo, result.Branch, result.To, result.Findings, time.Now().UTC(), false)
+
+		if err := store.save(); err != nil {
+			log.Err(err).Msg("Failed to save marker store")
+		}
+	}
+
+	findings := store.dropIgnored(result.Repo, result.Branch, result.Findings)
+	store.identify(result.Repo, result.Branch, findings)
+	return findings
+}
+
+// parseLocation splits a file:line location
+func parseLocation(location string) (string, int, error) {
+	i := strings.LastIndex(location, ":")
+	if i < 0 {
+		return "", 0, fmt.Errorf("invalid location %s, expected file:line", location)
+	}
+	line, err := strconv.Atoi(location[i+1:])
+	if err != nil || line < 1 {
+		return "", 0, fmt.Errorf("invalid line in %s, expected file:line", location)
+	}
+	return location[:i], line, nil
+}
+
+// likePrefix returns the SQL LIKE pattern, escaped with \, of the values starting with prefix
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+}
+
+// lookup returns the markers designated by args: an ID or ID prefix, or a repository and a file:line location,
+// on any branch unless one is given. Resolved markers are only returned withResolved. Only the markers of the ID or
+// repository are loaded.
+func (s *Store) lookup(args []string, branch string, withResolved bool) ([]*StoredMarker, error) {
+	if len(args) == 1 {
+		if err := s.load(`marker_id LIKE ? ESCAPE '\'`, likePrefix(strings.ToLower(args[0]))); err != nil {
+			return nil, err
+		}
+		var found []*StoredMarker
+		for _, m := range s.findByID(args[0]) {
+			if (branch == "" || m.Branch == branch) && (withResolved || m.State != markerResolved) {
+				found = append(found, m)
+			}
+		}
+		if len(found) > 1 && found[0].ID != found[1].ID {
+			return nil, fmt.Errorf("ambiguous ID %s, matching %s and %s", args[0], found[0].ID, found[1].ID)
+		}
+		return found, nil
+	}
+
+	file, line, err := parseLocation(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := s.load("repo = ?", canonicalURI(args[0])); err != nil {
+		return nil, err
+	}
+	return s.findMarkers(args[0], branch, file, line, withResolved), nil
+}
+
+// runIgnore ignores, or with undo reports again, the markers designated by args, see lookup
+func runIgnore(args []string, branch, reason string, undo bool) {
+	store, err := openStore(storeFilePath())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load marker store")
+	}
+
+	found, err := store.lookup(args, branch, false)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid marker")
+	}
+	if len(found) == 0 {
+		log.Fatal().Strs("marker", args).Msg("No open or ignored marker found, scan or sync the repository first")
+	}
+
+	now := time.Now().UTC()
+	for _, m := range found {
+		if undo {
+			m.unignore(now)
+		} else {
+			m.ignore(reason, now)
+		}
+		fmt.Printf("%s %s %s %s:%d %s\t%s\n", aurora.BrightYellow(m.State), aurora.Gray(12, m.ID), ScanResult{Repo: m.Repo, Branch: m.Branch}.title(), m.File, m.Line, aurora.BrightGreen(m.Marker), m.Text)
+	}
+
+	if err := store.save(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to save marker store")
+	}
+}
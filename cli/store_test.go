@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestStoreConcurrentSave checks that a marker ignored while a sync holds the store keeps being ignored when the sync
+// saves its own changes of the marker
+func TestStoreConcurrentSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tr4ck.db")
+	repo := "/src/repo"
+	now := time.Now().UTC()
+	finding := Finding{File: "main.go", Line: 3, Marker: "todo", Text: "// todo: marker"}
+
+	store, err := loadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.observe(repo, "", "a", []Finding{finding}, now, true)
+	if err := store.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sync loads the store, then tr4ck ignore runs
+	syncing, err := loadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ignoring, err := openStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := ignoring.lookup([]string{repo, "main.go:3"}, "", false)
+	if err != nil || len(found) != 1 {
+		t.Fatalf("lookup found %v, %v, expected the marker", found, err)
+	}
+	found[0].ignore("wontfix", now)
+	if err := ignoring.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sync then sees the marker moved
+	finding.Line = 5
+	syncing.observe(repo, "", "b", []Finding{finding}, now, true)
+	if err := syncing.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := loadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Markers) != 1 {
+		t.Fatalf("store has %d markers, expected 1", len(saved.Markers))
+	}
+	m := saved.Markers[0]
+	if m.State != markerIgnored || m.IgnoreReason != "wontfix" {
+		t.Errorf("marker is %s (%s), expected ignored (wontfix)", m.State, m.IgnoreReason)
+	}
+	if m.Line != 5 || m.Revision != "b" {
+		t.Errorf("marker is at line %d of %s, expected line 5 of b", m.Line, m.Revision)
+	}
+	var kinds []string
+	for _, e := range m.Events {
+		kinds = append(kinds, e.Kind)
+	}
+	if len(kinds) != 3 || kinds[0] != "opened" || kinds[1] != "ignored" || kinds[2] != "moved" {
+		t.Errorf("marker has events %v, expected opened, ignored and moved", kinds)
+	}
+}
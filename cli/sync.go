@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// RepoSync is the outcome of syncing a registry record
+type RepoSync struct {
+	Repo     string
+	Branch   string
+	Duration time.Duration
+	// Err is why the repository could not be synced
+	Err error
+}
+
+// SyncRun is the outcome of a sync of the registry
+type SyncRun struct {
+	Start    time.Time
+	Duration time.Duration
+	Repos    []RepoSync
+}
+
+// onSynced is called with the outcome of each repository of the current sync, and its result when it was scanned,
+// e.g. to stream them
+var onSynced func(repo RepoSync, result *ScanResult)
+
+// add records the outcome of syncing a record since start, result being its scan unless it failed or was unchanged
+func (r *SyncRun) add(record RegistryRecord, start time.Time, result *ScanResult, err error) {
+	repo := RepoSync{Repo: record.URI, Branch: record.Branch, Duration: time.Since(start), Err: err}
+	r.Repos = append(r.Repos, repo)
+	if onSynced != nil {
+		onSynced(repo, result)
+	}
+}
+
+// syncRegistry syncs each enabled registry record from its latest synced commit, or only those matching only when
+// set, reporting new and resolved markers to out, then updates the marker store and sends notifications. Errors of
+// a repository are logged and recorded in the returned run, which also holds the duration of the sync of each
+// repository.
+func syncRegistry(out *reporter, only func(RegistryRecord) bool) (*SyncRun, error) {
+	run := &SyncRun{Start: time.Now()}
+	defer func() { run.Duration = time.Since(run.Start) }()
+
+	registry, err := loadRegistry()
+	if err != nil {
+		return run, fmt.Errorf("failed to load registry: %w", err)
+	}
+
+	store, err := openStore(storeFilePath())
+	if err != nil {
+		return run, fmt.Errorf("failed to load marker store: %w", err)
+	}
+	state, err := loadFindingsState(store.db)
+	if err != nil {
+		return run, fmt.Errorf("failed to load findings state: %w", err)
+	}
+	baseline, err := flagBaseline()
+	if err != nil {
+		return run, fmt.Errorf("failed to apply baseline: %w", err)
+	}
+
+	trackers := issueTrackers()
+	reporters := commitReporters()
+	digest := SyncDigest{Time: time.Now().UTC()}
+	// synced are the keys of the records scanned, whose markers get their referenced issues checked
+	synced := map[string]bool{}
+
+	for _, record := range *registry {
+		if only != nil && !only(record) {
+			continue
+		}
+		resetSkipped()
+		start := time.Now()
+
+		if record.Disabled {
+			log.Debug().Str("uri", record.URI).Str("branch", record.Branch).Msg(aurora.BrightYellow("Disabled").String())
+			continue
+		}
+
+		// only the markers of the synced records are loaded
+		if err := store.loadBranch(record.URI, record.Branch); err != nil {
+			log.Err(err).Str("uri", record.URI).Str("branch", record.Branch).Msg("Failed to load marker store")
+			run.add(record, start, nil, err)
+			continue
+		}
+
+		repo, err := cloneRepo(&record)
+		if err != nil {
+			log.Err(err).Str("uri", record.URI).Str("branch", record.Branch).Msg("Failed to clone repository")
+			run.add(record, start, nil, err)
+			continue
+		}
+
+		// latest commit
+		latestHash, err := getLatestCommit(repo)
+		if err != nil {
+			log.Err(err).Msg("Failed to get latest commit")
+			run.add(record, start, nil, err)
+			continue
+		}
+
+		// the first sync of a record, without findings state to compare with, seeds it from the whole tree
+		_, seen := state[recordKey(record)]
+		initial := !seen
+
+		if record.LastestHash == latestHash && !initial {
+			log.Debug().Str("uri", record.URI).Str("branch", record.Branch).Str("latest", latestHash).Msg(aurora.BrightYellow("Skip").String())
+			// no latest commit, skip
+			run.add(record, start, nil, nil)
+			continue
+		}
+
+		firstHash := record.LastestHash
+		if initial {
+			firstHash = ""
+		}
+
+		// repository-local settings only apply to this repository
+		restore := applyRepoConfig(readRepoConfig(repo, latestHash))
+
+		var findings []Finding
+		var changed, removed, renamed []string
+		if firstHash == "" {
+			// without a cursor, e.g. after reg refresh --reset, the whole tree is scanned and its findings replace
+			// those of the previous run
+			findings, err = listFindings(repo, record.effectiveMarkers(), record.effectivePaths())
+			files := map[string]struct{}{}
+			for _, f := range state[recordKey(record)] {
+				if _, ok := files[f.File]; !ok {
+					files[f.File] = struct{}{}
+					changed = append(changed, f.File)
+				}
+			}
+		} else {
+			// list commits since last processed commit
+			findings, changed, removed, renamed, err = listFindingsSinceCommit(repo, firstHash, latestHash, record.effectiveMarkers(), record.effectivePaths())
+		}
+		restore()
+		if err != nil {
+			log.Err(err).Msg("Failed to list files in latest commit")
+			run.add(record, start, nil, err)
+			continue
+		}
+
+		// compare with the findings of the previous run, those of renamed files being reconciled with their new paths
+		added, resolved := state.update(recordKey(record), changed, slices.Concat(removed, renamed), findings)
+		// ownership follows the latest CODEOWNERS, which may change without the markers changing
+		assignOwners(repo, latestHash, "", state[recordKey(record)])
+		if err := state.saveRecord(store.db, recordKey(record)); err != nil {
+			log.Err(err).Msg("Failed to save findings state")
+		}
+		now := time.Now().UTC()
+		opened, closed := store.observe(record.URI, record.Branch, latestHash, state[recordKey(record)], now, true)
+		synced[recordKey(record)] = true
+		if commit, err := repo.CommitObject(plumbing.NewHash(latestHash)); err == nil {
+			store.snapshot(record.URI, record.Branch, latestHash, commit.Committer.When, now, state[recordKey(record)])
+		} else {
+			log.Err(err).Msg("Failed to get latest commit")
+		}
+		added = store.dropIgnored(record.URI, record.Branch, added)
+		store.identify(record.URI, record.Branch, added)
+
+		// who paid the debt down
+		removals := make([]*Finding, 0, len(resolved)+len(closed))
+		for i := range resolved {
+			removals = append(removals, &resolved[i])
+		}
+		for _, m := range closed {
+			removals = append(removals, &m.Finding)
+		}
+		attributeResolved(repo, firstHash, latestHash, removals)
+		for _, m := range closed {
+			m.attributeResolution()
+		}
+		syncTickets(trackers, opened, closed, initial)
+		syncReferences(trackers, store, closed)
+		digest.Repos = append(digest.Repos, RepoDigest{
+			Repo:     record.URI,
+			Branch:   record.Branch,
+			Labels:   record.Labels,
+			Initial:  initial,
+			Opened:   opened,
+			Resolved: closed,
+			Overdue:  store.overdueMarkers(record.URI, record.Branch, now),
+		})
+
+		result := ScanResult{
+			Repo:     record.URI,
+			Branch:   record.Branch,
+			Note:     record.Note,
+			From:     firstHash,
+			To:       latestHash,
+			Removed:  removed,
+			Resolved: resolved,
+		}
+
+		if added == nil && resolved == nil {
+			log.Debug().Str("uri", record.URI).Str("branch", record.Branch).Str("latest", latestHash).Any("skipped", skipped).Msg(aurora.BrightYellow("Skip").String())
+			result.finish(start)
+			out.add(result)
+			publishCommit(reporters, result, state[recordKey(record)], initial)
+
+			// update registry
+			if err = updateRegistryCursor(record, latestHash); err != nil {
+				log.Err(err).Msg("Failed to update registry")
+			}
+
+			// no new or resolved markers, skip
+			run.add(record, start, &result, nil)
+			continue
+		}
+
+		findings = baseline.filter(attributeAndFilter(repo, latestHash, "", added))
+		result.Findings = findings
+		result.finish(start)
+		out.add(result)
+		publishCommit(reporters, result, state[recordKey(record)], initial)
+
+		log.Debug().Int("findings", len(findings)).Int("resolved", len(resolved)).Int("opened", len(opened)).Int("closed", len(closed)).Int("removed", len(removed)).Any("skipped", skipped).Str("uri", record.URI).Str("branch", record.Branch).Str("note", record.Note).Str("latest", latestHash).Str("hash", record.LastestHash).Msg(aurora.BrightYellow("Update").String())
+
+		// update registry
+		if err = updateRegistryCursor(record, latestHash); err != nil {
+			log.Err(err).Msg("Failed to update registry")
+		}
+		run.add(record, start, &result, nil)
+	}
+
+	// count>N checks every marker of the synced entries, unchanged ones included, not only the new ones
+	out.markers = 0
+	for _, record := range *registry {
+		if record.Disabled || (only != nil && !only(record)) {
+			continue
+		}
+		out.markers += len(store.dropIgnored(record.URI, record.Branch, state[recordKey(record)]))
+	}
+
+	// marker counts for report --trend
+	if err := appendSnapshot(store.db, state.snapshot()); err != nil {
+		log.Err(err).Msg("Failed to save history")
+	}
+	// only the markers of the records scanned by this sync get their referenced issues checked, report --zombies
+	// checks those of every repository
+	var referencing []*StoredMarker
+	for _, m := range store.Markers {
+		if synced[recordKey(RegistryRecord{URI: m.Repo, Branch: m.Branch})] {
+			referencing = append(referencing, m)
+		}
+	}
+	checkReferences(trackers, referencing)
+	if err := store.save(); err != nil {
+		log.Err(err).Msg("Failed to save marker store")
+	}
+	sendNotifications(digest)
+	sendAlerts(store, *registry, digest.Time)
+
+	return run, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitFile writes a file to the worktree of repo and commits it
+func commitFile(t *testing.T, repo *git.Repository, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add(name); err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Commit("update "+name, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@localhost", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSyncAfterAdd checks that the first sync of a repository added to the registry fires no marker.created event
+// for the markers already there, and that the next sync only fires events for the markers added since
+func TestSyncAfterAdd(t *testing.T) {
+	tmp := t.TempDir()
+	// clones are kept in the temp dir
+	t.Setenv("TMPDIR", tmp)
+
+	repoDir := filepath.Join(tmp, "repo")
+	repo, err := git.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, repo, repoDir, "main.go", "package main\n\n// todo: existing marker\n")
+
+	var mu sync.Mutex
+	var events []WebhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload WebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		events = append(events, payload)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	savedRegistry, savedStore, savedWebhooks, savedFormat := registryFilePath, storePath, webhookConfigs, outputFormat
+	defer func() {
+		registryFilePath, storePath, webhookConfigs, outputFormat = savedRegistry, savedStore, savedWebhooks, savedFormat
+	}()
+	registryFilePath = filepath.Join(tmp, "test.registry")
+	storePath = ""
+	webhookConfigs = []WebhookConfig{{URL: srv.URL}}
+	outputFormat = "json"
+	if err := os.WriteFile(registryFilePath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := addToRegistry(RegistryRecord{URI: repoDir}); err != nil {
+		t.Fatal(err)
+	}
+
+	syncOnce := func() []WebhookPayload {
+		t.Helper()
+		out, err := newReporter()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.w = io.Discard
+		if _, err := syncRegistry(out, nil); err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		sent := events
+		events = nil
+		return sent
+	}
+
+	sent := syncOnce()
+	if len(sent) != 1 || sent[0].Event != "sync.completed" {
+		t.Fatalf("first sync sent %+v, expected only sync.completed", sent)
+	}
+	if repos := sent[0].Repos; len(repos) != 1 || !repos[0].Initial || repos[0].Opened != 1 {
+		t.Fatalf("first sync completed with %+v, expected one initial repository with one marker", repos)
+	}
+
+	commitFile(t, repo, repoDir, "main.go", "package main\n\n// todo: existing marker\n// fixme: new marker\n")
+
+	sent = syncOnce()
+	var created []string
+	for _, payload := range sent {
+		if payload.Event == "marker.created" {
+			created = append(created, payload.Marker.Marker)
+		}
+	}
+	if len(created) != 1 || created[0] != "fixme" {
+		t.Fatalf("second sync created %v, expected only the new marker", created)
+	}
+}
@@ -0,0 +1,263 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: tr4ck/v1/tr4ck.proto
+
+package tr4ckpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	TrackService_Scan_FullMethodName         = "/tr4ck.v1.TrackService/Scan"
+	TrackService_Sync_FullMethodName         = "/tr4ck.v1.TrackService/Sync"
+	TrackService_ListRecords_FullMethodName  = "/tr4ck.v1.TrackService/ListRecords"
+	TrackService_QueryMarkers_FullMethodName = "/tr4ck.v1.TrackService/QueryMarkers"
+)
+
+// TrackServiceClient is the client API for TrackService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// TrackService scans repositories for markers such as TODO and FIXME, syncs the registry and queries the marker
+// store. Scans and syncs stream their progress and findings, and run one at a time.
+type TrackServiceClient interface {
+	// Scan scans the latest commit of a repository, like tr4ck scan, streaming each file scanned, then the findings
+	// and the result of the repository.
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ScanEvent], error)
+	// Sync syncs the registry, or the entries of a repository, like tr4ck sync, streaming each file scanned, and the
+	// findings and result of each repository as soon as it is synced.
+	Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ScanEvent], error)
+	// ListRecords lists the registry entries.
+	ListRecords(ctx context.Context, in *ListRecordsRequest, opts ...grpc.CallOption) (*ListRecordsResponse, error)
+	// QueryMarkers streams the stored markers matching filters, like tr4ck query.
+	QueryMarkers(ctx context.Context, in *QueryMarkersRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StoredMarker], error)
+}
+
+type trackServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTrackServiceClient(cc grpc.ClientConnInterface) TrackServiceClient {
+	return &trackServiceClient{cc}
+}
+
+func (c *trackServiceClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ScanEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TrackService_ServiceDesc.Streams[0], TrackService_Scan_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ScanRequest, ScanEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TrackService_ScanClient = grpc.ServerStreamingClient[ScanEvent]
+
+func (c *trackServiceClient) Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ScanEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TrackService_ServiceDesc.Streams[1], TrackService_Sync_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SyncRequest, ScanEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TrackService_SyncClient = grpc.ServerStreamingClient[ScanEvent]
+
+func (c *trackServiceClient) ListRecords(ctx context.Context, in *ListRecordsRequest, opts ...grpc.CallOption) (*ListRecordsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRecordsResponse)
+	err := c.cc.Invoke(ctx, TrackService_ListRecords_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trackServiceClient) QueryMarkers(ctx context.Context, in *QueryMarkersRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StoredMarker], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TrackService_ServiceDesc.Streams[2], TrackService_QueryMarkers_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[QueryMarkersRequest, StoredMarker]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TrackService_QueryMarkersClient = grpc.ServerStreamingClient[StoredMarker]
+
+// TrackServiceServer is the server API for TrackService service.
+// All implementations must embed UnimplementedTrackServiceServer
+// for forward compatibility.
+//
+// TrackService scans repositories for markers such as TODO and FIXME, syncs the registry and queries the marker
+// store. Scans and syncs stream their progress and findings, and run one at a time.
+type TrackServiceServer interface {
+	// Scan scans the latest commit of a repository, like tr4ck scan, streaming each file scanned, then the findings
+	// and the result of the repository.
+	Scan(*ScanRequest, grpc.ServerStreamingServer[ScanEvent]) error
+	// Sync syncs the registry, or the entries of a repository, like tr4ck sync, streaming each file scanned, and the
+	// findings and result of each repository as soon as it is synced.
+	Sync(*SyncRequest, grpc.ServerStreamingServer[ScanEvent]) error
+	// ListRecords lists the registry entries.
+	ListRecords(context.Context, *ListRecordsRequest) (*ListRecordsResponse, error)
+	// QueryMarkers streams the stored markers matching filters, like tr4ck query.
+	QueryMarkers(*QueryMarkersRequest, grpc.ServerStreamingServer[StoredMarker]) error
+	mustEmbedUnimplementedTrackServiceServer()
+}
+
+// UnimplementedTrackServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTrackServiceServer struct{}
+
+func (UnimplementedTrackServiceServer) Scan(*ScanRequest, grpc.ServerStreamingServer[ScanEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (UnimplementedTrackServiceServer) Sync(*SyncRequest, grpc.ServerStreamingServer[ScanEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Sync not implemented")
+}
+func (UnimplementedTrackServiceServer) ListRecords(context.Context, *ListRecordsRequest) (*ListRecordsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRecords not implemented")
+}
+func (UnimplementedTrackServiceServer) QueryMarkers(*QueryMarkersRequest, grpc.ServerStreamingServer[StoredMarker]) error {
+	return status.Errorf(codes.Unimplemented, "method QueryMarkers not implemented")
+}
+func (UnimplementedTrackServiceServer) mustEmbedUnimplementedTrackServiceServer() {}
+func (UnimplementedTrackServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeTrackServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TrackServiceServer will
+// result in compilation errors.
+type UnsafeTrackServiceServer interface {
+	mustEmbedUnimplementedTrackServiceServer()
+}
+
+func RegisterTrackServiceServer(s grpc.ServiceRegistrar, srv TrackServiceServer) {
+	// If the following call pancis, it indicates UnimplementedTrackServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&TrackService_ServiceDesc, srv)
+}
+
+func _TrackService_Scan_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ScanRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TrackServiceServer).Scan(m, &grpc.GenericServerStream[ScanRequest, ScanEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TrackService_ScanServer = grpc.ServerStreamingServer[ScanEvent]
+
+func _TrackService_Sync_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SyncRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TrackServiceServer).Sync(m, &grpc.GenericServerStream[SyncRequest, ScanEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TrackService_SyncServer = grpc.ServerStreamingServer[ScanEvent]
+
+func _TrackService_ListRecords_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRecordsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrackServiceServer).ListRecords(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrackService_ListRecords_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrackServiceServer).ListRecords(ctx, req.(*ListRecordsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrackService_QueryMarkers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QueryMarkersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TrackServiceServer).QueryMarkers(m, &grpc.GenericServerStream[QueryMarkersRequest, StoredMarker]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TrackService_QueryMarkersServer = grpc.ServerStreamingServer[StoredMarker]
+
+// TrackService_ServiceDesc is the grpc.ServiceDesc for TrackService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TrackService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tr4ck.v1.TrackService",
+	HandlerType: (*TrackServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListRecords",
+			Handler:    _TrackService_ListRecords_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Scan",
+			Handler:       _TrackService_Scan_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Sync",
+			Handler:       _TrackService_Sync_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "QueryMarkers",
+			Handler:       _TrackService_QueryMarkers_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "tr4ck/v1/tr4ck.proto",
+}
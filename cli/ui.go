@@ -0,0 +1,523 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// uiFS holds the templates and static assets of the web UI, so that the daemon is a single binary
+//
+//go:embed ui
+var uiFS embed.FS
+
+const (
+	// uiChartWidth and uiChartHeight are the size of the trend charts, in SVG units
+	uiChartWidth  = 640
+	uiChartHeight = 120
+	// uiChartLines is the number of line colors of the charts, see style.css
+	uiChartLines = 6
+)
+
+// uiTemplates are the pages of the web UI, each calling the header and footer of layout.html
+var uiTemplates = template.Must(template.New("ui").ParseFS(uiFS, "ui/*.html"))
+
+// uiServer serves the web UI of the daemon
+type uiServer struct {
+	// auth checks the tokens of requests, as the password of the browser's basic auth prompt
+	auth *authenticator
+	// readOnly refuses to trigger syncs, when serving without authentication beyond localhost
+	readOnly bool
+
+	// syncing holds the record keys, or "" for the whole registry, with a sync triggered from the UI not done yet
+	mu      sync.Mutex
+	syncing map[string]bool
+}
+
+// uiRecord is a registry entry of the registry page
+type uiRecord struct {
+	RegistryRecord
+	Title   string
+	Link    string
+	Open    int
+	Overdue int
+	Trend   string
+	Syncing bool
+}
+
+// uiMarker is a row of the marker table of a repository
+type uiMarker struct {
+	ID       string
+	File     string
+	Line     int
+	URL      string
+	Marker   string
+	Text     string
+	Assignee string
+	Due      string
+	Overdue  bool
+	Author   string
+	State    string
+	Age      string
+	// AgeDays sorts the age column
+	AgeDays int
+}
+
+// uiChart is a trend chart, a line per series drawn between the first and last day of the period
+type uiChart struct {
+	Title string
+	Start string
+	End   string
+	Max   int
+	Lines []uiLine
+}
+
+// uiLine is a series of a chart, Points being the polyline coordinates
+type uiLine struct {
+	Label  string
+	Class  string
+	Points string
+	First  int
+	Last   int
+}
+
+// uiFilters are the marker filters of the repository page, see MarkerQuery
+type uiFilters struct {
+	Marker    string
+	Author    string
+	State     string
+	Path      string
+	OlderThan string
+	Overdue   bool
+	Zombie    bool
+}
+
+type uiIndexPage struct {
+	Notice  string
+	Syncing bool
+	Records []uiRecord
+}
+
+type uiRepoPage struct {
+	Notice  string
+	Record  uiRecord
+	Filters uiFilters
+	// States are the choices of the state filter
+	States  []string
+	Error   string
+	Markers []uiMarker
+	Chart   *uiChart
+}
+
+type uiTrendsPage struct {
+	Since  string
+	Charts []uiChart
+}
+
+// handle registers the UI pages and assets, redirecting / to the registry page. Pages require the read scope and
+// triggering syncs the admin scope, the assets being public.
+func (u *uiServer) handle(mux *http.ServeMux) {
+	static, _ := fs.Sub(uiFS, "ui/static")
+	mux.Handle("GET /ui/static/", http.StripPrefix("/ui/static/", http.FileServer(http.FS(static))))
+	mux.Handle("GET /ui/{$}", u.auth.require(scopeRead, http.HandlerFunc(u.serveIndex)))
+	mux.Handle("GET /ui/repo", u.auth.require(scopeRead, http.HandlerFunc(u.serveRepo)))
+	mux.Handle("GET /ui/trends", u.auth.require(scopeRead, http.HandlerFunc(u.serveTrends)))
+	mux.Handle("POST /ui/sync", u.auth.require(scopeAdmin, http.HandlerFunc(u.serveSync)))
+	mux.Handle("GET /{$}", http.RedirectHandler("/ui/", http.StatusFound))
+}
+
+// render executes a page template, buffered so that a failure replies an error rather than half a page
+func (u *uiServer) render(w http.ResponseWriter, page string, data interface{}) {
+	var b bytes.Buffer
+	if err := uiTemplates.ExecuteTemplate(&b, page, data); err != nil {
+		log.Err(err).Str("page", page).Msg("Failed to render page")
+		http.Error(w, "failed to render page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(b.Bytes())
+}
+
+// isSyncing reports whether a sync of a record key, or "" for the whole registry, was triggered and is not done
+func (u *uiServer) isSyncing(key string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.syncing[key] || u.syncing[""]
+}
+
+// uiNotice is the message of a page after a redirect from a form
+func uiNotice(r *http.Request) string {
+	if r.URL.Query().Get("sync") == "started" {
+		return "Sync started, reload the page to see its results once done."
+	}
+	return ""
+}
+
+// uiRecordLink links to the page of a registry entry
+func uiRecordLink(record RegistryRecord) string {
+	params := url.Values{"uri": {record.URI}}
+	if record.Branch != "" {
+		params.Set("branch", record.Branch)
+	}
+	return "/ui/repo?" + params.Encode()
+}
+
+// loadTrends returns the trend series of the snapshots taken within since, e.g. 90d
+func loadTrends(since string) ([]TrendSeries, error) {
+	age, err := parseAge(since)
+	if err != nil {
+		return nil, err
+	}
+	db, err := storeDB()
+	if err != nil {
+		return nil, err
+	}
+	history, err := loadHistory(db, time.Now().Add(-age))
+	if err != nil {
+		return nil, err
+	}
+	return trendSeries(history), nil
+}
+
+// serveIndex lists the registry entries with their open and overdue markers and the trend of their findings
+func (u *uiServer) serveIndex(w http.ResponseWriter, r *http.Request) {
+	records, err := loadRegistry()
+	if err != nil {
+		log.Err(err).Msg("Failed to load registry")
+		http.Error(w, "failed to load registry", http.StatusInternalServerError)
+		return
+	}
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		log.Err(err).Msg("Failed to load marker store")
+		http.Error(w, "failed to load marker store", http.StatusInternalServerError)
+		return
+	}
+	series, err := loadTrends(trendSince)
+	if err != nil {
+		log.Err(err).Msg("Failed to load history")
+		http.Error(w, "failed to load history", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	open, overdue := map[string]int{}, map[string]int{}
+	for _, m := range store.Markers {
+		if m.State != markerOpen {
+			continue
+		}
+		key := m.Repo + "#" + m.Branch
+		open[key]++
+		if _, late := m.overdue(now); late {
+			overdue[key]++
+		}
+	}
+	trends := map[string]string{}
+	for _, s := range series {
+		if s.Marker == "" {
+			trends[s.Repo] = sparkline(s.Points)
+		}
+	}
+
+	page := uiIndexPage{Notice: uiNotice(r), Syncing: u.isSyncing("")}
+	for _, record := range *records {
+		key := recordKey(record)
+		page.Records = append(page.Records, uiRecord{
+			RegistryRecord: record,
+			Title:          recordKeyTitle(key),
+			Link:           uiRecordLink(record),
+			Open:           open[key],
+			Overdue:        overdue[key],
+			Trend:          trends[recordKeyTitle(key)],
+			Syncing:        u.isSyncing(key),
+		})
+	}
+	u.render(w, "index.html", page)
+}
+
+// serveRepo lists the stored markers of a registry entry matching the filters of the query parameters, with the
+// trend of its findings per marker
+func (u *uiServer) serveRepo(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	found, err := findRecordBranch(params.Get("uri"), params.Get("branch"))
+	if err != nil {
+		log.Err(err).Msg("Failed to load registry")
+		http.Error(w, "failed to load registry", http.StatusInternalServerError)
+		return
+	}
+	if found == nil {
+		http.Error(w, "not found in the registry", http.StatusNotFound)
+		return
+	}
+	record := *found
+	key := recordKey(record)
+
+	filters := uiFilters{
+		Marker:    params.Get("marker"),
+		Author:    params.Get("author"),
+		State:     params.Get("state"),
+		Path:      params.Get("path"),
+		OlderThan: params.Get("older_than"),
+		Overdue:   params.Get("overdue") != "",
+		Zombie:    params.Get("zombie") != "",
+	}
+	if filters.State == "" {
+		filters.State = markerOpen
+	}
+	page := uiRepoPage{
+		Notice: uiNotice(r),
+		Record: uiRecord{
+			RegistryRecord: record,
+			Title:          recordKeyTitle(key),
+			Link:           uiRecordLink(record),
+			Syncing:        u.isSyncing(key),
+		},
+		Filters: filters,
+		States:  []string{markerOpen, markerResolved, markerIgnored, "all"},
+	}
+
+	store, err := loadStore(storeFilePath())
+	if err != nil {
+		log.Err(err).Msg("Failed to load marker store")
+		http.Error(w, "failed to load marker store", http.StatusInternalServerError)
+		return
+	}
+	q := MarkerQuery{
+		Repo:      canonicalURI(record.URI),
+		Author:    filters.Author,
+		State:     filters.State,
+		OlderThan: filters.OlderThan,
+		Overdue:   filters.Overdue,
+		Zombie:    filters.Zombie,
+	}
+	if filters.Marker != "" {
+		q.Markers = strings.Split(filters.Marker, ",")
+	}
+	if filters.Path != "" {
+		q.Paths = strings.Split(filters.Path, ",")
+	}
+
+	now := time.Now()
+	markers, err := store.query(q, now)
+	if err != nil {
+		// invalid filters are shown on the page rather than failing it
+		page.Error = err.Error()
+	}
+	for _, m := range markers {
+		if m.Branch != record.Branch {
+			continue
+		}
+		_, late := m.overdue(now)
+		age := m.since(now)
+		page.Markers = append(page.Markers, uiMarker{
+			ID:       m.ID,
+			File:     m.File,
+			Line:     m.Line,
+			URL:      blobURL(m.Repo, m.Revision, m.File, m.Line),
+			Marker:   m.Marker,
+			Text:     m.Text,
+			Assignee: m.Assignee,
+			Due:      m.Due,
+			Overdue:  late && m.State == markerOpen,
+			Author:   m.Author,
+			State:    m.State,
+			Age:      formatAge(age),
+			AgeDays:  int(age / (24 * time.Hour)),
+		})
+	}
+
+	series, err := loadTrends(trendSince)
+	if err != nil {
+		log.Err(err).Msg("Failed to load history")
+		http.Error(w, "failed to load history", http.StatusInternalServerError)
+		return
+	}
+	var lines []TrendSeries
+	for _, s := range series {
+		if s.Repo == page.Record.Title {
+			lines = append(lines, s)
+		}
+	}
+	if len(lines) > 0 {
+		chart := newChart(page.Record.Title, lines)
+		page.Chart = &chart
+	}
+
+	u.render(w, "repo.html", page)
+}
+
+// findRecordBranch returns the registry record of the branch of a URI, the default branch when empty, or nil
+func findRecordBranch(uri, branch string) (*RegistryRecord, error) {
+	records, err := loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(*records, func(record RegistryRecord) bool {
+		return sameRecord(record, RegistryRecord{URI: uri, Branch: branch})
+	})
+	if i < 0 {
+		return nil, nil
+	}
+	return &(*records)[i], nil
+}
+
+// serveTrends charts the findings of every repository per marker over the since query parameter, trendSince by
+// default
+func (u *uiServer) serveTrends(w http.ResponseWriter, r *http.Request) {
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		since = trendSince
+	}
+	series, err := loadTrends(since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	byRepo := map[string][]TrendSeries{}
+	var repos []string
+	for _, s := range series {
+		if _, ok := byRepo[s.Repo]; !ok {
+			repos = append(repos, s.Repo)
+		}
+		byRepo[s.Repo] = append(byRepo[s.Repo], s)
+	}
+	sort.Strings(repos)
+
+	page := uiTrendsPage{Since: since}
+	for _, repo := range repos {
+		page.Charts = append(page.Charts, newChart(repo, byRepo[repo]))
+	}
+	u.render(w, "trends.html", page)
+}
+
+// newChart draws series of the same repository, the total first, scaled to the largest count of the period
+func newChart(title string, series []TrendSeries) uiChart {
+	chart := uiChart{Title: title}
+	var start, end time.Time
+	for _, s := range series {
+		for _, p := range s.Points {
+			chart.Max = max(chart.Max, p.Count)
+			if start.IsZero() || p.Time.Before(start) {
+				start = p.Time
+			}
+			if p.Time.After(end) {
+				end = p.Time
+			}
+		}
+	}
+	chart.Start, chart.End = start.Local().Format("2006-01-02"), end.Local().Format("2006-01-02")
+
+	span := end.Sub(start)
+	colors := 0
+	for _, s := range series {
+		line := uiLine{Label: "total", Class: "total"}
+		if s.Marker != "" {
+			line.Label, line.Class = s.Marker, fmt.Sprintf("line%d", colors%uiChartLines)
+			colors++
+		}
+		var points []string
+		for _, p := range s.Points {
+			x := 0.0
+			if span > 0 {
+				x = float64(p.Time.Sub(start)) / float64(span) * uiChartWidth
+			}
+			y := float64(uiChartHeight)
+			if chart.Max > 0 {
+				y -= float64(p.Count) / float64(chart.Max) * uiChartHeight
+			}
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		if n := len(s.Points); n > 0 {
+			line.First, line.Last = s.Points[0].Count, s.Points[n-1].Count
+		}
+		// a single snapshot is drawn as a flat line
+		if len(points) == 1 {
+			_, y, _ := strings.Cut(points[0], ",")
+			points = append(points, fmt.Sprintf("%d,%s", uiChartWidth, y))
+		}
+		line.Points = strings.Join(points, " ")
+		chart.Lines = append(chart.Lines, line)
+	}
+	return chart
+}
+
+// sameOrigin reports whether a request comes from a page of the UI, so that other sites can not trigger syncs with
+// the credentials the browser keeps for it. Requests without the headers of browsers, e.g. from curl, pass.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// serveSync starts a sync of the registry, or of the entry of the uri and branch form values, and redirects back
+// to its page. The daemon runs it between its scheduled syncs, one at a time.
+func (u *uiServer) serveSync(w http.ResponseWriter, r *http.Request) {
+	if u.readOnly {
+		http.Error(w, "syncs can not be triggered without authentication, see the auth config", http.StatusForbidden)
+		return
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin request", http.StatusForbidden)
+		return
+	}
+	uri, branch := r.FormValue("uri"), r.FormValue("branch")
+	back := "/ui/"
+	var only func(RegistryRecord) bool
+	key := ""
+	if uri != "" {
+		found, err := findRecordBranch(uri, branch)
+		if err != nil {
+			log.Err(err).Msg("Failed to load registry")
+			http.Error(w, "failed to load registry", http.StatusInternalServerError)
+			return
+		}
+		if found == nil {
+			http.Error(w, "not found in the registry", http.StatusNotFound)
+			return
+		}
+		record := *found
+		key, back = recordKey(record), uiRecordLink(record)
+		only = func(r RegistryRecord) bool { return sameRecord(r, record) }
+	}
+
+	u.mu.Lock()
+	if !u.syncing[key] {
+		u.syncing[key] = true
+		go func() {
+			log.Info().Str("uri", uri).Str("branch", branch).Msg("Syncing from the web UI")
+			syncOnce(only)
+
+			u.mu.Lock()
+			delete(u.syncing, key)
+			u.mu.Unlock()
+		}()
+	}
+	u.mu.Unlock()
+
+	if strings.Contains(back, "?") {
+		back += "&sync=started"
+	} else {
+		back += "?sync=started"
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
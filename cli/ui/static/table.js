@@ -0,0 +1,25 @@
+// filters the rows of the tables by the text of the search box, and sorts them by the clicked column
+document.querySelectorAll("input.filter").forEach(function (input) {
+  input.addEventListener("input", function () {
+    var q = input.value.toLowerCase();
+    document.querySelectorAll("table.sortable tbody tr").forEach(function (tr) {
+      tr.style.display = tr.textContent.toLowerCase().indexOf(q) < 0 ? "none" : "";
+    });
+  });
+});
+document.querySelectorAll("table.sortable th").forEach(function (th) {
+  th.addEventListener("click", function () {
+    var body = th.closest("table").tBodies[0];
+    var col = Array.prototype.indexOf.call(th.parentNode.children, th);
+    var asc = th.dataset.order !== "asc";
+    th.dataset.order = asc ? "asc" : "desc";
+    var key = function (tr) {
+      var td = tr.children[col];
+      return td.dataset.sort !== undefined ? Number(td.dataset.sort) : td.textContent.toLowerCase();
+    };
+    Array.from(body.rows).sort(function (a, b) {
+      var x = key(a), y = key(b);
+      return (x < y ? -1 : x > y ? 1 : 0) * (asc ? 1 : -1);
+    }).forEach(function (tr) { body.appendChild(tr); });
+  });
+});
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// watchDebounce is how long a file must stay unchanged before it is rescanned, since editors save in several writes
+var watchDebounce = 100 * time.Millisecond
+
+// watchRoot is a watched directory with the scan settings of its repository, captured when the watch starts
+type watchRoot struct {
+	// name is the directory as given, prefixed to the printed files, and path its absolute path
+	name string
+	path string
+
+	gitignored        gitignore.Matcher
+	ignoreDirs        map[string]struct{}
+	ignoredExtensions map[string]struct{}
+	paths             pathFilter
+	matcher           *markerMatcher
+
+	// findings are the markers of each scanned file, by path relative to the root
+	findings map[string][]Finding
+}
+
+// newWatchRoot captures the scan settings of a local directory: those of its registry entry and repository
+// configuration, as tr4ck scan would use
+func newWatchRoot(name string) (*watchRoot, error) {
+	root, err := filepath.Abs(expandHome(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", name, err)
+	}
+	if !isLocalDir(root) {
+		return nil, fmt.Errorf("%s is not a directory", name)
+	}
+
+	configRoot := root
+	if repo, err := git.PlainOpenWithOptions(root, &git.PlainOpenOptions{DetectDotGit: true}); err == nil {
+		if worktree, err := repo.Worktree(); err == nil {
+			configRoot = worktree.Filesystem.Root()
+		}
+	}
+	defer applyRepoConfig(readDirRepoConfig(configRoot))()
+
+	record, _ := findRecord(root)
+	scanMarkers, scanPaths := scanSettings(record)
+
+	r := &watchRoot{
+		name:              name,
+		path:              root,
+		ignoreDirs:        ignoreDirs,
+		ignoredExtensions: ignoredExtensions,
+		paths:             scanPaths,
+		matcher:           newMarkerMatcher(scanMarkers),
+		findings:          map[string][]Finding{},
+	}
+	if !noGitignore {
+		patterns, err := gitignore.ReadPatterns(osfs.New(root), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read .gitignore patterns: %w", err)
+		}
+		r.gitignored = gitignore.NewMatcher(patterns)
+	}
+	return r, nil
+}
+
+// skipDir reports whether a directory below the root is not scanned, see scanDir
+func (r *watchRoot) skipDir(path string) bool {
+	file, err := filepath.Rel(r.path, path)
+	if err != nil || file == "." {
+		return false
+	}
+	if _, ignore := r.ignoreDirs[filepath.Base(path)]; ignore {
+		return true
+	}
+	if !submodules && isSubmoduleDir(path) {
+		return true
+	}
+	if r.gitignored != nil && r.gitignored.Match(strings.Split(filepath.ToSlash(file), "/"), true) {
+		return true
+	}
+	return r.paths.skipDir(file)
+}
+
+// skipFile reports whether a file below the root is not scanned, see scanDir
+func (r *watchRoot) skipFile(file string) bool {
+	if _, ignore := r.ignoredExtensions[filepath.Ext(file)]; ignore {
+		return true
+	}
+	if r.gitignored != nil && r.gitignored.Match(strings.Split(filepath.ToSlash(file), "/"), false) {
+		return true
+	}
+	return !r.paths.match(file)
+}
+
+// add watches dir and the directories below it, and scans their files, returning their markers
+func (r *watchRoot) add(watcher *fsnotify.Watcher, dir string) ([]Finding, error) {
+	var found []Finding
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// files removed while walking are picked up by their events
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if info.IsDir() {
+			if r.skipDir(path) {
+				return filepath.SkipDir
+			}
+			if err := watcher.Add(path); err != nil {
+				return fmt.Errorf("failed to watch %s: %w", path, err)
+			}
+			return nil
+		}
+
+		added, _ := r.rescan(path)
+		found = append(found, added...)
+		return nil
+	})
+	return found, err
+}
+
+// rescan scans a created, modified or removed file, or the files of a removed directory, and returns the markers
+// added and removed since it was last scanned. Markers are told apart by marker and text, so moved lines are not
+// reported.
+func (r *watchRoot) rescan(path string) (added, removed []Finding) {
+	file, err := filepath.Rel(r.path, path)
+	if err != nil {
+		return nil, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		// a removed or renamed file or directory
+		prefix := file + string(filepath.Separator)
+		for f, findings := range r.findings {
+			if f == file || strings.HasPrefix(f, prefix) {
+				removed = append(removed, findings...)
+				delete(r.findings, f)
+			}
+		}
+		return nil, removed
+	}
+	if r.skipFile(file) {
+		return nil, nil
+	}
+
+	findings, err := scanFile(path, file, r.matcher)
+	if err != nil {
+		// the file may have been removed since
+		log.Debug().Err(err).Str("file", file).Msg("Failed to scan file")
+		return nil, nil
+	}
+
+	previous := map[BaselineEntry]int{}
+	for _, f := range r.findings[file] {
+		previous[baselineEntry(f)]++
+	}
+	current := map[BaselineEntry]int{}
+	for _, f := range findings {
+		current[baselineEntry(f)]++
+		if entry := baselineEntry(f); previous[entry] > 0 {
+			previous[entry]--
+		} else {
+			added = append(added, f)
+		}
+	}
+	for _, f := range r.findings[file] {
+		if entry := baselineEntry(f); current[entry] > 0 {
+			current[entry]--
+		} else {
+			removed = append(removed, f)
+		}
+	}
+
+	if len(findings) > 0 {
+		r.findings[file] = findings
+	} else {
+		delete(r.findings, file)
+	}
+	return added, removed
+}
+
+// count returns the number of markers in the scanned files
+func (r *watchRoot) count() int {
+	n := 0
+	for _, findings := range r.findings {
+		n += len(findings)
+	}
+	return n
+}
+
+// runWatch watches local directories, rescanning files as they are saved and printing the markers they gain and
+// lose, until interrupted
+func runWatch(names []string) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to start watching")
+	}
+	defer watcher.Close()
+
+	var roots []*watchRoot
+	for _, name := range names {
+		r, err := newWatchRoot(name)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to watch directory")
+		}
+		if _, err := r.add(watcher, r.path); err != nil {
+			log.Fatal().Err(err).Str("path", name).Msg("Failed to watch directory")
+		}
+		roots = append(roots, r)
+		log.Info().Str("path", name).Int("markers", r.count()).Msg(aurora.BrightGreen("Watching").String())
+	}
+	// nested directories belong to the innermost root
+	sort.Slice(roots, func(i, j int) bool { return len(roots[i].path) > len(roots[j].path) })
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// changed paths are rescanned once their writes settle
+	pending := map[string]*watchRoot{}
+	settled := time.NewTimer(watchDebounce)
+	settled.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case err := <-watcher.Errors:
+			log.Err(err).Msg("Failed to watch files")
+
+		case event := <-watcher.Events:
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			r := rootOf(roots, event.Name)
+			if r == nil {
+				continue
+			}
+
+			// new directories are watched, and their files scanned, right away
+			if event.Has(fsnotify.Create) && isLocalDir(event.Name) {
+				if r.skipDir(event.Name) {
+					continue
+				}
+				added, err := r.add(watcher, event.Name)
+				if err != nil {
+					log.Err(err).Msg("Failed to watch directory")
+				}
+				printWatchChanges(os.Stdout, r, added, nil)
+				continue
+			}
+
+			pending[event.Name] = r
+			settled.Reset(watchDebounce)
+
+		case <-settled.C:
+			var paths []string
+			for path := range pending {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			for _, path := range paths {
+				added, removed := pending[path].rescan(path)
+				printWatchChanges(os.Stdout, pending[path], added, removed)
+			}
+			clear(pending)
+		}
+	}
+}
+
+// rootOf returns the watched directory of a path, roots being sorted innermost first
+func rootOf(roots []*watchRoot, path string) *watchRoot {
+	for _, r := range roots {
+		if path == r.path || strings.HasPrefix(path, r.path+string(filepath.Separator)) {
+			return r
+		}
+	}
+	return nil
+}
+
+// printWatchChanges writes a line per marker added or removed, the file being prefixed with the watched directory
+// as given. With --porcelain, lines are tab-separated: added or removed, the file, line, column, marker and text.
+func printWatchChanges(w io.Writer, r *watchRoot, added, removed []Finding) {
+	for _, f := range removed {
+		file := filepath.Join(r.name, f.File)
+		if porcelain {
+			fmt.Fprintf(w, "removed\t%s\t%d\t%d\t%s\t%s\n", file, f.Line, f.Column, f.Marker, porcelainField(f.Text))
+			continue
+		}
+		fmt.Fprintf(w, "%s %s\t%s\t%s\n", aurora.BrightRed("-"), aurora.Gray(12, fmt.Sprintf("%s:%d:%d", file, f.Line, f.Column)), aurora.BrightRed(f.Marker), aurora.Gray(12, f.Text))
+	}
+	for _, f := range added {
+		file := filepath.Join(r.name, f.File)
+		if porcelain {
+			fmt.Fprintf(w, "added\t%s\t%d\t%d\t%s\t%s\n", file, f.Line, f.Column, f.Marker, porcelainField(f.Text))
+			continue
+		}
+		fmt.Fprintf(w, "%s %s:%d:%d\t%s\t%s\n", aurora.BrightGreen("+"), aurora.Blue(file), f.Line, f.Column, aurora.BrightGreen(f.Marker), f.Text)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// webhookConfigs are the webhooks section of the config
+var webhookConfigs []WebhookConfig
+
+// webhookEvents are the events sent to webhooks
+var webhookEvents = []string{"marker.created", "marker.resolved", "sync.completed", "alert.triggered"}
+
+// WebhookConfig POSTs a json payload per event of a sync to a URL
+type WebhookConfig struct {
+	URL string `yaml:"url"`
+	// Secret signs the payloads, read from the SecretEnv environment variable when empty
+	Secret    string `yaml:"secret"`
+	SecretEnv string `yaml:"secret_env"`
+	// Events only sends these events, all of them when empty
+	Events []string `yaml:"events"`
+}
+
+// WebhookPayload is the body of a webhook request. Marker events have the repository and marker,
+// sync.completed a summary of each repository branch updated and alert.triggered the alert.
+type WebhookPayload struct {
+	Event  string        `json:"event"`
+	Time   time.Time     `json:"time"`
+	Repo   string        `json:"repo,omitempty"`
+	Branch string        `json:"branch,omitempty"`
+	Marker *StoredMarker `json:"marker,omitempty"`
+	Repos  []WebhookRepo `json:"repos,omitempty"`
+	Alert  *Alert        `json:"alert,omitempty"`
+}
+
+// WebhookRepo is the number of markers a sync opened and resolved in a repository branch, and of overdue ones.
+// Initial is set on the first sync of the repository, whose markers get no marker.created event.
+type WebhookRepo struct {
+	Repo     string `json:"repo"`
+	Branch   string `json:"branch,omitempty"`
+	Initial  bool   `json:"initial,omitempty"`
+	Opened   int    `json:"opened"`
+	Resolved int    `json:"resolved"`
+	Overdue  int    `json:"overdue"`
+}
+
+type webhookNotifier struct {
+	c      WebhookConfig
+	secret string
+}
+
+func newWebhookNotifier(c WebhookConfig) *webhookNotifier {
+	n := &webhookNotifier{c: c, secret: c.Secret}
+	if n.secret == "" && c.SecretEnv != "" {
+		n.secret = os.Getenv(c.SecretEnv)
+	}
+	for _, event := range c.Events {
+		if !containsFold(webhookEvents, event) {
+			log.Warn().Str("url", c.URL).Str("event", event).Msgf("Unknown webhook event, expected one of %s", strings.Join(webhookEvents, ", "))
+		}
+	}
+	return n
+}
+
+func (n *webhookNotifier) name() string {
+	return "webhook " + n.c.URL
+}
+
+// notify sends a marker.created and marker.resolved event per marker, then sync.completed. The first sync of a
+// repository opens all of its markers, which are only counted in sync.completed.
+func (n *webhookNotifier) notify(d SyncDigest) error {
+	var payloads []WebhookPayload
+	completed := WebhookPayload{Event: "sync.completed", Time: d.Time, Repos: []WebhookRepo{}}
+	for _, repo := range d.Repos {
+		for _, m := range repo.Opened {
+			if repo.Initial {
+				break
+			}
+			payloads = append(payloads, WebhookPayload{Event: "marker.created", Time: d.Time, Repo: repo.Repo, Branch: repo.Branch, Marker: m})
+		}
+		for _, m := range repo.Resolved {
+			payloads = append(payloads, WebhookPayload{Event: "marker.resolved", Time: d.Time, Repo: repo.Repo, Branch: repo.Branch, Marker: m})
+		}
+		completed.Repos = append(completed.Repos, WebhookRepo{
+			Repo: repo.Repo, Branch: repo.Branch, Initial: repo.Initial, Opened: len(repo.Opened), Resolved: len(repo.Resolved), Overdue: len(repo.Overdue),
+		})
+	}
+	payloads = append(payloads, completed)
+
+	sent, failed := 0, 0
+	var last error
+	for _, payload := range payloads {
+		if len(n.c.Events) > 0 && !containsFold(n.c.Events, payload.Event) {
+			continue
+		}
+		sent++
+		if err := n.send(payload); err != nil {
+			failed++
+			last = err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d deliveries failed, last: %w", failed, sent, last)
+	}
+	return nil
+}
+
+// alert sends an alert.triggered event
+func (n *webhookNotifier) alert(a Alert) error {
+	if len(n.c.Events) > 0 && !containsFold(n.c.Events, "alert.triggered") {
+		return nil
+	}
+	return n.send(WebhookPayload{Event: "alert.triggered", Time: a.Time, Alert: &a})
+}
+
+// webhookSignature is the hex HMAC-SHA256 of a payload with the secret
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// send POSTs a payload, signed in X-Tr4ck-Signature-256 when a secret is set
+func (n *webhookNotifier) send(payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.c.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	delivery := make([]byte, 16)
+	rand.Read(delivery)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tr4ck/"+version)
+	req.Header.Set("X-Tr4ck-Event", payload.Event)
+	req.Header.Set("X-Tr4ck-Delivery", hex.EncodeToString(delivery))
+	if n.secret != "" {
+		req.Header.Set("X-Tr4ck-Signature-256", "sha256="+webhookSignature(n.secret, body))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send %s: %w", payload.Event, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s: %s", payload.Event, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/logrusorgru/aurora/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// reportZombies lists the open markers referencing a closed issue instead of a regular report
+var reportZombies bool
+
+// checkReferences refreshes the state of the issues referenced by the open markers in the trackers, fetching each
+// issue once. Issues that fail to load keep the state of the previous check.
+func checkReferences(trackers []issueTracker, markers []*StoredMarker) {
+	fetched := map[string]*Ticket{}
+	for _, m := range markers {
+		if m.State != markerOpen || len(m.Issues) == 0 {
+			continue
+		}
+
+		var references []Ticket
+		for _, tracker := range trackers {
+			project := tracker.project(m.Repo)
+			if project == "" {
+				continue
+			}
+			for _, ref := range m.Issues {
+				t, ok := tracker.reference(project, ref)
+				if !ok {
+					continue
+				}
+
+				key := tracker.name() + " " + t.Key
+				issue, done := fetched[key]
+				if !done {
+					got, err := tracker.lookup(t)
+					if err != nil {
+						log.Warn().Err(err).Str("tracker", tracker.name()).Str("issue", t.Key).Msg("Failed to check referenced issue")
+					} else {
+						issue = &got
+					}
+					fetched[key] = issue
+				}
+				if issue == nil {
+					issue = m.reference(tracker.name(), t.Key)
+				}
+				if issue != nil {
+					references = append(references, *issue)
+				}
+			}
+		}
+		m.References = references
+	}
+}
+
+// reference returns the referenced issue of a tracker as of the last check, nil when unknown
+func (m *StoredMarker) reference(tracker, key string) *Ticket {
+	for i := range m.References {
+		if m.References[i].Tracker == tracker && m.References[i].Key == key {
+			return &m.References[i]
+		}
+	}
+	return nil
+}
+
+// closedReferences returns the referenced issues that are closed. An open marker with any is a zombie: the work it
+// points at is done, or abandoned, while the marker lives on.
+func (m *StoredMarker) closedReferences() []Ticket {
+	var closed []Ticket
+	for _, t := range m.References {
+		if t.State == "closed" {
+			closed = append(closed, t)
+		}
+	}
+	return closed
+}
+
+// runZombieReport lists the open markers of the store referencing a closed issue, of the repositories matching
+// uris, all when empty. The referenced issues are checked in the configured trackers first, and their states saved.
+func runZombieReport(uris []string) {
+	format := outputFormat
+	if format != "markdown" && format != "text" && format != "json" && format != "porcelain" {
+		log.Fatal().Str("format", format).Msg("Invalid --format, --zombies supports markdown, text, json and porcelain")
+	}
+
+	store, err := openStore(storeFilePath())
+	if err == nil {
+		err = store.load("state = ?", markerOpen)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load marker store")
+	}
+
+	var candidates []*StoredMarker
+	for _, m := range store.Markers {
+		if m.State != markerOpen || len(m.Issues) == 0 {
+			continue
+		}
+		if len(uris) > 0 && !matchRepos(uris, m.Repo) {
+			continue
+		}
+		candidates = append(candidates, m)
+	}
+
+	if trackers := issueTrackers(); len(trackers) > 0 {
+		checkReferences(trackers, candidates)
+		if err := store.save(); err != nil {
+			log.Err(err).Msg("Failed to save marker store")
+		}
+	} else {
+		log.Warn().Msg("No issue tracker configured, using the issue states of the last check")
+	}
+
+	var zombies []*StoredMarker
+	for _, m := range candidates {
+		if len(m.closedReferences()) > 0 {
+			zombies = append(zombies, m)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	f, err := openOutput()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open output")
+	}
+	if f != nil {
+		defer f.Close()
+		w = f
+	}
+
+	switch format {
+	case "json":
+		if zombies == nil {
+			zombies = []*StoredMarker{}
+		}
+		PrintStruct(w, zombies)
+	case "markdown":
+		writeZombieMarkdown(w, zombies)
+	case "text":
+		for _, m := range zombies {
+			repo := ScanResult{Repo: m.Repo, Branch: m.Branch}.title()
+			fmt.Fprintf(w, "%s %s:%d\t%s\t%s\t%s\n", aurora.Gray(12, repo), aurora.Blue(m.File), m.Line, aurora.BrightGreen(m.Marker), aurora.Red(closedKeys(m)), m.Text)
+		}
+	case "porcelain":
+		// repository, branch, file, line, marker, closed issues, text and ID
+		for _, m := range zombies {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", m.Repo, m.Branch, m.File, m.Line, m.Marker, closedKeys(m), porcelainField(m.Text), m.ID)
+		}
+	}
+}
+
+// matchRepos reports whether a canonical repository matches one of the URIs or globs
+func matchRepos(uris []string, repo string) bool {
+	for _, uri := range uris {
+		if repo == canonicalURI(uri) || globMatch(uri, repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// closedKeys joins the keys of the closed issues referenced by a marker
+func closedKeys(m *StoredMarker) string {
+	var keys []string
+	for _, t := range m.closedReferences() {
+		keys = append(keys, t.Key)
+	}
+	return strings.Join(keys, ",")
+}
+
+// writeZombieMarkdown writes a table of the zombie markers with links to their line and closed issues
+func writeZombieMarkdown(w io.Writer, zombies []*StoredMarker) {
+	fmt.Fprintf(w, "# tr4ck zombie markers\n\n")
+	fmt.Fprintf(w, "Generated %s, %d open markers referencing a closed issue.\n\n", time.Now().UTC().Format("2006-01-02 15:04 MST"), len(zombies))
+	fmt.Fprintln(w, "| Marker | Repository | Location | Closed issues | Text |")
+	fmt.Fprintln(w, "|---|---|---|---|---|")
+
+	for _, m := range zombies {
+		location := markdownEscaper.Replace(fmt.Sprintf("%s:%d", m.File, m.Line))
+		if url := markerURL(m); url != "" {
+			location = fmt.Sprintf("[%s](%s)", location, url)
+		}
+		var issues []string
+		for _, t := range m.closedReferences() {
+			if t.URL != "" {
+				issues = append(issues, fmt.Sprintf("[%s](%s)", markdownEscaper.Replace(t.Key), t.URL))
+			} else {
+				issues = append(issues, markdownEscaper.Replace(t.Key))
+			}
+		}
+		repo := ScanResult{Repo: m.Repo, Branch: m.Branch}.title()
+		fmt.Fprintf(w, "| %s | %s | %s | %s | %s |\n", markdownEscaper.Replace(m.Marker), markdownEscaper.Replace(repo), location, strings.Join(issues, ", "), markdownEscaper.Replace(m.Text))
+	}
+}